@@ -0,0 +1,28 @@
+package oauth2
+
+// DeviceAuthorizationResponse is used to respond a successful device
+// authorization request. RFC 8628 § 3.2.
+type DeviceAuthorizationResponse struct {
+	// The device verification code.
+	DeviceCode string `json:"device_code"`
+	// The end-user verification code.
+	UserCode string `json:"user_code"`
+	// The end-user verification URI on the authorization server. The URI
+	// should be short and easy to remember as end users will be asked to
+	// manually type it into their user agent.
+	VerificationURI string `json:"verification_uri"`
+	// A verification URI that includes the user_code, which is designed
+	// for non-textual transmission.
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	// The lifetime in seconds of the device_code and user_code.
+	ExpiresIn int64 `json:"expires_in"`
+	// The minimum amount of time in seconds that the client should wait
+	// between polling requests to the token endpoint.
+	Interval int64 `json:"interval,omitempty"`
+}
+
+func (DeviceAuthorizationResponse) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"": "See https://tools.ietf.org/html/rfc8628#section-3.2 for details.",
+	}
+}
@@ -0,0 +1,14 @@
+package oauth2
+
+// MFARequiredErrorResponse is used to respond a token request of which
+// the user has been authenticated with the first factor but is required
+// to provide a second factor. The client completes the authorization with
+// GrantTypeMFAOTP by providing the MFAToken.
+type MFARequiredErrorResponse struct {
+	ErrorResponse
+
+	// The token which identifies the pending authorization.
+	MFAToken string `json:"mfa_token"`
+	// The lifetime in seconds of the MFAToken.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
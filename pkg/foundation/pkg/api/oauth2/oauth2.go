@@ -16,6 +16,14 @@ const (
 	GrantTypeClientCredentials GrantType = "client_credentials"
 	GrantTypePassword          GrantType = "password"
 	GrantTypeRefreshToken      GrantType = "refresh_token"
+	// RFC 8628 § 3.4
+	GrantTypeDeviceCode GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// Completes an authorization which has been rejected with
+	// ErrorMFARequired by providing a one-time password. Not standardized.
+	GrantTypeMFAOTP GrantType = "urn:kadisoka:params:oauth:grant-type:mfa-otp"
+	// Authenticates the end-user with a WebAuthn assertion, i.e.,
+	// a passkey. Not standardized.
+	GrantTypeWebAuthn GrantType = "urn:kadisoka:params:oauth:grant-type:webauthn"
 
 	GrantTypeUnknown GrantType = ""
 )
@@ -30,10 +38,18 @@ func GrantTypeFromString(s string) GrantType {
 		return GrantTypePassword
 	case string(GrantTypeRefreshToken):
 		return GrantTypeRefreshToken
+	case string(GrantTypeDeviceCode):
+		return GrantTypeDeviceCode
+	case string(GrantTypeMFAOTP):
+		return GrantTypeMFAOTP
+	case string(GrantTypeWebAuthn):
+		return GrantTypeWebAuthn
 	}
 	return GrantTypeUnknown
 }
 
+func (grantType GrantType) String() string { return string(grantType) }
+
 type ErrorCode string
 
 const (
@@ -57,6 +73,15 @@ const (
 	ErrorInvalidGrant ErrorCode = "invalid_grant"
 	// 5.2
 	ErrorUnsupportedGrantType ErrorCode = "unsupported_grant_type"
+	// RFC 8628 § 3.5
+	ErrorAuthorizationPending ErrorCode = "authorization_pending"
+	// RFC 8628 § 3.5
+	ErrorSlowDown ErrorCode = "slow_down"
+	// RFC 8628 § 3.5
+	ErrorExpiredToken ErrorCode = "expired_token"
+	// The user needs to provide a second factor. Not standardized; see
+	// MFARequiredErrorResponse.
+	ErrorMFARequired ErrorCode = "mfa_required"
 )
 
 func (errorCode ErrorCode) HTTPStatusCode() int {
@@ -65,8 +90,14 @@ func (errorCode ErrorCode) HTTPStatusCode() int {
 		ErrorInvalidClient,
 		ErrorInvalidGrant,
 		ErrorUnauthorizedClient,
-		ErrorUnsupportedGrantType:
+		ErrorUnsupportedGrantType,
+		ErrorInvalidScope,
+		ErrorAuthorizationPending,
+		ErrorSlowDown,
+		ErrorExpiredToken:
 		return http.StatusBadRequest
+	case ErrorMFARequired:
+		return http.StatusForbidden
 	}
 	return http.StatusInternalServerError
 }
@@ -150,6 +181,11 @@ type AuthorizationRequest struct {
 	RedirectURI  string `schema:"redirect_uri,omitempty"`
 	Scope        string `schema:"scope,omitepmty"`
 	State        string `schema:"state,omitempty"`
+	// RFC 7636 § 4.3
+	CodeChallenge       string `schema:"code_challenge,omitempty"`
+	CodeChallengeMethod string `schema:"code_challenge_method,omitempty"`
+	// OpenID Connect Core 1.0 § 3.1.2.1
+	Nonce string `schema:"nonce,omitempty"`
 }
 
 func AuthorizationRequestFromURLValues(values url.Values) (*AuthorizationRequest, error) {
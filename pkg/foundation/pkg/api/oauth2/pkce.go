@@ -0,0 +1,74 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// CodeChallengeMethod is the method used to derive the code challenge
+// from the code verifier. RFC 7636 § 4.2.
+type CodeChallengeMethod string
+
+const (
+	CodeChallengeMethodPlain CodeChallengeMethod = "plain"
+	CodeChallengeMethodS256  CodeChallengeMethod = "S256"
+
+	CodeChallengeMethodUnknown CodeChallengeMethod = ""
+)
+
+// CodeChallengeMethodFromString returns the CodeChallengeMethod which
+// s represents. As specified by RFC 7636 § 4.3, an empty string
+// is interpreted as CodeChallengeMethodPlain.
+func CodeChallengeMethodFromString(s string) CodeChallengeMethod {
+	switch s {
+	case "", string(CodeChallengeMethodPlain):
+		return CodeChallengeMethodPlain
+	case string(CodeChallengeMethodS256):
+		return CodeChallengeMethodS256
+	}
+	return CodeChallengeMethodUnknown
+}
+
+func (method CodeChallengeMethod) String() string { return string(method) }
+
+// VerifyCodeVerifier checks the codeVerifier against the codeChallenge.
+// RFC 7636 § 4.6.
+func (method CodeChallengeMethod) VerifyCodeVerifier(
+	codeChallenge string, codeVerifier string,
+) bool {
+	if !IsCodeVerifierValid(codeVerifier) {
+		return false
+	}
+	var derived string
+	switch method {
+	case CodeChallengeMethodPlain:
+		derived = codeVerifier
+	case CodeChallengeMethodS256:
+		h := sha256.Sum256([]byte(codeVerifier))
+		derived = base64.RawURLEncoding.EncodeToString(h[:])
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(derived), []byte(codeChallenge)) == 1
+}
+
+// IsCodeVerifierValid checks whether s conforms to the syntax of code
+// verifier as specified in RFC 7636 § 4.1. The same syntax applies
+// to code challenges.
+func IsCodeVerifierValid(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		switch {
+		case c >= 'A' && c <= 'Z',
+			c >= 'a' && c <= 'z',
+			c >= '0' && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
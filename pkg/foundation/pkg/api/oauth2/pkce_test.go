@@ -0,0 +1,39 @@
+package oauth2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The values are taken from RFC 7636 Appendix B.
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestCodeChallengeMethodFromString(t *testing.T) {
+	assert.Equal(t, CodeChallengeMethodPlain, CodeChallengeMethodFromString(""))
+	assert.Equal(t, CodeChallengeMethodPlain, CodeChallengeMethodFromString("plain"))
+	assert.Equal(t, CodeChallengeMethodS256, CodeChallengeMethodFromString("S256"))
+	assert.Equal(t, CodeChallengeMethodUnknown, CodeChallengeMethodFromString("s256"))
+}
+
+func TestCodeChallengeMethodS256(t *testing.T) {
+	assert.Equal(t, true, CodeChallengeMethodS256.VerifyCodeVerifier(testCodeChallenge, testCodeVerifier))
+	assert.Equal(t, false, CodeChallengeMethodS256.VerifyCodeVerifier(testCodeVerifier, testCodeVerifier))
+	assert.Equal(t, false, CodeChallengeMethodS256.VerifyCodeVerifier(testCodeChallenge, testCodeChallenge))
+}
+
+func TestCodeChallengeMethodPlain(t *testing.T) {
+	assert.Equal(t, true, CodeChallengeMethodPlain.VerifyCodeVerifier(testCodeVerifier, testCodeVerifier))
+	assert.Equal(t, false, CodeChallengeMethodPlain.VerifyCodeVerifier(testCodeChallenge, testCodeVerifier))
+}
+
+func TestIsCodeVerifierValid(t *testing.T) {
+	assert.Equal(t, true, IsCodeVerifierValid(testCodeVerifier))
+	assert.Equal(t, false, IsCodeVerifierValid(""))
+	assert.Equal(t, false, IsCodeVerifierValid("short"))
+	assert.Equal(t, false, IsCodeVerifierValid(testCodeVerifier+"+"))
+	assert.Equal(t, false, IsCodeVerifierValid(testCodeVerifier+testCodeVerifier+testCodeVerifier))
+}
@@ -0,0 +1,41 @@
+package oauth2
+
+import (
+	"strings"
+)
+
+// ParseScope splits a scope string into its tokens. The scope string
+// is a list of space-delimited, case-sensitive strings. RFC 6749 § 3.3.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// ScopeContains returns true if the scope string contains scopeToken.
+func ScopeContains(scope string, scopeToken string) bool {
+	for _, s := range ParseScope(scope) {
+		if s == scopeToken {
+			return true
+		}
+	}
+	return false
+}
+
+// IsScopeTokenValid returns true if scopeToken conforms to the syntax
+// of a scope token. RFC 6749 § 3.3.
+func IsScopeTokenValid(scopeToken string) bool {
+	if scopeToken == "" {
+		return false
+	}
+	for i := 0; i < len(scopeToken); i++ {
+		c := scopeToken[i]
+		if c < 0x21 || c == 0x22 || c == 0x5c || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatScope joins scope tokens into a scope string.
+func FormatScope(scopeTokens []string) string {
+	return strings.Join(scopeTokens, " ")
+}
@@ -0,0 +1,64 @@
+package connect
+
+// ProviderMetadata describes the configuration of an OpenID provider.
+// It's served at the path /.well-known/openid-configuration relative to
+// the issuer identifier. OpenID Connect Discovery 1.0 § 3.
+//
+// The structure is a superset of OAuth 2.0 Authorization Server Metadata
+// (RFC 8414) so that it can be served for both.
+type ProviderMetadata struct {
+	// URL using the https scheme with no query or fragment component that
+	// the OP asserts as its Issuer Identifier.
+	Issuer string `json:"issuer"`
+	// URL of the OP's OAuth 2.0 Authorization Endpoint.
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	// URL of the OP's OAuth 2.0 Token Endpoint.
+	TokenEndpoint string `json:"token_endpoint,omitempty"`
+	// URL of the OP's UserInfo Endpoint.
+	UserInfoEndpoint string `json:"userinfo_endpoint,omitempty"`
+	// URL of the OP's JSON Web Key Set document.
+	JWKSURI string `json:"jwks_uri"`
+	// URL of the authorization server's OAuth 2.0 revocation endpoint.
+	// RFC 8414 § 2.
+	RevocationEndpoint string `json:"revocation_endpoint,omitempty"`
+	// URL of the authorization server's OAuth 2.0 introspection endpoint.
+	// RFC 8414 § 2.
+	IntrospectionEndpoint string `json:"introspection_endpoint,omitempty"`
+	// URL of the authorization server's device authorization endpoint.
+	// RFC 8628 § 4.
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	// JSON array containing a list of the OAuth 2.0 scope values that
+	// this server supports.
+	ScopesSupported []string `json:"scopes_supported,omitempty"`
+	// JSON array containing a list of the OAuth 2.0 response_type values
+	// that this OP supports.
+	ResponseTypesSupported []string `json:"response_types_supported"`
+	// JSON array containing a list of the OAuth 2.0 Grant Type values
+	// that this OP supports.
+	GrantTypesSupported []string `json:"grant_types_supported,omitempty"`
+	// JSON array containing a list of the Subject Identifier types that
+	// this OP supports. Valid types include pairwise and public.
+	SubjectTypesSupported []string `json:"subject_types_supported"`
+	// JSON array containing a list of the JWS signing algorithms (alg
+	// values) supported by the OP for the ID Token.
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	// JSON array containing a list of Client Authentication methods
+	// supported by this Token Endpoint.
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	// JSON array containing a list of the Claim Names of the Claims that
+	// the OpenID Provider MAY be able to supply values for.
+	ClaimsSupported []string `json:"claims_supported,omitempty"`
+	// JSON array containing a list of PKCE code challenge methods
+	// supported by this authorization server. RFC 8414 § 2.
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+	// URL of a page containing human-readable information that developers
+	// might want or need to know when using the OpenID Provider.
+	ServiceDocumentation string `json:"service_documentation,omitempty"`
+	// URL that the OpenID Provider provides to the person registering
+	// the Client to read about the OP's requirements on how the Relying
+	// Party can use the data provided by the OP.
+	OPPolicyURI string `json:"op_policy_uri,omitempty"`
+	// URL that the OpenID Provider provides to the person registering
+	// the Client to read about OpenID Provider's terms of service.
+	OPTosURI string `json:"op_tos_uri,omitempty"`
+}
@@ -0,0 +1,11 @@
+package connect
+
+// Scope values defined in OpenID Connect Core 1.0 § 5.4. The scope
+// ScopeOpenID is required to make an OpenID Connect request.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopeAddress = "address"
+	ScopePhone   = "phone"
+)
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// ErrSecretNotFound is returned by a SecretSource when it doesn't have
+// the requested secret.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretSource abstracts the storage of secrets, e.g., private keys and
+// credentials, so that the services don't need to know where the secrets
+// are stored.
+//
+// The names of the secrets are in the form of file names, e.g.,
+// jwt.key or clients.csv.
+type SecretSource interface {
+	// GetSecret returns the value of the secret. It returns
+	// ErrSecretNotFound if the source doesn't have the secret.
+	GetSecret(name string) ([]byte, error)
+}
+
+const (
+	SecretSourceTypeDir      = "dir"
+	SecretSourceTypeEnv      = "env"
+	SecretSourceTypeKeystore = "keystore"
+	SecretSourceTypeVault    = "vault"
+)
+
+// SecretFilesDirDefault is the directory where the secrets are loaded from
+// if no secret source has been configured. It's where Docker and
+// Kubernetes mount the secrets.
+const SecretFilesDirDefault = "/run/secrets"
+
+// SecretSourceConfig holds the configuration for NewSecretSourceByConfig.
+type SecretSourceConfig struct {
+	Type string `env:"TYPE"`
+
+	Dir string `env:"DIR"`
+
+	EnvVarsPrefix string `env:"ENV_VARS_PREFIX"`
+
+	KeystoreFile       string `env:"KEYSTORE_FILE"`
+	KeystorePassphrase string `env:"KEYSTORE_PASSPHRASE"`
+
+	Vault VaultSecretSourceConfig `env:"VAULT"`
+}
+
+func (SecretSourceConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"Type": "The type of the secret source: dir, env, keystore or vault. " +
+			"Defaults to dir",
+		"Dir": "The directory for the dir secret source. Defaults to " +
+			SecretFilesDirDefault,
+		"EnvVarsPrefix": "The prefix of the environment variables for " +
+			"the env secret source. A secret named jwt.key is looked up " +
+			"in PREFIX_JWT_KEY",
+		"KeystoreFile":       "The keystore file for the keystore secret source",
+		"KeystorePassphrase": "The passphrase of the keystore file",
+	}
+}
+
+// NewSecretSourceByConfig creates a SecretSource based on the configuration.
+func NewSecretSourceByConfig(cfg SecretSourceConfig) (SecretSource, error) {
+	switch cfg.Type {
+	case "", SecretSourceTypeDir:
+		dirName := cfg.Dir
+		if dirName == "" {
+			dirName = SecretFilesDirDefault
+		}
+		return NewDirSecretSource(dirName), nil
+	case SecretSourceTypeEnv:
+		return NewEnvSecretSource(cfg.EnvVarsPrefix), nil
+	case SecretSourceTypeKeystore:
+		if cfg.KeystoreFile == "" {
+			return nil, errors.ArgMsg("cfg.KeystoreFile", "empty")
+		}
+		return OpenKeystoreFile(cfg.KeystoreFile, cfg.KeystorePassphrase)
+	case SecretSourceTypeVault:
+		return NewVaultSecretSource(cfg.Vault)
+	}
+	return nil, errors.ArgMsg("cfg.Type", "unsupported: "+cfg.Type)
+}
+
+// DirSecretSource is a SecretSource which reads the secrets from the files
+// in a directory.
+type DirSecretSource struct {
+	dirName string
+}
+
+var _ SecretSource = &DirSecretSource{}
+
+func NewDirSecretSource(dirName string) *DirSecretSource {
+	return &DirSecretSource{dirName: dirName}
+}
+
+func (secretSource *DirSecretSource) GetSecret(name string) ([]byte, error) {
+	if !isSecretNameValid(name) {
+		return nil, errors.ArgMsg("name", "invalid")
+	}
+	secretBytes, err := os.ReadFile(filepath.Join(secretSource.dirName, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSecretNotFound
+		}
+		return nil, err
+	}
+	return secretBytes, nil
+}
+
+// isSecretNameValid checks that the name doesn't refer to anything outside
+// the secret source, e.g., a file in the parent directory.
+func isSecretNameValid(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, c := range name {
+		if c == '/' || c == '\\' || c == 0 {
+			return false
+		}
+	}
+	return true
+}
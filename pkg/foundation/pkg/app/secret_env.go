@@ -0,0 +1,51 @@
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// EnvSecretSource is a SecretSource which reads the secrets from
+// the environment variables. The name of the variable is derived from
+// the name of the secret, e.g., the secret jwt.key is read from
+// the variable PREFIX_JWT_KEY.
+type EnvSecretSource struct {
+	envVarsPrefix string
+}
+
+var _ SecretSource = &EnvSecretSource{}
+
+func NewEnvSecretSource(envVarsPrefix string) *EnvSecretSource {
+	return &EnvSecretSource{envVarsPrefix: envVarsPrefix}
+}
+
+func (secretSource *EnvSecretSource) GetSecret(name string) ([]byte, error) {
+	if !isSecretNameValid(name) {
+		return nil, errors.ArgMsg("name", "invalid")
+	}
+	secretStr, ok := os.LookupEnv(secretSource.EnvVarName(name))
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(secretStr), nil
+}
+
+// EnvVarName returns the name of the environment variable which holds
+// the secret.
+func (secretSource *EnvSecretSource) EnvVarName(secretName string) string {
+	varName := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		}
+		return '_'
+	}, secretName)
+	if secretSource.envVarsPrefix == "" {
+		return varName
+	}
+	return strings.TrimSuffix(secretSource.envVarsPrefix, "_") + "_" + varName
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// A keystore file is a JSON file which contains secrets encrypted with
+// a key derived from a passphrase. The key is derived with Argon2id and
+// the secrets are encrypted with AES-256-GCM.
+//
+// The KDF parameters are part of the authenticated data so that they
+// can't be tampered with.
+type keystoreFileJSON struct {
+	Version    int             `json:"version"`
+	KDF        keystoreKDFJSON `json:"kdf"`
+	Nonce      []byte          `json:"nonce"`
+	Ciphertext []byte          `json:"ciphertext"`
+}
+
+type keystoreKDFJSON struct {
+	Algorithm   string `json:"alg"`
+	Salt        []byte `json:"salt"`
+	Memory      uint32 `json:"memory"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint8  `json:"parallelism"`
+}
+
+const keystoreFileVersion = 1
+
+var keystoreKDFDefault = keystoreKDFJSON{
+	Algorithm:   "argon2id",
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+// ErrKeystorePassphraseInvalid is returned when a keystore file could not
+// be decrypted with the passphrase.
+var ErrKeystorePassphraseInvalid = errors.New("keystore passphrase invalid")
+
+// KeystoreSecretSource is a SecretSource backed by a passphrase-encrypted
+// keystore file. The secrets are decrypted when the file is opened.
+type KeystoreSecretSource struct {
+	secrets map[string][]byte
+}
+
+var _ SecretSource = &KeystoreSecretSource{}
+
+// OpenKeystoreFile loads and decrypts the keystore file.
+func OpenKeystoreFile(fileName string, passphrase string) (*KeystoreSecretSource, error) {
+	fileBytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := decryptKeystore(fileBytes, passphrase)
+	if err != nil {
+		return nil, errors.Ent(fileName, err)
+	}
+	return &KeystoreSecretSource{secrets: secrets}, nil
+}
+
+// WriteKeystoreFile encrypts the secrets with the passphrase and writes
+// them into the file. The file is created with permission 0600 if it
+// doesn't exist.
+func WriteKeystoreFile(
+	fileName string,
+	passphrase string,
+	secrets map[string][]byte,
+) error {
+	if passphrase == "" {
+		return errors.ArgMsg("passphrase", "empty")
+	}
+	for name := range secrets {
+		if !isSecretNameValid(name) {
+			return errors.ArgMsg("secrets", "invalid name: "+name)
+		}
+	}
+	fileBytes, err := encryptKeystore(secrets, passphrase, keystoreKDFDefault)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, fileBytes, 0600)
+}
+
+func (secretSource *KeystoreSecretSource) GetSecret(name string) ([]byte, error) {
+	secretBytes, ok := secretSource.secrets[name]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	return append([]byte(nil), secretBytes...), nil
+}
+
+// SecretNames returns the names of the secrets in the keystore.
+func (secretSource *KeystoreSecretSource) SecretNames() []string {
+	names := make([]string, 0, len(secretSource.secrets))
+	for name := range secretSource.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func encryptKeystore(
+	secrets map[string][]byte,
+	passphrase string,
+	kdf keystoreKDFJSON,
+) ([]byte, error) {
+	kdf.Salt = make([]byte, 16)
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return nil, errors.Wrap("salt generation", err)
+	}
+
+	aead, err := keystoreAEAD(kdf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	additionalData, err := json.Marshal(kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, errors.Wrap("nonce generation", err)
+	}
+
+	return json.MarshalIndent(keystoreFileJSON{
+		Version:    keystoreFileVersion,
+		KDF:        kdf,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, additionalData),
+	}, "", "  ")
+}
+
+func decryptKeystore(fileBytes []byte, passphrase string) (map[string][]byte, error) {
+	var keystoreFile keystoreFileJSON
+	if err := json.Unmarshal(fileBytes, &keystoreFile); err != nil {
+		return nil, errors.Wrap("keystore decoding", err)
+	}
+	if keystoreFile.Version != keystoreFileVersion {
+		return nil, errors.Msg("keystore version unsupported")
+	}
+
+	kdf := keystoreFile.KDF
+	aead, err := keystoreAEAD(kdf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(keystoreFile.Nonce) != aead.NonceSize() {
+		return nil, errors.Msg("keystore nonce invalid")
+	}
+	additionalData, err := json.Marshal(kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, keystoreFile.Nonce,
+		keystoreFile.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrKeystorePassphraseInvalid
+	}
+
+	var secrets map[string][]byte
+	if err = json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, errors.Wrap("keystore decoding", err)
+	}
+	return secrets, nil
+}
+
+func keystoreAEAD(kdf keystoreKDFJSON, passphrase string) (cipher.AEAD, error) {
+	if kdf.Algorithm != "argon2id" {
+		return nil, errors.Msg("keystore KDF unsupported: " + kdf.Algorithm)
+	}
+	if len(kdf.Salt) < 16 || kdf.Memory == 0 || kdf.Iterations == 0 ||
+		kdf.Parallelism == 0 {
+		return nil, errors.Msg("keystore KDF parameters invalid")
+	}
+
+	key := argon2.IDKey([]byte(passphrase), kdf.Salt,
+		kdf.Iterations, kdf.Memory, kdf.Parallelism, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirSecretSource(t *testing.T) {
+	dirName := t.TempDir()
+	err := os.WriteFile(filepath.Join(dirName, "jwt.key"), []byte("key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secretSource := NewDirSecretSource(dirName)
+	secretBytes, err := secretSource.GetSecret("jwt.key")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", string(secretBytes))
+	_, err = secretSource.GetSecret("clients.csv")
+	assert.Equal(t, ErrSecretNotFound, err)
+	_, err = secretSource.GetSecret("../jwt.key")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrSecretNotFound, err)
+}
+
+func TestEnvSecretSource(t *testing.T) {
+	t.Setenv("IAM_SECRET_JWT_KEY", "key")
+
+	secretSource := NewEnvSecretSource("IAM_SECRET_")
+	assert.Equal(t, "IAM_SECRET_CLIENTS_CSV", secretSource.EnvVarName("clients.csv"))
+	secretBytes, err := secretSource.GetSecret("jwt.key")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", string(secretBytes))
+	_, err = secretSource.GetSecret("clients.csv")
+	assert.Equal(t, ErrSecretNotFound, err)
+}
+
+func TestKeystoreSecretSource(t *testing.T) {
+	kdf := keystoreKDFJSON{Algorithm: "argon2id",
+		Memory: 1024, Iterations: 1, Parallelism: 1}
+	fileBytes, err := encryptKeystore(map[string][]byte{
+		"jwt.key": []byte("key"),
+	}, "passphrase", kdf)
+	assert.Nil(t, err)
+
+	secrets, err := decryptKeystore(fileBytes, "passphrase")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", string(secrets["jwt.key"]))
+
+	_, err = decryptKeystore(fileBytes, "wrong passphrase")
+	assert.Equal(t, ErrKeystorePassphraseInvalid, err)
+
+	// The KDF parameters are authenticated
+	var keystoreFile keystoreFileJSON
+	assert.Nil(t, json.Unmarshal(fileBytes, &keystoreFile))
+	keystoreFile.KDF.Iterations = 2
+	tamperedBytes, err := json.Marshal(keystoreFile)
+	assert.Nil(t, err)
+	_, err = decryptKeystore(tamperedBytes, "passphrase")
+	assert.NotNil(t, err)
+
+	fileName := filepath.Join(t.TempDir(), "keystore.json")
+	assert.Nil(t, os.WriteFile(fileName, fileBytes, 0600))
+	secretSource, err := NewSecretSourceByConfig(SecretSourceConfig{
+		Type:               SecretSourceTypeKeystore,
+		KeystoreFile:       fileName,
+		KeystorePassphrase: "passphrase",
+	})
+	assert.Nil(t, err)
+	secretBytes, err := secretSource.GetSecret("jwt.key")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", string(secretBytes))
+	_, err = secretSource.GetSecret("clients.csv")
+	assert.Equal(t, ErrSecretNotFound, err)
+}
+
+func TestVaultSecretSource(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			switch r.URL.Path {
+			case "/v1/kv/data/iam/server":
+				w.Write([]byte(`{"data":{"data":{"jwt.key":"key","count":1},` +
+					`"metadata":{"version":3}}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[]}`))
+			}
+		}))
+	defer httpSrv.Close()
+
+	secretSource, err := NewVaultSecretSource(VaultSecretSourceConfig{
+		Address:   httpSrv.URL,
+		Token:     "s.token",
+		MountPath: "kv",
+		Path:      "/iam/server",
+	})
+	assert.Nil(t, err)
+	secretBytes, err := secretSource.GetSecret("jwt.key")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", string(secretBytes))
+	_, err = secretSource.GetSecret("clients.csv")
+	assert.Equal(t, ErrSecretNotFound, err)
+	_, err = secretSource.GetSecret("count")
+	assert.NotNil(t, err)
+
+	secretSource, err = NewVaultSecretSource(VaultSecretSourceConfig{
+		Address: httpSrv.URL,
+		Token:   "s.token",
+		Path:    "iam/server",
+	})
+	assert.Nil(t, err)
+	_, err = secretSource.GetSecret("jwt.key")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	secretSource, err = NewVaultSecretSource(VaultSecretSourceConfig{
+		Address:   httpSrv.URL,
+		Token:     "s.other",
+		MountPath: "kv",
+		Path:      "iam/server",
+	})
+	assert.Nil(t, err)
+	_, err = secretSource.GetSecret("jwt.key")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "permission denied")
+	}
+}
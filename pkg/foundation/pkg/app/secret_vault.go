@@ -0,0 +1,160 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// VaultSecretSourceConfig holds the configuration for VaultSecretSource.
+type VaultSecretSourceConfig struct {
+	Address   string `env:"ADDR"`
+	Token     string `env:"TOKEN"`
+	Namespace string `env:"NAMESPACE"`
+	MountPath string `env:"MOUNT_PATH"`
+	Path      string `env:"PATH"`
+}
+
+func (VaultSecretSourceConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"Address": "The address of the Vault server, e.g., https://vault.example.com:8200. " +
+			"Defaults to the value of VAULT_ADDR",
+		"Token":     "The token used to access Vault. Defaults to the value of VAULT_TOKEN",
+		"Namespace": "The Vault Enterprise namespace, if any",
+		"MountPath": "The mount path of the KV version 2 secrets engine. Defaults to secret",
+		"Path": "The path of the secret which holds the secrets. Each " +
+			"secret is a key in the secret's data, e.g., jwt.key",
+	}
+}
+
+const vaultRequestTimeout = 10 * time.Second
+
+// VaultSecretSource is a SecretSource backed by a HashiCorp Vault KV
+// version 2 secrets engine. The secrets are the keys of the data of
+// a Vault secret, and the latest version of the data is always used.
+type VaultSecretSource struct {
+	address   string
+	token     string
+	namespace string
+	mountPath string
+	path      string
+
+	httpClient *http.Client
+}
+
+var _ SecretSource = &VaultSecretSource{}
+
+func NewVaultSecretSource(cfg VaultSecretSourceConfig) (*VaultSecretSource, error) {
+	address := cfg.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, errors.ArgMsg("cfg.Address", "empty")
+	}
+	if _, err := url.Parse(address); err != nil {
+		return nil, errors.Arg("cfg.Address", err)
+	}
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.ArgMsg("cfg.Token", "empty")
+	}
+	mountPath := strings.Trim(cfg.MountPath, "/")
+	if mountPath == "" {
+		mountPath = "secret"
+	}
+	secretPath := strings.Trim(cfg.Path, "/")
+	if secretPath == "" {
+		return nil, errors.ArgMsg("cfg.Path", "empty")
+	}
+
+	return &VaultSecretSource{
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		namespace:  cfg.Namespace,
+		mountPath:  mountPath,
+		path:       secretPath,
+		httpClient: &http.Client{Timeout: vaultRequestTimeout},
+	}, nil
+}
+
+// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#read-secret-version
+type vaultKVv2ReadResponseJSON struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type vaultErrorResponseJSON struct {
+	Errors []string `json:"errors"`
+}
+
+func (secretSource *VaultSecretSource) GetSecret(name string) ([]byte, error) {
+	if !isSecretNameValid(name) {
+		return nil, errors.ArgMsg("name", "invalid")
+	}
+
+	data, err := secretSource.readData()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[name]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	valueStr, ok := value.(string)
+	if !ok {
+		return nil, errors.Msg("vault secret value is not a string: " + name)
+	}
+	return []byte(valueStr), nil
+}
+
+func (secretSource *VaultSecretSource) readData() (map[string]interface{}, error) {
+	reqURL := secretSource.address + "/v1/" + secretSource.mountPath +
+		"/data/" + secretSource.path
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", secretSource.token)
+	if secretSource.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", secretSource.namespace)
+	}
+
+	resp, err := secretSource.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap("vault request", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Vault responds with 404 for a secret which doesn't exist and
+		// for the latest version which has been deleted.
+		return nil, ErrSecretNotFound
+	default:
+		var errResp vaultErrorResponseJSON
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, errors.Msg(fmt.Sprintf("vault request failed with code %v: %v",
+			resp.StatusCode, strings.Join(errResp.Errors, "; ")))
+	}
+
+	var respData vaultKVv2ReadResponseJSON
+	if err = json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return nil, errors.Wrap("vault response decoding", err)
+	}
+	return respData.Data.Data, nil
+}
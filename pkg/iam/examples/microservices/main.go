@@ -135,6 +135,7 @@ func main() {
 	defer shutdownCtxCancel()
 
 	httpServer.Shutdown(shutdownCtx)
+	svcApp.Close()
 	log.Info().Msg("Done.")
 }
 
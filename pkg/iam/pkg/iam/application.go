@@ -1,15 +1,32 @@
 package iam
 
 import (
+	"time"
+
 	"github.com/alloyzeus/go-azfl/azcore"
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+var (
+	ErrApplicationNotFound = errors.EntMsg("application", "not found")
 )
 
 type ApplicationData struct {
-	DisplayName       string
-	Secret            string
-	PlatformType      string // only for user-agent types
+	DisplayName string
+	// Secrets lists the secrets the application could use to
+	// authenticate itself. A public application without any secret
+	// authenticates with an empty secret; other types of application
+	// without any secret could not authenticate.
+	Secrets      []ApplicationSecret
+	PlatformType string // only for user-agent types
+	// RequiredScopes lists the non-public scopes the application may
+	// request. They are granted when the application does not specify
+	// any scope in its request.
 	RequiredScopes    []string
 	OAuth2RedirectURI []string
+	// OAuth2PKCERequired, if set to true, requires the application to
+	// use PKCE (RFC 7636) in the authorization code flow.
+	OAuth2PKCERequired bool
 }
 
 var _ azcore.EntityAttributes = ApplicationData{}
@@ -22,6 +39,11 @@ func (appData ApplicationData) Clone() ApplicationData {
 	// appData is already a clone, but it's shallow. here we are doing
 	// additional operations to copy over values with shared underlying
 	// instances like slices and maps
+	if src := appData.Secrets; src != nil {
+		dst := make([]ApplicationSecret, len(src))
+		copy(dst, src)
+		appData.Secrets = dst
+	}
 	if src := appData.RequiredScopes; src != nil {
 		dst := make([]string, len(src))
 		copy(dst, src)
@@ -47,9 +69,68 @@ func (appData ApplicationData) HasOAuth2RedirectURI(redirectURI string) bool {
 	return false
 }
 
+// ApplicationSecret holds a secret of an application. Only the hash of
+// the secret is kept.
+type ApplicationSecret struct {
+	// Hash is the argon2id hash of the secret, in the standard encoded
+	// hash representation.
+	Hash string
+	// ExpiryTime is the time after which the secret is no longer
+	// accepted. A zero value means the secret does not expire.
+	ExpiryTime time.Time
+}
+
+// IsExpiredAt returns true if the secret is no longer accepted at t.
+func (secret ApplicationSecret) IsExpiredAt(t time.Time) bool {
+	return !secret.ExpiryTime.IsZero() && !t.Before(secret.ExpiryTime)
+}
+
 type Application azcore.KeyedEntityAttributes[
 	ApplicationIDNum, ApplicationID, ApplicationData]
 
+// IsOAuth2PKCERequired returns true if the application is required
+// to use PKCE in the authorization code flow. Public clients are always
+// required to use PKCE as they are unable to authenticate themselves.
+func (app Application) IsOAuth2PKCERequired() bool {
+	return app.ID.IDNum().IsUserAgentAuthorizationPublic() ||
+		app.Attributes.OAuth2PKCERequired
+}
+
 type ApplicationDataProvider interface {
 	GetApplication(id ApplicationID) (*Application, error)
 }
+
+// JSONV1 models
+
+type ApplicationAttributesJSONV1 struct {
+	DisplayName        string   `json:"display_name"`
+	PlatformType       string   `json:"platform_type,omitempty"`
+	RequiredScopes     []string `json:"required_scopes,omitempty"`
+	OAuth2RedirectURI  []string `json:"oauth2_redirect_uri,omitempty"`
+	OAuth2PKCERequired bool     `json:"oauth2_pkce_required,omitempty"`
+}
+
+type ApplicationCreateRequestJSONV1 struct {
+	// Type is one of service, user-agent-public or
+	// user-agent-confidential.
+	Type       string `json:"type"`
+	FirstParty bool   `json:"first_party,omitempty"`
+
+	ApplicationAttributesJSONV1
+}
+
+type ApplicationCreateResponseJSONV1 struct {
+	ApplicationID string `json:"application_id"`
+	Secret        string `json:"secret"`
+}
+
+type ApplicationSecretRotateRequestJSONV1 struct {
+	// PreviousSecretsExpiresIn is the number of seconds the existing
+	// secrets are still accepted after the rotation. The existing
+	// secrets are invalidated immediately if this is zero.
+	PreviousSecretsExpiresIn int64 `json:"previous_secrets_expires_in,omitempty"`
+}
+
+type ApplicationSecretResponseJSONV1 struct {
+	Secret string `json:"secret"`
+}
@@ -21,6 +21,32 @@ var (
 	ErrReqFieldAuthorizationTypeUnsupported = ReqFieldErr(AuthorizationMetadataKey, dataerrs.ErrTypeUnsupported)
 
 	ErrAuthorizationCodeAlreadyClaimed = errors.EntMsg("authorization code", "already claimed")
+
+	ErrAuthorizationCodeVerifierMismatch = errors.EntMsg("code verifier", "mismatch")
+
+	ErrRefreshTokenAlreadyRotated = errors.EntMsg("refresh token", "already rotated")
+
+	ErrDeviceAuthorizationPending = errors.EntMsg("device authorization", "pending")
+
+	ErrDeviceAuthorizationPollingTooFrequent = errors.EntMsg("device authorization", "polling too frequent")
+
+	ErrDeviceAuthorizationDenied = errors.EntMsg("device authorization", "denied")
+
+	ErrDeviceCodeExpired = errors.EntMsg("device code", "expired")
+
+	ErrDeviceUserCodeInvalid = errors.EntMsg("user code", "invalid")
+
+	ErrMFATokenInvalid = errors.EntMsg("mfa token", "invalid")
+
+	ErrMFATokenExpired = errors.EntMsg("mfa token", "expired")
+
+	ErrMFACodeMismatch = errors.EntMsg("mfa code", "mismatch")
+
+	ErrWebAuthnChallengeInvalid = errors.EntMsg("webauthn challenge", "invalid")
+
+	ErrWebAuthnChallengeExpired = errors.EntMsg("webauthn challenge", "expired")
+
+	ErrWebAuthnCredentialInvalid = errors.EntMsg("webauthn credential", "invalid")
 )
 
 // Authorization is generally used to provide authorization information
@@ -34,7 +60,10 @@ type Authorization struct {
 
 	SessionID SessionID
 
-	// Scope, expiry time
+	// Scope is the list of scopes granted to the authorization.
+	Scope []string
+
+	//TODO: expiry time
 
 	rawToken string
 }
@@ -141,6 +170,27 @@ func (authz Authorization) ClientApplicationIDNum() ApplicationIDNum {
 	return authz.SessionID.terminal.application.IDNum()
 }
 
+// HasScope returns true if the authorization has been granted
+// the scope.
+func (authz Authorization) HasScope(scopeName string) bool {
+	return scopeListContains(authz.Scope, scopeName)
+}
+
+// RequireScopes returns ErrScopeInsufficient unless the authorization has
+// been granted all of the scopes. It returns ErrAuthorizationInvalid if
+// the authorization itself is not valid.
+func (authz Authorization) RequireScopes(scopeNames ...string) error {
+	if authz.IsNotStaticallyValid() {
+		return ErrAuthorizationInvalid
+	}
+	for _, s := range scopeNames {
+		if !authz.HasScope(s) {
+			return ErrScopeInsufficient
+		}
+	}
+	return nil
+}
+
 // RawToken returns the token where this instance of Authorization
 // was parsed from.
 func (authz Authorization) RawToken() string {
@@ -162,6 +212,27 @@ type AccessTokenClaims struct {
 	AuthorizedParty string `json:"azp,omitempty"`
 	SubType         string `json:"sub_type,omitempty"`
 	TerminalID      string `json:"terminal_id,omitempty"`
+	// Scope is a space-delimited list of the scopes granted to
+	// the token. RFC 8693 § 4.2.
+	Scope string `json:"scope,omitempty"`
+}
+
+// IDTokenTTLDefault is the active duration for an ID Token.
+const IDTokenTTLDefault = AccessTokenTTLDefault
+
+// IDTokenClaims holds the claims of an OpenID Connect ID Token.
+// OpenID Connect Core 1.0 § 2.
+type IDTokenClaims struct {
+	jwt.Claims
+
+	// Time when the End-User authentication occurred.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// The value passed by the client in the authentication request.
+	Nonce string `json:"nonce,omitempty"`
+	// The client ID of the party to which the ID Token was issued.
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Access Token hash value. OpenID Connect Core 1.0 § 3.1.3.6.
+	AccessTokenHash string `json:"at_hash,omitempty"`
 }
 
 // RefreshTokenTTLDefault is the active duration for a refresh token.
@@ -170,6 +241,7 @@ type AccessTokenClaims struct {
 const RefreshTokenTTLDefault = 30 * 24 * time.Hour
 
 type RefreshTokenClaims struct {
+	ID             string `json:"jti,omitempty"`
 	ExpiresAt      int64  `json:"exp,omitempty"`
 	NotBefore      int64  `json:"nbf,omitempty"`
 	TerminalID     string `json:"terminal_id,omitempty"`
@@ -10,12 +10,12 @@ import (
 	"github.com/alloyzeus/go-azfl/errors"
 	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
 	"github.com/square/go-jose/v3/jwt"
-	"github.com/tomasen/realip"
 	"golang.org/x/text/language"
 	grpcmd "google.golang.org/grpc/metadata"
 	grpcpeer "google.golang.org/grpc/peer"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api"
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/app"
 )
 
@@ -47,6 +47,10 @@ func NewConsumerServerSimple(
 	if err != nil {
 		return nil, errors.Wrap("config loading", err)
 	}
+	srvCfg, err := ConsumerServerConfigFromEnv(envVarsPrefix, nil)
+	if err != nil {
+		return nil, errors.Wrap("server config loading", err)
+	}
 
 	jwksURL := cfg.ServerBaseURL + serverOAuth2JWKSRelPath
 	var jwtKeyChain JWTKeyChain
@@ -57,7 +61,21 @@ func NewConsumerServerSimple(
 
 	userInstanceInfoService := &UserInstanceInfoServiceClientCore{}
 
-	inst, err := NewConsumerServer(cfg, &jwtKeyChain, userInstanceInfoService)
+	// The revocations are learned from the IAM server; the results are
+	// cached so that not every request makes a request to the server.
+	remoteRevocationChecker, err := NewSessionRevocationCheckerRemote(*cfg)
+	if err != nil {
+		return nil, errors.Wrap("session revocation checker initialization", err)
+	}
+	sessionRevocationChecker, err := NewSessionRevocationCheckerCache(
+		remoteRevocationChecker, sessionRevocationCheckerCacheSizeDefault,
+		SessionRevocationCheckerCacheTTLDefault)
+	if err != nil {
+		return nil, errors.Wrap("session revocation checker initialization", err)
+	}
+
+	inst, err := newConsumerServer(cfg, srvCfg, &jwtKeyChain,
+		userInstanceInfoService, sessionRevocationChecker)
 	if err != nil {
 		return nil, err
 	}
@@ -67,30 +85,54 @@ func NewConsumerServerSimple(
 		return nil, err
 	}
 
+	// Keep the keys up to date as the IAM server rotates its keys. It's
+	// stopped by Close.
+	inst.jwksRefresherStop = jwtKeyChain.StartJWKSetRefresher(func(err error) {
+		log.Warn().Err(err).Str("url", jwksURL).Msg("JWK set refresh")
+	})
+
 	return inst, nil
 }
 
+// NewConsumerServer creates a ConsumerServer.
+//
+// If sessionRevocationChecker is nil, the revocation status of the sessions
+// will not be checked; access tokens will be accepted until they expire.
 func NewConsumerServer(
 	serviceClientConfig *ServiceClientConfig,
+	consumerServerConfig *ConsumerServerConfig,
 	jwtKeyChain *JWTKeyChain,
 	userInstanceInfoService UserInstanceInfoService,
+	sessionRevocationChecker SessionRevocationChecker,
 ) (ConsumerServer, error) {
+	return newConsumerServer(serviceClientConfig, consumerServerConfig,
+		jwtKeyChain, userInstanceInfoService, sessionRevocationChecker)
+}
+
+func newConsumerServer(
+	serviceClientConfig *ServiceClientConfig,
+	consumerServerConfig *ConsumerServerConfig,
+	jwtKeyChain *JWTKeyChain,
+	userInstanceInfoService UserInstanceInfoService,
+	sessionRevocationChecker SessionRevocationChecker,
+) (*consumerServerCore, error) {
 	if serviceClientConfig != nil {
 		cfg := *serviceClientConfig
 		serviceClientConfig = &cfg
 	}
 
-	srvCore, err := NewConsumerServerCore(jwtKeyChain, userInstanceInfoService)
+	srvCore, err := NewConsumerServerCore(consumerServerConfig,
+		jwtKeyChain, userInstanceInfoService, sessionRevocationChecker)
 	if err != nil {
 		return nil, err
 	}
 
 	return &consumerServerCore{
-		&serviceClientCore{
+		serviceClientCore: &serviceClientCore{
 			serviceClientConfig: serviceClientConfig,
 			userInstanceInfoSvc: userInstanceInfoService,
 		},
-		srvCore,
+		ConsumerServerBase: srvCore,
 	}, nil
 }
 
@@ -100,6 +142,11 @@ func NewConsumerServer(
 type ConsumerServer interface {
 	ConsumerServerBase
 	ServiceClient
+
+	// Close stops the background jobs of the server, e.g., the refreshing
+	// of the JWK set. The server must not be used after it has been
+	// closed.
+	Close() error
 }
 
 // ConsumerServerBase is an interface which contains utilities for
@@ -139,21 +186,52 @@ type ConsumerRESTServer interface {
 type consumerServerCore struct {
 	*serviceClientCore
 	ConsumerServerBase
+
+	jwksRefresherStop func()
+}
+
+func (consumerSrv *consumerServerCore) Close() error {
+	if consumerSrv.jwksRefresherStop != nil {
+		consumerSrv.jwksRefresherStop()
+	}
+	return nil
 }
 
 func NewConsumerServerCore(
+	consumerServerConfig *ConsumerServerConfig,
 	jwtKeyChain *JWTKeyChain,
 	userInstanceInfoService UserInstanceInfoService,
+	sessionRevocationChecker SessionRevocationChecker,
 ) (ConsumerServerBase, error) {
+	var cfg ConsumerServerConfig
+	if consumerServerConfig != nil {
+		cfg = *consumerServerConfig
+	} else {
+		cfg.AccessTokenClockSkew = AccessTokenClockSkewDefault
+	}
+	if cfg.AccessTokenClockSkew < 0 {
+		return nil, errors.ArgMsg("consumerServerConfig.AccessTokenClockSkew", "negative")
+	}
+	trustedProxies, err := parseTrustedProxyList(cfg.TrustedProxies)
+	if err != nil {
+		return nil, errors.Arg("consumerServerConfig.TrustedProxies", err)
+	}
+
 	return &consumerServerBaseCore{
-		jwtKeyChain:             jwtKeyChain,
-		userInstanceInfoService: userInstanceInfoService,
+		config:                   cfg,
+		trustedProxies:           trustedProxies,
+		jwtKeyChain:              jwtKeyChain,
+		userInstanceInfoService:  userInstanceInfoService,
+		sessionRevocationChecker: sessionRevocationChecker,
 	}, nil
 }
 
 type consumerServerBaseCore struct {
-	jwtKeyChain             *JWTKeyChain
-	userInstanceInfoService UserInstanceInfoService
+	config                   ConsumerServerConfig
+	trustedProxies           trustedProxyList
+	jwtKeyChain              *JWTKeyChain
+	userInstanceInfoService  UserInstanceInfoService
+	sessionRevocationChecker SessionRevocationChecker
 }
 
 var _ ConsumerServerBase = &consumerServerBaseCore{}
@@ -199,7 +277,29 @@ func (consumerSrv *consumerServerBaseCore) AuthorizationFromJWTString(
 		return emptyAuthCtx, errors.ArgWrap("", "verification", err)
 	}
 
-	//TODO: check expiry
+	// RFC 7519 § 4.1.4
+	if claims.Expiry == nil {
+		return emptyAuthCtx, errors.Arg("", errors.EntMsg("exp", "empty"))
+	}
+	err = claims.Claims.ValidateWithLeeway(
+		jwt.Expected{
+			Issuer: consumerSrv.config.AccessTokenIssuer,
+			Time:   time.Now(),
+		},
+		consumerSrv.config.AccessTokenClockSkew)
+	if err != nil {
+		switch err {
+		case jwt.ErrExpired:
+			return emptyAuthCtx, errors.Arg("", errors.EntMsg("exp", "expired"))
+		case jwt.ErrNotValidYet:
+			return emptyAuthCtx, errors.Arg("", errors.EntMsg("nbf", "not yet valid"))
+		case jwt.ErrIssuedInTheFuture:
+			return emptyAuthCtx, errors.Arg("", errors.EntMsg("iat", "in the future"))
+		case jwt.ErrInvalidIssuer:
+			return emptyAuthCtx, errors.Arg("", errors.EntMsg("iss", "mismatch"))
+		}
+		return emptyAuthCtx, errors.ArgWrap("", "validation", err)
+	}
 
 	if claims.ID == "" {
 		return emptyAuthCtx, errors.Arg("", errors.EntMsg("jti", "empty"))
@@ -208,7 +308,20 @@ func (consumerSrv *consumerServerBaseCore) AuthorizationFromJWTString(
 	if err != nil {
 		return emptyAuthCtx, errors.Arg("", errors.Ent("jti", dataerrs.Malformed(err)))
 	}
-	//TODO(exa): check if the authorization instance id has been revoked
+	if checker := consumerSrv.sessionRevocationChecker; checker != nil {
+		var revoked bool
+		if tokenChecker, ok := checker.(SessionTokenRevocationChecker); ok {
+			revoked, err = tokenChecker.IsSessionTokenRevoked(sessionID, jwtStr)
+		} else {
+			revoked, err = checker.IsSessionRevoked(sessionID)
+		}
+		if err != nil {
+			return emptyAuthCtx, errors.Wrap("session revocation check", err)
+		}
+		if revoked {
+			return emptyAuthCtx, errors.Arg("", errors.EntMsg("jti", "revoked"))
+		}
+	}
 
 	var userID UserID
 	if claims.Subject != "" {
@@ -243,6 +356,7 @@ func (consumerSrv *consumerServerBaseCore) AuthorizationFromJWTString(
 
 	return &Authorization{
 		SessionID: sessionID,
+		Scope:     oauth2.ParseScope(claims.Scope),
 		rawToken:  jwtStr,
 	}, nil
 }
@@ -260,15 +374,18 @@ func (consumerSrv *consumerServerBaseCore) GRPCCallInputContext(
 func (consumerSrv *consumerServerBaseCore) callContextFromGRPCContext(
 	grpcCallCtx context.Context,
 ) (CallInputContext, error) {
-	var remoteAddr string
+	var peerAddr string
 	if peer, _ := grpcpeer.FromContext(grpcCallCtx); peer != nil {
-		remoteAddr = peer.Addr.String() //TODO: attempt to resolve if it's proxied
+		peerAddr = peer.Addr.String()
 	}
 
+	var forwardedFor []string
 	var originEnvString string
 	var originAcceptLanguages []language.Tag
 
 	if md, mdOK := grpcmd.FromIncomingContext(grpcCallCtx); mdOK {
+		forwardedFor = md.Get("x-forwarded-for")
+
 		userAgentMDVal := md.Get("user-agent")
 		if len(userAgentMDVal) > 0 {
 			originEnvString = userAgentMDVal[0]
@@ -281,7 +398,8 @@ func (consumerSrv *consumerServerBaseCore) callContextFromGRPCContext(
 	}
 
 	originInfo := azcore.ServiceMethodCallOriginInfo{
-		Address:           remoteAddr,
+		Address: consumerSrv.trustedProxies.
+			resolveOriginAddress(peerAddr, forwardedFor),
 		AcceptLanguage:    originAcceptLanguages,
 		EnvironmentString: originEnvString,
 	}
@@ -358,10 +476,8 @@ func (consumerSrv *consumerServerBaseCore) callContextFromHTTPRequest(
 	ctx := req.Context()
 	ctxAuth := newEmptyAuthorization()
 
-	remoteAddr := realip.FromRequest(req)
-	if remoteAddr == "" {
-		remoteAddr = req.RemoteAddr
-	}
+	remoteAddr := consumerSrv.trustedProxies.
+		resolveOriginAddress(req.RemoteAddr, req.Header.Values("X-Forwarded-For"))
 
 	remoteEnvString := req.UserAgent()
 	acceptLanguages, _, _ := language.ParseAcceptLanguage(req.Header.Get("Accept-Language"))
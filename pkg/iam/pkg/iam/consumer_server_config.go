@@ -0,0 +1,44 @@
+package iam
+
+import (
+	"time"
+
+	"github.com/rez-go/stev"
+)
+
+// AccessTokenClockSkewDefault is the default leeway used when validating
+// the time-based claims of access tokens.
+const AccessTokenClockSkewDefault = 30 * time.Second
+
+// ConsumerServerConfig holds the configuration used by a consumer server
+// to validate the access tokens it receives and to identify where
+// the calls come from.
+type ConsumerServerConfig struct {
+	// AccessTokenIssuer is the expected value of the access tokens'
+	// iss claim. The claim won't be checked if this field is empty.
+	AccessTokenIssuer string `env:"ACCESS_TOKEN_ISSUER"`
+	// AccessTokenClockSkew is the leeway when checking the access tokens'
+	// exp, nbf and iat claims to account for clock drift between hosts.
+	AccessTokenClockSkew time.Duration `env:"ACCESS_TOKEN_CLOCK_SKEW"`
+	// TrustedProxies is a comma-separated list of the IP addresses or
+	// CIDR ranges of the reverse proxies in front of the server. The
+	// X-Forwarded-For header is only honored for the calls which come
+	// through these proxies; otherwise, the address of the peer is
+	// the origin of the call.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+}
+
+func ConsumerServerConfigFromEnv(
+	prefix string, def *ConsumerServerConfig,
+) (*ConsumerServerConfig, error) {
+	if def == nil {
+		def = &ConsumerServerConfig{
+			AccessTokenClockSkew: AccessTokenClockSkewDefault,
+		}
+	}
+	err := stev.LoadEnv(prefix, def)
+	if err != nil {
+		return nil, err
+	}
+	return def, nil
+}
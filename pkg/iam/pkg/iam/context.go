@@ -20,6 +20,7 @@ var (
 
 	ErrOperationNotAllowed = accesserrs.Msg("actor is not allowed perform action on the target resource")
 	ErrAccessNotAllowed    = accesserrs.Msg("actor is not allowed to access target resource")
+	ErrScopeInsufficient   = accesserrs.Msg("authorization does not have the required scopes")
 )
 
 func NewEmptyCallInputContext(ctx context.Context) CallInputContext {
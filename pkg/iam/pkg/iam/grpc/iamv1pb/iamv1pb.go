@@ -0,0 +1,6 @@
+// Package iamv1pb contains the messages and the service stubs of
+// the kadisoka.iam.v1 gRPC services which are defined in this
+// repository.
+package iamv1pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative application_management.proto user_terminal.proto
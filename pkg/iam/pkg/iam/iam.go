@@ -1 +1,7 @@
 package iam
+
+import (
+	foundationlog "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/logging"
+)
+
+var log = foundationlog.NewPkgLogger()
@@ -2,17 +2,20 @@ package iam
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/alloyzeus/go-azfl/errors"
 	"github.com/square/go-jose/v3"
@@ -26,180 +29,358 @@ var (
 	rsaSigningAlg = jose.RS256
 	// Available for EdDSA: EdDSA
 	edDSASigningAlg = jose.EdDSA
+	// For ECDSA, the algorithm is determined by the curve: ES256 for
+	// P-256 and ES384 for P-384.
 )
 
 func NewJWTKeyChainFromFiles(
 	privateKeyFilenamesToTry []string,
 	publicKeyFilenamePattern string,
 ) (*JWTKeyChain, error) {
+	var keys []JWTKey
+
 	signerKey, err := loadPrivateKeyFromPEMFile(privateKeyFilenamesToTry, "")
 	if err != nil {
 		return nil, err
 	}
-	var signerKeyID string
 	if signerKey != nil {
-		signerKeyID, err = thumbprintKey(signerKey)
-		if err != nil {
-			panic(err)
-		}
+		keys = append(keys, JWTKey{Key: signerKey})
 	}
 
-	keySet := make(map[string]interface{})
 	if publicKeyFilenamePattern != "" {
 		rsaVerifierKeys, err := loadRSAPublicKeysByFileNamePattern(publicKeyFilenamePattern)
 		if err != nil {
 			return nil, err
 		}
 		for k, v := range rsaVerifierKeys {
-			keySet[k] = v
+			keys = append(keys, JWTKey{ID: k, Key: v})
 		}
 	}
 
-	return &JWTKeyChain{
-		signerKey:   signerKey,
-		signerKeyID: signerKeyID,
-		keySet:      keySet}, nil
+	jwtKeyChain := &JWTKeyChain{}
+	if err = jwtKeyChain.SetKeys(keys); err != nil {
+		return nil, err
+	}
+	return jwtKeyChain, nil
 }
 
-type JWTKeyChain struct {
-	signerKey   crypto.Signer
-	signerKeyID string
-	keySet      map[string]interface{}
+// NewJWTKeyChainFromPrivateKeyPEM creates a key chain with a signing key
+// parsed from the PEM data. See ParseJWTPrivateKeyPEM for the supported
+// formats.
+func NewJWTKeyChainFromPrivateKeyPEM(pemBytes []byte) (*JWTKeyChain, error) {
+	signerKey, err := ParseJWTPrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	jwtKeyChain := &JWTKeyChain{}
+	if err = jwtKeyChain.SetKeys([]JWTKey{{Key: signerKey}}); err != nil {
+		return nil, err
+	}
+	return jwtKeyChain, nil
 }
 
-func (jwtKeyChain JWTKeyChain) CanSign() bool {
-	return jwtKeyChain.signerKey != nil && jwtKeyChain.signerKeyID != ""
+// JWTKey is a key in a JWTKeyChain along with its lifecycle.
+//
+// A key which has not been activated is published so that the consumers
+// are able to verify the tokens signed with it as soon as it's in use.
+// Once a newer key is activated, the key is retired: it's no longer used
+// to sign tokens but it's still published and accepted until it expires.
+type JWTKey struct {
+	// ID is the key ID (kid). If it's empty, the thumbprint of the key
+	// will be used.
+	ID string
+	// Algorithm is the algorithm the key is used with. If it's empty,
+	// the default algorithm for the type of the key will be used.
+	Algorithm jose.SignatureAlgorithm
+	// Key is a crypto.Signer for the keys which could be used to sign
+	// tokens, or a public key for the keys which are used only to
+	// verify them.
+	Key interface{}
+	// ActivationTime is the time since the key is used to sign tokens.
+	// A zero value means that the key has always been active.
+	ActivationTime time.Time
+	// ExpiryTime is the time after which the key is no longer published
+	// nor accepted. A zero value means that the key does not expire.
+	ExpiryTime time.Time
 }
 
-func (jwtKeyChain JWTKeyChain) GetSigner() (jose.Signer, error) {
-	if !jwtKeyChain.CanSign() {
-		return nil, nil
-	}
+// CanSign returns true if the key could be used to sign tokens.
+func (key JWTKey) CanSign() bool {
+	_, ok := key.Key.(crypto.Signer)
+	return ok
+}
 
-	var alg jose.SignatureAlgorithm
-	switch jwtKeyChain.signerKey.(type) {
-	case *rsa.PrivateKey:
-		alg = rsaSigningAlg
-	case ed25519.PrivateKey:
-		alg = edDSASigningAlg
-	default:
-		return nil, errors.Msg("unexpected condition")
+// Signer returns a signer which signs with the key, using the key's
+// algorithm.
+func (key JWTKey) Signer() (jose.Signer, error) {
+	if !key.CanSign() {
+		return nil, errors.Msg("key can't be used for signing")
 	}
-
 	return jose.NewSigner(jose.SigningKey{
-		Key:       jwtKeyChain.signerKey,
-		Algorithm: alg,
+		Key:       key.Key,
+		Algorithm: key.Algorithm,
 	}, &jose.SignerOptions{
 		ExtraHeaders: map[jose.HeaderKey]interface{}{
-			jose.HeaderKey("kid"): jwtKeyChain.signerKeyID,
+			jose.HeaderKey("kid"): key.ID,
 		},
 	})
 }
 
-func (jwtKeyChain JWTKeyChain) GetSignedVerifierKey(keyID string) interface{} {
-	if jwtKeyChain.signerKey != nil && jwtKeyChain.signerKeyID == keyID {
-		return jwtKeyChain.signerKey.Public()
+// PublicKey returns the public part of the key.
+func (key JWTKey) PublicKey() interface{} {
+	if signer, ok := key.Key.(crypto.Signer); ok {
+		return signer.Public()
 	}
-	if len(jwtKeyChain.keySet) > 0 {
-		if key := jwtKeyChain.keySet[keyID]; key != nil {
-			return key
+	return key.Key
+}
+
+func (key JWTKey) IsActivatedAt(t time.Time) bool {
+	return !t.Before(key.ActivationTime)
+}
+
+func (key JWTKey) IsExpiredAt(t time.Time) bool {
+	return !key.ExpiryTime.IsZero() && !t.Before(key.ExpiryTime)
+}
+
+// JWTKeyChain holds the keys used to sign and to verify JWTs. It's safe
+// for concurrent use.
+type JWTKeyChain struct {
+	mutex sync.RWMutex
+	// keys holds the keys owned by the key chain, ordered by their
+	// activation time.
+	keys []JWTKey
+	// keySet holds the keys loaded from the issuer's JWK set.
+	keySet map[string]JWTKey
+
+	keyDirName string
+
+	// jwksMutex guards the JWK set fields. It's not held during
+	// the fetches; the concurrent fetches share jwksFetch.
+	jwksMutex           sync.Mutex
+	jwksURL             string
+	jwksLastFetchTime   time.Time
+	jwksNextRefreshTime time.Time
+	jwksFetch           *jwksFetchCall
+}
+
+// SetKeys replaces the keys owned by the key chain. The keys loaded
+// from JWK sets are kept.
+func (jwtKeyChain *JWTKeyChain) SetKeys(keys []JWTKey) error {
+	normalizedKeys := make([]JWTKey, 0, len(keys))
+	keyIDs := map[string]bool{}
+	for _, key := range keys {
+		key, err := normalizeJWTKey(key)
+		if err != nil {
+			return err
+		}
+		if keyIDs[key.ID] {
+			return errors.EntMsg(key.ID, "duplicate key ID")
 		}
+		keyIDs[key.ID] = true
+		normalizedKeys = append(normalizedKeys, key)
 	}
+	sort.SliceStable(normalizedKeys, func(i, j int) bool {
+		return normalizedKeys[i].ActivationTime.Before(normalizedKeys[j].ActivationTime)
+	})
+
+	jwtKeyChain.mutex.Lock()
+	jwtKeyChain.keys = normalizedKeys
+	jwtKeyChain.mutex.Unlock()
+
 	return nil
 }
 
-func (jwtKeyChain *JWTKeyChain) LoadVerifierKeysFromJWKSetByURL(
-	jwksURL string,
-) (int, error) {
-	publicKeys, err := loadJSONWebKeySetByURL(jwksURL)
-	if err != nil {
-		return 0, err
+// Keys returns the keys owned by the key chain, including the expired
+// ones.
+func (jwtKeyChain *JWTKeyChain) Keys() []JWTKey {
+	jwtKeyChain.mutex.RLock()
+	defer jwtKeyChain.mutex.RUnlock()
+	keys := make([]JWTKey, len(jwtKeyChain.keys))
+	copy(keys, jwtKeyChain.keys)
+	return keys
+}
+
+// SigningKeyAt returns the key used to sign tokens at t, which is
+// the most recently activated key which can sign and has not expired.
+func (jwtKeyChain *JWTKeyChain) SigningKeyAt(t time.Time) *JWTKey {
+	jwtKeyChain.mutex.RLock()
+	defer jwtKeyChain.mutex.RUnlock()
+	return jwtKeyChain.signingKeyAtLocked(t)
+}
+
+func (jwtKeyChain *JWTKeyChain) signingKeyAtLocked(t time.Time) *JWTKey {
+	for i := len(jwtKeyChain.keys) - 1; i >= 0; i-- {
+		key := jwtKeyChain.keys[i]
+		if key.CanSign() && key.IsActivatedAt(t) && !key.IsExpiredAt(t) {
+			return &key
+		}
 	}
-	if len(publicKeys) > 0 && jwtKeyChain.keySet == nil {
-		jwtKeyChain.keySet = make(map[string]interface{})
+	return nil
+}
+
+func (jwtKeyChain *JWTKeyChain) CanSign() bool {
+	return jwtKeyChain.SigningKeyAt(time.Now()) != nil
+}
+
+// SignatureAlgorithm returns the algorithm used to sign the tokens. It
+// returns an empty string if the key chain can't be used for signing.
+func (jwtKeyChain *JWTKeyChain) SignatureAlgorithm() jose.SignatureAlgorithm {
+	signingKey := jwtKeyChain.SigningKeyAt(time.Now())
+	if signingKey == nil {
+		return ""
 	}
-	for keyID, keyData := range publicKeys {
-		jwtKeyChain.keySet[keyID] = keyData
+	return signingKey.Algorithm
+}
+
+func (jwtKeyChain *JWTKeyChain) GetSigner() (jose.Signer, error) {
+	signingKey := jwtKeyChain.SigningKeyAt(time.Now())
+	if signingKey == nil {
+		return nil, nil
 	}
-	return len(publicKeys), nil
+	return signingKey.Signer()
 }
 
-func (jwtKeyChain JWTKeyChain) JWKSet() jose.JSONWebKeySet {
+// GetSignedVerifierKey returns the public key used to verify the tokens
+// signed with the key identified by keyID. If the key is not known and
+// the key chain has a JWK set URL, the JWK set will be refreshed.
+func (jwtKeyChain *JWTKeyChain) GetSignedVerifierKey(keyID string) interface{} {
+	if key := jwtKeyChain.getSignedVerifierKey(keyID); key != nil {
+		return key
+	}
+	if jwtKeyChain.refreshJWKSetForUnknownKeyID() {
+		return jwtKeyChain.getSignedVerifierKey(keyID)
+	}
+	return nil
+}
+
+func (jwtKeyChain *JWTKeyChain) getSignedVerifierKey(keyID string) interface{} {
+	t := time.Now()
+
+	jwtKeyChain.mutex.RLock()
+	defer jwtKeyChain.mutex.RUnlock()
+
+	for _, key := range jwtKeyChain.keys {
+		if key.ID == keyID && !key.IsExpiredAt(t) {
+			return key.PublicKey()
+		}
+	}
+	if key, ok := jwtKeyChain.keySet[keyID]; ok && !key.IsExpiredAt(t) {
+		return key.Key
+	}
+	return nil
+}
+
+// JWKSet returns the set of the keys which are to be published. It
+// includes the upcoming keys, the signing key, and the retired keys which
+// have not expired.
+func (jwtKeyChain *JWTKeyChain) JWKSet() jose.JSONWebKeySet {
+	return jwtKeyChain.JWKSetAt(time.Now())
+}
+
+func (jwtKeyChain *JWTKeyChain) JWKSetAt(t time.Time) jose.JSONWebKeySet {
+	jwtKeyChain.mutex.RLock()
+	defer jwtKeyChain.mutex.RUnlock()
+
 	jwks := []jose.JSONWebKey{}
 
-	// Add active signer key
-	signerKey := jwtKeyChain.signerKey
-	signerKeyID := jwtKeyChain.signerKeyID
-	if signerKey != nil && signerKeyID != "" {
-		var publicKey interface{}
-		var algStr string
-		switch pk := signerKey.(type) {
-		case *rsa.PrivateKey:
-			algStr = string(rsaSigningAlg)
-			publicKey = &pk.PublicKey
-		case ed25519.PrivateKey:
-			algStr = string(edDSASigningAlg)
-			// pk.PublicKey() doesn't return *ed25519.PublicKey. We pass
-			// the private key instead and let JOSE extract the public key
-			// from it.
-			publicKey = pk
-		default:
-			panic("unexpected condition")
+	for _, key := range jwtKeyChain.keys {
+		if key.IsExpiredAt(t) {
+			continue
 		}
 		jwks = append(jwks, jose.JSONWebKey{
-			KeyID:     signerKeyID,
-			Key:       publicKey,
+			KeyID:     key.ID,
+			Key:       key.PublicKey(),
 			Use:       "sig",
-			Algorithm: algStr,
+			Algorithm: string(key.Algorithm),
 		})
 	}
 
-	// Add verifier keys
 	for kid, key := range jwtKeyChain.keySet {
+		if key.IsExpiredAt(t) {
+			continue
+		}
 		jwks = append(jwks, jose.JSONWebKey{
 			KeyID:     kid,
-			Key:       key,
+			Key:       key.Key,
 			Use:       "sig",
-			Algorithm: string(jose.RS256), //TODO: should be stored along with the key
+			Algorithm: string(key.Algorithm),
 		})
 	}
 
 	return jose.JSONWebKeySet{Keys: jwks}
 }
 
-func thumbprintKey(key interface{}) (thumbprintStr string, err error) {
-	k := &jose.JSONWebKey{Key: key}
-	tpBytes, err := k.Thumbprint(thumbprintHasher)
-	return base64.RawURLEncoding.EncodeToString(tpBytes), err
-}
-
-func loadJSONWebKeySetByURL(jwksURL string) (keyMap map[string]interface{}, err error) {
-	client := &http.Client{}
-
-	resp, err := client.Get(jwksURL)
-	if err != nil {
-		return nil, err
+// normalizeJWTKey fills the ID and the algorithm of the key if they
+// were not provided, and ensures that the algorithm is usable with
+// the key.
+func normalizeJWTKey(key JWTKey) (JWTKey, error) {
+	if key.Key == nil {
+		return key, errors.ArgMsg("key.Key", "empty")
 	}
-	defer resp.Body.Close()
+	if key.ID == "" {
+		keyID, err := thumbprintKey(key.PublicKey())
+		if err != nil {
+			return key, errors.Arg("key.Key", err)
+		}
+		key.ID = keyID
+	}
+	if key.Algorithm == "" {
+		key.Algorithm = defaultJWTKeyAlgorithm(key.PublicKey())
+		if key.Algorithm == "" {
+			return key, errors.ArgMsg("key.Key", "unsupported key type")
+		}
+	} else if !isJWTKeyAlgorithmSupported(key.PublicKey(), key.Algorithm) {
+		return key, errors.ArgMsg("key.Algorithm",
+			"unsupported for the key: "+string(key.Algorithm))
+	}
+	return key, nil
+}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("fetch failed with code %v url %v", resp.StatusCode, jwksURL)
+func defaultJWTKeyAlgorithm(publicKey interface{}) jose.SignatureAlgorithm {
+	switch pk := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsaSigningAlg
+	case ed25519.PublicKey:
+		return edDSASigningAlg
+	case *ecdsa.PublicKey:
+		return ecdsaSigningAlg(pk.Curve)
 	}
+	return ""
+}
 
-	var set jose.JSONWebKeySet
-	err = json.NewDecoder(resp.Body).Decode(&set)
-	if err != nil {
-		return nil, err
+func ecdsaSigningAlg(curve elliptic.Curve) jose.SignatureAlgorithm {
+	switch curve {
+	case elliptic.P256():
+		return jose.ES256
+	case elliptic.P384():
+		return jose.ES384
 	}
+	return ""
+}
 
-	keySet := make(map[string]interface{})
-	for _, key := range set.Keys {
-		if _, ok := keySet[key.KeyID]; ok {
-			panic("multiple keys with the same ID")
+func isJWTKeyAlgorithmSupported(
+	publicKey interface{}, alg jose.SignatureAlgorithm,
+) bool {
+	switch pk := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case jose.RS256, jose.RS384, jose.RS512,
+			jose.PS256, jose.PS384, jose.PS512:
+			return true
 		}
-		keySet[key.KeyID] = key.Key
+	case ed25519.PublicKey:
+		return alg == jose.EdDSA
+	case *ecdsa.PublicKey:
+		ecAlg := ecdsaSigningAlg(pk.Curve)
+		return ecAlg != "" && alg == ecAlg
 	}
-	return keySet, nil
+	return false
+}
+
+func thumbprintKey(key interface{}) (thumbprintStr string, err error) {
+	k := &jose.JSONWebKey{Key: key}
+	tpBytes, err := k.Thumbprint(thumbprintHasher)
+	return base64.RawURLEncoding.EncodeToString(tpBytes), err
 }
 
 // see filepath.Match for the pattern
@@ -264,16 +445,40 @@ func loadPrivateKeyFromPEMFile(
 		return nil, errors.Msg(fmt.Sprintf("none of these files could be loaded: %v", fileNamesToTry))
 	}
 
-	pemData, _ := pem.Decode(fileBytes)
+	return parsePrivateKeyPEM(fileName, fileBytes, passphrase)
+}
+
+// ParseJWTPrivateKeyPEM parses a private key, in PEM format, which could
+// be used as a signing key of a JWTKeyChain. The supported formats are
+// PKCS #1 and PKCS #8 RSA keys, PKCS #8 Ed25519 keys, and SEC 1 and
+// PKCS #8 ECDSA keys with P-256 or P-384 curve.
+func ParseJWTPrivateKeyPEM(pemBytes []byte) (crypto.Signer, error) {
+	return parsePrivateKeyPEM("pemBytes", pemBytes, "")
+}
+
+func parsePrivateKeyPEM(
+	sourceName string,
+	fileBytes []byte,
+	passphrase string,
+) (crypto.Signer, error) {
+	var err error
+
+	pemData, rest := pem.Decode(fileBytes)
+	// The output of openssl ecparam -genkey contains the curve parameters
+	// before the key.
+	if pemData != nil && pemData.Type == "EC PARAMETERS" {
+		pemData, _ = pem.Decode(rest)
+	}
 	if pemData == nil {
-		return nil, errors.EntMsg(fileName, "key file doesn't containt private key")
+		return nil, errors.EntMsg(sourceName, "key file doesn't containt private key")
 	}
 
 	switch pemData.Type {
 	case "RSA PRIVATE KEY":
+	case "EC PRIVATE KEY":
 	case "PRIVATE KEY":
 	default:
-		return nil, errors.EntMsg(fileName, "key type unsupported: "+pemData.Type)
+		return nil, errors.EntMsg(sourceName, "key type unsupported: "+pemData.Type)
 	}
 
 	var pemBytes []byte
@@ -283,27 +488,39 @@ func loadPrivateKeyFromPEMFile(
 		// reading existing data.
 		pemBytes, err = x509.DecryptPEMBlock(pemData, []byte(passphrase))
 		if err != nil {
-			return nil, errors.Ent(fileName, errors.Wrap("decrypt failed", err))
+			return nil, errors.Ent(sourceName, errors.Wrap("decrypt failed", err))
 		}
 	} else {
 		pemBytes = pemData.Bytes
 	}
 
 	var parsedKey interface{}
-	if parsedKey, err = x509.ParsePKCS1PrivateKey(pemBytes); err != nil {
-		if parsedKey, err = x509.ParsePKCS8PrivateKey(pemBytes); err != nil {
+	switch pemData.Type {
+	case "EC PRIVATE KEY":
+		if parsedKey, err = x509.ParseECPrivateKey(pemBytes); err != nil {
 			return nil, err
 		}
+	default:
+		if parsedKey, err = x509.ParsePKCS1PrivateKey(pemBytes); err != nil {
+			if parsedKey, err = x509.ParsePKCS8PrivateKey(pemBytes); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	if pk, ok := parsedKey.(*rsa.PrivateKey); ok {
+	switch pk := parsedKey.(type) {
+	case *rsa.PrivateKey:
 		return pk, nil
-	}
-	if pk, ok := parsedKey.(ed25519.PrivateKey); ok {
+	case ed25519.PrivateKey:
+		return pk, nil
+	case *ecdsa.PrivateKey:
+		if ecdsaSigningAlg(pk.Curve) == "" {
+			return nil, errors.EntMsg(sourceName, "unsupported curve: "+pk.Curve.Params().Name)
+		}
 		return pk, nil
 	}
 
-	return nil, errors.EntMsg(fileName, "unsupported key type")
+	return nil, errors.EntMsg(sourceName, "unsupported key type")
 }
 
 //TODO: support other key types (ed25519)
@@ -0,0 +1,260 @@
+package iam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/square/go-jose/v3"
+)
+
+const (
+	// The refresh interval used when the JWK set response does not
+	// specify its max-age.
+	jwksRefreshIntervalDefault = 15 * time.Minute
+	// The minimum time between two fetches. This is also the rate limit
+	// of the fetches triggered by unknown key IDs.
+	jwksRefreshIntervalMin = 30 * time.Second
+	jwksRefreshIntervalMax = 24 * time.Hour
+
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// LoadVerifierKeysFromJWKSetByURL loads the keys from the JWK set at
+// the URL. The URL is remembered so that the keys could be refreshed
+// later. See RefreshJWKSet.
+func (jwtKeyChain *JWTKeyChain) LoadVerifierKeysFromJWKSetByURL(
+	jwksURL string,
+) (int, error) {
+	jwtKeyChain.jwksMutex.Lock()
+	jwtKeyChain.jwksURL = jwksURL
+	jwtKeyChain.jwksMutex.Unlock()
+
+	return jwtKeyChain.fetchJWKSet(false)
+}
+
+// RefreshJWKSet reloads the keys from the JWK set URL, as provided to
+// LoadVerifierKeysFromJWKSetByURL. If the fetch fails, the keys loaded
+// previously are kept.
+func (jwtKeyChain *JWTKeyChain) RefreshJWKSet() error {
+	_, err := jwtKeyChain.fetchJWKSet(false)
+	return err
+}
+
+// StartJWKSetRefresher starts a background process which refreshes
+// the keys from the JWK set URL. The interval follows the max-age
+// directive in the Cache-Control header of the JWK set response.
+// Refresh errors are passed to errHandler, if provided. Call the returned
+// function to stop the process; it could be called more than once.
+func (jwtKeyChain *JWTKeyChain) StartJWKSetRefresher(
+	errHandler func(error),
+) (stop func()) {
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		retryInterval := jwksRefreshIntervalMin
+		for {
+			jwtKeyChain.jwksMutex.Lock()
+			waitDuration := time.Until(jwtKeyChain.jwksNextRefreshTime)
+			jwtKeyChain.jwksMutex.Unlock()
+			if waitDuration < jwksRefreshIntervalMin {
+				waitDuration = jwksRefreshIntervalMin
+			}
+
+			timer := time.NewTimer(waitDuration)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			err := jwtKeyChain.RefreshJWKSet()
+			if err == nil {
+				retryInterval = jwksRefreshIntervalMin
+				continue
+			}
+			if errHandler != nil {
+				errHandler(err)
+			}
+			// Back off on failures, up to the default interval.
+			jwtKeyChain.jwksMutex.Lock()
+			jwtKeyChain.jwksNextRefreshTime = time.Now().Add(retryInterval)
+			jwtKeyChain.jwksMutex.Unlock()
+			retryInterval *= 2
+			if retryInterval > jwksRefreshIntervalDefault {
+				retryInterval = jwksRefreshIntervalDefault
+			}
+		}
+	}()
+	return func() {
+		stopOnce.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// refreshJWKSetForUnknownKeyID refreshes the keys from the JWK set URL
+// when a token refers to a key the key chain doesn't have, e.g., after
+// the issuer has rotated its keys. The refreshes are rate limited. It
+// returns false if the key chain has no JWK set URL.
+func (jwtKeyChain *JWTKeyChain) refreshJWKSetForUnknownKeyID() bool {
+	jwtKeyChain.jwksMutex.Lock()
+	hasURL := jwtKeyChain.jwksURL != ""
+	jwtKeyChain.jwksMutex.Unlock()
+	if !hasURL {
+		return false
+	}
+
+	// The caller will look up the key again either way.
+	_, _ = jwtKeyChain.fetchJWKSet(true)
+	return true
+}
+
+// jwksFetchCall is a fetch of a JWK set which is in progress. The callers
+// which need the keys while the fetch is in progress wait for it instead
+// of making their own.
+type jwksFetchCall struct {
+	jwksURL string
+	done    chan struct{}
+	n       int
+	err     error
+}
+
+// fetchJWKSet fetches the JWK set from the URL and replaces the keys
+// loaded previously if it succeeds. The fetch is made without holding
+// jwksMutex so that it doesn't block the callers which only need to
+// read the JWK set fields. If rateLimited is true, the fetch will not be
+// made if the last one was made too recently.
+func (jwtKeyChain *JWTKeyChain) fetchJWKSet(rateLimited bool) (int, error) {
+	jwtKeyChain.jwksMutex.Lock()
+	for {
+		if jwtKeyChain.jwksURL == "" {
+			jwtKeyChain.jwksMutex.Unlock()
+			return 0, errors.Msg("key chain has no JWK set URL")
+		}
+		call := jwtKeyChain.jwksFetch
+		if call == nil {
+			break
+		}
+		jwtKeyChain.jwksMutex.Unlock()
+		<-call.done
+		if call.jwksURL == jwtKeyChain.currentJWKSetURL() {
+			return call.n, call.err
+		}
+		// The URL was changed while the fetch was in progress.
+		jwtKeyChain.jwksMutex.Lock()
+	}
+	if rateLimited && time.Since(jwtKeyChain.jwksLastFetchTime) < jwksRefreshIntervalMin {
+		jwtKeyChain.jwksMutex.Unlock()
+		return 0, nil
+	}
+
+	call := &jwksFetchCall{
+		jwksURL: jwtKeyChain.jwksURL,
+		done:    make(chan struct{}),
+	}
+	jwtKeyChain.jwksFetch = call
+	jwtKeyChain.jwksLastFetchTime = time.Now()
+	jwtKeyChain.jwksMutex.Unlock()
+
+	keySet, maxAge, err := loadJSONWebKeySetByURL(call.jwksURL)
+
+	jwtKeyChain.jwksMutex.Lock()
+	if err == nil {
+		if maxAge < 0 {
+			maxAge = jwksRefreshIntervalDefault
+		} else if maxAge < jwksRefreshIntervalMin {
+			maxAge = jwksRefreshIntervalMin
+		} else if maxAge > jwksRefreshIntervalMax {
+			maxAge = jwksRefreshIntervalMax
+		}
+		jwtKeyChain.jwksNextRefreshTime = time.Now().Add(maxAge)
+
+		jwtKeyChain.mutex.Lock()
+		jwtKeyChain.keySet = keySet
+		jwtKeyChain.mutex.Unlock()
+
+		call.n = len(keySet)
+	}
+	call.err = err
+	jwtKeyChain.jwksFetch = nil
+	jwtKeyChain.jwksMutex.Unlock()
+	close(call.done)
+
+	return call.n, call.err
+}
+
+func (jwtKeyChain *JWTKeyChain) currentJWKSetURL() string {
+	jwtKeyChain.jwksMutex.Lock()
+	defer jwtKeyChain.jwksMutex.Unlock()
+	return jwtKeyChain.jwksURL
+}
+
+func loadJSONWebKeySetByURL(
+	jwksURL string,
+) (keyMap map[string]JWTKey, maxAge time.Duration, err error) {
+	client := &http.Client{Timeout: jwksFetchTimeout}
+
+	resp, err := client.Get(jwksURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, 0, fmt.Errorf("fetch failed with code %v url %v", resp.StatusCode, jwksURL)
+	}
+
+	var set jose.JSONWebKeySet
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keySet := make(map[string]JWTKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.KeyID == "" {
+			return nil, 0, errors.Msg("key without ID in the key set")
+		}
+		if _, ok := keySet[key.KeyID]; ok {
+			return nil, 0, errors.Msg("multiple keys with the same ID: " + key.KeyID)
+		}
+		keySet[key.KeyID] = JWTKey{
+			ID:        key.KeyID,
+			Algorithm: jose.SignatureAlgorithm(key.Algorithm),
+			Key:       key.Key,
+		}
+	}
+
+	return keySet, cacheControlMaxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// cacheControlMaxAge returns the max-age in the Cache-Control header
+// value. It returns zero if the response must not be cached, and
+// a negative value if the header does not specify the max-age.
+func cacheControlMaxAge(headerValue string) time.Duration {
+	maxAge := time.Duration(-1)
+	for _, directive := range strings.Split(headerValue, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store", directive == "no-cache":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.ParseInt(
+				strings.Trim(strings.TrimPrefix(directive, "max-age="), `"`), 10, 64)
+			if err == nil && seconds >= 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return maxAge
+}
@@ -0,0 +1,163 @@
+package iam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type jwksTestServer struct {
+	mutex      sync.Mutex
+	keys       []jose.JSONWebKey
+	statusCode int
+	fetchCount int
+	// If set, the responses are held until it's closed.
+	hold chan struct{}
+}
+
+func (srv *jwksTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	hold := srv.hold
+	srv.mutex.Unlock()
+	if hold != nil {
+		<-hold
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.fetchCount++
+	if srv.statusCode != 0 {
+		w.WriteHeader(srv.statusCode)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: srv.keys})
+}
+
+func (srv *jwksTestServer) setKeys(keys ...jose.JSONWebKey) {
+	srv.mutex.Lock()
+	srv.keys = keys
+	srv.statusCode = 0
+	srv.mutex.Unlock()
+}
+
+func TestJWTKeyChainJWKSetRefresh(t *testing.T) {
+	keyA := jose.JSONWebKey{KeyID: "a", Key: generateEd25519KeyForTest(t).Public(),
+		Use: "sig", Algorithm: "EdDSA"}
+	keyB := jose.JSONWebKey{KeyID: "b", Key: generateEd25519KeyForTest(t).Public(),
+		Use: "sig", Algorithm: "EdDSA"}
+
+	jwksSrv := &jwksTestServer{}
+	jwksSrv.setKeys(keyA)
+	httpSrv := httptest.NewServer(jwksSrv)
+	defer httpSrv.Close()
+
+	var jwtKeyChain JWTKeyChain
+	n, err := jwtKeyChain.LoadVerifierKeysFromJWKSetByURL(httpSrv.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("a"))
+	assert.WithinDuration(t, time.Now().Add(300*time.Second),
+		jwtKeyChain.jwksNextRefreshTime, 5*time.Second)
+
+	// The issuer rotated its keys. The unknown key is looked up once
+	// within the rate limit interval.
+	jwksSrv.setKeys(keyA, keyB)
+	assert.Nil(t, jwtKeyChain.GetSignedVerifierKey("b"))
+	jwtKeyChain.jwksLastFetchTime = time.Now().Add(-jwksRefreshIntervalMin)
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("b"))
+	assert.Equal(t, 2, jwksSrv.fetchCount)
+	assert.Nil(t, jwtKeyChain.GetSignedVerifierKey("c"))
+	assert.Equal(t, 2, jwksSrv.fetchCount)
+
+	// Failed fetches keep the last known-good key set
+	jwksSrv.setKeys(keyA, keyA)
+	assert.NotNil(t, jwtKeyChain.RefreshJWKSet())
+	jwksSrv.mutex.Lock()
+	jwksSrv.statusCode = http.StatusServiceUnavailable
+	jwksSrv.mutex.Unlock()
+	assert.NotNil(t, jwtKeyChain.RefreshJWKSet())
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("a"))
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("b"))
+
+	// Keys removed by the issuer are no longer accepted
+	jwksSrv.setKeys(keyB)
+	assert.Nil(t, jwtKeyChain.RefreshJWKSet())
+	assert.Nil(t, jwtKeyChain.getSignedVerifierKey("a"))
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("b"))
+
+	// The refresher could be stopped more than once
+	stop := jwtKeyChain.StartJWKSetRefresher(nil)
+	stop()
+	assert.NotPanics(t, stop)
+}
+
+func TestJWTKeyChainJWKSetFetchConcurrent(t *testing.T) {
+	keyA := jose.JSONWebKey{KeyID: "a", Key: generateEd25519KeyForTest(t).Public(),
+		Use: "sig", Algorithm: "EdDSA"}
+	keyB := jose.JSONWebKey{KeyID: "b", Key: generateEd25519KeyForTest(t).Public(),
+		Use: "sig", Algorithm: "EdDSA"}
+
+	jwksSrv := &jwksTestServer{}
+	jwksSrv.setKeys(keyA)
+	httpSrv := httptest.NewServer(jwksSrv)
+	defer httpSrv.Close()
+
+	var jwtKeyChain JWTKeyChain
+	_, err := jwtKeyChain.LoadVerifierKeysFromJWKSetByURL(httpSrv.URL)
+	assert.Nil(t, err)
+
+	hold := make(chan struct{})
+	jwksSrv.mutex.Lock()
+	jwksSrv.keys = []jose.JSONWebKey{keyA, keyB}
+	jwksSrv.hold = hold
+	jwksSrv.mutex.Unlock()
+	jwtKeyChain.jwksMutex.Lock()
+	jwtKeyChain.jwksLastFetchTime = time.Now().Add(-jwksRefreshIntervalMin)
+	jwtKeyChain.jwksMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("b"))
+		}()
+	}
+
+	// The lock must not be held while the fetch is in progress.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jwtKeyChain.jwksMutex.Lock()
+		inProgress := jwtKeyChain.jwksFetch != nil
+		jwtKeyChain.jwksMutex.Unlock()
+		if inProgress || time.Now().After(deadline) {
+			assert.True(t, inProgress)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("a"))
+
+	close(hold)
+	wg.Wait()
+
+	jwksSrv.mutex.Lock()
+	defer jwksSrv.mutex.Unlock()
+	assert.Equal(t, 2, jwksSrv.fetchCount)
+}
+
+func TestCacheControlMaxAge(t *testing.T) {
+	assert.Equal(t, time.Duration(-1), cacheControlMaxAge(""))
+	assert.Equal(t, time.Duration(-1), cacheControlMaxAge("public"))
+	assert.Equal(t, 300*time.Second, cacheControlMaxAge("public, max-age=300"))
+	assert.Equal(t, 60*time.Second, cacheControlMaxAge(`Max-Age="60", must-revalidate`))
+	assert.Equal(t, time.Duration(0), cacheControlMaxAge("no-cache, max-age=300"))
+	assert.Equal(t, time.Duration(-1), cacheControlMaxAge("max-age=abc"))
+}
@@ -0,0 +1,208 @@
+package iam
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/square/go-jose/v3"
+)
+
+// A key directory contains the keys of a JWTKeyChain. Each key is stored
+// in a PEM file: a private key in a file with .key extension, or a public
+// key, for a key which is no longer used to sign tokens, in a file with
+// .pub extension.
+//
+// The lifecycle of a key is described in an optional JSON file with
+// the same base name as the key file, e.g., 2022-07.json for 2022-07.key,
+// which contains an object with these optional fields:
+//
+//	kid              the key ID, defaults to the thumbprint of the key
+//	alg              the algorithm, defaults to the default for the key type
+//	activation_time  RFC 3339 time the key starts to be used for signing
+//	expiry_time      RFC 3339 time the key is no longer published
+//
+// To rotate the keys, add the new key with its activation time in
+// the future, and set the expiry time of the current key to sometime
+// after the new key's activation time plus the lifetime of the tokens,
+// including the refresh tokens.
+type jwtKeyFileMetadataJSON struct {
+	KeyID          string     `json:"kid,omitempty"`
+	Algorithm      string     `json:"alg,omitempty"`
+	ActivationTime *time.Time `json:"activation_time,omitempty"`
+	ExpiryTime     *time.Time `json:"expiry_time,omitempty"`
+}
+
+// NewJWTKeyChainFromDirectory creates a key chain with the keys loaded
+// from the directory. See ReloadKeyDirectory to pick up the changes
+// made to the directory.
+func NewJWTKeyChainFromDirectory(dirName string) (*JWTKeyChain, error) {
+	jwtKeyChain := &JWTKeyChain{keyDirName: dirName}
+	if err := jwtKeyChain.ReloadKeyDirectory(); err != nil {
+		return nil, err
+	}
+	return jwtKeyChain, nil
+}
+
+// ReloadKeyDirectory reloads the keys from the key directory. If
+// the loading fails, including when the directory is empty or can't be
+// read, the keys the key chain has are kept.
+func (jwtKeyChain *JWTKeyChain) ReloadKeyDirectory() error {
+	jwtKeyChain.mutex.RLock()
+	dirName := jwtKeyChain.keyDirName
+	jwtKeyChain.mutex.RUnlock()
+	if dirName == "" {
+		return errors.Msg("key chain has no key directory")
+	}
+
+	keys, err := loadJWTKeysFromDirectory(dirName)
+	if err != nil {
+		return err
+	}
+	return jwtKeyChain.SetKeys(keys)
+}
+
+// StartKeyDirectoryReloader starts a background process which reloads
+// the keys from the key directory at the interval. Reloading errors are
+// passed to errHandler, if provided. Call the returned function to stop
+// the process; it could be called more than once.
+func (jwtKeyChain *JWTKeyChain) StartKeyDirectoryReloader(
+	interval time.Duration,
+	errHandler func(error),
+) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := jwtKeyChain.ReloadKeyDirectory()
+				if err != nil && errHandler != nil {
+					errHandler(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		stopOnce.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// loadJWTKeysFromDirectory loads the keys from the directory. A directory
+// without any key is an error as it's more likely a mistake, e.g.,
+// a volume which has not been mounted, than a deliberate removal of all
+// the keys; the key chain would be left unable to verify any token.
+func loadJWTKeysFromDirectory(dirName string) ([]JWTKey, error) {
+	entries, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		return nil, errors.Wrap(dirName, err)
+	}
+
+	var keys []JWTKey
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := filepath.Join(dirName, entry.Name())
+		ext := filepath.Ext(fileName)
+
+		var key JWTKey
+		switch ext {
+		case ".key":
+			signer, err := loadPrivateKeyFromPEMFile([]string{fileName}, "")
+			if err != nil {
+				return nil, errors.Wrap(fileName, err)
+			}
+			key.Key = signer
+		case ".pub":
+			publicKey, err := loadPublicKeyFromPEMFile(fileName)
+			if err != nil {
+				return nil, errors.Wrap(fileName, err)
+			}
+			key.Key = publicKey
+		default:
+			continue
+		}
+
+		metadataFileName := strings.TrimSuffix(fileName, ext) + ".json"
+		metadataBytes, err := ioutil.ReadFile(metadataFileName)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(metadataFileName, err)
+		}
+		if len(metadataBytes) > 0 {
+			var metadata jwtKeyFileMetadataJSON
+			if err = json.Unmarshal(metadataBytes, &metadata); err != nil {
+				return nil, errors.Wrap(metadataFileName, err)
+			}
+			key.ID = metadata.KeyID
+			key.Algorithm = jose.SignatureAlgorithm(metadata.Algorithm)
+			if metadata.ActivationTime != nil {
+				key.ActivationTime = *metadata.ActivationTime
+			}
+			if metadata.ExpiryTime != nil {
+				key.ExpiryTime = *metadata.ExpiryTime
+			}
+		}
+
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.EntMsg(dirName, "no keys")
+	}
+
+	return keys, nil
+}
+
+func loadPublicKeyFromPEMFile(fileName string) (interface{}, error) {
+	fileBytes, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	pemData, _ := pem.Decode(fileBytes)
+	if pemData == nil {
+		return nil, errors.EntMsg(fileName, "key file doesn't contain public key")
+	}
+
+	var parsedKey interface{}
+	switch pemData.Type {
+	case "PUBLIC KEY":
+		parsedKey, err = x509.ParsePKIXPublicKey(pemData.Bytes)
+	case "RSA PUBLIC KEY":
+		if parsedKey, err = x509.ParsePKCS1PublicKey(pemData.Bytes); err != nil {
+			parsedKey, err = x509.ParsePKIXPublicKey(pemData.Bytes)
+		}
+	default:
+		return nil, errors.EntMsg(fileName, "key type unsupported: "+pemData.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch pk := parsedKey.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return parsedKey, nil
+	case *ecdsa.PublicKey:
+		if ecdsaSigningAlg(pk.Curve) == "" {
+			return nil, errors.EntMsg(fileName, "unsupported curve: "+pk.Curve.Params().Name)
+		}
+		return parsedKey, nil
+	}
+	return nil, errors.EntMsg(fileName, "unsupported key type")
+}
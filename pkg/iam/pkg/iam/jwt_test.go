@@ -0,0 +1,248 @@
+package iam
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateEd25519KeyForTest(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func TestJWTKeyChainLifecycle(t *testing.T) {
+	now := time.Now()
+	retiredKey := generateEd25519KeyForTest(t)
+	currentKey := generateEd25519KeyForTest(t)
+	upcomingKey := generateEd25519KeyForTest(t)
+	expiredKey := generateEd25519KeyForTest(t)
+
+	var jwtKeyChain JWTKeyChain
+	err := jwtKeyChain.SetKeys([]JWTKey{
+		{ID: "upcoming", Key: upcomingKey, ActivationTime: now.Add(time.Hour)},
+		{ID: "current", Key: currentKey, ActivationTime: now.Add(-time.Hour)},
+		{ID: "retired", Key: retiredKey, ActivationTime: now.Add(-2 * time.Hour),
+			ExpiryTime: now.Add(time.Hour)},
+		{ID: "expired", Key: expiredKey, ActivationTime: now.Add(-3 * time.Hour),
+			ExpiryTime: now.Add(-time.Minute)},
+	})
+	assert.Nil(t, err)
+
+	signingKey := jwtKeyChain.SigningKeyAt(now)
+	if assert.NotNil(t, signingKey) {
+		assert.Equal(t, "current", signingKey.ID)
+		assert.Equal(t, jose.EdDSA, signingKey.Algorithm)
+	}
+	signingKey = jwtKeyChain.SigningKeyAt(now.Add(2 * time.Hour))
+	if assert.NotNil(t, signingKey) {
+		assert.Equal(t, "upcoming", signingKey.ID)
+	}
+
+	jwks := jwtKeyChain.JWKSetAt(now)
+	var keyIDs []string
+	for _, k := range jwks.Keys {
+		keyIDs = append(keyIDs, k.KeyID)
+		assert.True(t, k.IsPublic())
+		assert.Equal(t, "EdDSA", k.Algorithm)
+	}
+	assert.ElementsMatch(t, []string{"retired", "current", "upcoming"}, keyIDs)
+
+	jwksJSON, err := json.Marshal(jwks)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(jwksJSON), `"d":`))
+
+	assert.NotNil(t, jwtKeyChain.GetSignedVerifierKey("retired"))
+	assert.Nil(t, jwtKeyChain.GetSignedVerifierKey("expired"))
+	assert.Nil(t, jwtKeyChain.GetSignedVerifierKey("unknown"))
+}
+
+func TestJWTKeyChainSetKeysInvalid(t *testing.T) {
+	key := generateEd25519KeyForTest(t)
+
+	var jwtKeyChain JWTKeyChain
+	assert.NotNil(t, jwtKeyChain.SetKeys([]JWTKey{
+		{Key: key, Algorithm: jose.RS256}}))
+	assert.NotNil(t, jwtKeyChain.SetKeys([]JWTKey{
+		{ID: "a", Key: key}, {ID: "a", Key: generateEd25519KeyForTest(t)}}))
+	assert.NotNil(t, jwtKeyChain.SetKeys([]JWTKey{{ID: "a"}}))
+	assert.False(t, jwtKeyChain.CanSign())
+}
+
+func TestJWTKeyChainFromDirectory(t *testing.T) {
+	dirName := t.TempDir()
+	activationTime := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	writeKey := func(name string, key ed25519.PrivateKey) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dirName, name),
+			pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeKey("a.key", generateEd25519KeyForTest(t))
+	jwtKeyChain, err := NewJWTKeyChainFromDirectory(dirName)
+	assert.Nil(t, err)
+	assert.True(t, jwtKeyChain.CanSign())
+	assert.Len(t, jwtKeyChain.Keys(), 1)
+
+	writeKey("b.key", generateEd25519KeyForTest(t))
+	err = ioutil.WriteFile(filepath.Join(dirName, "b.json"),
+		[]byte(`{"kid":"b","activation_time":"`+
+			activationTime.Format(time.RFC3339)+`"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, jwtKeyChain.ReloadKeyDirectory())
+	assert.Len(t, jwtKeyChain.Keys(), 2)
+	assert.NotEqual(t, "b", jwtKeyChain.SigningKeyAt(time.Now()).ID)
+	assert.Equal(t, "b", jwtKeyChain.SigningKeyAt(activationTime).ID)
+
+	// A broken directory keeps the keys loaded previously
+	err = ioutil.WriteFile(filepath.Join(dirName, "c.key"), []byte("garbage"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, jwtKeyChain.ReloadKeyDirectory())
+	assert.Len(t, jwtKeyChain.Keys(), 2)
+
+	// So does an empty directory, or one which can't be read
+	for _, name := range []string{"a.key", "b.key", "b.json", "c.key"} {
+		if err = os.Remove(filepath.Join(dirName, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NotNil(t, jwtKeyChain.ReloadKeyDirectory())
+	assert.Len(t, jwtKeyChain.Keys(), 2)
+	if err = os.Remove(dirName); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, jwtKeyChain.ReloadKeyDirectory())
+	assert.Len(t, jwtKeyChain.Keys(), 2)
+}
+
+func generateECDSAKeyForTest(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+func TestJWTKeyChainECDSA(t *testing.T) {
+	p256Key := generateECDSAKeyForTest(t, elliptic.P256())
+	p384Key := generateECDSAKeyForTest(t, elliptic.P384())
+
+	var jwtKeyChain JWTKeyChain
+	assert.NotNil(t, jwtKeyChain.SetKeys([]JWTKey{
+		{ID: "a", Key: p256Key, Algorithm: jose.ES384}}))
+	assert.NotNil(t, jwtKeyChain.SetKeys([]JWTKey{
+		{ID: "a", Key: generateECDSAKeyForTest(t, elliptic.P224())}}))
+
+	err := jwtKeyChain.SetKeys([]JWTKey{
+		{ID: "p256", Key: p256Key, ActivationTime: time.Now().Add(-time.Hour)},
+		{ID: "p384", Key: p384Key, ActivationTime: time.Now().Add(time.Hour)},
+	})
+	assert.Nil(t, err)
+	signingKey := jwtKeyChain.SigningKeyAt(time.Now())
+	if assert.NotNil(t, signingKey) {
+		assert.Equal(t, jose.ES256, signingKey.Algorithm)
+	}
+	signingKey = jwtKeyChain.SigningKeyAt(time.Now().Add(2 * time.Hour))
+	if assert.NotNil(t, signingKey) {
+		assert.Equal(t, jose.ES384, signingKey.Algorithm)
+	}
+
+	jwksJSON, err := json.Marshal(jwtKeyChain.JWKSet())
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(jwksJSON), `"crv":"P-256"`))
+	assert.True(t, strings.Contains(string(jwksJSON), `"crv":"P-384"`))
+	assert.False(t, strings.Contains(string(jwksJSON), `"d":`))
+
+	signer, err := jwtKeyChain.GetSigner()
+	assert.Nil(t, err)
+	jws, err := signer.Sign([]byte("payload"))
+	assert.Nil(t, err)
+	verifierKey := jwtKeyChain.GetSignedVerifierKey("p256")
+	if assert.NotNil(t, verifierKey) {
+		payload, err := jws.Verify(verifierKey)
+		assert.Nil(t, err)
+		assert.Equal(t, "payload", string(payload))
+	}
+}
+
+func TestJWTKeyChainECDSAFromDirectory(t *testing.T) {
+	dirName := t.TempDir()
+
+	writePEM := func(name string, blocks ...*pem.Block) {
+		var fileBytes []byte
+		for _, block := range blocks {
+			fileBytes = append(fileBytes, pem.EncodeToMemory(block)...)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dirName, name), fileBytes, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// SEC 1, as generated by openssl ecparam -genkey
+	sec1Key := generateECDSAKeyForTest(t, elliptic.P256())
+	sec1DER, err := x509.MarshalECPrivateKey(sec1Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("sec1.key",
+		&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86,
+			0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}},
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1DER})
+
+	pkcs8Key := generateECDSAKeyForTest(t, elliptic.P384())
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(pkcs8Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("pkcs8.key", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER})
+
+	pubDER, err := x509.MarshalPKIXPublicKey(generateECDSAKeyForTest(t, elliptic.P256()).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("retired.pub", &pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	jwtKeyChain, err := NewJWTKeyChainFromDirectory(dirName)
+	assert.Nil(t, err)
+	algs := map[jose.SignatureAlgorithm]int{}
+	for _, key := range jwtKeyChain.Keys() {
+		algs[key.Algorithm]++
+	}
+	assert.Equal(t, map[jose.SignatureAlgorithm]int{jose.ES256: 2, jose.ES384: 1}, algs)
+
+	// Unsupported curve
+	p224DER, err := x509.MarshalPKCS8PrivateKey(generateECDSAKeyForTest(t, elliptic.P224()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM("p224.key", &pem.Block{Type: "PRIVATE KEY", Bytes: p224DER})
+	assert.NotNil(t, jwtKeyChain.ReloadKeyDirectory())
+	assert.Len(t, jwtKeyChain.Keys(), 3)
+}
@@ -11,6 +11,10 @@ type OAuth2TokenResponse struct {
 
 	TerminalID     string `json:"terminal_id,omitempty" schema:"terminal_id,omitempty"`
 	TerminalSecret string `json:"terminal_secret,omitempty" schema:"terminal_secret,omitempty"`
+
+	// IDToken is the OpenID Connect ID Token. It's provided only if
+	// the openid scope was requested.
+	IDToken string `json:"id_token,omitempty" schema:"id_token,omitempty"`
 }
 
 // The OAuth2AuthorizePostResponse is used for responding successful POST /authorize
@@ -18,3 +22,33 @@ type OAuth2TokenResponse struct {
 type OAuth2AuthorizePostResponse struct {
 	RedirectURI string `json:"redirect_uri"`
 }
+
+// OAuth2TokenIntrospectionResponse is used for responding token
+// introspection requests. See RFC 7662 § 2.2 for the details.
+//
+// For inactive tokens, all the fields other than Active will be left
+// empty.
+type OAuth2TokenIntrospectionResponse struct {
+	Active bool `json:"active"`
+
+	Scope      string `json:"scope,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	TokenType  string `json:"token_type,omitempty"`
+	ExpiresAt  int64  `json:"exp,omitempty"`
+	IssuedAt   int64  `json:"iat,omitempty"`
+	NotBefore  int64  `json:"nbf,omitempty"`
+	Subject    string `json:"sub,omitempty"`
+	Issuer     string `json:"iss,omitempty"`
+	JWTID      string `json:"jti,omitempty"`
+	TerminalID string `json:"terminal_id,omitempty"`
+}
+
+// OAuth2DeviceGetResponse is used by the web front-end to display
+// the details of a device authorization request to the end-user.
+type OAuth2DeviceGetResponse struct {
+	ClientID          string `json:"client_id"`
+	ClientDisplayName string `json:"client_display_name,omitempty"`
+	Scope             string `json:"scope,omitempty"`
+	// The remaining lifetime of the request in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
@@ -0,0 +1,86 @@
+package iam
+
+import (
+	"net"
+	"strings"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// trustedProxyList holds the networks of the reverse proxies whose
+// X-Forwarded-For header is honored.
+type trustedProxyList []*net.IPNet
+
+// parseTrustedProxyList parses a comma-separated list of IP addresses
+// and CIDR ranges.
+func parseTrustedProxyList(s string) (trustedProxyList, error) {
+	var proxies trustedProxyList
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, errors.ArgMsg("s", "invalid address: "+entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, errors.Arg("s", err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func (proxies trustedProxyList) contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range proxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveOriginAddress returns the IP address of the client which made
+// the call. The X-Forwarded-For entries are walked from the nearest hop,
+// i.e., the last entry, as long as the hops are trusted proxies; the
+// entries added by the client itself are never reached.
+func (proxies trustedProxyList) resolveOriginAddress(
+	peerAddr string,
+	forwardedFor []string,
+) string {
+	addr := peerAddr
+	if host, _, err := net.SplitHostPort(peerAddr); err == nil {
+		addr = host
+	}
+	if len(proxies) == 0 {
+		return addr
+	}
+
+	var hops []string
+	for _, headerValue := range forwardedFor {
+		for _, hop := range strings.Split(headerValue, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0 && proxies.contains(addr); i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		addr = hops[i]
+	}
+	return addr
+}
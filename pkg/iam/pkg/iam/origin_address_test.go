@@ -0,0 +1,41 @@
+package iam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxyListResolveOriginAddress(t *testing.T) {
+	proxies, err := parseTrustedProxyList("10.0.0.0/8, 192.0.2.1")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	testCases := []struct {
+		peerAddr     string
+		forwardedFor []string
+		expected     string
+	}{
+		// Not through a trusted proxy; the header is ignored.
+		{"198.51.100.7:5000", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"10.1.2.3:5000", nil, "10.1.2.3"},
+		{"10.1.2.3:5000", []string{"203.0.113.9"}, "203.0.113.9"},
+		// The entries added before the trusted proxies are not honored.
+		{"10.1.2.3:5000", []string{"198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{"10.1.2.3:5000", []string{"198.51.100.1, 203.0.113.9", "192.0.2.1"}, "203.0.113.9"},
+		{"10.1.2.3:5000", []string{"10.4.5.6"}, "10.4.5.6"},
+		{"10.1.2.3:5000", []string{"garbage"}, "10.1.2.3"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected,
+			proxies.resolveOriginAddress(testCase.peerAddr, testCase.forwardedFor),
+			"%s %v", testCase.peerAddr, testCase.forwardedFor)
+	}
+
+	assert.Equal(t, "10.1.2.3",
+		trustedProxyList(nil).resolveOriginAddress("10.1.2.3:5000", []string{"203.0.113.9"}))
+
+	_, err = parseTrustedProxyList("10.0.0.0/8,not-an-address")
+	assert.NotNil(t, err)
+}
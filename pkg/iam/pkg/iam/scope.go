@@ -0,0 +1,133 @@
+package iam
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	oidc "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/openid/connect"
+)
+
+var (
+	// ErrScopeInvalid is returned when a requested scope is malformed,
+	// unknown, or not allowed to be requested by the application.
+	ErrScopeInvalid = errors.EntMsg("scope", "invalid")
+)
+
+// ScopeApplicationsManage grants access to the application management
+// API. It's not a public scope; the application has to list it in
+// its RequiredScopes. The scope is honored only for the service
+// applications authenticated with their client credentials; it's never
+// honored for the users of the application.
+const ScopeApplicationsManage = "iam.applications.manage"
+
+// ScopeDefinition describes a scope recognized by the IAM service.
+type ScopeDefinition struct {
+	Name        string
+	Description string
+	// Public scopes might be requested by any application. Other scopes
+	// might only be requested by the applications which list them in
+	// their RequiredScopes.
+	Public bool
+}
+
+// ScopeRegistry holds the definitions of the scopes recognized by
+// the IAM service. A registry is not safe for concurrent registrations;
+// all the scopes should be registered during the initialization.
+type ScopeRegistry struct {
+	definitions map[string]ScopeDefinition
+}
+
+// NewScopeRegistry creates a registry which contains the scopes
+// defined by OpenID Connect.
+func NewScopeRegistry() *ScopeRegistry {
+	reg := &ScopeRegistry{definitions: map[string]ScopeDefinition{}}
+	for _, def := range []ScopeDefinition{
+		{Name: oidc.ScopeOpenID, Description: "Sign you in", Public: true},
+		{Name: oidc.ScopeProfile, Description: "View your basic profile", Public: true},
+		{Name: oidc.ScopeEmail, Description: "View your email address", Public: true},
+		{Name: oidc.ScopeAddress, Description: "View your address", Public: true},
+		{Name: oidc.ScopePhone, Description: "View your phone number", Public: true},
+		{Name: ScopeApplicationsManage, Description: "Manage the registered applications"},
+	} {
+		reg.definitions[def.Name] = def
+	}
+	return reg
+}
+
+// Register adds a scope definition into the registry. A scope could
+// only be registered once.
+func (reg *ScopeRegistry) Register(def ScopeDefinition) error {
+	if !oauth2.IsScopeTokenValid(def.Name) {
+		return errors.Arg("def", errors.EntMsg("Name", "invalid"))
+	}
+	if _, exists := reg.definitions[def.Name]; exists {
+		return errors.Arg("def", errors.EntMsg("Name", "already registered"))
+	}
+	reg.definitions[def.Name] = def
+	return nil
+}
+
+// Get returns the definition of the scope. It returns nil if the scope
+// is not registered.
+func (reg *ScopeRegistry) Get(scopeName string) *ScopeDefinition {
+	if def, ok := reg.definitions[scopeName]; ok {
+		return &def
+	}
+	return nil
+}
+
+// ResolveApplicationScope validates the scope requested by an application
+// and returns the scope which should be granted. If the request does not
+// specify any scope, the application's RequiredScopes will be granted.
+// RFC 6749 § 3.3.
+//
+// A scope could be requested by the application if it's a public scope
+// or if it's listed in the application's RequiredScopes. The method
+// returns ErrScopeInvalid otherwise.
+func (reg *ScopeRegistry) ResolveApplicationScope(
+	app *Application,
+	requestedScope string,
+) (grantedScope string, err error) {
+	if app == nil {
+		return "", errors.ArgMsg("app", "missing")
+	}
+
+	scopeTokens := oauth2.ParseScope(requestedScope)
+	if len(scopeTokens) == 0 {
+		return oauth2.FormatScope(app.Attributes.RequiredScopes), nil
+	}
+
+	granted := make([]string, 0, len(scopeTokens))
+	for _, s := range scopeTokens {
+		if !oauth2.IsScopeTokenValid(s) {
+			return "", ErrScopeInvalid
+		}
+		if !reg.isScopeAllowedForApplication(app, s) {
+			return "", ErrScopeInvalid
+		}
+		if !scopeListContains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return oauth2.FormatScope(granted), nil
+}
+
+func (reg *ScopeRegistry) isScopeAllowedForApplication(
+	app *Application,
+	scopeName string,
+) bool {
+	if def := reg.Get(scopeName); def != nil && def.Public {
+		return true
+	}
+	return scopeListContains(app.Attributes.RequiredScopes, scopeName)
+}
+
+func scopeListContains(scopeList []string, scopeName string) bool {
+	for _, s := range scopeList {
+		if s == scopeName {
+			return true
+		}
+	}
+	return false
+}
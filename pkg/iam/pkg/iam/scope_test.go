@@ -0,0 +1,49 @@
+package iam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeRegistryResolveApplicationScope(t *testing.T) {
+	reg := NewScopeRegistry()
+	assert.Nil(t, reg.Register(ScopeDefinition{Name: "orders.read"}))
+	assert.Nil(t, reg.Register(ScopeDefinition{Name: "orders.write"}))
+	assert.NotNil(t, reg.Register(ScopeDefinition{Name: "orders.read"}), "duplicate")
+	assert.NotNil(t, reg.Register(ScopeDefinition{Name: "orders read"}), "malformed")
+
+	app := &Application{
+		Attributes: ApplicationData{
+			RequiredScopes: []string{"orders.read"},
+		},
+	}
+
+	testCases := []struct {
+		requested string
+		granted   string
+		err       error
+		label     string
+	}{
+		{"", "orders.read", nil, "default"},
+		{"openid profile", "openid profile", nil, "public"},
+		{"openid orders.read openid", "openid orders.read", nil, "duplicate"},
+		{"orders.write", "", ErrScopeInvalid, "not allowed"},
+		{"unknown", "", ErrScopeInvalid, "unknown"},
+		{"orders\\read", "", ErrScopeInvalid, "malformed"},
+	}
+
+	for _, testCase := range testCases {
+		granted, err := reg.ResolveApplicationScope(app, testCase.requested)
+		assert.Equal(t, testCase.err, err, testCase.label)
+		assert.Equal(t, testCase.granted, granted, testCase.label)
+	}
+}
+
+func TestAuthorizationRequireScopes(t *testing.T) {
+	authz := Authorization{Scope: []string{"openid", "orders.read"}}
+	assert.Equal(t, true, authz.HasScope("orders.read"))
+	assert.Equal(t, false, authz.HasScope("orders.write"))
+	// Not statically valid as it has no session
+	assert.Equal(t, ErrAuthorizationInvalid, authz.RequireScopes("orders.read"))
+}
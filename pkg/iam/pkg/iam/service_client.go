@@ -77,8 +77,9 @@ type ServiceClientAuth interface {
 }
 
 const (
-	serverOAuth2JWKSRelPath  = "/oauth2/jwks"
-	serverOAuth2TokenRelPath = "/oauth2/token"
+	serverOAuth2JWKSRelPath       = "/oauth2/jwks"
+	serverOAuth2TokenRelPath      = "/oauth2/token"
+	serverOAuth2IntrospectRelPath = "/oauth2/introspect"
 )
 
 func NewServiceClientSimple(
@@ -96,6 +97,10 @@ func NewServiceClientSimple(
 	if err != nil {
 		return nil, errors.Wrap("jwt key set loading", err)
 	}
+	// Keep the keys up to date as the IAM server rotates its keys.
+	jwtKeyChain.StartJWKSetRefresher(func(err error) {
+		log.Warn().Err(err).Str("url", jwksURL).Msg("JWK set refresh")
+	})
 
 	userInstanceInfoService := &UserInstanceInfoServiceClientCore{}
 
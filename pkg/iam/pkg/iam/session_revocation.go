@@ -0,0 +1,222 @@
+package iam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// SessionRevocationChecker is an abstraction for a service which is able
+// to tell whether a session has been revoked.
+//
+// A session is considered revoked if it has been deleted, or if the
+// terminal it was created for has been deleted.
+type SessionRevocationChecker interface {
+	// IsSessionRevoked returns true if the session identified by
+	// sessionID has been revoked. Unknown sessions are considered
+	// revoked.
+	IsSessionRevoked(sessionID SessionID) (revoked bool, err error)
+}
+
+// SessionTokenRevocationChecker is implemented by the checkers which
+// need the access token itself to tell whether its session has been
+// revoked, e.g., those which ask the IAM server through its token
+// introspection endpoint. The consumer servers prefer this method
+// over IsSessionRevoked when the checker implements it.
+type SessionTokenRevocationChecker interface {
+	SessionRevocationChecker
+
+	// IsSessionTokenRevoked returns true if the session identified by
+	// sessionID, which was issued the access token, has been revoked.
+	IsSessionTokenRevoked(
+		sessionID SessionID,
+		accessToken string,
+	) (revoked bool, err error)
+}
+
+// SessionRevocationCheckerCacheTTLDefault is the default duration
+// a non-revoked session status will be kept in the cache.
+const SessionRevocationCheckerCacheTTLDefault = 30 * time.Second
+
+const sessionRevocationCheckerCacheSizeDefault = 4096
+
+// NewSessionRevocationCheckerCache creates a SessionRevocationChecker which
+// caches the results from the backing checker.
+//
+// As a revocation is permanent, a revoked status will be kept until it's
+// evicted from the cache. A non-revoked status will be kept for the
+// duration of ttl, which is the upper bound of the delay of a revocation
+// to take effect. If ttl is zero, SessionRevocationCheckerCacheTTLDefault
+// will be used.
+func NewSessionRevocationCheckerCache(
+	backend SessionRevocationChecker,
+	size int,
+	ttl time.Duration,
+) (SessionRevocationChecker, error) {
+	if backend == nil {
+		return nil, errors.ArgMsg("backend", "missing")
+	}
+	if ttl == 0 {
+		ttl = SessionRevocationCheckerCacheTTLDefault
+	}
+	cache, err := lru.NewARC(size)
+	if err != nil {
+		return nil, errors.ArgWrap("size", "cache initialization", err)
+	}
+	return &sessionRevocationCheckerCache{
+		backend: backend,
+		cache:   cache,
+		ttl:     ttl,
+	}, nil
+}
+
+type sessionRevocationCheckerCache struct {
+	backend SessionRevocationChecker
+	cache   *lru.ARCCache
+	ttl     time.Duration
+}
+
+var _ SessionTokenRevocationChecker = &sessionRevocationCheckerCache{}
+
+type sessionRevocationCacheEntry struct {
+	revoked   bool
+	checkTime time.Time
+}
+
+func (checker *sessionRevocationCheckerCache) IsSessionRevoked(
+	sessionID SessionID,
+) (revoked bool, err error) {
+	return checker.isSessionRevoked(sessionID, func() (bool, error) {
+		return checker.backend.IsSessionRevoked(sessionID)
+	})
+}
+
+// IsSessionTokenRevoked conforms SessionTokenRevocationChecker. The token
+// is passed to the backend if it's a SessionTokenRevocationChecker.
+func (checker *sessionRevocationCheckerCache) IsSessionTokenRevoked(
+	sessionID SessionID,
+	accessToken string,
+) (revoked bool, err error) {
+	return checker.isSessionRevoked(sessionID, func() (bool, error) {
+		if backend, ok := checker.backend.(SessionTokenRevocationChecker); ok {
+			return backend.IsSessionTokenRevoked(sessionID, accessToken)
+		}
+		return checker.backend.IsSessionRevoked(sessionID)
+	})
+}
+
+func (checker *sessionRevocationCheckerCache) isSessionRevoked(
+	sessionID SessionID,
+	check func() (revoked bool, err error),
+) (revoked bool, err error) {
+	cacheKey := sessionID.AZIDText()
+	if v, ok := checker.cache.Get(cacheKey); ok {
+		if entry, ok := v.(sessionRevocationCacheEntry); ok {
+			if entry.revoked || time.Since(entry.checkTime) < checker.ttl {
+				return entry.revoked, nil
+			}
+		}
+	}
+
+	revoked, err = check()
+	if err != nil {
+		return false, err
+	}
+
+	checker.cache.Add(cacheKey, sessionRevocationCacheEntry{
+		revoked:   revoked,
+		checkTime: time.Now(),
+	})
+
+	return revoked, nil
+}
+
+const sessionRevocationCheckTimeout = 10 * time.Second
+
+// NewSessionRevocationCheckerRemote creates a SessionTokenRevocationChecker
+// which asks the IAM server, through its token introspection endpoint
+// (RFC 7662), whether the sessions of the access tokens have been
+// revoked. The client must be a service application. The checker makes
+// a request for every check; wrap it with NewSessionRevocationCheckerCache
+// to limit the requests.
+func NewSessionRevocationCheckerRemote(
+	serviceClientConfig ServiceClientConfig,
+) (SessionTokenRevocationChecker, error) {
+	if !strings.HasPrefix(serviceClientConfig.ServerBaseURL, "http") {
+		return nil, errors.ArgMsg("serviceClientConfig.ServerBaseURL", "invalid")
+	}
+	if serviceClientConfig.Credentials.ClientID == "" {
+		return nil, errors.ArgMsg("serviceClientConfig.Credentials.ClientID", "empty")
+	}
+	return &sessionRevocationCheckerRemote{
+		introspectionEndpointURL: serviceClientConfig.ServerBaseURL +
+			serverOAuth2IntrospectRelPath,
+		credentials: serviceClientConfig.Credentials,
+		httpClient:  &http.Client{Timeout: sessionRevocationCheckTimeout},
+	}, nil
+}
+
+type sessionRevocationCheckerRemote struct {
+	introspectionEndpointURL string
+	credentials              ServiceClientCredentials
+	httpClient               *http.Client
+}
+
+var _ SessionTokenRevocationChecker = &sessionRevocationCheckerRemote{}
+
+// IsSessionRevoked always returns an error as the introspection endpoint
+// requires the token; use IsSessionTokenRevoked instead.
+func (checker *sessionRevocationCheckerRemote) IsSessionRevoked(
+	sessionID SessionID,
+) (revoked bool, err error) {
+	return false, errors.New("the remote session revocation check requires the access token")
+}
+
+func (checker *sessionRevocationCheckerRemote) IsSessionTokenRevoked(
+	sessionID SessionID,
+	accessToken string,
+) (revoked bool, err error) {
+	if accessToken == "" {
+		return false, errors.ArgMsg("accessToken", "empty")
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		checker.introspectionEndpointURL,
+		strings.NewReader(url.Values{
+			"token":           {accessToken},
+			"token_type_hint": {"access_token"},
+		}.Encode()))
+	if err != nil {
+		return false, errors.Wrap("request creation", err)
+	}
+	req.SetBasicAuth(
+		checker.credentials.ClientID,
+		checker.credentials.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := checker.httpClient.Do(req)
+	if err != nil {
+		return false, errors.Wrap("introspection request", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.New("introspection response status: " + resp.Status)
+	}
+
+	var introspection OAuth2TokenIntrospectionResponse
+	err = json.NewDecoder(resp.Body).Decode(&introspection)
+	if err != nil {
+		return false, errors.Wrap("introspection response decoding", err)
+	}
+
+	// The token has been verified by the consumer; an inactive token
+	// means that its session, or its terminal, has been revoked.
+	return !introspection.Active, nil
+}
@@ -0,0 +1,97 @@
+package iam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type introspectionTestServer struct {
+	mutex        sync.Mutex
+	active       bool
+	requestCount int
+}
+
+func (srv *introspectionTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	srv.requestCount++
+	if r.URL.Path != serverOAuth2IntrospectRelPath {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if clientID, clientSecret, ok := r.BasicAuth(); !ok ||
+		clientID != "svc" || clientSecret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("token") != "token-a" {
+		json.NewEncoder(w).Encode(OAuth2TokenIntrospectionResponse{})
+		return
+	}
+	json.NewEncoder(w).Encode(OAuth2TokenIntrospectionResponse{
+		Active: srv.active,
+	})
+}
+
+func TestSessionRevocationCheckerRemote(t *testing.T) {
+	sessionID := NewSessionID(
+		NewTerminalID(NewApplicationID(ApplicationIDNum(0x7fff0001)),
+			NewUserID(UserIDNum(0x10203040)), TerminalIDNum(0x01020304)),
+		SessionIDNum(0x0a0b))
+
+	introspectionSrv := &introspectionTestServer{active: true}
+	httpSrv := httptest.NewServer(introspectionSrv)
+	defer httpSrv.Close()
+
+	remoteChecker, err := NewSessionRevocationCheckerRemote(ServiceClientConfig{
+		ServerBaseURL: httpSrv.URL,
+		Credentials: ServiceClientCredentials{
+			ClientID:     "svc",
+			ClientSecret: "secret",
+		},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	revoked, err := remoteChecker.IsSessionTokenRevoked(sessionID, "token-a")
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+
+	// Unknown tokens are inactive.
+	revoked, err = remoteChecker.IsSessionTokenRevoked(sessionID, "token-b")
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+
+	// The token is required.
+	_, err = remoteChecker.IsSessionRevoked(sessionID)
+	assert.NotNil(t, err)
+
+	cachedChecker, err := NewSessionRevocationCheckerCache(remoteChecker, 16, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	tokenChecker, ok := cachedChecker.(SessionTokenRevocationChecker)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	introspectionSrv.mutex.Lock()
+	introspectionSrv.requestCount = 0
+	introspectionSrv.mutex.Unlock()
+
+	for i := 0; i < 3; i++ {
+		revoked, err = tokenChecker.IsSessionTokenRevoked(sessionID, "token-a")
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+	}
+
+	introspectionSrv.mutex.Lock()
+	defer introspectionSrv.mutex.Unlock()
+	assert.Equal(t, 1, introspectionSrv.requestCount)
+}
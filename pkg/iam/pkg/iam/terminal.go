@@ -21,6 +21,12 @@ const (
 	TerminalVerificationResourceTypeOAuthAuthorizationCode = "oauth2-authorization-code"
 	TerminalVerificationResourceTypeOAuthClientCredentials = "oauth2-client-credentials"
 	TerminalVerificationResourceTypeOAuthPassword          = "oauth2-password"
+	TerminalVerificationResourceTypeOAuthDeviceCode        = "oauth2-device-code"
+
+	// TerminalVerificationResourceTypeWebAuthn is for the terminals
+	// authorized with a WebAuthn assertion, i.e., a passkey. The
+	// verification ID refers to the user's credential.
+	TerminalVerificationResourceTypeWebAuthn = "webauthn"
 )
 
 var (
@@ -30,6 +36,8 @@ var (
 	ErrTerminalVerificationResourceConflict = errors.EntMsg("terminal verification resource", "conflict")
 
 	ErrTerminalVerificationResourceNameInvalid = errors.Ent("terminal verification resource name", nil)
+
+	ErrTerminalCredentialsInvalid = errors.EntMsg("terminal credentials", "invalid")
 )
 
 type TerminalInfo struct {
@@ -11,10 +11,16 @@ type UserServiceInternal interface {
 
 	UserKeyPhoneNumberService
 	UserKeyEmailAddressService
+	UserKeyUsernameService
 }
 
 var (
 	ErrUserKeyPhoneNumberConflict = errors.EntMsg("user key phone number", "conflict")
+	ErrUserKeyUsernameConflict    = errors.EntMsg("user key username", "conflict")
+
+	ErrUserPasswordResetTokenInvalid = errors.EntMsg("password reset token", "invalid")
+	ErrUserPasswordResetTokenExpired = errors.EntMsg("password reset token", "expired")
+	ErrUserPasswordResetCodeMismatch = errors.EntMsg("password reset code", "mismatch")
 )
 
 type UserKeyPhoneNumber struct {
@@ -36,3 +42,66 @@ type UserPhoneNumberListJSONV1 struct {
 type UserContactListsJSONV1 struct {
 	Items []UserJSONV1 `json:"items"`
 }
+
+// UserGrantedApplicationJSONV1 describes an application the user
+// has authorized through the authorization endpoint.
+type UserGrantedApplicationJSONV1 struct {
+	ApplicationID     string   `json:"application_id"`
+	DisplayName       string   `json:"display_name,omitempty"`
+	Scope             string   `json:"scope,omitempty"`
+	ScopeDescriptions []string `json:"scope_descriptions,omitempty"`
+	GrantTime         string   `json:"grant_time"`
+}
+
+type UserGrantedApplicationListJSONV1 struct {
+	Items []UserGrantedApplicationJSONV1 `json:"items"`
+}
+
+// UserPasskeyJSONV1 describes a WebAuthn credential, i.e., a passkey,
+// of the user.
+type UserPasskeyJSONV1 struct {
+	// ID is the base64url-encoded credential ID, the same as the id of
+	// the PublicKeyCredential.
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	// Synced is true for the passkeys which are synced among the user's
+	// devices.
+	Synced       bool   `json:"synced"`
+	CreationTime string `json:"creation_time"`
+	LastUseTime  string `json:"last_use_time,omitempty"`
+}
+
+type UserPasskeyListJSONV1 struct {
+	Items []UserPasskeyJSONV1 `json:"items"`
+}
+
+// UserTerminalJSONV1 describes a terminal, e.g., a device, which
+// the user is signed in with.
+type UserTerminalJSONV1 struct {
+	TerminalID             string `json:"terminal_id"`
+	DisplayName            string `json:"display_name,omitempty"`
+	ApplicationID          string `json:"application_id"`
+	ApplicationDisplayName string `json:"application_display_name,omitempty"`
+	VerificationType       string `json:"verification_type"`
+	AcceptLanguage         string `json:"accept_language,omitempty"`
+	CreationTime           string `json:"creation_time"`
+	// CreationOriginAddress is the IP address the terminal was
+	// registered from.
+	CreationOriginAddress string `json:"creation_origin_address,omitempty"`
+	// CreationOriginEnv is the user agent the terminal was
+	// registered with.
+	CreationOriginEnv string `json:"creation_origin_env,omitempty"`
+	LastUseTime       string `json:"last_use_time,omitempty"`
+	// LastUseOriginAddress is the IP address the terminal was
+	// last used from.
+	LastUseOriginAddress string `json:"last_use_origin_address,omitempty"`
+	// LastUseOriginEnv is the user agent the terminal was last
+	// used with.
+	LastUseOriginEnv string `json:"last_use_origin_env,omitempty"`
+	// Current is true for the terminal which made the request.
+	Current bool `json:"current"`
+}
+
+type UserTerminalListJSONV1 struct {
+	Items []UserTerminalJSONV1 `json:"items"`
+}
@@ -0,0 +1,16 @@
+package iam
+
+// A key username is a username that can be used as the identifier
+// for logging in by the specified user. Unlike email addresses and phone
+// numbers, usernames don't need verification.
+
+// UserKeyUsernameService provides a contract
+// for methods related to UserKeyUsername.
+type UserKeyUsernameService interface {
+	// GetUserKeyUsername returns the username of the user as the user
+	// provided it, or an empty string if the user has not set one.
+	GetUserKeyUsername(
+		inputCtx CallInputContext,
+		userID UserID,
+	) (string, error)
+}
@@ -59,6 +59,7 @@ type UserDataJSONV1 struct {
 	ProfileImageURL string `json:"profile_image_url"`
 	PhoneNumber     string `json:"phone_number,omitempty"`
 	EmailAddress    string `json:"email_address,omitempty"`
+	Username        string `json:"username,omitempty"`
 }
 
 func UserDataJSONV1FromBaseProfile(model *UserBaseProfileData) *UserDataJSONV1 {
@@ -2,4 +2,7 @@ package iam
 
 type WebUIURLs struct {
 	SignIn string `env:"SIGNIN"`
+	// DeviceVerification is the URL of the page where end-users enter
+	// the user code to approve a device authorization request. RFC 8628.
+	DeviceVerification string `env:"DEVICE_VERIFICATION"`
 }
@@ -171,6 +171,9 @@ func resolveConfig(cfg *Config) {
 	if cfg.WebUI.URLs.SignIn == "" {
 		cfg.WebUI.URLs.SignIn = cfg.WebUI.Server.ServePath + "signin"
 	}
+	if cfg.WebUI.URLs.DeviceVerification == "" {
+		cfg.WebUI.URLs.DeviceVerification = cfg.WebUI.Server.ServePath + "device"
+	}
 
 	if cfg.REST == nil {
 		cfg.REST = &rest.ServerConfig{}
@@ -181,6 +184,12 @@ func resolveConfig(cfg *Config) {
 	if cfg.RESTCanonicalBaseURL == "" {
 		cfg.RESTCanonicalBaseURL = cfg.REST.ServePath + rest.ServerLatestVersionString + "/"
 	}
+	if cfg.REST.V1 == nil {
+		cfg.REST.V1 = &rest.ServerV1Config{}
+	}
+	if cfg.REST.V1.CanonicalBaseURL == "" {
+		cfg.REST.V1.CanonicalBaseURL = cfg.RESTCanonicalBaseURL
+	}
 
 	if cfg.Core.EAV.ResourcesDir == "" {
 		cfg.Core.EAV.ResourcesDir = "resources/iam-pnv10n-resources"
@@ -195,6 +204,21 @@ type App struct {
 // RealmInfo returns information about the realm of the app.
 func (srvApp App) RealmInfo() realm.Info { return srvApp.core.RealmInfo() }
 
+// Run runs the servers and closes the app once they have been stopped.
+func (srvApp *App) Run() {
+	srvApp.App.Run()
+	if err := srvApp.Close(); err != nil {
+		log.Error().Err(err).Msg("App closing")
+	}
+}
+
+// Close stops the background jobs of the IAM server core. The apps
+// created with NewWithCombinedHTTPServers should call it once their
+// servers have been stopped.
+func (srvApp *App) Close() error {
+	return srvApp.core.Close()
+}
+
 func (srvApp *App) initServers(appBase app.App, cfg Config) error {
 	iamServerCore := srvApp.core
 
@@ -3,7 +3,9 @@ package iamserver
 import (
 	"encoding/csv"
 	"errors"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
@@ -23,7 +25,13 @@ func newApplicationStaticDataProviderFromCSVFileByName(
 	}
 	defer csvFile.Close()
 
-	rows, err := csv.NewReader(csvFile).ReadAll()
+	return newApplicationStaticDataProviderFromCSV(csvFile, skipRows)
+}
+
+func newApplicationStaticDataProviderFromCSV(
+	csvReader io.Reader, skipRows int,
+) (*applicationStaticDataProvider, error) {
+	rows, err := csv.NewReader(csvReader).ReadAll()
 	if err != nil {
 		//TODO: translate errors
 		return nil, err
@@ -38,6 +46,7 @@ func newApplicationStaticDataProviderFromCSVFileByName(
 	platformTypeIdx := -1
 	requiredScopesIdx := -1
 	oauth2RedirectURIIdx := -1
+	oauth2PKCERequiredIdx := -1
 
 	for idx, key := range rows[0] {
 		switch key {
@@ -51,6 +60,8 @@ func newApplicationStaticDataProviderFromCSVFileByName(
 			requiredScopesIdx = idx
 		case "oauth2_redirect_uri":
 			oauth2RedirectURIIdx = idx
+		case "oauth2_pkce_required":
+			oauth2PKCERequiredIdx = idx
 		}
 	}
 
@@ -105,13 +116,36 @@ func newApplicationStaticDataProviderFromCSVFileByName(
 			}
 		}
 
+		var secrets []iam.ApplicationSecret
+		for _, secretStr := range strings.Fields(indexexdValue(r, secretIdx)) {
+			if !isApplicationSecretHash(secretStr) {
+				log.Warn().Str("application_id", clID.AZIDText()).
+					Msg("Application secret is stored in plain text. " +
+						"Replace it with the hash as generated by the app-id-gen tool.")
+				secretStr, err = HashApplicationSecret(secretStr)
+				if err != nil {
+					return nil, err
+				}
+			}
+			secrets = append(secrets, iam.ApplicationSecret{Hash: secretStr})
+		}
+
+		var pkceRequired bool
+		if pkceRequiredStr := indexexdValue(r, oauth2PKCERequiredIdx); pkceRequiredStr != "" {
+			pkceRequired, err = strconv.ParseBool(strings.TrimSpace(pkceRequiredStr))
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		//TODO: validate platform type with clID
 		clList[clID] = &iam.ApplicationData{
-			DisplayName:       indexexdValue(r, displayNameIdx),
-			Secret:            indexexdValue(r, secretIdx),
-			PlatformType:      indexexdValue(r, platformTypeIdx),
-			RequiredScopes:    requiredScopes,
-			OAuth2RedirectURI: redirectURIs,
+			DisplayName:        indexexdValue(r, displayNameIdx),
+			Secrets:            secrets,
+			PlatformType:       indexexdValue(r, platformTypeIdx),
+			RequiredScopes:     requiredScopes,
+			OAuth2RedirectURI:  redirectURIs,
+			OAuth2PKCERequired: pkceRequired,
 		}
 	}
 
@@ -0,0 +1,307 @@
+package iamserver
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// applicationDBDataProvider is an iam.ApplicationDataProvider which
+// loads the applications from the database.
+type applicationDBDataProvider struct {
+	db *sqlx.DB
+}
+
+var _ iam.ApplicationDataProvider = &applicationDBDataProvider{}
+
+// errApplicationDeleted is returned by applicationDBDataProvider for
+// the applications which have been registered but then deleted, e.g.,
+// disabled. It tells them apart from those which have never been
+// registered.
+var errApplicationDeleted = errors.EntMsg("application", "deleted")
+
+func (provider *applicationDBDataProvider) GetApplication(
+	appID iam.ApplicationID,
+) (*iam.Application, error) {
+	var appData iam.ApplicationData
+	var deletionTime *time.Time
+	sqlString, _, _ := goqu.
+		From(applicationDBTableName).
+		Select(
+			"display_name", "platform_type",
+			"required_scopes", "oauth2_redirect_uri", "oauth2_pkce_required",
+			applicationDBColMDDeletionTimestamp).
+		Where(
+			goqu.C(applicationDBColIDNum).Eq(appID.IDNum().PrimitiveValue()),
+		).
+		ToSQL()
+	err := provider.db.
+		QueryRow(sqlString).
+		Scan(
+			&appData.DisplayName, &appData.PlatformType,
+			pq.Array(&appData.RequiredScopes), pq.Array(&appData.OAuth2RedirectURI),
+			&appData.OAuth2PKCERequired, &deletionTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if deletionTime != nil {
+		return nil, errApplicationDeleted
+	}
+
+	appData.Secrets, err = getApplicationSecrets(provider.db, appID)
+	if err != nil {
+		return nil, errors.Wrap("getApplicationSecrets", err)
+	}
+
+	return &iam.Application{ID: appID, Attributes: appData}, nil
+}
+
+const applicationSecretDBTableName = "application_secret_dt"
+
+// getApplicationSecrets loads the secrets of the application which have
+// not been deleted. The expired secrets are included.
+func getApplicationSecrets(
+	db sqlx.Queryer,
+	appID iam.ApplicationID,
+) ([]iam.ApplicationSecret, error) {
+	sqlString, _, _ := goqu.
+		From(applicationSecretDBTableName).
+		Select("secret_hash", "expiry_ts").
+		Where(
+			goqu.C("application_id").Eq(appID.IDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		ToSQL()
+	rows, err := db.Query(sqlString)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []iam.ApplicationSecret
+	for rows.Next() {
+		var secret iam.ApplicationSecret
+		var expiryTime *time.Time
+		if err = rows.Scan(&secret.Hash, &expiryTime); err != nil {
+			return nil, err
+		}
+		if expiryTime != nil {
+			secret.ExpiryTime = *expiryTime
+		}
+		secrets = append(secrets, secret)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// applicationDataProviderChain looks up the applications from each of
+// the providers in order, returning the first one found. The look up
+// stops at the provider which tells that the application has been
+// deleted so that the application can't be revived by the providers
+// down the chain, e.g., the legacy CSV data.
+type applicationDataProviderChain []iam.ApplicationDataProvider
+
+var _ iam.ApplicationDataProvider = applicationDataProviderChain{}
+
+func (providers applicationDataProviderChain) GetApplication(
+	appID iam.ApplicationID,
+) (*iam.Application, error) {
+	for _, provider := range providers {
+		app, err := provider.GetApplication(appID)
+		if err == errApplicationDeleted {
+			return nil, nil
+		}
+		if err != nil || app != nil {
+			return app, err
+		}
+	}
+	return nil, nil
+}
+
+// ImportApplicationsFromCSVFileByName imports the applications defined
+// in a CSV file, in the format of the legacy clients.csv, into
+// the database. Applications which have already been registered are
+// skipped unless they have no active secrets, in which case the secrets
+// from the file are imported.
+func ImportApplicationsFromCSVFileByName(
+	db *sqlx.DB,
+	filename string,
+) (importedIDs []iam.ApplicationID, err error) {
+	staticProvider, err := newApplicationStaticDataProviderFromCSVFileByName(
+		filename, 1)
+	if err != nil {
+		return nil, errors.Wrap("CSV file loading", err)
+	}
+
+	for appID, appData := range staticProvider.applications {
+		imported, err := importApplication(db, appID, appData)
+		if err != nil {
+			return importedIDs, errors.Wrap("importApplication", err)
+		}
+		if imported {
+			importedIDs = append(importedIDs, appID)
+		}
+	}
+
+	return importedIDs, nil
+}
+
+// importApplication inserts the application if it has not been
+// registered. The secrets are inserted if the application has no
+// active secrets, e.g., those registered before the secrets were
+// stored in the database.
+func importApplication(
+	db *sqlx.DB,
+	appID iam.ApplicationID,
+	appData *iam.ApplicationData,
+) (imported bool, err error) {
+	err = doTx(db, func(dbTx *sqlx.Tx) error {
+		sqlString, _, _ := goqu.
+			Insert(applicationDBTableName).
+			Rows(
+				goqu.Record{
+					applicationDBColIDNum:  appID.IDNum().PrimitiveValue(),
+					"display_name":         appData.DisplayName,
+					"platform_type":        appData.PlatformType,
+					"required_scopes":      pq.Array(nonNilStrings(appData.RequiredScopes)),
+					"oauth2_redirect_uri":  pq.Array(nonNilStrings(appData.OAuth2RedirectURI)),
+					"oauth2_pkce_required": appData.OAuth2PKCERequired,
+				},
+			).
+			OnConflict(goqu.DoNothing()).
+			ToSQL()
+		xres, txErr := dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("application insert", txErr)
+		}
+		n, txErr := xres.RowsAffected()
+		if txErr != nil {
+			return errors.Wrap("application insert", txErr)
+		}
+
+		existingSecrets, txErr := getApplicationSecrets(dbTx, appID)
+		if txErr != nil {
+			return errors.Wrap("getApplicationSecrets", txErr)
+		}
+		if len(existingSecrets) > 0 {
+			imported = n == 1
+			return nil
+		}
+
+		for _, secret := range appData.Secrets {
+			sqlString, _, _ = goqu.
+				Insert(applicationSecretDBTableName).
+				Rows(
+					goqu.Record{
+						"application_id": appID.IDNum().PrimitiveValue(),
+						"secret_hash":    secret.Hash,
+					},
+				).
+				ToSQL()
+			_, txErr = dbTx.Exec(sqlString)
+			if txErr != nil {
+				return errors.Wrap("secret insert", txErr)
+			}
+		}
+		imported = n == 1 || len(appData.Secrets) > 0
+		return nil
+	})
+	return imported, err
+}
+
+// hashApplicationPlaintextSecrets moves the plain-text secrets which
+// were stored in application_dt before the secrets were hashed into
+// application_secret_dt. It's safe to be called by more than one
+// server at the same time.
+func hashApplicationPlaintextSecrets(
+	db *sqlx.DB,
+) (hashedIDNums []iam.ApplicationIDNum, err error) {
+	err = doTx(db, func(dbTx *sqlx.Tx) error {
+		sqlString, _, _ := goqu.
+			From(applicationDBTableName).
+			Select(applicationDBColIDNum, "secret_plaintext").
+			Where(
+				goqu.C("secret_plaintext").Neq(""),
+			).
+			ForUpdate(goqu.Wait).
+			ToSQL()
+		rows, txErr := dbTx.Query(sqlString)
+		if txErr != nil {
+			return errors.Wrap("select", txErr)
+		}
+		secrets := map[iam.ApplicationIDNum]string{}
+		for rows.Next() {
+			var idNum iam.ApplicationIDNum
+			var secret string
+			if txErr = rows.Scan(&idNum, &secret); txErr != nil {
+				rows.Close()
+				return errors.Wrap("scan", txErr)
+			}
+			secrets[idNum] = secret
+		}
+		rows.Close()
+		if txErr = rows.Err(); txErr != nil {
+			return errors.Wrap("select", txErr)
+		}
+
+		for idNum, secret := range secrets {
+			secretHash, txErr := HashApplicationSecret(secret)
+			if txErr != nil {
+				return errors.Wrap("HashApplicationSecret", txErr)
+			}
+			sqlString, _, _ = goqu.
+				Insert(applicationSecretDBTableName).
+				Rows(
+					goqu.Record{
+						"application_id": idNum.PrimitiveValue(),
+						"secret_hash":    secretHash,
+					},
+				).
+				ToSQL()
+			_, txErr = dbTx.Exec(sqlString)
+			if txErr != nil {
+				return errors.Wrap("secret insert", txErr)
+			}
+			sqlString, _, _ = goqu.
+				From(applicationDBTableName).
+				Where(
+					goqu.C(applicationDBColIDNum).Eq(idNum.PrimitiveValue()),
+				).
+				Update().
+				Set(
+					goqu.Record{"secret_plaintext": ""},
+				).
+				ToSQL()
+			_, txErr = dbTx.Exec(sqlString)
+			if txErr != nil {
+				return errors.Wrap("application update", txErr)
+			}
+			hashedIDNums = append(hashedIDNums, idNum)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashedIDNums, nil
+}
+
+// nonNilStrings is used to store empty arrays instead of NULLs.
+func nonNilStrings(ls []string) []string {
+	if ls == nil {
+		return []string{}
+	}
+	return ls
+}
@@ -3,10 +3,12 @@
 package iamserver
 
 import (
+	"bytes"
+	"fmt"
 	"net/url"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alloyzeus/go-azfl/errors"
@@ -20,6 +22,7 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/email"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
 
@@ -37,8 +40,6 @@ import (
 	_ "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/media/store/s3"
 )
 
-const secretFilesDir = "/run/secrets"
-
 type Core struct {
 	realmInfo realm.Info
 	db        *sqlx.DB
@@ -48,7 +49,25 @@ type Core struct {
 	UserService *UserServiceServerBase //TODO: the interface
 
 	applicationDataProvider iam.ApplicationDataProvider
+	scopeRegistry           *iam.ScopeRegistry
 	mediaStore              *mediastore.Store
+	passwordHasher          *passwordHasher
+	passwordPolicy          *passwordPolicy
+	usernamePolicy          *usernamePolicy
+	rateLimiter             *rateLimiter
+	totpSecretCipher        *secretCipher
+	webAuthnRelyingParty    *webauthn.RelyingParty
+
+	terminalActivityRecorder *terminalActivityRecorder
+	terminalIdleTimeout      time.Duration
+	terminalIdleSweeperStop  func()
+
+	jwtKeyDirReloaderStop func()
+
+	// The deliveries which are made after the call which requested them
+	// has returned, e.g., the password reset codes. A pointer as Core
+	// must not contain locks.
+	pendingDeliveries *sync.WaitGroup
 
 	eaVerifier *eav10n.Verifier
 	pnVerifier *pnv10n.Verifier
@@ -76,25 +95,93 @@ func NewCoreByConfig(
 		return nil, errors.Wrap("DB connection", err)
 	}
 
-	//TODO: get from secret storage (e.g., vault or AWS secret manager)
-	jwtPrivateKeyFilenames := []string{
-		filepath.Join(secretFilesDir, "jwt_ed25519.key"),
-		filepath.Join(secretFilesDir, "jwt_rsa.key"),
-		filepath.Join(secretFilesDir, "jwt.key"),
-	}
-	jwtKeyChain, err := iam.NewJWTKeyChainFromFiles(jwtPrivateKeyFilenames, "")
+	secretSource, err := app.NewSecretSourceByConfig(coreCfg.Secrets)
 	if err != nil {
-		return nil, errors.Wrap("JWT key chain loading", err)
+		return nil, errors.Arg("coreCfg.Secrets", err)
+	}
+
+	var jwtKeyChain *iam.JWTKeyChain
+	if coreCfg.JWTKeyDir != "" {
+		jwtKeyChain, err = iam.NewJWTKeyChainFromDirectory(coreCfg.JWTKeyDir)
+		if err != nil {
+			return nil, errors.Wrap("JWT key chain loading", err)
+		}
+	} else {
+		jwtKeyChain, err = loadJWTKeyChainFromSecretSource(secretSource)
+		if err != nil {
+			return nil, errors.Wrap("JWT key chain loading", err)
+		}
 	}
 
-	// NOTE: We should store these data into a database instead of CSV file.
-	clientDataCSVFilename := filepath.Join(secretFilesDir, "clients.csv")
-	applicationDataProvider, err := newApplicationStaticDataProviderFromCSVFileByName(
-		clientDataCSVFilename, 1)
+	hashedAppIDNums, err := hashApplicationPlaintextSecrets(iamDB)
 	if err != nil {
+		return nil, errors.Wrap("application secret hashing", err)
+	}
+	if len(hashedAppIDNums) > 0 {
+		log.Info().Msgf("Hashed the plain-text secrets of %d applications",
+			len(hashedAppIDNums))
+	}
+
+	applicationDataProvider := applicationDataProviderChain{
+		&applicationDBDataProvider{db: iamDB},
+	}
+	// The CSV data is still supported so that the existing deployments
+	// keep working until the applications have been imported into
+	// the database.
+	clientDataCSV, err := secretSource.GetSecret(clientDataCSVSecretName)
+	if err == nil {
+		log.Warn().Msgf("Loading applications from %s secret. The secret is "+
+			"deprecated; import it into the database with the app-csv-import tool.",
+			clientDataCSVSecretName)
+		csvDataProvider, err := newApplicationStaticDataProviderFromCSV(
+			bytes.NewReader(clientDataCSV), 1)
+		if err != nil {
+			return nil, errors.Wrap("client data loading", err)
+		}
+		applicationDataProvider = append(applicationDataProvider, csvDataProvider)
+	} else if err != app.ErrSecretNotFound {
 		return nil, errors.Wrap("client data loading", err)
 	}
 
+	passwordPolicy, err := newPasswordPolicy(coreCfg.PasswordPolicy)
+	if err != nil {
+		return nil, errors.Arg("coreCfg.PasswordPolicy", err)
+	}
+
+	usernamePolicy, err := newUsernamePolicy(coreCfg.UsernamePolicy)
+	if err != nil {
+		return nil, errors.Arg("coreCfg.UsernamePolicy", err)
+	}
+
+	rateLimiter, err := newRateLimiter(coreCfg.RateLimit, iamDB)
+	if err != nil {
+		return nil, errors.Arg("coreCfg.RateLimit", err)
+	}
+
+	totpSecretCipher, err := loadSecretCipherFromSecretSource(
+		secretSource, totpEncryptionKeySecretName)
+	if err != nil {
+		return nil, errors.Wrap("TOTP encryption key loading", err)
+	}
+	if totpSecretCipher == nil {
+		log.Warn().Msgf("TOTP enrollment is disabled because the %s "+
+			"secret is not available", totpEncryptionKeySecretName)
+	}
+
+	webAuthnRelyingParty, err := newWebAuthnRelyingParty(
+		coreCfg.WebAuthn, realmInfo.Name)
+	if err != nil {
+		return nil, errors.Arg("coreCfg.WebAuthn", err)
+	}
+	if webAuthnRelyingParty == nil {
+		log.Info().Msg("Passkeys are disabled because the WebAuthn " +
+			"relying party ID is not configured")
+	}
+
+	if coreCfg.Terminal.IdleTimeoutDays < 0 {
+		return nil, errors.ArgMsg("coreCfg.Terminal.IdleTimeoutDays", "negative")
+	}
+
 	log.Info().Msg("Initializing media service...")
 	log.Info().Msgf("Registered media object storage service integrations: %v",
 		mediastore.ModuleNames())
@@ -138,6 +225,18 @@ func NewCoreByConfig(
 					ctxAuth.TerminalIDNum().PrimitiveValue())
 			}
 
+			// The username is released so that it could be claimed
+			// by another user.
+			if txErr == nil {
+				_, txErr = dbTx.Exec(
+					`UPDATE `+userKeyUsernameDBTableName+` `+
+						"SET md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 "+
+						"WHERE user_id = $2 AND md_d_ts IS NULL",
+					inputCtx.CallInputMetadata().ReceiveTime,
+					ctxAuth.UserIDNum().PrimitiveValue(),
+					ctxAuth.TerminalIDNum().PrimitiveValue())
+			}
+
 			if txErr == nil {
 				_, txErr = dbTx.Exec(
 					`UPDATE `+userProfileImageKeyDBTableName+` `+
@@ -148,6 +247,16 @@ func NewCoreByConfig(
 					ctxAuth.TerminalIDNum().PrimitiveValue())
 			}
 
+			if txErr == nil {
+				_, txErr = dbTx.Exec(
+					`UPDATE `+userWebAuthnCredentialDBTableName+` `+
+						"SET md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 "+
+						"WHERE user_id = $2 AND md_d_ts IS NULL",
+					inputCtx.CallInputMetadata().ReceiveTime,
+					ctxAuth.UserIDNum().PrimitiveValue(),
+					ctxAuth.TerminalIDNum().PrimitiveValue())
+			}
+
 			return txErr
 		},
 	}
@@ -157,21 +266,96 @@ func NewCoreByConfig(
 		db:                      iamDB,
 		UserService:             userService,
 		applicationDataProvider: applicationDataProvider,
+		scopeRegistry:           iam.NewScopeRegistry(),
 		mediaStore:              mediaStore,
+		passwordHasher:          newPasswordHasher(coreCfg.PasswordHashing),
+		passwordPolicy:          passwordPolicy,
+		usernamePolicy:          usernamePolicy,
+		rateLimiter:             rateLimiter,
+		totpSecretCipher:        totpSecretCipher,
+		webAuthnRelyingParty:    webAuthnRelyingParty,
 		eaVerifier:              eaVerifier,
 		pnVerifier:              pnVerifier,
+		pendingDeliveries:       &sync.WaitGroup{},
 	}
 
-	svcForServer, err := iam.NewConsumerServer(nil, jwtKeyChain, userService)
+	sessionRevocationChecker, err := iam.NewSessionRevocationCheckerCache(
+		inst, sessionRevocationCacheSize, sessionRevocationCacheTTL)
+	if err != nil {
+		panic(err)
+	}
+
+	svcForServer, err := iam.NewConsumerServer(
+		nil,
+		&iam.ConsumerServerConfig{
+			AccessTokenIssuer:    realmInfo.Name,
+			AccessTokenClockSkew: iam.AccessTokenClockSkewDefault,
+			TrustedProxies:       coreCfg.TrustedProxies,
+		},
+		jwtKeyChain, userService, sessionRevocationChecker)
 	if err != nil {
 		panic(err)
 	}
 
 	inst.ConsumerServer = svcForServer
 
+	// The background jobs are started last so that they are not left
+	// running when the initialization fails. They are stopped by Close.
+	if coreCfg.JWTKeyDir != "" {
+		reloadInterval := coreCfg.JWTKeyDirReloadInterval
+		if reloadInterval <= 0 {
+			reloadInterval = jwtKeyDirReloadIntervalDefault
+		}
+		inst.jwtKeyDirReloaderStop = jwtKeyChain.StartKeyDirectoryReloader(reloadInterval, func(err error) {
+			log.Error().Err(err).Msg("JWT key directory reloading")
+		})
+	}
+
+	inst.terminalActivityRecorder = newTerminalActivityRecorder(
+		coreCfg.Terminal.ActivityFlushInterval, inst.updateTerminalsLastUse)
+	if days := coreCfg.Terminal.IdleTimeoutDays; days > 0 {
+		inst.terminalIdleTimeout = time.Duration(days) * 24 * time.Hour
+		inst.terminalIdleSweeperStop = inst.
+			startTerminalIdleSweeper(terminalIdleSweepInterval)
+	}
+
 	return inst, nil
 }
 
+// Close stops the background jobs of the core. The terminals' last use
+// which has not been written is written, and the pending deliveries are
+// made, before it returns. The core must not be used after it has been
+// closed.
+func (core *Core) Close() error {
+	if core.jwtKeyDirReloaderStop != nil {
+		core.jwtKeyDirReloaderStop()
+	}
+	if core.terminalIdleSweeperStop != nil {
+		core.terminalIdleSweeperStop()
+	}
+	if core.terminalActivityRecorder != nil {
+		core.terminalActivityRecorder.stop()
+	}
+	if core.pendingDeliveries != nil {
+		core.pendingDeliveries.Wait()
+	}
+	return nil
+}
+
+// deliverLater runs deliver in the background. Close waits for it to
+// finish.
+func (core *Core) deliverLater(deliver func()) {
+	if core.pendingDeliveries == nil {
+		deliver()
+		return
+	}
+	core.pendingDeliveries.Add(1)
+	go func() {
+		defer core.pendingDeliveries.Done()
+		deliver()
+	}()
+}
+
 func (core *Core) isTestPhoneNumber(phoneNumber telephony.PhoneNumber) bool {
 	return phoneNumber.CountryCode() == 1 &&
 		phoneNumber.NationalNumber() > 5550000 &&
@@ -236,16 +420,80 @@ func connectPostgres(dbURL string) (*sqlx.DB, error) {
 	return db, nil
 }
 
+// The names of the secrets loaded from the secret source.
+const (
+	clientDataCSVSecretName = "clients.csv"
+)
+
+// The secrets which contain the JWT signing key, in the order they
+// are looked up.
+var jwtKeySecretNames = []string{"jwt_ed25519.key", "jwt_rsa.key", "jwt.key"}
+
+func loadJWTKeyChainFromSecretSource(
+	secretSource app.SecretSource,
+) (*iam.JWTKeyChain, error) {
+	for _, secretName := range jwtKeySecretNames {
+		pemBytes, err := secretSource.GetSecret(secretName)
+		if err != nil {
+			if err == app.ErrSecretNotFound {
+				continue
+			}
+			return nil, errors.Wrap(secretName, err)
+		}
+		if len(pemBytes) == 0 {
+			continue
+		}
+		jwtKeyChain, err := iam.NewJWTKeyChainFromPrivateKeyPEM(pemBytes)
+		if err != nil {
+			return nil, errors.Wrap(secretName, err)
+		}
+		return jwtKeyChain, nil
+	}
+	return nil, errors.Msg(fmt.Sprintf(
+		"none of these secrets could be loaded: %v", jwtKeySecretNames))
+}
+
+const jwtKeyDirReloadIntervalDefault = time.Minute
+
+// The session revocation checks made by the server's own consumer
+// server are cached, so that not every request hits the database. The
+// TTL is the upper bound of the delay before a revocation takes effect
+// in this server; a revocation made in this server takes effect here
+// within this duration.
+const (
+	sessionRevocationCacheSize = 4096
+	sessionRevocationCacheTTL  = 5 * time.Second
+)
+
 type CoreConfig struct {
 	DBURL string            `env:"DB_URL,required"`
 	Media mediastore.Config `env:"MEDIA"`
 	EAV   eav10n.Config     `env:"EAV"`
 	PNV   pnv10n.Config     `env:"PNV"`
+
+	Secrets         app.SecretSourceConfig `env:"SECRETS"`
+	PasswordHashing PasswordHashingConfig  `env:"PASSWORD_HASHING"`
+	PasswordPolicy  PasswordPolicyConfig   `env:"PASSWORD_POLICY"`
+	UsernamePolicy  UsernamePolicyConfig   `env:"USERNAME_POLICY"`
+	RateLimit       RateLimitConfig        `env:"RATE_LIMIT"`
+	WebAuthn        WebAuthnConfig         `env:"WEBAUTHN"`
+	Terminal        TerminalConfig         `env:"TERMINAL"`
+
+	JWTKeyDir               string        `env:"JWT_KEY_DIR"`
+	JWTKeyDirReloadInterval time.Duration `env:"JWT_KEY_DIR_RELOAD_INTERVAL"`
+
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
 }
 
 func (CoreConfig) FieldDescriptions() map[string]string {
 	return map[string]string{
 		"DBURL": "Connection string, e.g, for PostgreSQL postgresql://postgresql.db.server:5430/my_database",
+		"JWTKeyDir": "Directory which contains the keys used to sign the tokens, " +
+			"along with their lifecycle. If it's not set, the key is loaded " +
+			"from the secret jwt.key",
+		"JWTKeyDirReloadInterval": "How often the keys are reloaded from JWTKeyDir. Defaults to 1m",
+		"TrustedProxies": "Comma-separated IP addresses or CIDR ranges of the reverse " +
+			"proxies whose X-Forwarded-For header is honored",
 	}
 }
 
@@ -1,9 +1,12 @@
 package iamserver
 
 import (
-	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"time"
 
 	errors "github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 )
@@ -27,9 +30,109 @@ func (core *Core) AuthenticatedApplication(
 	if app == nil {
 		return nil, nil
 	}
-	if subtle.ConstantTimeCompare([]byte(secret), []byte(app.Attributes.Secret)) != 1 {
+	match, err := matchApplicationSecret(core.passwordHasher,
+		app.ID.IDNum(), app.Attributes.Secrets, secret, time.Now())
+	if err != nil {
+		return nil, errors.Wrap("secret matching", err)
+	}
+	if !match {
 		return nil, errors.ArgMsg("password", "mismatch")
 	}
 
 	return app, nil
 }
+
+// ApplicationByBasicAuthorization returns the application authenticated
+// by the value of a Basic authorization, e.g., the Authorization header
+// field of an HTTP request. RFC 6749 § 2.3.1.
+//
+// It returns an error if the authorization is malformed or it doesn't
+// authenticate any application.
+func (core *Core) ApplicationByBasicAuthorization(
+	authorization string,
+) (*iam.Application, error) {
+	authorizationParts := strings.SplitN(authorization, " ", 2)
+	if len(authorizationParts) != 2 {
+		return nil, iam.ErrReqFieldAuthorizationMalformed
+	}
+	if authorizationParts[0] != "Basic" {
+		return nil, iam.ErrReqFieldAuthorizationTypeUnsupported
+	}
+
+	credsBytes, err := base64.StdEncoding.
+		DecodeString(strings.TrimSpace(authorizationParts[1]))
+	if err != nil {
+		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, dataerrs.Malformed(err))
+	}
+
+	creds := strings.SplitN(string(credsBytes), ":", 2)
+	if creds[0] == "" {
+		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.EntMsg("username", "empty"))
+	}
+	if len(creds) != 2 {
+		return nil, iam.ErrReqFieldAuthorizationMalformed
+	}
+
+	appID, err := iam.ApplicationIDFromAZIDText(creds[0])
+	if err != nil {
+		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.Ent("username", dataerrs.Malformed(err)))
+	}
+	if appID.IsNotStaticallyValid() {
+		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.Ent("username", nil))
+	}
+
+	app, err := core.AuthenticatedApplication(appID, creds[1])
+	if err != nil {
+		return nil, errors.Wrap("client look up", err)
+	}
+	if app == nil {
+		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.EntMsg("username", "reference invalid"))
+	}
+
+	return app, nil
+}
+
+// HashApplicationSecret returns the hash of an application secret in
+// the form which is to be stored, e.g., in the secret column of
+// clients.csv. The hash is computed with the default parameters.
+func HashApplicationSecret(secret string) (string, error) {
+	return hashPasswordArgon2id(secret, argon2PasswordHashingParamsDefault)
+}
+
+// matchApplicationSecret checks the secret against all the secrets
+// which are still valid at t. A public application without any valid
+// secret matches only the empty secret; other types of application
+// without any valid secret match nothing.
+func matchApplicationSecret(
+	hasher *passwordHasher,
+	appIDNum iam.ApplicationIDNum,
+	appSecrets []iam.ApplicationSecret,
+	secret string,
+	t time.Time,
+) (match bool, err error) {
+	hasValidSecret := false
+	for _, appSecret := range appSecrets {
+		if appSecret.IsExpiredAt(t) {
+			continue
+		}
+		hasValidSecret = true
+		match, _, err = hasher.match(secret, appSecret.Hash)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	if !hasValidSecret {
+		return appIDNum.IsUserAgentAuthorizationPublic() && secret == "", nil
+	}
+	return false, nil
+}
+
+// isApplicationSecretHash returns true if s looks like a value produced
+// by HashApplicationSecret.
+func isApplicationSecretHash(s string) bool {
+	_, _, _, err := decodePasswordHash(s)
+	return err == nil
+}
@@ -0,0 +1,492 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// Application types which could be registered through the application
+// management API. The type is embedded in the application's ID.
+const (
+	ApplicationTypeService               = "service"
+	ApplicationTypeUserAgentPublic       = "user-agent-public"
+	ApplicationTypeUserAgentConfidential = "user-agent-confidential"
+)
+
+func applicationTypeIDNumBits(appType string) (bits uint32, ok bool) {
+	switch appType {
+	case ApplicationTypeService:
+		return iam.ApplicationIDNumServiceBits, true
+	case ApplicationTypeUserAgentPublic:
+		return iam.ApplicationIDNumUserAgentAuthorizationPublicBits, true
+	case ApplicationTypeUserAgentConfidential:
+		return iam.ApplicationIDNumUserAgentAuthorizationConfidentialBits, true
+	}
+	return 0, false
+}
+
+// ApplicationAttributesInputData holds the attributes of an application
+// which are editable through the application management API.
+type ApplicationAttributesInputData struct {
+	DisplayName        string
+	PlatformType       string
+	RequiredScopes     []string
+	OAuth2RedirectURI  []string
+	OAuth2PKCERequired bool
+}
+
+func (inputData ApplicationAttributesInputData) validate() error {
+	for _, s := range inputData.RequiredScopes {
+		if !oauth2.IsScopeTokenValid(s) {
+			return errors.ArgMsg("RequiredScopes", "invalid")
+		}
+	}
+	for _, s := range inputData.OAuth2RedirectURI {
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return errors.ArgMsg("OAuth2RedirectURI", "invalid")
+		}
+	}
+	return nil
+}
+
+type ApplicationCreationInputData struct {
+	Type       string
+	FirstParty bool
+
+	ApplicationAttributesInputData
+}
+
+type ApplicationCreationOutputData struct {
+	ApplicationID iam.ApplicationID
+	// Secret is provided only once, right after the application has
+	// been created. It's empty for the public user-agent applications
+	// as they can't keep a secret.
+	Secret string
+}
+
+// CreateApplication registers a new application. The context must be
+// of a service application which has been granted the
+// iam.ScopeApplicationsManage scope.
+func (core *Core) CreateApplication(
+	inputCtx iam.CallInputContext,
+	inputData ApplicationCreationInputData,
+) (*ApplicationCreationOutputData, error) {
+	if err := core.requireApplicationManagementAccess(inputCtx); err != nil {
+		return nil, err
+	}
+
+	idNumBits, ok := applicationTypeIDNumBits(inputData.Type)
+	if !ok {
+		return nil, errors.ArgMsg("inputData.Type", "unsupported")
+	}
+	if inputData.FirstParty {
+		idNumBits |= iam.ApplicationIDNumFirstPartyBits
+	}
+	if err := inputData.validate(); err != nil {
+		return nil, errors.Arg("inputData", err)
+	}
+
+	var secret, secretHash string
+	if !iam.ApplicationIDNum(idNumBits).HasUserAgentAuthorizationPublicBits() {
+		secret = core.generateApplicationSecret()
+		var err error
+		secretHash, err = core.passwordHasher.hash(secret)
+		if err != nil {
+			return nil, errors.Wrap("secret hashing", err)
+		}
+	}
+
+	// The instance, its attributes and its secret are created at once so
+	// that a failure doesn't leave an application without a secret.
+	var appID iam.ApplicationID
+	err := doTx(core.db, func(dbTx *sqlx.Tx) error {
+		var txErr error
+		appID, txErr = core.insertApplicationInstanceInsecure(inputCtx, dbTx, idNumBits)
+		if txErr != nil {
+			return errors.Wrap("insertApplicationInstanceInsecure", txErr)
+		}
+		_, txErr = core.updateApplicationInsecure(inputCtx, dbTx, appID, goqu.Record{
+			"display_name":         inputData.DisplayName,
+			"platform_type":        inputData.PlatformType,
+			"required_scopes":      pq.Array(nonNilStrings(inputData.RequiredScopes)),
+			"oauth2_redirect_uri":  pq.Array(nonNilStrings(inputData.OAuth2RedirectURI)),
+			"oauth2_pkce_required": inputData.OAuth2PKCERequired,
+		})
+		if txErr != nil {
+			return errors.Wrap("updateApplicationInsecure", txErr)
+		}
+		if secretHash == "" {
+			return nil
+		}
+		return core.insertApplicationSecretInsecure(inputCtx, dbTx, appID, secretHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ApplicationCreationOutputData{
+		ApplicationID: appID,
+		Secret:        secret,
+	}, nil
+}
+
+// UpdateApplication replaces the attributes of an application. It
+// returns iam.ErrApplicationNotFound if the application is not
+// registered in the database or it has been disabled.
+func (core *Core) UpdateApplication(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	inputData ApplicationAttributesInputData,
+) error {
+	if err := core.requireApplicationManagementAccess(inputCtx); err != nil {
+		return err
+	}
+	if applicationID.IsNotStaticallyValid() {
+		return errors.ArgMsg("applicationID", "invalid")
+	}
+	if err := inputData.validate(); err != nil {
+		return errors.Arg("inputData", err)
+	}
+
+	updated, err := core.updateApplicationInsecure(inputCtx, core.db, applicationID, goqu.Record{
+		"display_name":         inputData.DisplayName,
+		"platform_type":        inputData.PlatformType,
+		"required_scopes":      pq.Array(nonNilStrings(inputData.RequiredScopes)),
+		"oauth2_redirect_uri":  pq.Array(nonNilStrings(inputData.OAuth2RedirectURI)),
+		"oauth2_pkce_required": inputData.OAuth2PKCERequired,
+	})
+	if err != nil {
+		return errors.Wrap("updateApplicationInsecure", err)
+	}
+	if !updated {
+		return iam.ErrApplicationNotFound
+	}
+
+	return nil
+}
+
+// RotateApplicationSecret adds a newly generated secret to an
+// application. The existing secrets will still be accepted for
+// the duration of previousSecretsTTL, or they are invalidated
+// immediately if previousSecretsTTL is zero. The public user-agent
+// applications have no secrets; iam.ErrOperationNotAllowed is returned
+// for them.
+func (core *Core) RotateApplicationSecret(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	previousSecretsTTL time.Duration,
+) (secret string, err error) {
+	if err := core.requireApplicationManagementAccess(inputCtx); err != nil {
+		return "", err
+	}
+	if applicationID.IsNotStaticallyValid() {
+		return "", errors.ArgMsg("applicationID", "invalid")
+	}
+	if previousSecretsTTL < 0 {
+		return "", errors.ArgMsg("previousSecretsTTL", "negative")
+	}
+	if applicationID.IDNum().IsUserAgentAuthorizationPublic() {
+		return "", iam.ErrOperationNotAllowed
+	}
+
+	secret = core.generateApplicationSecret()
+	secretHash, err := core.passwordHasher.hash(secret)
+	if err != nil {
+		return "", errors.Wrap("secret hashing", err)
+	}
+
+	ctxAuth := inputCtx.Authorization()
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	err = doTx(core.db, func(dbTx *sqlx.Tx) error {
+		updated, txErr := core.updateApplicationInsecure(inputCtx, dbTx, applicationID, goqu.Record{})
+		if txErr != nil {
+			return errors.Wrap("updateApplicationInsecure", txErr)
+		}
+		if !updated {
+			return iam.ErrApplicationNotFound
+		}
+
+		var sqlString string
+		if previousSecretsTTL == 0 {
+			sqlString, _, _ = goqu.
+				From(applicationSecretDBTableName).
+				Where(
+					goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+					goqu.C("md_d_ts").IsNull(),
+				).
+				Update().
+				Set(
+					goqu.Record{
+						"md_d_ts":  ctxTime,
+						"md_d_tid": ctxAuth.TerminalIDNumPtr(),
+						"md_d_uid": ctxAuth.UserIDNumPtr(),
+					},
+				).
+				ToSQL()
+		} else {
+			expiryTime := ctxTime.Add(previousSecretsTTL)
+			sqlString, _, _ = goqu.
+				From(applicationSecretDBTableName).
+				Where(
+					goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+					goqu.C("md_d_ts").IsNull(),
+					goqu.Or(
+						goqu.C("expiry_ts").IsNull(),
+						goqu.C("expiry_ts").Gt(expiryTime),
+					),
+				).
+				Update().
+				Set(goqu.Record{"expiry_ts": expiryTime}).
+				ToSQL()
+		}
+		_, txErr = dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("secret update", txErr)
+		}
+
+		return core.insertApplicationSecretInsecure(inputCtx, dbTx, applicationID, secretHash)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// DisableApplication disables an application and revokes all the
+// terminals registered for it. Disabling is permanent.
+func (core *Core) DisableApplication(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+) (stateChanged bool, err error) {
+	if err := core.requireApplicationManagementAccess(inputCtx); err != nil {
+		return false, err
+	}
+	if applicationID.IsNotStaticallyValid() {
+		return false, errors.ArgMsg("applicationID", "invalid")
+	}
+
+	stateChanged, err = core.disableApplicationInsecure(inputCtx, applicationID)
+	if err != nil {
+		return false, errors.Wrap("disableApplicationInsecure", err)
+	}
+
+	sqlString, _, _ := goqu.
+		From(terminalDBTableName).
+		Select("id_num").
+		Where(
+			goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		ToSQL()
+	var terminalIDNums []iam.TerminalIDNum
+	err = core.db.Select(&terminalIDNums, sqlString)
+	if err != nil {
+		return false, errors.Wrap("terminal query", err)
+	}
+
+	for _, terminalIDNum := range terminalIDNums {
+		termRevoked, err := core.revokeTerminalInsecure(inputCtx, terminalIDNum)
+		if err != nil {
+			return false, errors.Wrap("revokeTerminalInsecure", err)
+		}
+		stateChanged = stateChanged || termRevoked
+	}
+
+	return stateChanged, nil
+}
+
+// requireApplicationManagementAccess allows only the service
+// applications, i.e., those which authenticated with client credentials
+// and not on behalf of a user, to manage the applications. The scope
+// alone is not sufficient as it's the configuration of the client which
+// decides whether the scope could be granted, and the users of the client
+// would be granted the scope as well.
+func (core *Core) requireApplicationManagementAccess(
+	inputCtx iam.CallInputContext,
+) error {
+	if inputCtx == nil {
+		return iam.ErrCallInputContextMissing
+	}
+	ctxAuth := inputCtx.Authorization()
+	if err := ctxAuth.RequireScopes(iam.ScopeApplicationsManage); err != nil {
+		return err
+	}
+	if !ctxAuth.IsServiceClientContext() {
+		return iam.ErrOperationNotAllowed
+	}
+	return nil
+}
+
+// insertApplicationInstanceInsecure is like the instance creation of
+// ApplicationServiceServerBase but it's made within the transaction and
+// it embeds the type bits into the ID. The conflicting IDs are skipped
+// rather than failing the statement, which would abort the transaction.
+func (core *Core) insertApplicationInstanceInsecure(
+	inputCtx iam.CallInputContext,
+	dbTx *sqlx.Tx,
+	idNumEmbeddedFieldBits uint32,
+) (iam.ApplicationID, error) {
+	ctxAuth := inputCtx.Authorization()
+	cTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	const attemptNumMax = 5
+
+	for attemptNum := 0; ; attemptNum++ {
+		newInstanceIDNum, err := GenerateApplicationIDNum(idNumEmbeddedFieldBits)
+		if err != nil {
+			return iam.ApplicationIDZero(), errors.Wrap("GenerateApplicationIDNum", err)
+		}
+
+		sqlString, _, _ := goqu.
+			Insert(applicationDBTableName).
+			Rows(
+				goqu.Record{
+					applicationDBColIDNum:                newInstanceIDNum,
+					applicationDBColMDCreationTimestamp:  cTime,
+					applicationDBColMDCreationUserID:     ctxAuth.UserIDNumPtr(),
+					applicationDBColMDCreationTerminalID: ctxAuth.TerminalIDNumPtr(),
+				},
+			).
+			OnConflict(goqu.DoNothing()).
+			ToSQL()
+
+		xres, err := dbTx.Exec(sqlString)
+		if err != nil {
+			return iam.ApplicationIDZero(), errors.Wrap("insert", err)
+		}
+		n, err := xres.RowsAffected()
+		if err != nil {
+			return iam.ApplicationIDZero(), errors.Wrap("insert", err)
+		}
+		if n == 1 {
+			return iam.NewApplicationID(newInstanceIDNum), nil
+		}
+		if attemptNum >= attemptNumMax {
+			return iam.ApplicationIDZero(), errors.Msg("insert max attempts")
+		}
+	}
+}
+
+// disableApplicationInsecure marks the application as deleted. It's
+// used instead of the instance deletion of ApplicationServiceServerBase
+// which matches the application by the ID of the user in the context.
+func (core *Core) disableApplicationInsecure(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+) (justDisabled bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+
+	sqlString, _, _ := goqu.
+		From(applicationDBTableName).
+		Where(
+			goqu.C(applicationDBColIDNum).Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C(applicationDBColMDDeletionTimestamp).IsNull(),
+		).
+		Update().
+		Set(
+			goqu.Record{
+				applicationDBColMDDeletionTimestamp:  inputCtx.CallInputMetadata().ReceiveTime,
+				applicationDBColMDDeletionTerminalID: ctxAuth.TerminalIDNumPtr(),
+				applicationDBColMDDeletionUserID:     ctxAuth.UserIDNumPtr(),
+			},
+		).
+		ToSQL()
+	xres, err := core.db.Exec(sqlString)
+	if err != nil {
+		return false, err
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (core *Core) updateApplicationInsecure(
+	inputCtx iam.CallInputContext,
+	db sqlx.Execer,
+	applicationID iam.ApplicationID,
+	record goqu.Record,
+) (updated bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+
+	record[applicationDBColMDUpdateTimestamp] = inputCtx.CallInputMetadata().ReceiveTime
+	record[applicationDBColMDUpdateTerminalID] = ctxAuth.TerminalIDNumPtr()
+	record[applicationDBColMDUpdateUserID] = ctxAuth.UserIDNumPtr()
+
+	sqlString, _, _ := goqu.
+		From(applicationDBTableName).
+		Where(
+			goqu.C(applicationDBColIDNum).Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C(applicationDBColMDDeletionTimestamp).IsNull(),
+		).
+		Update().
+		Set(record).
+		ToSQL()
+	xres, err := db.Exec(sqlString)
+	if err != nil {
+		return false, err
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (core *Core) insertApplicationSecretInsecure(
+	inputCtx iam.CallInputContext,
+	db sqlx.Execer,
+	applicationID iam.ApplicationID,
+	secretHash string,
+) error {
+	ctxAuth := inputCtx.Authorization()
+
+	sqlString, _, _ := goqu.
+		Insert(applicationSecretDBTableName).
+		Rows(
+			goqu.Record{
+				"application_id": applicationID.IDNum().PrimitiveValue(),
+				"secret_hash":    secretHash,
+				"md_c_ts":        inputCtx.CallInputMetadata().ReceiveTime,
+				"md_c_tid":       ctxAuth.TerminalIDNumPtr(),
+				"md_c_uid":       ctxAuth.UserIDNumPtr(),
+			},
+		).
+		ToSQL()
+	_, err := db.Exec(sqlString)
+	if err != nil {
+		return errors.Wrap("secret insert", err)
+	}
+	return nil
+}
+
+const (
+	applicationDBColMDUpdateTimestamp  = "md_u_ts"
+	applicationDBColMDUpdateTerminalID = "md_u_tid"
+	applicationDBColMDUpdateUserID     = "md_u_uid"
+)
+
+func (core *Core) generateApplicationSecret() string {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
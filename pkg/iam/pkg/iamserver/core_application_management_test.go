@@ -0,0 +1,24 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplicationAttributesInputDataValidate(t *testing.T) {
+	assert.Nil(t, ApplicationAttributesInputData{}.validate())
+	assert.Nil(t, ApplicationAttributesInputData{
+		RequiredScopes:    []string{"openid", "orders.read"},
+		OAuth2RedirectURI: []string{"https://example.com/callback", "com.example.app:/cb"},
+	}.validate())
+	assert.NotNil(t, ApplicationAttributesInputData{
+		RequiredScopes: []string{"orders read"},
+	}.validate())
+	assert.NotNil(t, ApplicationAttributesInputData{
+		OAuth2RedirectURI: []string{"/callback"},
+	}.validate())
+	assert.NotNil(t, ApplicationAttributesInputData{
+		OAuth2RedirectURI: []string{"https://example.com/callback#frag"},
+	}.validate())
+}
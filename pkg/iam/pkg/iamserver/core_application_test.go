@@ -0,0 +1,110 @@
+package iamserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+var argon2PasswordHashingParamsTest = argon2PasswordHashingParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestMatchApplicationSecret(t *testing.T) {
+	now := time.Now()
+	oldHash, err := hashPasswordArgon2id("old-secret", argon2PasswordHashingParamsTest)
+	assert.Nil(t, err)
+	newHash, err := hashPasswordArgon2id("new-secret", argon2PasswordHashingParamsTest)
+	assert.Nil(t, err)
+	assert.True(t, isApplicationSecretHash(oldHash))
+	assert.False(t, isApplicationSecretHash("old-secret"))
+
+	publicAppIDNum := iam.ApplicationIDNum(0x20000001)
+	confidentialAppIDNum := iam.ApplicationIDNum(0x30000001)
+	serviceAppIDNum := iam.ApplicationIDNum(0x00000001)
+
+	hasher := &passwordHasher{
+		params: argon2PasswordHashingParamsTest,
+		slots:  make(chan struct{}, 1),
+	}
+	secrets := []iam.ApplicationSecret{
+		{Hash: oldHash, ExpiryTime: now.Add(time.Hour)},
+		{Hash: newHash},
+	}
+
+	match, err := matchApplicationSecret(hasher, confidentialAppIDNum, secrets, "old-secret", now)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	match, err = matchApplicationSecret(hasher, confidentialAppIDNum, secrets, "new-secret", now)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	match, err = matchApplicationSecret(hasher, confidentialAppIDNum, secrets, "other-secret", now)
+	assert.Nil(t, err)
+	assert.False(t, match)
+	match, err = matchApplicationSecret(hasher, confidentialAppIDNum, secrets, "old-secret", now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, match)
+	match, err = matchApplicationSecret(hasher, confidentialAppIDNum, secrets, "", now)
+	assert.Nil(t, err)
+	assert.False(t, match)
+
+	// Only the public applications could be without any secret.
+	match, err = matchApplicationSecret(hasher, publicAppIDNum, nil, "", now)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	match, err = matchApplicationSecret(hasher, publicAppIDNum, nil, "new-secret", now)
+	assert.Nil(t, err)
+	assert.False(t, match)
+	for _, appIDNum := range []iam.ApplicationIDNum{
+		confidentialAppIDNum, serviceAppIDNum,
+	} {
+		match, err = matchApplicationSecret(hasher, appIDNum, nil, "", now)
+		assert.Nil(t, err)
+		assert.False(t, match)
+	}
+	// All the secrets have expired.
+	match, err = matchApplicationSecret(hasher, confidentialAppIDNum, secrets[:1], "", now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, match)
+}
+
+type applicationDataProviderFunc func(appID iam.ApplicationID) (*iam.Application, error)
+
+func (fn applicationDataProviderFunc) GetApplication(
+	appID iam.ApplicationID,
+) (*iam.Application, error) {
+	return fn(appID)
+}
+
+func TestApplicationDataProviderChainDeleted(t *testing.T) {
+	appID := iam.NewApplicationID(iam.ApplicationIDNum(0x01000001))
+	csvApp := &iam.Application{ID: appID}
+	csvProvider := applicationDataProviderFunc(
+		func(iam.ApplicationID) (*iam.Application, error) { return csvApp, nil })
+
+	notFound := applicationDataProviderChain{
+		applicationDataProviderFunc(
+			func(iam.ApplicationID) (*iam.Application, error) { return nil, nil }),
+		csvProvider,
+	}
+	app, err := notFound.GetApplication(appID)
+	assert.Nil(t, err)
+	assert.Equal(t, csvApp, app)
+
+	// A deleted application must not be revived by the CSV data
+	deleted := applicationDataProviderChain{
+		applicationDataProviderFunc(
+			func(iam.ApplicationID) (*iam.Application, error) { return nil, errApplicationDeleted }),
+		csvProvider,
+	}
+	app, err = deleted.GetApplication(appID)
+	assert.Nil(t, err)
+	assert.Nil(t, app)
+}
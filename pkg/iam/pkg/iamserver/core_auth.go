@@ -1,6 +1,8 @@
 package iamserver
 
 import (
+	"crypto/subtle"
+	"database/sql"
 	"strings"
 	"time"
 
@@ -13,11 +15,25 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
 )
 
-//TODO:SEC: harden
+// Interface conformance assertion.
+var _ iam.SessionRevocationChecker = &Core{}
+
+// AuthorizeTerminalByUserIdentifierAndPassword registers a terminal for
+// the user identified by the identifier if the password matches. The
+// failed attempts are rate limited per user, or per identifier if it
+// doesn't identify any user, and per origin; it
+// returns a *ratelimit.ExceededError once the limits have been reached.
+// If the user has enabled a second factor, it returns
+// an *MFARequiredError.
+//
+// An identifier in the form of terminal:<terminal-id>, with the terminal
+// secret as the password, authenticates a service application's terminal
+// instead; the terminal's credentials are returned as they are.
 func (core *Core) AuthorizeTerminalByUserIdentifierAndPassword(
 	inputCtx iam.CallInputContext,
 	reqApp *iam.Application,
 	terminalDisplayName string,
+	scope string,
 	identifier string,
 	password string,
 ) (terminalID iam.TerminalID, terminalSecret string, userID iam.UserID, err error) {
@@ -25,11 +41,23 @@ func (core *Core) AuthorizeTerminalByUserIdentifierAndPassword(
 
 	identifier = strings.TrimSpace(identifier)
 
+	rateLimitRules := core.rateLimitRules()
+	var reqAppID iam.ApplicationID
+	if reqApp != nil {
+		reqAppID = reqApp.ID
+	}
+	err = core.takeRateLimits(inputCtx, rateLimitKey{
+		rateLimitRules.passwordApplication, rateLimitApplicationKey(reqAppID)})
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+
 	// Username with scheme. The format is '<scheme>:<scheme-specific-identifier>'
 	if names := strings.SplitN(identifier, ":", 2); len(names) == 2 {
 		switch names[0] {
 		case "terminal":
-			panic("TODO")
+			return core.authorizeTerminalByTerminalCredentials(
+				inputCtx, reqApp, names[1], password)
 		default:
 		}
 	}
@@ -61,9 +89,40 @@ func (core *Core) AuthorizeTerminalByUserIdentifierAndPassword(
 		}
 	}
 
-	//TODO: last, check if it matches ourr specification of usernames
+	// Last, look it up as a username. The policy is not checked here as
+	// it might have been changed after the username was set.
+	if userIDNum.IsNotStaticallyValid() {
+		if username := core.usernamePolicy.lookupKey(identifier); username != "" {
+			ownerUserIDNum, err := core.getUserIDNumByKeyUsernameInsecure(username)
+			if err != nil {
+				logCtx(inputCtx).Error().Err(err).
+					Msg("getUserIDNumByKeyUsernameInsecure")
+			} else {
+				userIDNum = ownerUserIDNum
+			}
+		}
+	}
+
+	// Only the failed attempts are counted for these. The identifier
+	// limit is keyed on the user so that the different spellings of
+	// the user's phone number, for example, share the limit.
+	identifierKey := rateLimitIdentifierKey(identifier)
+	if userIDNum.IsStaticallyValid() {
+		identifierKey = rateLimitUserKey(userIDNum)
+	}
+	failureRateLimitKeys := []rateLimitKey{
+		{rateLimitRules.passwordIdentifier, identifierKey},
+		{rateLimitRules.passwordIP, rateLimitOriginKey(inputCtx)},
+	}
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, failureRateLimitKeys...)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+	defer attempt.end()
 
 	if userIDNum.IsNotStaticallyValid() {
+		attempt.fail()
 		// No errors
 		return iam.TerminalIDZero(), "", iam.UserIDZero(), nil
 	}
@@ -77,29 +136,182 @@ func (core *Core) AuthorizeTerminalByUserIdentifierAndPassword(
 	}
 
 	if !passwordMatch {
+		attempt.fail()
 		return iam.TerminalIDZero(), "", iam.UserIDZero(), nil
 	}
 
 	var appID iam.ApplicationID
 	if reqApp != nil {
 		appID = reqApp.ID
+		scope, err = core.scopeRegistry.ResolveApplicationScope(reqApp, scope)
+		if err != nil {
+			return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+		}
+	}
+
+	secondFactorRequired, err := core.IsUserTOTPEnabled(userID)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.Wrap("IsUserTOTPEnabled", err)
 	}
 
 	regOutCtx, regOutData := core.RegisterTerminal(inputCtx, TerminalRegistrationInputData{
-		ApplicationID:    appID,
-		UserID:           userID,
-		DisplayName:      terminalDisplayName,
-		VerificationType: iam.TerminalVerificationResourceTypeOAuthPassword,
-		VerificationID:   0, //TODO: request ID or such
+		ApplicationID:        appID,
+		UserID:               userID,
+		DisplayName:          terminalDisplayName,
+		VerificationType:     iam.TerminalVerificationResourceTypeOAuthPassword,
+		VerificationID:       0, //TODO: request ID or such
+		SecondFactorRequired: secondFactorRequired,
+		OAuth2Scope:          scope,
 	})
 	if err = regOutCtx.Err; err != nil {
 		return iam.TerminalIDZero(), "", iam.UserIDZero(),
 			errors.Wrap("RegisterTerminal", err)
 	}
 
+	if secondFactorRequired {
+		err = core.requireTerminalSecondFactor(
+			inputCtx, regOutData.TerminalID.IDNum(), userID)
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+
 	return regOutData.TerminalID, regOutData.TerminalSecret, userID, nil
 }
 
+// authorizeTerminalByTerminalCredentials is the password grant with
+// the terminal:<terminal-id> identifier. Only the terminals of service
+// applications which are not associated to any user could be authorized
+// this way.
+func (core *Core) authorizeTerminalByTerminalCredentials(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+	terminalIDStr string,
+	terminalSecret string,
+) (terminalID iam.TerminalID, terminalSecretOut string, userID iam.UserID, err error) {
+	if reqApp == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.ArgMsg("reqApp", "missing")
+	}
+	if !reqApp.ID.IDNum().IsService() {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrOperationNotAllowed
+	}
+
+	terminalID, err = iam.TerminalIDFromAZIDText(terminalIDStr)
+	if err != nil || terminalID.IsNotStaticallyValid() {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrTerminalCredentialsInvalid
+	}
+
+	userID, err = core.AuthenticateTerminalByCredentials(
+		inputCtx, reqApp, terminalID, terminalSecret)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+	if userID.IsStaticallyValid() {
+		logCtx(inputCtx).Warn().
+			Str("terminal", terminalID.AZIDText()).Str("user", userID.AZIDText()).
+			Msg("Terminal must not be associated to any user")
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrOperationNotAllowed
+	}
+
+	return terminalID, terminalSecret, userID, nil
+}
+
+// AuthenticateTerminalByCredentials authenticates a terminal with its
+// credentials. If reqApp is provided, the terminal must be one of its
+// terminals; otherwise, the terminal's application must still be
+// registered. The terminal must not have been revoked, and it must have
+// been verified. If the terminal is associated to a user, the user must
+// be active.
+//
+// It returns iam.ErrTerminalCredentialsInvalid if the authentication
+// failed. The failed attempts are rate limited like the password grants.
+func (core *Core) AuthenticateTerminalByCredentials(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+	terminalID iam.TerminalID,
+	terminalSecret string,
+) (userID iam.UserID, err error) {
+	if terminalID.IsNotStaticallyValid() || terminalSecret == "" {
+		return iam.UserIDZero(), iam.ErrTerminalCredentialsInvalid
+	}
+
+	rateLimitRules := core.rateLimitRules()
+	failureRateLimitKeys := []rateLimitKey{
+		{rateLimitRules.passwordIdentifier, rateLimitIdentifierKey("terminal:" + terminalID.AZIDText())},
+		{rateLimitRules.passwordIP, rateLimitOriginKey(inputCtx)},
+	}
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, failureRateLimitKeys...)
+	if err != nil {
+		return iam.UserIDZero(), err
+	}
+	defer attempt.end()
+	authFailed := func(reason string) (iam.UserID, error) {
+		logCtx(inputCtx).Warn().
+			Str("terminal", terminalID.AZIDText()).
+			Msg("Terminal authentication: " + reason)
+		attempt.fail()
+		return iam.UserIDZero(), iam.ErrTerminalCredentialsInvalid
+	}
+
+	appID := terminalID.Application()
+	if reqApp != nil {
+		if !appID.EqualsApplicationID(reqApp.ID) {
+			return authFailed("terminal of other application")
+		}
+	} else {
+		app, err := core.ApplicationByID(appID)
+		if err != nil {
+			return iam.UserIDZero(), errors.Wrap("ApplicationByID", err)
+		}
+		if app == nil {
+			return authFailed("application not registered")
+		}
+	}
+
+	var ownerUserIDNum iam.UserIDNum
+	var storedSecret string
+	var deletionTime, verificationTime *time.Time
+	err = core.db.
+		QueryRow(
+			`SELECT user_id, secret, md_d_ts, verification_ts `+
+				`FROM `+terminalDBTableName+` `+
+				`WHERE id_num = $1`,
+			terminalID.IDNum().PrimitiveValue()).
+		Scan(&ownerUserIDNum, &storedSecret, &deletionTime, &verificationTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return authFailed("not found")
+		}
+		return iam.UserIDZero(), errors.Wrap("terminal look up", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(storedSecret), []byte(terminalSecret)) != 1 {
+		return authFailed("secret mismatch")
+	}
+	// The state is checked after the secret so that it's not revealed
+	// to those who don't have the credentials.
+	if deletionTime != nil {
+		return authFailed("revoked")
+	}
+	if verificationTime == nil {
+		return authFailed("not verified")
+	}
+
+	userID = iam.NewUserID(ownerUserIDNum)
+	if userID.IsStaticallyValid() {
+		userInstInfo, err := core.UserService.
+			getUserInstanceInfoInsecure(inputCtx, userID)
+		if err != nil {
+			return iam.UserIDZero(), errors.Wrap("user instance info", err)
+		}
+		if userInstInfo == nil || !userInstInfo.IsActive() {
+			return authFailed("user not active")
+		}
+	}
+
+	return userID, nil
+}
+
 func (core *Core) issueSession(
 	inputCtx iam.CallInputContext,
 	terminalID iam.TerminalID,
@@ -111,6 +323,7 @@ func (core *Core) issueSession(
 	err error,
 ) {
 	ctxAuth := inputCtx.Authorization()
+	originInfo := inputCtx.OriginInfo()
 
 	const attemptNumMax = 5
 
@@ -136,6 +349,8 @@ func (core *Core) issueSession(
 					sessionDBColMDCreationTimestamp:  sessionStartTime,
 					sessionDBColMDCreationTerminalID: ctxAuth.TerminalIDNumPtr(),
 					sessionDBColMDCreationUserID:     ctxAuth.UserIDNumPtr(),
+					"md_c_origin_address":            originInfo.Address,
+					"md_c_origin_env":                originInfo.EnvironmentString,
 				},
 			).
 			ToSQL()
@@ -160,6 +375,56 @@ func (core *Core) issueSession(
 			errors.Wrap("insert", err)
 	}
 
+	// The session has recorded the origin of this use of the terminal.
+	// The terminal's last use is updated in batches.
+	core.recordTerminalUse(inputCtx, terminalID, sessionStartTime)
+
 	return iam.NewSessionID(terminalID, sessionIDNum),
 		sessionStartTime, sessionExpiry, nil
 }
+
+// IsSessionRevoked returns true if the session, or the terminal it was
+// issued for, has been deleted. A session which is not registered is
+// considered revoked.
+func (core *Core) IsSessionRevoked(
+	sessionID iam.SessionID,
+) (revoked bool, err error) {
+	if sessionID.IsNotStaticallyValid() {
+		return true, nil
+	}
+
+	sqlString, _, _ := goqu.
+		From(goqu.T(sessionDBTableName).As("s")).
+		Join(
+			goqu.T(terminalDBTableName).As("t"),
+			goqu.On(goqu.I("t.id_num").Eq(goqu.I("s."+sessionDBColTerminalID))),
+		).
+		Select(
+			goqu.Case().
+				When(
+					goqu.Or(
+						goqu.I("s."+sessionDBColMDDeletionTimestamp).IsNotNull(),
+						goqu.I("t.md_d_ts").IsNotNull(),
+					),
+					true).
+				Else(false).
+				As("revoked"),
+		).
+		Where(
+			goqu.I("s."+sessionDBColTerminalID).Eq(sessionID.Terminal().IDNum().PrimitiveValue()),
+			goqu.I("s."+sessionDBColIDNum).Eq(sessionID.IDNum().PrimitiveValue()),
+		).
+		ToSQL()
+
+	err = core.db.
+		QueryRow(sqlString).
+		Scan(&revoked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return
+}
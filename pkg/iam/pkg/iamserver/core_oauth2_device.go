@@ -0,0 +1,530 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+const (
+	oauth2DeviceAuthorizationDBTableName = "oauth2_device_authorization_dt"
+
+	oauth2DeviceAuthorizationDBUserCodeIndexName = "oauth2_device_authorization_dt_user_code_pidx"
+)
+
+const (
+	// OAuth2DeviceCodeTTLDefault is the lifetime of a device code and
+	// its user code.
+	OAuth2DeviceCodeTTLDefault = 10 * time.Minute
+	// OAuth2DevicePollingIntervalDefault is the minimum interval between
+	// polling requests a device is initially required to wait.
+	OAuth2DevicePollingIntervalDefault = 5 * time.Second
+
+	// RFC 8628 § 3.5
+	oauth2DevicePollingIntervalIncrement = 5 * time.Second
+)
+
+// The user code character set as recommended in RFC 8628 § 6.1. It contains
+// only consonants to avoid forming words and to avoid ambiguous characters.
+const oauth2DeviceUserCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+const oauth2DeviceUserCodeLength = 8
+
+type OAuth2DeviceAuthorizationStartOutputData struct {
+	DeviceCode string
+	// UserCode is formatted for display, e.g., WDJB-MJHT.
+	UserCode        string
+	ExpiryTime      time.Time
+	PollingInterval time.Duration
+}
+
+// OAuth2DeviceAuthorizationInfo describes a pending device authorization
+// request to the end-user who is about to approve it.
+type OAuth2DeviceAuthorizationInfo struct {
+	ApplicationID iam.ApplicationID
+	Scope         string
+	ExpiryTime    time.Time
+}
+
+// oauth2DeviceAuthorizationDBRawModel represents a row from the device
+// authorization table.
+type oauth2DeviceAuthorizationDBRawModel struct {
+	DeviceCode       string               `db:"device_code"`
+	UserCode         string               `db:"user_code"`
+	ApplicationIDNum iam.ApplicationIDNum `db:"application_id"`
+	Scope            string               `db:"scope"`
+
+	Expiry       time.Time  `db:"expiry"`
+	PollInterval int64      `db:"poll_interval"`
+	PollTime     *time.Time `db:"poll_ts"`
+
+	DecisionTime      *time.Time     `db:"decision_ts"`
+	DecisionUserIDNum *iam.UserIDNum `db:"decision_uid"`
+	Denied            bool           `db:"denied"`
+	TerminalIDNum     *int64         `db:"terminal_id"`
+	ClaimTime         *time.Time     `db:"claim_ts"`
+}
+
+// StartOAuth2DeviceAuthorization creates a device authorization request
+// for the application. The device displays the user code to the end-user
+// and polls the token endpoint with the device code. RFC 8628 § 3.1.
+func (core *Core) StartOAuth2DeviceAuthorization(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	scope string,
+) (*OAuth2DeviceAuthorizationStartOutputData, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	// The device will act on behalf of the end-user
+	if applicationID.IsNotStaticallyValid() || !applicationID.IDNum().IsUserAgent() {
+		return nil, errors.ArgMsg("applicationID", "invalid")
+	}
+
+	scope, err := core.ResolveApplicationScope(applicationID, scope)
+	if err != nil {
+		if err == iam.ErrScopeInvalid {
+			return nil, err
+		}
+		return nil, errors.Wrap("ResolveApplicationScope", err)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	originInfo := inputCtx.OriginInfo()
+
+	deviceCode := core.generateOAuth2DeviceCode()
+	expiry := ctxTime.Add(OAuth2DeviceCodeTTLDefault)
+	pollInterval := OAuth2DevicePollingIntervalDefault
+
+	var userCode string
+	const attemptNumMax = 5
+	for attemptNum := 1; ; attemptNum++ {
+		userCode = generateOAuth2DeviceUserCode()
+
+		sqlString, _, _ := goqu.
+			Insert(oauth2DeviceAuthorizationDBTableName).
+			Rows(
+				goqu.Record{
+					"device_code":         deviceCode,
+					"user_code":           userCode,
+					"application_id":      applicationID.IDNum().PrimitiveValue(),
+					"scope":               scope,
+					"md_c_ts":             ctxTime,
+					"md_c_origin_address": originInfo.Address,
+					"md_c_origin_env":     originInfo.EnvironmentString,
+					"expiry":              expiry,
+					"poll_interval":       int64(pollInterval / time.Second),
+				},
+			).
+			ToSQL()
+		_, err := core.db.
+			Exec(sqlString)
+		if err == nil {
+			break
+		}
+
+		pqErr, _ := err.(*pq.Error)
+		if pqErr != nil &&
+			pqErr.Code == "23505" &&
+			pqErr.Constraint == oauth2DeviceAuthorizationDBUserCodeIndexName {
+			if attemptNum >= attemptNumMax {
+				return nil, errors.Wrap("insert max attempts", err)
+			}
+			continue
+		}
+
+		return nil, errors.Wrap("insert", err)
+	}
+
+	return &OAuth2DeviceAuthorizationStartOutputData{
+		DeviceCode:      deviceCode,
+		UserCode:        formatOAuth2DeviceUserCode(userCode),
+		ExpiryTime:      expiry,
+		PollingInterval: pollInterval,
+	}, nil
+}
+
+// GetOAuth2DeviceAuthorizationByUserCode retrieves the pending device
+// authorization request identified by the user code. It returns
+// iam.ErrDeviceUserCodeInvalid if there's no such request or if the
+// request has expired or has been decided.
+func (core *Core) GetOAuth2DeviceAuthorizationByUserCode(
+	inputCtx iam.CallInputContext,
+	userCode string,
+) (*OAuth2DeviceAuthorizationInfo, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return nil, iam.ErrUserContextRequired
+	}
+
+	userCode = normalizeOAuth2DeviceUserCode(userCode)
+	if userCode == "" {
+		return nil, errors.Arg("userCode", dataerrs.ErrEmpty)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	var appIDNum iam.ApplicationIDNum
+	var scope string
+	var expiry time.Time
+	sqlString, _, _ := goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Select("application_id", "scope", "expiry").
+		Where(
+			goqu.C("user_code").Eq(userCode),
+			goqu.C("decision_ts").IsNull(),
+			goqu.C("expiry").Gt(ctxTime),
+		).
+		ToSQL()
+	err := core.db.
+		QueryRow(sqlString).
+		Scan(&appIDNum, &scope, &expiry)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, iam.ErrDeviceUserCodeInvalid
+		}
+		return nil, err
+	}
+
+	return &OAuth2DeviceAuthorizationInfo{
+		ApplicationID: iam.NewApplicationID(appIDNum),
+		Scope:         scope,
+		ExpiryTime:    expiry,
+	}, nil
+}
+
+// DecideOAuth2DeviceAuthorization records the end-user's decision on
+// the device authorization request identified by the user code. If the
+// request is approved, a terminal will be registered for the device.
+// RFC 8628 § 3.3.
+func (core *Core) DecideOAuth2DeviceAuthorization(
+	inputCtx iam.CallInputContext,
+	userCode string,
+	approved bool,
+) (iam.CallOutputContext, error) {
+	if inputCtx == nil {
+		return iam.CallOutputContext{}, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return iam.CallOutputContext{}, iam.ErrUserContextRequired
+	}
+
+	userCode = normalizeOAuth2DeviceUserCode(userCode)
+	if userCode == "" {
+		return iam.CallOutputContext{}, errors.Arg("userCode", dataerrs.ErrEmpty)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	decisionRecord := goqu.Record{
+		"decision_ts":  ctxTime,
+		"decision_uid": ctxAuth.UserIDNumPtr(),
+		"decision_tid": ctxAuth.TerminalIDNumPtr(),
+		"denied":       !approved,
+	}
+
+	if !approved {
+		updated, err := core.updateOAuth2DeviceAuthorizationDecision(
+			userCode, ctxTime, decisionRecord)
+		if err != nil {
+			return iam.CallOutputContext{}, errors.Wrap("updateOAuth2DeviceAuthorizationDecision", err)
+		}
+		if !updated {
+			return iam.CallOutputContext{}, iam.ErrDeviceUserCodeInvalid
+		}
+		return iam.CallOutputContext{Mutated: true}, nil
+	}
+
+	authzInfo, err := core.GetOAuth2DeviceAuthorizationByUserCode(inputCtx, userCode)
+	if err != nil {
+		return iam.CallOutputContext{}, err
+	}
+
+	regOutCtx, regOutData := core.RegisterTerminal(inputCtx,
+		TerminalRegistrationInputData{
+			ApplicationID:    authzInfo.ApplicationID,
+			UserID:           ctxAuth.UserID(),
+			VerificationType: iam.TerminalVerificationResourceTypeOAuthDeviceCode,
+			VerificationID:   0,
+
+			OAuth2Scope: authzInfo.Scope,
+		})
+	if regOutCtx.Err != nil {
+		return iam.CallOutputContext{},
+			errors.Wrap("RegisterTerminal", regOutCtx.Err)
+	}
+
+	// The decision and the terminal are recorded in a single conditional
+	// update so that a user code could only be decided once, and that
+	// the device never observes an approval without a terminal.
+	decisionRecord["terminal_id"] = regOutData.TerminalID.IDNum().PrimitiveValue()
+	updated, err := core.updateOAuth2DeviceAuthorizationDecision(
+		userCode, ctxTime, decisionRecord)
+	if err != nil {
+		return iam.CallOutputContext{Mutated: true},
+			errors.Wrap("updateOAuth2DeviceAuthorizationDecision", err)
+	}
+	if !updated {
+		// Another decision has been made since we checked. The terminal
+		// we have just registered would never be claimed.
+		_, err = core.revokeTerminalInsecure(inputCtx, regOutData.TerminalID.IDNum())
+		if err != nil {
+			return iam.CallOutputContext{Mutated: true},
+				errors.Wrap("revokeTerminalInsecure", err)
+		}
+		return iam.CallOutputContext{Mutated: true}, iam.ErrDeviceUserCodeInvalid
+	}
+
+	return iam.CallOutputContext{Mutated: true}, nil
+}
+
+// updateOAuth2DeviceAuthorizationDecision records the decision on
+// the pending request identified by the user code. It returns false
+// if there's no such pending request.
+func (core *Core) updateOAuth2DeviceAuthorizationDecision(
+	userCode string,
+	ctxTime time.Time,
+	decisionRecord goqu.Record,
+) (updated bool, err error) {
+	sqlString, _, _ := goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Where(
+			goqu.C("user_code").Eq(userCode),
+			goqu.C("decision_ts").IsNull(),
+			goqu.C("expiry").Gt(ctxTime),
+		).
+		Update().
+		Set(decisionRecord).
+		ToSQL()
+	xres, err := core.db.
+		Exec(sqlString)
+	if err != nil {
+		return false, err
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// ExchangeOAuth2DeviceCode is used by the device to poll the state of
+// its authorization request. Once the request has been approved, the
+// terminal's credentials are returned; it could only be done once.
+// RFC 8628 § 3.4.
+//
+// While the request is pending, the method returns
+// iam.ErrDeviceAuthorizationPending, or
+// iam.ErrDeviceAuthorizationPollingTooFrequent if the device did not
+// respect the polling interval. The errors of the terminal's
+// confirmation, e.g., *ratelimit.ExceededError, are returned as they
+// are.
+func (core *Core) ExchangeOAuth2DeviceCode(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	deviceCode string,
+) (terminalID iam.TerminalID, userID iam.UserID, terminalSecret string, err error) {
+	if inputCtx == nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", errors.ArgMsg("inputCtx", "missing")
+	}
+	if deviceCode == "" {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", errors.Arg("deviceCode", dataerrs.ErrEmpty)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	var authData oauth2DeviceAuthorizationDBRawModel
+	sqlString, _, _ := goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Select(
+			"device_code", "user_code", "application_id", "scope",
+			"expiry", "poll_interval", "poll_ts",
+			"decision_ts", "decision_uid", "denied", "terminal_id",
+			"claim_ts").
+		Where(
+			goqu.C("device_code").Eq(deviceCode),
+		).
+		ToSQL()
+	err = core.db.
+		QueryRowx(sqlString).
+		StructScan(&authData)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return iam.TerminalIDZero(), iam.UserIDZero(), "",
+				errors.ArgMsg("deviceCode", "reference invalid")
+		}
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", err
+	}
+
+	// RFC 8628 § 3.4
+	if !authData.ApplicationIDNum.EqualsApplicationIDNum(applicationID.IDNum()) {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			errors.ArgMsg("deviceCode", "issued to other application")
+	}
+	if authData.ClaimTime != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			iam.ErrAuthorizationCodeAlreadyClaimed
+	}
+	if authData.DecisionTime != nil && authData.Denied {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			iam.ErrDeviceAuthorizationDenied
+	}
+	if !authData.Expiry.After(ctxTime) {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			iam.ErrDeviceCodeExpired
+	}
+
+	pollInterval := time.Duration(authData.PollInterval) * time.Second
+	tooFrequent := authData.PollTime != nil &&
+		ctxTime.Sub(*authData.PollTime) < pollInterval
+	if tooFrequent {
+		pollInterval += oauth2DevicePollingIntervalIncrement
+	}
+
+	// The update is conditional on the poll time we have read so that
+	// only one of the concurrent polls passes the check.
+	pollTimeCond := goqu.C("poll_ts").IsNull()
+	if authData.PollTime != nil {
+		pollTimeCond = goqu.C("poll_ts").Eq(*authData.PollTime)
+	}
+	sqlString, _, _ = goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Where(
+			goqu.C("device_code").Eq(deviceCode),
+			pollTimeCond,
+		).
+		Update().
+		Set(
+			goqu.Record{
+				"poll_ts":       ctxTime,
+				"poll_interval": int64(pollInterval / time.Second),
+			},
+		).
+		ToSQL()
+	xres, err := core.db.
+		Exec(sqlString)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", errors.Wrap("update", err)
+	}
+
+	if tooFrequent || n != 1 {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			iam.ErrDeviceAuthorizationPollingTooFrequent
+	}
+	// The terminal might not have been registered yet right after
+	// the approval.
+	if authData.TerminalIDNum == nil || authData.DecisionUserIDNum == nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "",
+			iam.ErrDeviceAuthorizationPending
+	}
+
+	terminalID = iam.NewTerminalID(
+		applicationID,
+		iam.NewUserID(*authData.DecisionUserIDNum),
+		iam.TerminalIDNum(*authData.TerminalIDNum))
+
+	// The confirmation could be done only once; it returns
+	// iam.ErrAuthorizationCodeAlreadyClaimed for the subsequent ones.
+	// The code is claimed only after the confirmation succeeded so
+	// that the device could retry if it failed, e.g., it has been rate
+	// limited.
+	terminalSecret, userID, err = core.
+		ConfirmTerminalAuthorization(inputCtx, terminalID, deviceCode)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", err
+	}
+
+	sqlString, _, _ = goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Where(
+			goqu.C("device_code").Eq(deviceCode),
+			goqu.C("claim_ts").IsNull(),
+		).
+		Update().
+		Set(
+			goqu.Record{
+				"claim_ts": ctxTime,
+			},
+		).
+		ToSQL()
+	_, err = core.db.
+		Exec(sqlString)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", errors.Wrap("update", err)
+	}
+
+	return terminalID, userID, terminalSecret, nil
+}
+
+func (core *Core) generateOAuth2DeviceCode() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func generateOAuth2DeviceUserCode() string {
+	charsetLen := len(oauth2DeviceUserCodeCharset)
+	// Rejecting the values beyond the largest multiple of the charset
+	// length to keep the distribution uniform.
+	maxVal := 256 - (256 % charsetLen)
+
+	code := make([]byte, 0, oauth2DeviceUserCodeLength)
+	b := make([]byte, 1)
+	for len(code) < oauth2DeviceUserCodeLength {
+		_, err := rand.Read(b)
+		if err != nil {
+			panic(err)
+		}
+		if int(b[0]) >= maxVal {
+			continue
+		}
+		code = append(code, oauth2DeviceUserCodeCharset[int(b[0])%charsetLen])
+	}
+	return string(code)
+}
+
+// formatOAuth2DeviceUserCode splits the code into two groups for
+// readability.
+func formatOAuth2DeviceUserCode(userCode string) string {
+	if len(userCode) != oauth2DeviceUserCodeLength {
+		return userCode
+	}
+	half := oauth2DeviceUserCodeLength / 2
+	return userCode[:half] + "-" + userCode[half:]
+}
+
+// normalizeOAuth2DeviceUserCode converts the user input into the stored
+// form. The input is case-insensitive and any punctuation and whitespace
+// are ignored. RFC 8628 § 6.1.
+func normalizeOAuth2DeviceUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r = r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, userCode)
+}
@@ -0,0 +1,29 @@
+package iamserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth2DeviceUserCodeGeneration(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code := generateOAuth2DeviceUserCode()
+		assert.Len(t, code, oauth2DeviceUserCodeLength)
+		for _, c := range code {
+			assert.True(t, strings.ContainsRune(oauth2DeviceUserCodeCharset, c))
+		}
+	}
+}
+
+func TestOAuth2DeviceUserCodeFormatting(t *testing.T) {
+	assert.Equal(t, "WDJB-MJHT", formatOAuth2DeviceUserCode("WDJBMJHT"))
+	assert.Equal(t, "WDJB", formatOAuth2DeviceUserCode("WDJB"))
+}
+
+func TestOAuth2DeviceUserCodeNormalization(t *testing.T) {
+	assert.Equal(t, "WDJBMJHT", normalizeOAuth2DeviceUserCode("WDJB-MJHT"))
+	assert.Equal(t, "WDJBMJHT", normalizeOAuth2DeviceUserCode(" wdjb mjht "))
+	assert.Equal(t, "", normalizeOAuth2DeviceUserCode("-"))
+}
@@ -0,0 +1,331 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/square/go-jose/v3/jwt"
+
+	apperrs "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/app/errors"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+const terminalRefreshTokenDBTableName = "terminal_refresh_token_dt"
+
+// ExchangeRefreshTokenJWT validates a refresh token, issues a new token
+// set for the token's terminal and then marks the token as rotated.
+// The token is marked only after the new token set has been issued so
+// that the client could retry with the same token if the issuance
+// failed.
+//
+// The refresh token must have been issued to the application identified
+// by applicationID. Refresh tokens are single-use. If the provided token
+// has already been rotated, the terminal will be revoked and the method
+// returns iam.ErrRefreshTokenAlreadyRotated.
+func (core *Core) ExchangeRefreshTokenJWT(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	refreshToken string,
+) (terminalID iam.TerminalID, userID iam.UserID, accessToken string, newRefreshToken string, err error) {
+	if inputCtx == nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "", errors.ArgMsg("inputCtx", "missing")
+	}
+	if refreshToken == "" {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "", errors.Arg("refreshToken", dataerrs.ErrEmpty)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	claims, terminalID, err := core.
+		parseRefreshTokenJWT(refreshToken, ctxTime)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "", err
+	}
+
+	// RFC 6749 § 10.4
+	if !terminalID.Application().EqualsApplicationID(applicationID) {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Arg("refreshToken", errors.EntMsg("terminal_id", "issued to other application"))
+	}
+
+	userID, err = core.AuthenticateTerminalByCredentials(
+		inputCtx, nil, terminalID, claims.TerminalSecret)
+	if err != nil {
+		if err == iam.ErrTerminalCredentialsInvalid {
+			return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+				errors.Arg("refreshToken", errors.EntMsg("terminal_id", "authentication failed"))
+		}
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Wrap("AuthenticateTerminalByCredentials", err)
+	}
+
+	// The sweeper revokes the idle terminals periodically; this covers
+	// the time in between.
+	idle, err := core.isTerminalIdleInsecure(terminalID.IDNum(), ctxTime)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Wrap("isTerminalIdleInsecure", err)
+	}
+	if idle {
+		_, err = core.revokeTerminalInsecure(inputCtx, terminalID.IDNum())
+		if err != nil {
+			return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+				errors.Wrap("revokeTerminalInsecure", err)
+		}
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Arg("refreshToken", errors.EntMsg("terminal_id", "idle"))
+	}
+
+	active, rotated, err := core.getRefreshTokenState(terminalID, claims.ID, ctxTime)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Wrap("getRefreshTokenState", err)
+	}
+	if rotated {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			core.revokeReusedRefreshTokenTerminal(inputCtx, terminalID)
+	}
+	if !active {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Arg("refreshToken", errors.EntMsg("jti", "reference invalid"))
+	}
+
+	accessToken, newRefreshToken, err = core.
+		GenerateTokenSetJWT(inputCtx, terminalID, userID, claims.TerminalSecret)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Wrap("GenerateTokenSetJWT", err)
+	}
+
+	// The new token set is discarded if the token could not be rotated.
+	// They are never handed out so there's no need to revoke them.
+	rotated, err = core.rotateRefreshToken(inputCtx, terminalID, claims.ID)
+	if err != nil {
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			errors.Wrap("rotateRefreshToken", err)
+	}
+	if !rotated {
+		// Another exchange of the same token has come in between.
+		return iam.TerminalIDZero(), iam.UserIDZero(), "", "",
+			core.revokeReusedRefreshTokenTerminal(inputCtx, terminalID)
+	}
+
+	return terminalID, userID, accessToken, newRefreshToken, nil
+}
+
+// revokeReusedRefreshTokenTerminal revokes the terminal of a refresh
+// token which has been used more than once. Either the legitimate client
+// or an attacker is holding a stolen token; we can't tell which one,
+// so we revoke the whole terminal.
+func (core *Core) revokeReusedRefreshTokenTerminal(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+) error {
+	_, err := core.revokeTerminalInsecure(inputCtx, terminalID.IDNum())
+	if err != nil {
+		return errors.Wrap("revokeTerminalInsecure", err)
+	}
+	return iam.ErrRefreshTokenAlreadyRotated
+}
+
+// parseRefreshTokenJWT parses and verifies a refresh token. The token's
+// time-based claims are checked against refTime. Note that this method
+// does not consult the database.
+func (core *Core) parseRefreshTokenJWT(
+	refreshToken string,
+	refTime time.Time,
+) (claims *iam.RefreshTokenClaims, terminalID iam.TerminalID, err error) {
+	jwtKeyChain := core.JWTKeyChain()
+	if jwtKeyChain == nil {
+		return nil, iam.TerminalIDZero(),
+			apperrs.NewConfigurationMsg("JWT key chain is not configured")
+	}
+
+	tok, err := jwt.ParseSigned(refreshToken)
+	if err != nil {
+		return nil, iam.TerminalIDZero(),
+			errors.ArgWrap("refreshToken", "parsing", err)
+	}
+	if len(tok.Headers) != 1 {
+		return nil, iam.TerminalIDZero(),
+			errors.ArgMsg("refreshToken", "invalid number of headers")
+	}
+	keyID := tok.Headers[0].KeyID
+	if keyID == "" {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("kid", "empty"))
+	}
+	verifierKey := jwtKeyChain.GetSignedVerifierKey(keyID)
+	if verifierKey == nil {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("kid", "reference invalid"))
+	}
+
+	claims = &iam.RefreshTokenClaims{}
+	err = tok.Claims(verifierKey, claims)
+	if err != nil {
+		return nil, iam.TerminalIDZero(),
+			errors.ArgWrap("refreshToken", "verification", err)
+	}
+
+	if claims.ExpiresAt == 0 || !refTime.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("exp", "expired"))
+	}
+	if claims.NotBefore != 0 && refTime.Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("nbf", "not yet valid"))
+	}
+	if claims.ID == "" {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("jti", "empty"))
+	}
+	if claims.TerminalID == "" {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.EntMsg("terminal_id", "empty"))
+	}
+	terminalID, err = iam.TerminalIDFromAZIDText(claims.TerminalID)
+	if err != nil {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.Ent("terminal_id", dataerrs.Malformed(err)))
+	}
+	if terminalID.IsNotStaticallyValid() {
+		return nil, iam.TerminalIDZero(),
+			errors.Arg("refreshToken", errors.Ent("terminal_id", dataerrs.ErrMalformed))
+	}
+
+	return claims, terminalID, nil
+}
+
+// issueRefreshToken registers a new refresh token for the terminal.
+func (core *Core) issueRefreshToken(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+	issueTime time.Time,
+) (tokenID string, expiry time.Time, err error) {
+	ctxAuth := inputCtx.Authorization()
+
+	tokenID = core.generateRefreshTokenID()
+	expiry = issueTime.Add(iam.RefreshTokenTTLDefault)
+
+	sqlString, _, _ := goqu.
+		Insert(terminalRefreshTokenDBTableName).
+		Rows(
+			goqu.Record{
+				"terminal_id": terminalID.IDNum().PrimitiveValue(),
+				"token_id":    tokenID,
+				"expiry":      expiry,
+				"md_c_ts":     issueTime,
+				"md_c_tid":    ctxAuth.TerminalIDNumPtr(),
+				"md_c_uid":    ctxAuth.UserIDNumPtr(),
+			},
+		).
+		ToSQL()
+	_, err = core.db.
+		Exec(sqlString)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap("insert", err)
+	}
+
+	return tokenID, expiry, nil
+}
+
+// rotateRefreshToken marks the refresh token as rotated. It returns false
+// if the token does not exist, has been revoked or has already been
+// rotated.
+func (core *Core) rotateRefreshToken(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+	tokenID string,
+) (rotated bool, err error) {
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	sqlString, _, _ := goqu.
+		From(terminalRefreshTokenDBTableName).
+		Where(
+			goqu.C("terminal_id").Eq(terminalID.IDNum().PrimitiveValue()),
+			goqu.C("token_id").Eq(tokenID),
+			goqu.C("md_d_ts").IsNull(),
+			goqu.C("rotation_ts").IsNull(),
+			goqu.C("expiry").Gt(ctxTime),
+		).
+		Update().
+		Set(
+			goqu.Record{
+				"rotation_ts": ctxTime,
+			},
+		).
+		ToSQL()
+
+	xres, err := core.db.
+		Exec(sqlString)
+	if err != nil {
+		return false, err
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// getRefreshTokenState returns whether the refresh token could still be
+// exchanged at refTime, and whether it has been rotated.
+func (core *Core) getRefreshTokenState(
+	terminalID iam.TerminalID,
+	tokenID string,
+	refTime time.Time,
+) (active bool, rotated bool, err error) {
+	var expiry time.Time
+	var deletionTime, rotationTime *time.Time
+	sqlString, _, _ := goqu.
+		From(terminalRefreshTokenDBTableName).
+		Select("expiry", "md_d_ts", "rotation_ts").
+		Where(
+			goqu.C("terminal_id").Eq(terminalID.IDNum().PrimitiveValue()),
+			goqu.C("token_id").Eq(tokenID),
+		).
+		ToSQL()
+
+	err = core.db.
+		QueryRow(sqlString).
+		Scan(&expiry, &deletionTime, &rotationTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	rotated = rotationTime != nil
+	active = !rotated && deletionTime == nil && expiry.After(refTime)
+	return active, rotated, nil
+}
+
+// isRefreshTokenJWTUnverified tells whether the token is a refresh token
+// by looking at its claims. Only refresh tokens carry the terminal secret.
+// Note that this function does not verify the token's signature.
+func isRefreshTokenJWTUnverified(tok *jwt.JSONWebToken) bool {
+	var claims struct {
+		TerminalSecret string `json:"terminal_secret,omitempty"`
+	}
+	err := tok.UnsafeClaimsWithoutVerification(&claims)
+	if err != nil {
+		return false
+	}
+	return claims.TerminalSecret != ""
+}
+
+func (core *Core) generateRefreshTokenID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,51 @@
+package iamserver
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RegisterScope registers a scope so that it could be requested by
+// the applications. The resource services' scopes should be registered
+// before the server starts serving requests.
+func (core *Core) RegisterScope(def iam.ScopeDefinition) error {
+	return core.scopeRegistry.Register(def)
+}
+
+// ScopeDefinition returns the definition of a registered scope. It
+// returns nil if the scope is not registered.
+func (core *Core) ScopeDefinition(scopeName string) *iam.ScopeDefinition {
+	return core.scopeRegistry.Get(scopeName)
+}
+
+// ResolveApplicationScope validates the scope requested by the application
+// and returns the scope to be granted. It returns iam.ErrScopeInvalid
+// if the application is not allowed to request any of the scopes.
+func (core *Core) ResolveApplicationScope(
+	applicationID iam.ApplicationID,
+	requestedScope string,
+) (grantedScope string, err error) {
+	app, err := core.ApplicationByID(applicationID)
+	if err != nil {
+		return "", errors.Wrap("ApplicationByID", err)
+	}
+	if app == nil {
+		return "", errors.ArgMsg("applicationID", "reference invalid")
+	}
+	return core.scopeRegistry.ResolveApplicationScope(app, requestedScope)
+}
+
+// getTerminalOAuth2Scope returns the scope granted to the terminal.
+func (core *Core) getTerminalOAuth2Scope(
+	terminalID iam.TerminalID,
+) (scope string, err error) {
+	termData, err := core.getTerminalRaw(terminalID.IDNum())
+	if err != nil {
+		return "", errors.Wrap("getTerminalRaw", err)
+	}
+	if termData == nil {
+		return "", nil
+	}
+	return termData.OAuth2Scope, nil
+}
@@ -2,16 +2,18 @@ package iamserver
 
 import (
 	"crypto/rand"
-	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
 	"fmt"
 	"strings"
 
 	"github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
 	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
 	"golang.org/x/text/language"
 
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
@@ -21,40 +23,6 @@ var (
 	errTerminalVerificationConfirmationReplayed = errors.EntMsg("terminal verification confirmation", "replayed")
 )
 
-func (core *Core) AuthenticateTerminal(
-	terminalID iam.TerminalID,
-	terminalSecret string,
-) (authOK bool, ownerUserID iam.UserID, err error) {
-	var storedSecret string
-	var ownerUserIDNum iam.UserIDNum
-
-	sqlString, _, _ := goqu.
-		From(terminalDBTableName).
-		Select("user_id", "secret").
-		Where(
-			goqu.C("id_num").Eq(terminalID.IDNum().PrimitiveValue()),
-			goqu.C("md_d_ts").IsNull(),
-			goqu.C("verification_ts").IsNotNull(),
-		).
-		ToSQL()
-
-	err = core.db.
-		QueryRow(sqlString).
-		Scan(&ownerUserIDNum, &storedSecret)
-	if err == sql.ErrNoRows {
-		return false, iam.UserIDZero(), nil
-	}
-	if err != nil {
-		return false, iam.UserIDZero(), err
-	}
-
-	return subtle.ConstantTimeCompare(
-			[]byte(storedSecret),
-			[]byte(terminalSecret),
-		) == 1,
-		iam.NewUserID(ownerUserIDNum), nil
-}
-
 func (core *Core) StartTerminalAuthorizationByPhoneNumber(
 	inputCtx iam.CallInputContext,
 	inputData TerminalAuthorizationByPhoneNumberStartInputData,
@@ -71,6 +39,12 @@ func (core *Core) StartTerminalAuthorizationByPhoneNumber(
 			TerminalAuthorizationStartOutputData{}
 	}
 
+	err := core.takeRateLimits(inputCtx, core.verificationStartRateLimitKeys(
+		inputCtx, phoneNumber.String(), inputData.ApplicationID)...)
+	if err != nil {
+		return iam.CallOutputContext{Err: err}, TerminalAuthorizationStartOutputData{}
+	}
+
 	// Get the existing owner, whether already verified or not.
 	ownerUserID, _, err := core.
 		getUserIDByKeyPhoneNumberAllowUnverifiedInsecure(phoneNumber)
@@ -151,6 +125,12 @@ func (core *Core) StartTerminalAuthorizationByEmailAddress(
 			TerminalAuthorizationStartOutputData{}
 	}
 
+	err := core.takeRateLimits(inputCtx, core.verificationStartRateLimitKeys(
+		inputCtx, emailAddress.String(), inputData.ApplicationID)...)
+	if err != nil {
+		return iam.CallOutputContext{Err: err}, TerminalAuthorizationStartOutputData{}
+	}
+
 	// Get the existing owner, whether already verified or not.
 	ownerUserID, _, err := core.
 		getUserIDByKeyEmailAddressAllowUnverifiedInsecure(emailAddress)
@@ -228,11 +208,39 @@ func (core *Core) StartTerminalAuthorizationByEmailAddress(
 
 // ConfirmTerminalAuthorization confirms authorization of a
 // terminal by providing the verificationCode which was delivered through
-// selected channel when the authorization was created.
+// selected channel when the authorization was created. If the user has
+// enabled a second factor, it returns an *MFARequiredError.
 func (core *Core) ConfirmTerminalAuthorization(
 	inputCtx iam.CallInputContext,
 	terminalID iam.TerminalID,
 	verificationCode string,
+) (terminalSecret string, userID iam.UserID, err error) {
+	return core.confirmTerminalAuthorization(
+		inputCtx, terminalID, verificationCode, "")
+}
+
+// ConfirmTerminalOAuth2AuthorizationCode is the ConfirmTerminalAuthorization
+// for the authorization code grant. Only the terminals registered through
+// the authorization endpoint are accepted; the code verifier is the PKCE
+// code verifier. RFC 6749 § 4.1.3.
+func (core *Core) ConfirmTerminalOAuth2AuthorizationCode(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+	codeVerifier string,
+) (terminalSecret string, userID iam.UserID, err error) {
+	return core.confirmTerminalAuthorization(
+		inputCtx, terminalID, codeVerifier,
+		iam.TerminalVerificationResourceTypeOAuthAuthorizationCode)
+}
+
+// confirmTerminalAuthorization confirms the authorization of the terminal.
+// If verificationType is not empty, the terminal must have been registered
+// with the verification type.
+func (core *Core) confirmTerminalAuthorization(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+	verificationCode string,
+	verificationType string,
 ) (terminalSecret string, userID iam.UserID, err error) {
 	// The code is verified based on the identifier used when the verification
 	// was requested. Each of the implementation required to implement
@@ -240,6 +248,14 @@ func (core *Core) ConfirmTerminalAuthorization(
 
 	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
 
+	rateLimitKeys := core.verificationConfirmRateLimitKeys(inputCtx, terminalID)
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return "", iam.UserIDZero(), err
+	}
+	defer attempt.end()
+
 	termData, err := core.getTerminalRaw(terminalID.IDNum())
 	if err != nil {
 		panic(err)
@@ -247,6 +263,10 @@ func (core *Core) ConfirmTerminalAuthorization(
 	if termData == nil {
 		return "", iam.UserIDZero(), errors.ArgMsg("terminalID", "reference invalid")
 	}
+	if verificationType != "" && termData.VerificationType != verificationType {
+		attempt.fail()
+		return "", iam.UserIDZero(), iam.ErrTerminalVerificationCodeMismatch
+	}
 	disallowReplay := false
 
 	if termData.UserIDNum.IsStaticallyValid() {
@@ -262,6 +282,7 @@ func (core *Core) ConfirmTerminalAuthorization(
 			if err != nil {
 				switch err {
 				case eav10n.ErrVerificationCodeMismatch:
+					attempt.fail()
 					return "", iam.UserIDZero(), iam.ErrTerminalVerificationCodeMismatch
 				case eav10n.ErrVerificationCodeExpired:
 					return "", iam.UserIDZero(), iam.ErrTerminalVerificationCodeExpired
@@ -308,6 +329,7 @@ func (core *Core) ConfirmTerminalAuthorization(
 			if err != nil {
 				switch err {
 				case pnv10n.ErrVerificationCodeMismatch:
+					attempt.fail()
 					return "", iam.UserIDZero(), iam.ErrTerminalVerificationCodeMismatch
 				case pnv10n.ErrVerificationCodeExpired:
 					return "", iam.UserIDZero(), iam.ErrTerminalVerificationCodeExpired
@@ -346,6 +368,25 @@ func (core *Core) ConfirmTerminalAuthorization(
 			}
 
 		case iam.TerminalVerificationResourceTypeOAuthAuthorizationCode:
+			// For this verification type, the verification code is
+			// the PKCE code verifier.
+			err = core.verifyTerminalOAuth2CodeVerifier(
+				terminalID, termData, verificationCode)
+			if err != nil {
+				return "", iam.UserIDZero(), err
+			}
+			disallowReplay = true
+
+		case iam.TerminalVerificationResourceTypeOAuthDeviceCode:
+			// For this verification type, the verification code is
+			// the device code which the end-user has approved.
+			err = core.verifyTerminalOAuth2DeviceCode(termData, verificationCode)
+			if err != nil {
+				if err == iam.ErrTerminalVerificationCodeMismatch {
+					attempt.fail()
+				}
+				return "", iam.UserIDZero(), err
+			}
 			disallowReplay = true
 
 		default:
@@ -353,6 +394,19 @@ func (core *Core) ConfirmTerminalAuthorization(
 		}
 	}
 
+	// The terminals authorized through the user's email address or phone
+	// number need the second factor, if the user has enabled one. Those
+	// authorized through OAuth are authorized by a signed-in user.
+	switch termData.VerificationType {
+	case iam.TerminalVerificationResourceTypeEmailAddress,
+		iam.TerminalVerificationResourceTypePhoneNumber:
+		err = core.requireTerminalSecondFactor(
+			inputCtx, termData.IDNum, iam.NewUserID(termData.UserIDNum))
+		if err != nil {
+			return "", iam.UserIDZero(), err
+		}
+	}
+
 	termSecret, err := core.
 		setTerminalVerified(inputCtx, termData.IDNum, disallowReplay)
 	if err != nil {
@@ -365,6 +419,96 @@ func (core *Core) ConfirmTerminalAuthorization(
 	return termSecret, iam.NewUserID(termData.UserIDNum), nil
 }
 
+// verifyTerminalOAuth2CodeVerifier checks the code verifier against the
+// code challenge registered along with the terminal. RFC 7636 § 4.6.
+func (core *Core) verifyTerminalOAuth2CodeVerifier(
+	terminalID iam.TerminalID,
+	termData *terminalDBRawModel,
+	codeVerifier string,
+) error {
+	if termData.OAuth2CodeChallenge == "" {
+		app, err := core.ApplicationByID(terminalID.Application())
+		if err != nil {
+			return errors.Wrap("ApplicationByID", err)
+		}
+		// The requirement might have been changed after the terminal
+		// was registered.
+		if app == nil || app.IsOAuth2PKCERequired() {
+			return iam.ErrAuthorizationCodeVerifierMismatch
+		}
+		// A verifier without a challenge is considered as an attempt
+		// of a downgrade attack.
+		if codeVerifier != "" {
+			return iam.ErrAuthorizationCodeVerifierMismatch
+		}
+		return nil
+	}
+
+	method := oauth2.CodeChallengeMethodFromString(termData.OAuth2CodeChallengeMethod)
+	if !method.VerifyCodeVerifier(termData.OAuth2CodeChallenge, codeVerifier) {
+		return iam.ErrAuthorizationCodeVerifierMismatch
+	}
+	return nil
+}
+
+// verifyTerminalOAuth2DeviceCode checks that the device code is the one
+// of the device authorization request which the terminal was registered
+// for.
+func (core *Core) verifyTerminalOAuth2DeviceCode(
+	termData *terminalDBRawModel,
+	deviceCode string,
+) error {
+	if deviceCode == "" {
+		return iam.ErrTerminalVerificationCodeMismatch
+	}
+
+	sqlString, _, _ := goqu.
+		From(oauth2DeviceAuthorizationDBTableName).
+		Select(goqu.L("1")).
+		Where(
+			goqu.C("device_code").Eq(deviceCode),
+			goqu.C("application_id").Eq(termData.ApplicationIDNum.PrimitiveValue()),
+			goqu.C("terminal_id").Eq(termData.IDNum.PrimitiveValue()),
+		).
+		ToSQL()
+	var found int
+	err := core.db.
+		QueryRow(sqlString).
+		Scan(&found)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return iam.ErrTerminalVerificationCodeMismatch
+		}
+		return errors.Wrap("device authorization query", err)
+	}
+
+	return nil
+}
+
+// GetTerminalOAuth2AuthorizationData retrieves the parameters of
+// the authorization request which the terminal was registered for.
+func (core *Core) GetTerminalOAuth2AuthorizationData(
+	terminalID iam.TerminalID,
+) (*TerminalOAuth2AuthorizationData, error) {
+	if terminalID.IsNotStaticallyValid() {
+		return nil, errors.ArgMsg("terminalID", "invalid")
+	}
+
+	termData, err := core.getTerminalRaw(terminalID.IDNum())
+	if err != nil {
+		return nil, errors.Wrap("getTerminalRaw", err)
+	}
+	if termData == nil {
+		return nil, nil
+	}
+
+	return &TerminalOAuth2AuthorizationData{
+		Scope:             termData.OAuth2Scope,
+		OIDCNonce:         termData.OIDCNonce,
+		AuthorizationTime: termData.CreationTime,
+	}, nil
+}
+
 func (core *Core) getTerminalRaw(idNum iam.TerminalIDNum) (*terminalDBRawModel, error) {
 	var err error
 	var ut terminalDBRawModel
@@ -375,7 +519,9 @@ func (core *Core) getTerminalRaw(idNum iam.TerminalIDNum) (*terminalDBRawModel,
 			"id_num", "application_id", "user_id",
 			"md_c_ts", "md_c_uid", "md_c_tid", "md_c_origin_address",
 			"display_name", "accept_language",
-			"verification_type", "verification_id", "verification_ts").
+			"verification_type", "verification_id", "verification_ts",
+			"oauth2_code_challenge", "oauth2_code_challenge_method",
+			"oauth2_scope", "oidc_nonce").
 		Where(
 			goqu.C("id_num").Eq(idNum.PrimitiveValue())).
 		ToSQL()
@@ -484,6 +630,38 @@ func (core *Core) RegisterTerminal(
 			TerminalRegistrationOutputData{}
 	}
 
+	if inputData.VerificationType == iam.TerminalVerificationResourceTypeOAuthAuthorizationCode {
+		if inputData.OAuth2CodeChallenge == "" {
+			if appInfo.IsOAuth2PKCERequired() {
+				return iam.CallOutputContext{
+						Err: errors.ArgMsg("input", "code challenge required",
+							errors.Ent("OAuth2CodeChallenge", dataerrs.ErrEmpty))},
+					TerminalRegistrationOutputData{}
+			}
+		} else {
+			// RFC 7636 § 4.2
+			if !oauth2.IsCodeVerifierValid(inputData.OAuth2CodeChallenge) {
+				return iam.CallOutputContext{
+						Err: errors.ArgMsg("input", "code challenge check",
+							errors.Ent("OAuth2CodeChallenge", dataerrs.ErrMalformed))},
+					TerminalRegistrationOutputData{}
+			}
+			switch inputData.OAuth2CodeChallengeMethod {
+			case oauth2.CodeChallengeMethodPlain, oauth2.CodeChallengeMethodS256:
+			default:
+				return iam.CallOutputContext{
+						Err: errors.ArgMsg("input", "code challenge method check",
+							errors.Ent("OAuth2CodeChallengeMethod", dataerrs.ErrTypeUnsupported))},
+					TerminalRegistrationOutputData{}
+			}
+		}
+	} else if inputData.OAuth2CodeChallenge != "" {
+		return iam.CallOutputContext{
+				Err: errors.ArgMsg("input", "code challenge is only for authorization code flow",
+					errors.Ent("OAuth2CodeChallenge", nil))},
+			TerminalRegistrationOutputData{}
+	}
+
 	//TODO:SEC:
 	// - check verification type against client type
 	// - check user ref validity against verification type and client type
@@ -501,9 +679,10 @@ func (core *Core) registerTerminalInsecure(
 	originInfo := inputCtx.OriginInfo()
 
 	var termSecret string
-	generateSecret :=
-		inputData.VerificationType == iam.TerminalVerificationResourceTypeOAuthClientCredentials ||
-			inputData.VerificationType == iam.TerminalVerificationResourceTypeOAuthPassword
+	generateSecret := !inputData.SecondFactorRequired &&
+		(inputData.VerificationType == iam.TerminalVerificationResourceTypeOAuthClientCredentials ||
+			inputData.VerificationType == iam.TerminalVerificationResourceTypeOAuthPassword ||
+			inputData.VerificationType == iam.TerminalVerificationResourceTypeWebAuthn)
 	if generateSecret {
 		termSecret = core.generateTerminalSecret()
 		inputData.VerificationTime = &ctxTime
@@ -543,6 +722,11 @@ func (core *Core) registerTerminalInsecure(
 				"verification_type":   inputData.VerificationType,
 				"verification_id":     inputData.VerificationID,
 				"verification_ts":     inputData.VerificationTime,
+
+				"oauth2_code_challenge":        inputData.OAuth2CodeChallenge,
+				"oauth2_code_challenge_method": inputData.OAuth2CodeChallengeMethod.String(),
+				"oauth2_scope":                 inputData.OAuth2Scope,
+				"oidc_nonce":                   inputData.OIDCNonce,
 			}).
 		ToSQL()
 
@@ -563,50 +747,128 @@ func (core *Core) registerTerminalInsecure(
 		}
 }
 
+// DeleteTerminal revokes a terminal. A terminal could delete itself and
+// a user could delete any of their terminals. For the terminals which
+// don't belong to the user, the result is the same as for the terminals
+// which don't exist, i.e., the state is not changed.
 func (core *Core) DeleteTerminal(
 	inputCtx iam.CallInputContext,
 	terminalIDToDelete iam.TerminalID,
 ) (stateChanged bool, err error) {
 	ctxAuth := inputCtx.Authorization()
 
-	//TODO: allow delete any owned terminal
 	if !ctxAuth.IsTerminal(terminalIDToDelete) {
-		return false, iam.ErrOperationNotAllowed
+		if !ctxAuth.IsUserSubject() {
+			return false, iam.ErrOperationNotAllowed
+		}
+		var ownerUserIDNum iam.UserIDNum
+		sqlString, _, _ := goqu.
+			From(terminalDBTableName).
+			Select("user_id").
+			Where(
+				goqu.C("id_num").Eq(terminalIDToDelete.IDNum().PrimitiveValue()),
+				goqu.C("md_d_ts").IsNull(),
+			).
+			ToSQL()
+		err = core.db.
+			QueryRow(sqlString).
+			Scan(&ownerUserIDNum)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			return false, errors.Wrap("terminal query", err)
+		}
+		if !ctxAuth.UserIDNum().EqualsUserIDNum(ownerUserIDNum) {
+			return false, nil
+		}
 	}
 
-	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
-
-	sqlString, _, _ := goqu.
-		From(terminalDBTableName).
-		Where(
-			goqu.C("id_num").Eq(terminalIDToDelete.IDNum().PrimitiveValue()),
-			goqu.C("md_d_ts").IsNull(),
-		).
-		Update().
-		Set(
-			goqu.Record{
-				"md_d_ts":  ctxTime,
-				"md_d_tid": ctxAuth.TerminalIDNum().PrimitiveValue(),
-				"md_d_uid": ctxAuth.UserIDNum().PrimitiveValue(),
-			},
-		).
-		ToSQL()
-
-	xres, err := core.db.
-		Exec(sqlString)
+	// Revoke the sessions too so that the access tokens issued for
+	// the terminal are no longer accepted.
+	stateChanged, err = core.revokeTerminalInsecure(
+		inputCtx, terminalIDToDelete.IDNum())
 	if err != nil {
 		return false, err
 	}
-	n, err := xres.RowsAffected()
-	if err != nil {
-		panic(err)
-	}
 
-	if n == 1 {
+	if stateChanged {
 		//TODO: push the event
 	}
 
-	return n == 1, nil
+	return stateChanged, nil
+}
+
+// revokeTerminalInsecure deletes the terminal along with all its sessions
+// and refresh tokens.
+func (core *Core) revokeTerminalInsecure(
+	inputCtx iam.CallInputContext,
+	terminalIDNum iam.TerminalIDNum,
+) (stateChanged bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	deletionRecord := goqu.Record{
+		"md_d_ts":  ctxTime,
+		"md_d_tid": ctxAuth.TerminalIDNumPtr(),
+		"md_d_uid": ctxAuth.UserIDNumPtr(),
+	}
+
+	err = doTx(core.db, func(dbTx *sqlx.Tx) error {
+		sqlString, _, _ := goqu.
+			From(terminalDBTableName).
+			Where(
+				goqu.C("id_num").Eq(terminalIDNum.PrimitiveValue()),
+				goqu.C("md_d_ts").IsNull(),
+			).
+			Update().
+			Set(deletionRecord).
+			ToSQL()
+		xres, txErr := dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("terminal update", txErr)
+		}
+		n, txErr := xres.RowsAffected()
+		if txErr != nil {
+			return errors.Wrap("terminal update", txErr)
+		}
+		stateChanged = n == 1
+
+		sqlString, _, _ = goqu.
+			From(sessionDBTableName).
+			Where(
+				goqu.C(sessionDBColTerminalID).Eq(terminalIDNum.PrimitiveValue()),
+				goqu.C(sessionDBColMDDeletionTimestamp).IsNull(),
+			).
+			Update().
+			Set(deletionRecord).
+			ToSQL()
+		_, txErr = dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("session update", txErr)
+		}
+
+		sqlString, _, _ = goqu.
+			From(terminalRefreshTokenDBTableName).
+			Where(
+				goqu.C("terminal_id").Eq(terminalIDNum.PrimitiveValue()),
+				goqu.C("md_d_ts").IsNull(),
+			).
+			Update().
+			Set(deletionRecord).
+			ToSQL()
+		_, txErr = dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("refresh token update", txErr)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return stateChanged, nil
 }
 
 //TODO: error if the terminal is deleted?
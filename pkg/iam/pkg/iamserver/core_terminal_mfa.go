@@ -0,0 +1,167 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+const (
+	terminalMFAChallengeDBTableName = "terminal_mfa_challenge_dt"
+
+	terminalMFAChallengeTTL = 5 * time.Minute
+)
+
+// MFARequiredError is returned when the user has been authenticated with
+// the first factor, e.g., a password, but the user has enabled a second
+// factor. The terminal is authorized once the second factor has been
+// provided to ConfirmTerminalAuthorizationSecondFactor along with
+// the MFAToken.
+type MFARequiredError struct {
+	MFAToken string
+	Expiry   time.Time
+}
+
+var _ error = &MFARequiredError{}
+
+func (e *MFARequiredError) Error() string { return "second factor required" }
+
+// requireTerminalSecondFactor returns an *MFARequiredError if the user has
+// enabled a second factor. The terminal must not have been verified; it
+// will be verified when the challenge is completed.
+func (core *Core) requireTerminalSecondFactor(
+	inputCtx iam.CallInputContext,
+	terminalIDNum iam.TerminalIDNum,
+	userID iam.UserID,
+) error {
+	required, err := core.IsUserTOTPEnabled(userID)
+	if err != nil {
+		return errors.Wrap("IsUserTOTPEnabled", err)
+	}
+	if !required {
+		return nil
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err = rand.Read(tokenBytes); err != nil {
+		return errors.Wrap("token generation", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	expiry := inputCtx.CallInputMetadata().ReceiveTime.Add(terminalMFAChallengeTTL)
+
+	// There's only one challenge for a terminal; e.g., confirming the
+	// verification code again issues a new token.
+	_, err = core.db.Exec(
+		`INSERT INTO `+terminalMFAChallengeDBTableName+` `+
+			`(terminal_id, user_id, token_hash, expiry_ts) `+
+			`VALUES ($1, $2, $3, $4) `+
+			`ON CONFLICT (terminal_id) DO UPDATE SET `+
+			`token_hash = EXCLUDED.token_hash, expiry_ts = EXCLUDED.expiry_ts, `+
+			`claimed_ts = NULL`,
+		terminalIDNum.PrimitiveValue(), userID.IDNum().PrimitiveValue(),
+		hashTerminalMFAToken(token), expiry)
+	if err != nil {
+		return errors.Wrap("insert", err)
+	}
+
+	return &MFARequiredError{MFAToken: token, Expiry: expiry}
+}
+
+// ConfirmTerminalAuthorizationSecondFactor completes the authorization
+// which has been suspended with an *MFARequiredError. The code is either
+// a TOTP code or a recovery code.
+func (core *Core) ConfirmTerminalAuthorizationSecondFactor(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+	mfaToken string,
+	code string,
+) (terminalID iam.TerminalID, terminalSecret string, userID iam.UserID, err error) {
+	if reqApp == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.ArgMsg("reqApp", "missing")
+	}
+	if mfaToken == "" {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+	}
+
+	var terminalIDNum iam.TerminalIDNum
+	var userIDNum iam.UserIDNum
+	var expiry time.Time
+	var claimTime *time.Time
+	err = core.db.
+		QueryRow(
+			`SELECT terminal_id, user_id, expiry_ts, claimed_ts `+
+				`FROM `+terminalMFAChallengeDBTableName+` `+
+				`WHERE token_hash = $1`,
+			hashTerminalMFAToken(mfaToken)).
+		Scan(&terminalIDNum, &userIDNum, &expiry, &claimTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+		}
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("select", err)
+	}
+	if claimTime != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+	}
+
+	termData, err := core.getTerminalRaw(terminalIDNum)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("getTerminalRaw", err)
+	}
+	// The token is only usable by the application it was issued to
+	if termData == nil ||
+		termData.ApplicationIDNum != reqApp.ID.IDNum() ||
+		termData.UserIDNum != userIDNum {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	if ctxTime.After(expiry) {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenExpired
+	}
+
+	err = core.verifyUserSecondFactorInsecure(inputCtx, userIDNum, code)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+
+	xres, err := core.db.Exec(
+		`UPDATE `+terminalMFAChallengeDBTableName+` SET claimed_ts = $1 `+
+			`WHERE terminal_id = $2 AND claimed_ts IS NULL`,
+		ctxTime, terminalIDNum.PrimitiveValue())
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("update", err)
+	}
+	if n != 1 {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+	}
+
+	terminalSecret, err = core.setTerminalVerified(inputCtx, terminalIDNum, true)
+	if err != nil {
+		if err == errTerminalVerificationConfirmationReplayed {
+			return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrMFATokenInvalid
+		}
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("setTerminalVerified", err)
+	}
+
+	userID = iam.NewUserID(userIDNum)
+	terminalID = iam.NewTerminalID(reqApp.ID, userID, terminalIDNum)
+	return terminalID, terminalSecret, userID, nil
+}
+
+func hashTerminalMFAToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
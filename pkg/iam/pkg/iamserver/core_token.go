@@ -40,6 +40,11 @@ func (core *Core) GenerateTokenSetJWT(
 		return "", "", apperrs.NewConfigurationMsg("JWT key chain does not have any signing key")
 	}
 
+	scope, err := core.getTerminalOAuth2Scope(terminalID)
+	if err != nil {
+		return "", "", errors.Wrap("getTerminalOAuth2Scope", err)
+	}
+
 	sessionID, issueTime, expiry, err := core.
 		issueSession(inputCtx, terminalID, userID)
 	if err != nil {
@@ -56,6 +61,7 @@ func (core *Core) GenerateTokenSetJWT(
 		},
 		AuthorizedParty: terminalID.Application().AZIDText(),
 		TerminalID:      terminalID.AZIDText(),
+		Scope:           scope,
 	}
 
 	accessToken, err = jwt.Signed(signer).Claims(accessTokenClaims).
@@ -64,9 +70,16 @@ func (core *Core) GenerateTokenSetJWT(
 		return "", "", errors.Wrap("access token signing", err)
 	}
 
+	refreshTokenID, refreshTokenExpiry, err := core.
+		issueRefreshToken(inputCtx, terminalID, issueTime)
+	if err != nil {
+		return "", "", errors.Wrap("issueRefreshToken", err)
+	}
+
 	tokenClaims := &iam.RefreshTokenClaims{
+		ID:             refreshTokenID,
 		NotBefore:      issueTime.Unix(),
-		ExpiresAt:      issueTime.Add(iam.RefreshTokenTTLDefault).Unix(),
+		ExpiresAt:      refreshTokenExpiry.Unix(),
 		TerminalID:     terminalID.AZIDText(),
 		TerminalSecret: terminalSecret,
 	}
@@ -109,6 +122,11 @@ func (core *Core) GenerateAccessTokenJWT(
 		return "", apperrs.NewConfigurationMsg("JWT key chain does not have any signing key")
 	}
 
+	scope, err := core.getTerminalOAuth2Scope(terminalID)
+	if err != nil {
+		return "", errors.Wrap("getTerminalOAuth2Scope", err)
+	}
+
 	sessionID, issueTime, expiry, err := core.
 		issueSession(inputCtx, terminalID, userID)
 	if err != nil {
@@ -125,6 +143,7 @@ func (core *Core) GenerateAccessTokenJWT(
 		},
 		AuthorizedParty: terminalID.Application().AZIDText(),
 		TerminalID:      terminalID.AZIDText(),
+		Scope:           scope,
 	}
 
 	tokenString, err = jwt.Signed(signer).Claims(tokenClaims).
@@ -141,6 +160,10 @@ func (core *Core) GenerateRefreshTokenJWT(
 	terminalSecret string,
 	issueTime time.Time,
 ) (tokenString string, err error) {
+	if inputCtx == nil {
+		return "", errors.ArgMsg("inputCtx", "missing")
+	}
+
 	jwtKeyChain := core.JWTKeyChain()
 	if jwtKeyChain == nil {
 		return "", apperrs.NewConfigurationMsg("JWT key chain is not configured")
@@ -153,9 +176,16 @@ func (core *Core) GenerateRefreshTokenJWT(
 		return "", apperrs.NewConfigurationMsg("JWT key chain does not have any signing key")
 	}
 
+	tokenID, expiry, err := core.
+		issueRefreshToken(inputCtx, terminalID, issueTime)
+	if err != nil {
+		return "", errors.Wrap("issueRefreshToken", err)
+	}
+
 	tokenClaims := &iam.RefreshTokenClaims{
+		ID:             tokenID,
 		NotBefore:      issueTime.Unix(),
-		ExpiresAt:      issueTime.Add(iam.RefreshTokenTTLDefault).Unix(),
+		ExpiresAt:      expiry.Unix(),
 		TerminalID:     terminalID.AZIDText(),
 		TerminalSecret: terminalSecret,
 	}
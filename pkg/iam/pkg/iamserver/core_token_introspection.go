@@ -0,0 +1,196 @@
+package iamserver
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/square/go-jose/v3/jwt"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// IntrospectTokenJWT looks up the state of an access token or a refresh
+// token issued by this server. RFC 7662.
+//
+// Tokens which are malformed, expired or revoked are reported as inactive.
+// An error is returned only if the state of the token could not be
+// determined. Refresh tokens are reported as active only to the
+// application they were issued to.
+func (core *Core) IntrospectTokenJWT(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	token string,
+) (*iam.OAuth2TokenIntrospectionResponse, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	if token == "" {
+		return nil, errors.Arg("token", dataerrs.ErrEmpty)
+	}
+
+	inactive := &iam.OAuth2TokenIntrospectionResponse{Active: false}
+
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	// The signature will be verified by the respective methods.
+	if isRefreshTokenJWTUnverified(tok) {
+		return core.introspectRefreshTokenJWT(inputCtx, applicationID, token)
+	}
+	return core.introspectAccessTokenJWT(tok, token)
+}
+
+func (core *Core) introspectAccessTokenJWT(
+	tok *jwt.JSONWebToken,
+	token string,
+) (*iam.OAuth2TokenIntrospectionResponse, error) {
+	inactive := &iam.OAuth2TokenIntrospectionResponse{Active: false}
+
+	// This covers the signature, the time-based claims, the issuer, the
+	// session revocation and the subject's state.
+	_, err := core.AuthorizationFromJWTString(token)
+	if err != nil {
+		if errors.IsCallError(err) {
+			return inactive, nil
+		}
+		return nil, errors.Wrap("AuthorizationFromJWTString", err)
+	}
+
+	// The token has been verified above.
+	var claims iam.AccessTokenClaims
+	err = tok.UnsafeClaimsWithoutVerification(&claims)
+	if err != nil {
+		return inactive, nil
+	}
+
+	return &iam.OAuth2TokenIntrospectionResponse{
+		Active:     true,
+		Scope:      claims.Scope,
+		ClientID:   claims.AuthorizedParty,
+		TokenType:  string(oauth2.TokenTypeBearer),
+		ExpiresAt:  numericDateUnix(claims.Expiry),
+		IssuedAt:   numericDateUnix(claims.IssuedAt),
+		NotBefore:  numericDateUnix(claims.NotBefore),
+		Subject:    claims.Subject,
+		Issuer:     claims.Issuer,
+		JWTID:      claims.ID,
+		TerminalID: claims.TerminalID,
+	}, nil
+}
+
+func (core *Core) introspectRefreshTokenJWT(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	token string,
+) (*iam.OAuth2TokenIntrospectionResponse, error) {
+	inactive := &iam.OAuth2TokenIntrospectionResponse{Active: false}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	claims, terminalID, err := core.parseRefreshTokenJWT(token, ctxTime)
+	if err != nil {
+		if errors.IsCallError(err) {
+			return inactive, nil
+		}
+		return nil, errors.Wrap("parseRefreshTokenJWT", err)
+	}
+
+	// RFC 7662 § 4
+	if !terminalID.Application().EqualsApplicationID(applicationID) {
+		return inactive, nil
+	}
+
+	// This covers the state of the terminal, its application and its user.
+	userID, err := core.AuthenticateTerminalByCredentials(
+		inputCtx, nil, terminalID, claims.TerminalSecret)
+	if err != nil {
+		if err == iam.ErrTerminalCredentialsInvalid {
+			return inactive, nil
+		}
+		return nil, errors.Wrap("AuthenticateTerminalByCredentials", err)
+	}
+
+	active, err := core.isRefreshTokenActive(terminalID, claims.ID, ctxTime)
+	if err != nil {
+		return nil, errors.Wrap("isRefreshTokenActive", err)
+	}
+	if !active {
+		return inactive, nil
+	}
+
+	var subject string
+	if userID.IsStaticallyValid() {
+		subject = userID.AZIDText()
+	}
+
+	// The access tokens obtained with the refresh token are granted
+	// the scope of the terminal.
+	scope, err := core.getTerminalOAuth2Scope(terminalID)
+	if err != nil {
+		return nil, errors.Wrap("getTerminalOAuth2Scope", err)
+	}
+
+	return &iam.OAuth2TokenIntrospectionResponse{
+		Active:   true,
+		Scope:    scope,
+		ClientID: terminalID.Application().AZIDText(),
+		// Refresh tokens are issued at the same time they become valid.
+		ExpiresAt:  claims.ExpiresAt,
+		IssuedAt:   claims.NotBefore,
+		NotBefore:  claims.NotBefore,
+		Subject:    subject,
+		Issuer:     core.RealmName(),
+		JWTID:      claims.ID,
+		TerminalID: claims.TerminalID,
+	}, nil
+}
+
+// isRefreshTokenActive returns true if the refresh token is registered,
+// has not been rotated nor revoked, has not expired as of refTime, and
+// its terminal has not been deleted.
+func (core *Core) isRefreshTokenActive(
+	terminalID iam.TerminalID,
+	tokenID string,
+	refTime time.Time,
+) (active bool, err error) {
+	sqlString, _, _ := goqu.
+		From(goqu.T(terminalRefreshTokenDBTableName).As("r")).
+		Join(
+			goqu.T(terminalDBTableName).As("t"),
+			goqu.On(goqu.I("t.id_num").Eq(goqu.I("r.terminal_id"))),
+		).
+		Select(goqu.L("true")).
+		Where(
+			goqu.I("r.terminal_id").Eq(terminalID.IDNum().PrimitiveValue()),
+			goqu.I("r.token_id").Eq(tokenID),
+			goqu.I("r.md_d_ts").IsNull(),
+			goqu.I("r.rotation_ts").IsNull(),
+			goqu.I("r.expiry").Gt(refTime),
+			goqu.I("t.md_d_ts").IsNull(),
+		).
+		ToSQL()
+
+	err = core.db.
+		QueryRow(sqlString).
+		Scan(&active)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return
+}
+
+func numericDateUnix(d *jwt.NumericDate) int64 {
+	if d == nil {
+		return 0
+	}
+	return int64(*d)
+}
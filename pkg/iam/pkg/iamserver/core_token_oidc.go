@@ -0,0 +1,141 @@
+package iamserver
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/square/go-jose/v3"
+	"github.com/square/go-jose/v3/jwt"
+
+	apperrs "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/app/errors"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// IDTokenInputData holds the data used to generate an OpenID Connect
+// ID Token.
+type IDTokenInputData struct {
+	// Issuer is the issuer identifier, an https URL, as advertised in
+	// the provider's discovery document.
+	Issuer string
+
+	TerminalID iam.TerminalID
+	UserID     iam.UserID
+
+	// Nonce is the value provided by the client in the authentication
+	// request, if any.
+	Nonce string
+	// AuthTime is the time when the end-user authentication occurred.
+	AuthTime time.Time
+	// AccessToken is the access token issued along with the ID Token.
+	// It's used to calculate the at_hash claim.
+	AccessToken string
+}
+
+// GenerateIDTokenJWT generates a signed OpenID Connect ID Token.
+// OpenID Connect Core 1.0 § 2.
+func (core *Core) GenerateIDTokenJWT(
+	inputCtx iam.CallInputContext,
+	inputData IDTokenInputData,
+) (tokenString string, err error) {
+	if inputCtx == nil {
+		return "", errors.ArgMsg("inputCtx", "missing")
+	}
+
+	if inputData.Issuer == "" {
+		return "", errors.ArgMsg("inputData.Issuer", "empty")
+	}
+	if inputData.TerminalID.IsNotStaticallyValid() {
+		return "", errors.ArgMsg("inputData.TerminalID", "invalid")
+	}
+	// ID Tokens are about end-users
+	if inputData.UserID.IsNotStaticallyValid() {
+		return "", errors.ArgMsg("inputData.UserID", "invalid")
+	}
+
+	jwtKeyChain := core.JWTKeyChain()
+	if jwtKeyChain == nil {
+		return "", apperrs.NewConfigurationMsg("JWT key chain is not configured")
+	}
+	// The at_hash depends on the algorithm of the key which signs
+	// the token, thus we get the key once.
+	signingKey := jwtKeyChain.SigningKeyAt(time.Now())
+	if signingKey == nil {
+		return "", apperrs.NewConfigurationMsg("JWT key chain does not have any signing key")
+	}
+	signer, err := signingKey.Signer()
+	if err != nil {
+		return "", errors.Wrap("signer", err)
+	}
+
+	var accessTokenHash string
+	if inputData.AccessToken != "" {
+		accessTokenHash, err = idTokenAccessTokenHash(
+			signingKey.Algorithm, inputData.AccessToken)
+		if err != nil {
+			return "", errors.Wrap("access token hash", err)
+		}
+	}
+
+	issueTime := inputCtx.CallInputMetadata().ReceiveTime
+	clientID := inputData.TerminalID.Application().AZIDText()
+
+	var authTime *jwt.NumericDate
+	if !inputData.AuthTime.IsZero() {
+		authTime = jwt.NewNumericDate(inputData.AuthTime)
+	}
+
+	tokenClaims := &iam.IDTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:   inputData.Issuer,
+			Subject:  inputData.UserID.AZIDText(),
+			Audience: jwt.Audience{clientID},
+			IssuedAt: jwt.NewNumericDate(issueTime),
+			Expiry:   jwt.NewNumericDate(issueTime.Add(iam.IDTokenTTLDefault)),
+		},
+		AuthTime:        authTime,
+		Nonce:           inputData.Nonce,
+		AuthorizedParty: clientID,
+		AccessTokenHash: accessTokenHash,
+	}
+
+	tokenString, err = jwt.Signed(signer).Claims(tokenClaims).
+		CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap("signing", err)
+	}
+	return
+}
+
+// idTokenAccessTokenHash calculates the value for the at_hash claim. It's
+// the base64url encoding of the left-most half of the hash of the access
+// token, where the hash algorithm is the one used by the signing algorithm.
+// OpenID Connect Core 1.0 § 3.1.3.6.
+func idTokenAccessTokenHash(
+	alg jose.SignatureAlgorithm,
+	accessToken string,
+) (string, error) {
+	var hashFunc crypto.Hash
+	switch alg {
+	case jose.RS256, jose.ES256, jose.PS256, jose.HS256:
+		hashFunc = crypto.SHA256
+	case jose.RS384, jose.ES384, jose.PS384, jose.HS384:
+		hashFunc = crypto.SHA384
+	case jose.RS512, jose.ES512, jose.PS512, jose.HS512:
+		hashFunc = crypto.SHA512
+	case jose.EdDSA:
+		// For Ed25519
+		hashFunc = crypto.SHA512
+	default:
+		return "", errors.ArgMsg("alg", "unsupported")
+	}
+
+	hasher := hashFunc.New()
+	hasher.Write([]byte(accessToken))
+	sum := hasher.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
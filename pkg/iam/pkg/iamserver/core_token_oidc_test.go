@@ -0,0 +1,23 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/square/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDTokenAccessTokenHash(t *testing.T) {
+	// OpenID Connect Core 1.0 § A.3
+	h, err := idTokenAccessTokenHash(jose.RS256,
+		"jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y")
+	assert.Nil(t, err)
+	assert.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", h)
+
+	h, err = idTokenAccessTokenHash(jose.EdDSA, "access-token")
+	assert.Nil(t, err)
+	assert.Len(t, h, 43)
+
+	_, err = idTokenAccessTokenHash("", "access-token")
+	assert.NotNil(t, err)
+}
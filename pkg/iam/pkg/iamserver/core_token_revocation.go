@@ -0,0 +1,116 @@
+package iamserver
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/square/go-jose/v3/jwt"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RevokeTokenJWT revokes an access token or a refresh token issued by
+// this server. RFC 7009.
+//
+// Revoking an access token revokes its session. Revoking a refresh token
+// revokes the terminal it was issued for, along with all the terminal's
+// sessions and refresh tokens.
+//
+// Tokens which are malformed, expired or already revoked are ignored.
+// If the token was issued to other application, the method returns
+// iam.ErrOperationNotAllowed.
+func (core *Core) RevokeTokenJWT(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	token string,
+) (stateChanged bool, err error) {
+	if inputCtx == nil {
+		return false, errors.ArgMsg("inputCtx", "missing")
+	}
+	if token == "" {
+		return false, errors.Arg("token", dataerrs.ErrEmpty)
+	}
+
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return false, nil
+	}
+
+	if isRefreshTokenJWTUnverified(tok) {
+		ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+		_, terminalID, err := core.parseRefreshTokenJWT(token, ctxTime)
+		if err != nil {
+			if errors.IsCallError(err) {
+				return false, nil
+			}
+			return false, errors.Wrap("parseRefreshTokenJWT", err)
+		}
+		// RFC 7009 § 2.1
+		if !terminalID.Application().EqualsApplicationID(applicationID) {
+			return false, iam.ErrOperationNotAllowed
+		}
+
+		stateChanged, err = core.revokeTerminalInsecure(inputCtx, terminalID.IDNum())
+		if err != nil {
+			return false, errors.Wrap("revokeTerminalInsecure", err)
+		}
+		return stateChanged, nil
+	}
+
+	authz, err := core.AuthorizationFromJWTString(token)
+	if err != nil {
+		if errors.IsCallError(err) {
+			return false, nil
+		}
+		return false, errors.Wrap("AuthorizationFromJWTString", err)
+	}
+	// RFC 7009 § 2.1
+	if !authz.SessionID.Terminal().Application().EqualsApplicationID(applicationID) {
+		return false, iam.ErrOperationNotAllowed
+	}
+
+	stateChanged, err = core.revokeSessionInsecure(inputCtx, authz.SessionID)
+	if err != nil {
+		return false, errors.Wrap("revokeSessionInsecure", err)
+	}
+	return stateChanged, nil
+}
+
+// revokeSessionInsecure deletes the session. The terminal and its other
+// sessions are not affected.
+func (core *Core) revokeSessionInsecure(
+	inputCtx iam.CallInputContext,
+	sessionID iam.SessionID,
+) (stateChanged bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	sqlString, _, _ := goqu.
+		From(sessionDBTableName).
+		Where(
+			goqu.C(sessionDBColTerminalID).Eq(sessionID.Terminal().IDNum().PrimitiveValue()),
+			goqu.C(sessionDBColIDNum).Eq(sessionID.IDNum().PrimitiveValue()),
+			goqu.C(sessionDBColMDDeletionTimestamp).IsNull(),
+		).
+		Update().
+		Set(
+			goqu.Record{
+				sessionDBColMDDeletionTimestamp:  ctxTime,
+				sessionDBColMDDeletionTerminalID: ctxAuth.TerminalIDNumPtr(),
+				sessionDBColMDDeletionUserID:     ctxAuth.UserIDNumPtr(),
+			},
+		).
+		ToSQL()
+
+	xres, err := core.db.
+		Exec(sqlString)
+	if err != nil {
+		return false, err
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
@@ -158,6 +158,12 @@ func (core *Core) SetUserKeyEmailAddress(
 		return 0, nil, nil
 	}
 
+	err = core.takeRateLimits(inputCtx, core.verificationStartRateLimitKeys(
+		inputCtx, emailAddress.String(), iam.ApplicationIDZero())...)
+	if err != nil {
+		return 0, nil, err
+	}
+
 	//TODO: user-set has higher priority over terminal's
 	userLanguages, err := core.getTerminalAcceptLanguagesAllowDeleted(ctxAuth.TerminalIDNum())
 	if err != nil {
@@ -235,11 +241,20 @@ func (core *Core) ConfirmUserEmailAddressVerification(
 	code string,
 ) (stateChanged bool, err error) {
 	ctxAuth := inputCtx.Authorization()
+	rateLimitKeys := core.verificationConfirmRateLimitKeys(
+		inputCtx, ctxAuth.TerminalID())
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return false, err
+	}
+	defer attempt.end()
 	err = core.eaVerifier.ConfirmVerification(
 		inputCtx, verificationID, code)
 	if err != nil {
 		switch err {
 		case eav10n.ErrVerificationCodeMismatch:
+			attempt.fail()
 			return false, errors.ArgMsg("code", "mismatch")
 		case eav10n.ErrVerificationCodeExpired:
 			return false, errors.ArgMsg("code", "expired")
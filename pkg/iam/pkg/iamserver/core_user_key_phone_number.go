@@ -160,6 +160,12 @@ func (core *Core) SetUserKeyPhoneNumber(
 		return 0, nil, nil
 	}
 
+	err = core.takeRateLimits(inputCtx, core.verificationStartRateLimitKeys(
+		inputCtx, phoneNumber.String(), iam.ApplicationIDZero())...)
+	if err != nil {
+		return 0, nil, err
+	}
+
 	//TODO: user-set has higher priority over terminal's
 	userLanguages, err := core.getTerminalAcceptLanguagesAllowDeleted(ctxAuth.TerminalIDNum())
 	if err != nil {
@@ -237,11 +243,20 @@ func (core *Core) ConfirmUserPhoneNumberVerification(
 	code string,
 ) (stateChanged bool, err error) {
 	ctxAuth := inputCtx.Authorization()
+	rateLimitKeys := core.verificationConfirmRateLimitKeys(
+		inputCtx, ctxAuth.TerminalID())
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return false, err
+	}
+	defer attempt.end()
 	err = core.pnVerifier.ConfirmVerification(
 		inputCtx, verificationID, code)
 	if err != nil {
 		switch err {
 		case pnv10n.ErrVerificationCodeMismatch:
+			attempt.fail()
 			return false, errors.ArgMsg("code", "mismatch")
 		case pnv10n.ErrVerificationCodeExpired:
 			return false, errors.ArgMsg("code", "expired")
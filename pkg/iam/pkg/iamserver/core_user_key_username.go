@@ -0,0 +1,170 @@
+package iamserver
+
+import (
+	"database/sql"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// Interface conformance assertion.
+var _ iam.UserKeyUsernameService = &Core{}
+
+const userKeyUsernameDBTableName = `user_key_username_dt`
+
+func (core *Core) GetUserKeyUsername(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) (string, error) {
+	//TODO: access control
+	return core.getUserKeyUsernameInsecure(inputCtx, userID)
+}
+
+func (core *Core) getUserKeyUsernameInsecure(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) (string, error) {
+	var rawInput string
+	err := core.db.
+		QueryRow(
+			`SELECT raw_input `+
+				`FROM `+userKeyUsernameDBTableName+` `+
+				`WHERE user_id = $1 AND md_d_ts IS NULL`,
+			userID.IDNum().PrimitiveValue()).
+		Scan(&rawInput)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return rawInput, nil
+}
+
+// The ID of the user which has the username. The username must have been
+// normalized.
+func (core *Core) getUserIDNumByKeyUsernameInsecure(
+	normalizedUsername string,
+) (ownerUserIDNum iam.UserIDNum, err error) {
+	err = core.db.
+		QueryRow(
+			`SELECT user_id `+
+				`FROM `+userKeyUsernameDBTableName+` `+
+				`WHERE username = $1 AND md_d_ts IS NULL`,
+			normalizedUsername).
+		Scan(&ownerUserIDNum)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return iam.UserIDNumZero, nil
+		}
+		return iam.UserIDNumZero, err
+	}
+	return
+}
+
+// IsUsernameAvailable returns true if the username could be set by
+// the current user, i.e., it satisfies the username policy and it
+// doesn't belong to any other user. It returns an error which wraps
+// a *UsernamePolicyError if the username violates the policy.
+func (core *Core) IsUsernameAvailable(
+	inputCtx iam.CallInputContext,
+	username string,
+) (available bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return false, iam.ErrUserContextRequired
+	}
+
+	normalizedUsername, err := core.normalizeUsername(username)
+	if err != nil {
+		return false, err
+	}
+
+	ownerUserIDNum, err := core.getUserIDNumByKeyUsernameInsecure(normalizedUsername)
+	if err != nil {
+		return false, errors.Wrap("getUserIDNumByKeyUsernameInsecure", err)
+	}
+	return ownerUserIDNum.IsNotStaticallyValid() ||
+		ownerUserIDNum == ctxAuth.UserIDNum(), nil
+}
+
+// SetUserKeyUsername sets the username of the user, replacing the current
+// one if there's any. The username previously used by the user becomes
+// available for the other users.
+func (core *Core) SetUserKeyUsername(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	username string,
+) (stateChanged bool, err error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return false, iam.ErrUserContextRequired
+	}
+	// Don't allow changing other user's for now
+	if !ctxAuth.IsUser(userID) {
+		return false, iam.ErrOperationNotAllowed
+	}
+
+	normalizedUsername, err := core.normalizeUsername(username)
+	if err != nil {
+		return false, err
+	}
+	username = cleanUsername(username)
+
+	currentUsername, err := core.getUserKeyUsernameInsecure(inputCtx, userID)
+	if err != nil {
+		return false, errors.Wrap("getUserKeyUsernameInsecure", err)
+	}
+	if currentUsername == username {
+		return false, nil
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	err = doTx(core.db, func(tx *sqlx.Tx) error {
+		_, txErr := tx.Exec(
+			`UPDATE `+userKeyUsernameDBTableName+` SET `+
+				`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
+				`WHERE user_id = $4 AND md_d_ts IS NULL`,
+			ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+			userID.IDNum().PrimitiveValue())
+		if txErr != nil {
+			return txErr
+		}
+		_, txErr = tx.Exec(
+			`INSERT INTO `+userKeyUsernameDBTableName+` `+
+				`(user_id, username, raw_input, md_c_ts, md_c_uid, md_c_tid) `+
+				`VALUES ($1, $2, $3, $4, $5, $6)`,
+			userID.IDNum().PrimitiveValue(), normalizedUsername, username,
+			ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue())
+		return txErr
+	})
+	if err != nil {
+		pqErr, _ := err.(*pq.Error)
+		if pqErr != nil &&
+			pqErr.Code == "23505" &&
+			pqErr.Constraint == userKeyUsernameDBTableName+`_username_uidx` {
+			return false, iam.ErrUserKeyUsernameConflict
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// normalizeUsername returns the form of the username which is used for
+// look ups. It returns an error which wraps a *UsernamePolicyError if
+// the username violates the username policy.
+func (core *Core) normalizeUsername(username string) (string, error) {
+	normalizedUsername, err := core.usernamePolicy.normalize(username)
+	if err != nil {
+		if policyErr, ok := err.(*UsernamePolicyError); ok {
+			return "", errors.Arg("username", policyErr)
+		}
+		return "", err
+	}
+	return normalizedUsername, nil
+}
@@ -0,0 +1,288 @@
+package iamserver
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	goqu "github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+const userOAuth2ConsentDBTableName = "user_oauth2_consent_dt"
+
+// UserOAuth2ConsentInfo holds the information about an application
+// which has been authorized by a user.
+type UserOAuth2ConsentInfo struct {
+	ApplicationID iam.ApplicationID
+	// Scope is the space-delimited list of the scopes granted to
+	// the application.
+	Scope string
+	// GrantTime is the last time the user granted the application.
+	GrantTime time.Time
+}
+
+// CoversScope returns true if all the scopes in scope have been
+// granted.
+func (consentInfo UserOAuth2ConsentInfo) CoversScope(scope string) bool {
+	for _, s := range oauth2.ParseScope(scope) {
+		if !oauth2.ScopeContains(consentInfo.Scope, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// GrantUserOAuth2Consent records that the user in the context has
+// authorized the application with the scope. The scope will be merged
+// with the scopes which have been previously granted to the application.
+func (core *Core) GrantUserOAuth2Consent(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+	scope string,
+) error {
+	if inputCtx == nil {
+		return errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return iam.ErrUserContextRequired
+	}
+	if applicationID.IsNotStaticallyValid() {
+		return errors.ArgMsg("applicationID", "invalid")
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	userIDNum := ctxAuth.UserIDNum()
+
+	return doTx(core.db, func(dbTx *sqlx.Tx) error {
+		var grantedScope string
+		sqlString, _, _ := goqu.
+			From(userOAuth2ConsentDBTableName).
+			Select("scope").
+			Where(
+				goqu.C("user_id").Eq(userIDNum.PrimitiveValue()),
+				goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+				goqu.C("md_d_ts").IsNull(),
+			).
+			ForUpdate(goqu.Wait).
+			ToSQL()
+		txErr := dbTx.QueryRow(sqlString).Scan(&grantedScope)
+		if txErr != nil && txErr != sql.ErrNoRows {
+			return errors.Wrap("consent query", txErr)
+		}
+
+		scopeTokens := oauth2.ParseScope(grantedScope)
+		for _, s := range oauth2.ParseScope(scope) {
+			if !oauth2.ScopeContains(grantedScope, s) {
+				scopeTokens = append(scopeTokens, s)
+			}
+		}
+
+		sqlString, _, _ = goqu.
+			From(userOAuth2ConsentDBTableName).
+			Where(
+				goqu.C("user_id").Eq(userIDNum.PrimitiveValue()),
+				goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+				goqu.C("md_d_ts").IsNull(),
+			).
+			Update().
+			Set(
+				goqu.Record{
+					"md_d_ts":  ctxTime,
+					"md_d_tid": ctxAuth.TerminalIDNum().PrimitiveValue(),
+					"md_d_uid": userIDNum.PrimitiveValue(),
+				},
+			).
+			ToSQL()
+		_, txErr = dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("consent update", txErr)
+		}
+
+		sqlString, _, _ = goqu.
+			Insert(userOAuth2ConsentDBTableName).
+			Rows(
+				goqu.Record{
+					"user_id":        userIDNum.PrimitiveValue(),
+					"application_id": applicationID.IDNum().PrimitiveValue(),
+					"scope":          oauth2.FormatScope(scopeTokens),
+					"md_c_ts":        ctxTime,
+					"md_c_tid":       ctxAuth.TerminalIDNum().PrimitiveValue(),
+					"md_c_uid":       userIDNum.PrimitiveValue(),
+				},
+			).
+			ToSQL()
+		_, txErr = dbTx.Exec(sqlString)
+		if txErr != nil {
+			return errors.Wrap("consent insert", txErr)
+		}
+
+		return nil
+	})
+}
+
+// GetUserOAuth2Consent retrieves the consent the user in the context
+// has given to the application. It returns nil if the user has not
+// authorized the application.
+func (core *Core) GetUserOAuth2Consent(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+) (*UserOAuth2ConsentInfo, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return nil, iam.ErrUserContextRequired
+	}
+
+	var scope string
+	var grantTime time.Time
+	sqlString, _, _ := goqu.
+		From(userOAuth2ConsentDBTableName).
+		Select("scope", "md_c_ts").
+		Where(
+			goqu.C("user_id").Eq(ctxAuth.UserIDNum().PrimitiveValue()),
+			goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		ToSQL()
+	err := core.db.
+		QueryRow(sqlString).
+		Scan(&scope, &grantTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &UserOAuth2ConsentInfo{
+		ApplicationID: applicationID,
+		Scope:         scope,
+		GrantTime:     grantTime,
+	}, nil
+}
+
+// ListUserOAuth2Consents retrieves all the applications the user in
+// the context has authorized.
+func (core *Core) ListUserOAuth2Consents(
+	inputCtx iam.CallInputContext,
+) ([]UserOAuth2ConsentInfo, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return nil, iam.ErrUserContextRequired
+	}
+
+	sqlString, _, _ := goqu.
+		From(userOAuth2ConsentDBTableName).
+		Select("application_id", "scope", "md_c_ts").
+		Where(
+			goqu.C("user_id").Eq(ctxAuth.UserIDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		Order(goqu.C("md_c_ts").Desc()).
+		ToSQL()
+	rows, err := core.db.Query(sqlString)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []UserOAuth2ConsentInfo
+	for rows.Next() {
+		var appIDNum iam.ApplicationIDNum
+		var consentInfo UserOAuth2ConsentInfo
+		err = rows.Scan(&appIDNum, &consentInfo.Scope, &consentInfo.GrantTime)
+		if err != nil {
+			return nil, err
+		}
+		consentInfo.ApplicationID = iam.NewApplicationID(appIDNum)
+		consents = append(consents, consentInfo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// RevokeUserOAuth2Consent removes the consent the user in the context
+// has given to the application. All the user's terminals for the
+// application will be revoked as well.
+func (core *Core) RevokeUserOAuth2Consent(
+	inputCtx iam.CallInputContext,
+	applicationID iam.ApplicationID,
+) (stateChanged bool, err error) {
+	if inputCtx == nil {
+		return false, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return false, iam.ErrUserContextRequired
+	}
+	if applicationID.IsNotStaticallyValid() {
+		return false, errors.ArgMsg("applicationID", "invalid")
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	userIDNum := ctxAuth.UserIDNum()
+
+	sqlString, _, _ := goqu.
+		From(userOAuth2ConsentDBTableName).
+		Where(
+			goqu.C("user_id").Eq(userIDNum.PrimitiveValue()),
+			goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		Update().
+		Set(
+			goqu.Record{
+				"md_d_ts":  ctxTime,
+				"md_d_tid": ctxAuth.TerminalIDNum().PrimitiveValue(),
+				"md_d_uid": userIDNum.PrimitiveValue(),
+			},
+		).
+		ToSQL()
+	xres, err := core.db.Exec(sqlString)
+	if err != nil {
+		return false, errors.Wrap("consent update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap("consent update", err)
+	}
+	stateChanged = n == 1
+
+	sqlString, _, _ = goqu.
+		From(terminalDBTableName).
+		Select("id_num").
+		Where(
+			goqu.C("user_id").Eq(userIDNum.PrimitiveValue()),
+			goqu.C("application_id").Eq(applicationID.IDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+		).
+		ToSQL()
+	var terminalIDNums []iam.TerminalIDNum
+	err = core.db.Select(&terminalIDNums, sqlString)
+	if err != nil {
+		return false, errors.Wrap("terminal query", err)
+	}
+
+	for _, terminalIDNum := range terminalIDNums {
+		termRevoked, err := core.revokeTerminalInsecure(inputCtx, terminalIDNum)
+		if err != nil {
+			return false, errors.Wrap("revokeTerminalInsecure", err)
+		}
+		stateChanged = stateChanged || termRevoked
+	}
+
+	return stateChanged, nil
+}
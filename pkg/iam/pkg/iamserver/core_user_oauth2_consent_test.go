@@ -0,0 +1,16 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserOAuth2ConsentInfoCoversScope(t *testing.T) {
+	consentInfo := UserOAuth2ConsentInfo{Scope: "openid profile orders.read"}
+	assert.Equal(t, true, consentInfo.CoversScope(""))
+	assert.Equal(t, true, consentInfo.CoversScope("openid"))
+	assert.Equal(t, true, consentInfo.CoversScope("orders.read openid"))
+	assert.Equal(t, false, consentInfo.CoversScope("openid email"))
+	assert.Equal(t, false, UserOAuth2ConsentInfo{}.CoversScope("openid"))
+}
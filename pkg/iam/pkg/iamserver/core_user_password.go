@@ -5,10 +5,11 @@ import (
 	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
-	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/alloyzeus/go-azfl/errors"
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/argon2"
 
@@ -30,7 +31,8 @@ type argon2PasswordHashingParams struct {
 	KeyLength   uint32
 }
 
-//TODO:make this configurable
+// argon2PasswordHashingParamsDefault is used for the parameters not
+// specified in PasswordHashingConfig.
 var argon2PasswordHashingParamsDefault = argon2PasswordHashingParams{
 	Memory:      64 * 1024,
 	Iterations:  3,
@@ -51,6 +53,41 @@ func (core *Core) SetUserPassword(
 		return iam.ErrOperationNotAllowed
 	}
 
+	if err := core.checkUserPasswordPolicy(inputCtx, userID, clearTextPassword); err != nil {
+		return err
+	}
+
+	return core.setUserPasswordInsecure(inputCtx, userID, clearTextPassword)
+}
+
+// checkUserPasswordPolicy returns an error which wraps
+// a *PasswordPolicyError if the password is not acceptable for the user.
+func (core *Core) checkUserPasswordPolicy(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	clearTextPassword string,
+) error {
+	userIdentifiers, err := core.getUserIdentifiersInsecure(inputCtx, userID)
+	if err != nil {
+		return errors.Wrap("user identifiers look up", err)
+	}
+	if err = core.passwordPolicy.check(clearTextPassword, userIdentifiers); err != nil {
+		if policyErr, ok := err.(*PasswordPolicyError); ok {
+			return errors.Arg("clearTextPassword", policyErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// setUserPasswordInsecure replaces the user's password without checking
+// the authorization nor the password policy.
+func (core *Core) setUserPasswordInsecure(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	clearTextPassword string,
+) error {
+	ctxAuth := inputCtx.Authorization()
 	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
 
 	passwordHash, err := core.hashPassword(clearTextPassword)
@@ -59,7 +96,7 @@ func (core *Core) SetUserPassword(
 	}
 
 	return doTx(core.db, func(tx *sqlx.Tx) error {
-		_, txErr := core.db.Exec(
+		_, txErr := tx.Exec(
 			`UPDATE `+userPasswordDBTableName+` SET `+
 				`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
 				`WHERE user_id = $4 AND md_d_ts IS NULL`,
@@ -68,7 +105,7 @@ func (core *Core) SetUserPassword(
 		if txErr != nil {
 			return txErr
 		}
-		_, txErr = core.db.Exec(
+		_, txErr = tx.Exec(
 			`INSERT INTO `+userPasswordDBTableName+` `+
 				`(user_id, password, md_c_ts, md_c_uid, md_c_tid) `+
 				`VALUES ($1, $2, $3, $4, $5) `,
@@ -86,10 +123,98 @@ func (core *Core) MatchUserPassword(
 	if err != nil {
 		return false, err
 	}
-	if passwordHash == "" && clearTextPassword == passwordHash {
-		return true, err
+	// A user who has not set a password can't be authenticated with
+	// a password, not even with an empty one.
+	if passwordHash == "" {
+		return false, nil
+	}
+	match, needsRehash, err := core.passwordHasher.match(clearTextPassword, passwordHash)
+	if err != nil || !match {
+		return false, err
+	}
+	if needsRehash {
+		// The password is valid regardless whether the re-hashing
+		// succeeded.
+		if err = core.rehashUserPassword(userID.IDNum(), clearTextPassword, passwordHash); err != nil {
+			log.Warn().Err(err).Str("user", userID.AZIDText()).
+				Msg("User password re-hashing")
+		}
+	}
+	return true, nil
+}
+
+// rehashUserPassword replaces the hash of the user's password with
+// a hash computed with the current parameters. The hash is replaced only
+// if the password has not been changed since it was matched.
+func (core *Core) rehashUserPassword(
+	userIDNum iam.UserIDNum,
+	clearTextPassword string,
+	oldPasswordHash string,
+) error {
+	passwordHash, err := core.hashPassword(clearTextPassword)
+	if err != nil {
+		return err
+	}
+	_, err = core.db.Exec(
+		`UPDATE `+userPasswordDBTableName+` SET password = $1 `+
+			`WHERE user_id = $2 AND password = $3 AND md_d_ts IS NULL`,
+		passwordHash, userIDNum.PrimitiveValue(), oldPasswordHash)
+	return err
+}
+
+// UserHasPassword returns true if the user has set a password.
+func (core *Core) UserHasPassword(userID iam.UserID) (bool, error) {
+	passwordHash, err := core.getUserPasswordHash(userID.IDNum())
+	if err != nil {
+		return false, err
+	}
+	return passwordHash != "", nil
+}
+
+// getUserIdentifiersInsecure returns the values which could be used to
+// identify the user, which must not be used as part of the password.
+func (core *Core) getUserIdentifiersInsecure(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) ([]string, error) {
+	var identifiers []string
+
+	emailAddress, err := core.getUserKeyEmailAddressInsecure(inputCtx, userID)
+	if err != nil {
+		return nil, errors.Wrap("email address", err)
+	}
+	if emailAddress != nil {
+		identifiers = append(identifiers,
+			emailAddress.String(), emailAddress.LocalPart())
 	}
-	return core.matchPasswordAndPasswordHash(clearTextPassword, passwordHash)
+
+	phoneNumber, err := core.getUserKeyPhoneNumberInsecure(inputCtx, userID)
+	if err != nil {
+		return nil, errors.Wrap("phone number", err)
+	}
+	if phoneNumber != nil {
+		identifiers = append(identifiers,
+			strconv.FormatInt(phoneNumber.NationalNumber(), 10))
+	}
+
+	username, err := core.getUserKeyUsernameInsecure(inputCtx, userID)
+	if err != nil {
+		return nil, errors.Wrap("username", err)
+	}
+	if username != "" {
+		identifiers = append(identifiers, username)
+	}
+
+	baseProfile, err := core.getUserBaseProfileInsecure(inputCtx, userID)
+	if err != nil {
+		return nil, errors.Wrap("base profile", err)
+	}
+	if baseProfile != nil && baseProfile.DisplayName != "" {
+		identifiers = append(identifiers, baseProfile.DisplayName)
+		identifiers = append(identifiers, strings.Fields(baseProfile.DisplayName)...)
+	}
+
+	return identifiers, nil
 }
 
 func (core *Core) getUserPasswordHash(
@@ -115,10 +240,17 @@ func (core *Core) getUserPasswordHash(
 func (core *Core) hashPassword(
 	password string,
 ) (encodedPasswordHash string, err error) {
-	params := argon2PasswordHashingParamsDefault
+	return core.passwordHasher.hash(password)
+}
 
+// hashPasswordArgon2id derives the argon2id hash of the password and
+// returns it in the standard encoded hash representation.
+func hashPasswordArgon2id(
+	password string,
+	params argon2PasswordHashingParams,
+) (encodedPasswordHash string, err error) {
 	// generate a chryptographically secure random salt
-	salt, err := core.generatePasswordSalt(params.SaltLength)
+	salt, err := generatePasswordSalt(params.SaltLength)
 	if err != nil {
 		return "", err
 	}
@@ -145,7 +277,7 @@ func (core *Core) hashPassword(
 	return encodedPasswordHash, nil
 }
 
-func (core *Core) generatePasswordSalt(n uint32) ([]byte, error) {
+func generatePasswordSalt(n uint32) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
 	if err != nil {
@@ -154,7 +286,7 @@ func (core *Core) generatePasswordSalt(n uint32) ([]byte, error) {
 	return b, nil
 }
 
-func (core *Core) matchPasswordAndPasswordHash(
+func matchPasswordArgon2id(
 	clearTextPassword, encodedPasswordHash string,
 ) (match bool, err error) {
 	// Extract the parameters, salt and derived key from the encoded password
@@ -163,8 +295,7 @@ func (core *Core) matchPasswordAndPasswordHash(
 		return false, nil
 	}
 
-	params, salt, hash, err := core.
-		decodePasswordHash(encodedPasswordHash)
+	params, salt, hash, err := decodePasswordHash(encodedPasswordHash)
 	if err != nil {
 		return false, err
 	}
@@ -180,12 +311,12 @@ func (core *Core) matchPasswordAndPasswordHash(
 	return true, nil
 }
 
-func (core *Core) decodePasswordHash(
+func decodePasswordHash(
 	encodedPasswordHash string,
 ) (params *argon2PasswordHashingParams, salt, hash []byte, err error) {
 	vals := strings.Split(encodedPasswordHash, "$")
 
-	if len(vals) != 6 {
+	if len(vals) != 6 || vals[1] != "argon2id" {
 		return nil, nil, nil, ErrPasswordHashFormatInvalid
 	}
 
@@ -0,0 +1,343 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/email"
+	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
+)
+
+const (
+	userPasswordResetDBTableName = "user_password_reset_dt"
+
+	userPasswordResetTTL = 15 * time.Minute
+
+	userPasswordResetConfirmationAttemptsMax = 3
+)
+
+// StartUserPasswordReset sends a password reset code to the identifier,
+// which is either an email address or a phone number, if it's a verified
+// identifier of a user. The returned token is required, along with
+// the code, to set the new password with ConfirmUserPasswordReset.
+//
+// To prevent the identifiers from being enumerated, the result is the same
+// whether the identifier has been registered or not; the requests are
+// rate limited either way, and the code is sent in the background.
+func (core *Core) StartUserPasswordReset(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+	identifier string,
+) (resetToken string, expiry time.Time, err error) {
+	if reqApp == nil {
+		return "", time.Time{}, errors.ArgMsg("reqApp", "missing")
+	}
+	if identifier == "" {
+		return "", time.Time{}, errors.ArgMsg("identifier", "empty")
+	}
+
+	var emailAddress *email.Address
+	var phoneNumber *telephony.PhoneNumber
+	if v, parseErr := email.AddressFromString(identifier); parseErr == nil {
+		emailAddress = &v
+	} else if v, parseErr := telephony.PhoneNumberFromString(identifier); parseErr == nil {
+		phoneNumber = &v
+	} else {
+		return "", time.Time{}, errors.ArgMsg("identifier", "malformed")
+	}
+
+	// The limits are on the canonical form so that the different forms
+	// of an identifier share the limit.
+	var canonicalIdentifier string
+	if emailAddress != nil {
+		canonicalIdentifier = emailAddress.String()
+	} else {
+		canonicalIdentifier = phoneNumber.String()
+	}
+	err = core.takeRateLimits(inputCtx, core.passwordResetRateLimitKeys(
+		inputCtx, canonicalIdentifier, reqApp.ID)...)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	var ownerUserIDNum iam.UserIDNum
+	var verificationType string
+	if emailAddress != nil {
+		verificationType = iam.TerminalVerificationResourceTypeEmailAddress
+		ownerUserIDNum, err = core.getUserIDNumByKeyEmailAddressInsecure(*emailAddress)
+		if err != nil {
+			return "", time.Time{}, errors.Wrap("getUserIDNumByKeyEmailAddressInsecure", err)
+		}
+	} else {
+		verificationType = iam.TerminalVerificationResourceTypePhoneNumber
+		ownerUserIDNum, err = core.getUserIDNumByKeyPhoneNumberInsecure(*phoneNumber)
+		if err != nil {
+			return "", time.Time{}, errors.Wrap("getUserIDNumByKeyPhoneNumberInsecure", err)
+		}
+	}
+	if ownerUserIDNum.IsNotStaticallyValid() {
+		// Nothing is sent but the reset is recorded nonetheless; it can't
+		// be confirmed.
+		ownerUserIDNum = iam.UserIDNumZero
+		logCtx(inputCtx).Info().
+			Str("event", "password_reset_unknown_identifier").
+			Msg("Password reset for an unregistered identifier")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err = rand.Read(tokenBytes); err != nil {
+		return "", time.Time{}, errors.Wrap("token generation", err)
+	}
+	resetToken = base64.RawURLEncoding.EncodeToString(tokenBytes)
+	expiry = ctxTime.Add(userPasswordResetTTL).Truncate(time.Minute)
+
+	// The verification is attached once the code has been sent.
+	tokenHash := hashUserPasswordResetToken(resetToken)
+	_, err = core.db.Exec(
+		`INSERT INTO `+userPasswordResetDBTableName+` `+
+			`(token_hash, user_id, verification_type, `+
+			`expiry_ts, confirmation_attempts_remaining, `+
+			`md_c_ts, md_c_tid, md_c_uid) `+
+			`VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		tokenHash, ownerUserIDNum.PrimitiveValue(), verificationType,
+		expiry, userPasswordResetConfirmationAttemptsMax,
+		ctxTime, inputCtx.Authorization().TerminalIDNumPtr(),
+		inputCtx.Authorization().UserIDNumPtr())
+	if err != nil {
+		return "", time.Time{}, errors.Wrap("insert", err)
+	}
+
+	// The code is sent after the call has returned so that neither
+	// the response time nor a delivery failure tells whether
+	// the identifier has been registered.
+	if ownerUserIDNum.IsStaticallyValid() {
+		core.deliverLater(func() {
+			core.deliverUserPasswordResetCode(inputCtx, tokenHash,
+				emailAddress, phoneNumber)
+		})
+	}
+
+	// The stale resets are of no use to anyone.
+	_, err = core.db.Exec(
+		`DELETE FROM `+userPasswordResetDBTableName+` `+
+			`WHERE expiry_ts < $1`,
+		ctxTime.Add(-time.Hour))
+	if err != nil {
+		logCtx(inputCtx).Warn().Err(err).
+			Msg("Stale password resets clean up")
+	}
+
+	return resetToken, expiry, nil
+}
+
+// deliverUserPasswordResetCode sends the code to the identifier and
+// attaches the verification to the reset. The errors are only logged;
+// the reset can't be confirmed without the code.
+func (core *Core) deliverUserPasswordResetCode(
+	inputCtx iam.CallInputContext,
+	tokenHash string,
+	emailAddress *email.Address,
+	phoneNumber *telephony.PhoneNumber,
+) {
+	userPreferredLanguages := inputCtx.OriginInfo().AcceptLanguage
+
+	var verificationID int64
+	var err error
+	if emailAddress != nil {
+		verificationID, _, err = core.eaVerifier.
+			StartPasswordResetVerification(inputCtx, *emailAddress,
+				userPasswordResetTTL, userPreferredLanguages)
+		if err != nil {
+			logCtx(inputCtx).Error().Err(err).
+				Msg("eaVerifier.StartPasswordResetVerification")
+			return
+		}
+	} else {
+		verificationID, _, err = core.pnVerifier.
+			StartPasswordResetVerification(inputCtx, *phoneNumber,
+				userPasswordResetTTL, userPreferredLanguages)
+		if err != nil {
+			logCtx(inputCtx).Error().Err(err).
+				Msg("pnVerifier.StartPasswordResetVerification")
+			return
+		}
+	}
+
+	_, err = core.db.Exec(
+		`UPDATE `+userPasswordResetDBTableName+` `+
+			`SET verification_id = $1 `+
+			`WHERE token_hash = $2`,
+		verificationID, tokenHash)
+	if err != nil {
+		logCtx(inputCtx).Error().Err(err).
+			Msg("Password reset verification update")
+	}
+}
+
+// ConfirmUserPasswordReset sets the password of the user who requested
+// the reset if the code matches the one sent to the user's identifier.
+// All the user's terminals, except the one making the call if there's
+// any, are revoked.
+func (core *Core) ConfirmUserPasswordReset(
+	inputCtx iam.CallInputContext,
+	resetToken string,
+	code string,
+	newPassword string,
+) error {
+	if resetToken == "" {
+		return iam.ErrUserPasswordResetTokenInvalid
+	}
+	if code == "" {
+		return errors.ArgMsg("code", "empty")
+	}
+
+	rateLimitKeys := []rateLimitKey{
+		{core.rateLimitRules().verificationConfirmIP, rateLimitOriginKey(inputCtx)},
+	}
+	attempt, err := core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return err
+	}
+	defer attempt.end()
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	tokenHash := hashUserPasswordResetToken(resetToken)
+
+	var userIDNum iam.UserIDNum
+	var verificationType string
+	var verificationID int64
+	var expiry time.Time
+	var attemptsRemaining int16
+	var claimTime *time.Time
+	err = core.db.
+		QueryRow(
+			`UPDATE `+userPasswordResetDBTableName+` `+
+				`SET confirmation_attempts_remaining = confirmation_attempts_remaining - 1 `+
+				`WHERE token_hash = $1 `+
+				`RETURNING user_id, verification_type, verification_id, `+
+				`expiry_ts, confirmation_attempts_remaining, claimed_ts`,
+			tokenHash).
+		Scan(&userIDNum, &verificationType, &verificationID,
+			&expiry, &attemptsRemaining, &claimTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			attempt.fail()
+			return iam.ErrUserPasswordResetTokenInvalid
+		}
+		return errors.Wrap("update", err)
+	}
+	if claimTime != nil {
+		return iam.ErrUserPasswordResetTokenInvalid
+	}
+	if attemptsRemaining < 0 || expiry.Before(ctxTime) {
+		return iam.ErrUserPasswordResetTokenExpired
+	}
+	if userIDNum.IsNotStaticallyValid() || verificationID == 0 {
+		// The identifier has not been registered, or the code has not
+		// been sent; no code could match.
+		attempt.fail()
+		return iam.ErrUserPasswordResetCodeMismatch
+	}
+
+	switch verificationType {
+	case iam.TerminalVerificationResourceTypeEmailAddress:
+		err = core.eaVerifier.
+			ConfirmVerification(inputCtx, verificationID, code)
+		switch err {
+		case eav10n.ErrVerificationCodeMismatch:
+			attempt.fail()
+			return iam.ErrUserPasswordResetCodeMismatch
+		case eav10n.ErrVerificationCodeExpired:
+			return iam.ErrUserPasswordResetTokenExpired
+		}
+	case iam.TerminalVerificationResourceTypePhoneNumber:
+		err = core.pnVerifier.
+			ConfirmVerification(inputCtx, verificationID, code)
+		switch err {
+		case pnv10n.ErrVerificationCodeMismatch:
+			attempt.fail()
+			return iam.ErrUserPasswordResetCodeMismatch
+		case pnv10n.ErrVerificationCodeExpired:
+			return iam.ErrUserPasswordResetTokenExpired
+		}
+	default:
+		return errors.New("unsupported verification type " + verificationType)
+	}
+	if err != nil {
+		return errors.Wrap("ConfirmVerification", err)
+	}
+
+	userID := iam.NewUserID(userIDNum)
+
+	// The password is checked before the reset is claimed so that
+	// the user could try another password with the same code.
+	if err = core.checkUserPasswordPolicy(inputCtx, userID, newPassword); err != nil {
+		return err
+	}
+
+	xres, err := core.db.Exec(
+		`UPDATE `+userPasswordResetDBTableName+` `+
+			`SET claimed_ts = $1 `+
+			`WHERE token_hash = $2 AND claimed_ts IS NULL`,
+		ctxTime, tokenHash)
+	if err != nil {
+		return errors.Wrap("claim", err)
+	}
+	if n, err := xres.RowsAffected(); err != nil {
+		return errors.Wrap("claim", err)
+	} else if n != 1 {
+		return iam.ErrUserPasswordResetTokenInvalid
+	}
+
+	if err = core.setUserPasswordInsecure(inputCtx, userID, newPassword); err != nil {
+		return errors.Wrap("setUserPasswordInsecure", err)
+	}
+
+	// Whoever knew the old password must not stay signed in.
+	err = core.revokeUserTerminalsInsecure(inputCtx, userIDNum,
+		inputCtx.Authorization().TerminalIDNum())
+	if err != nil {
+		return errors.Wrap("revokeUserTerminalsInsecure", err)
+	}
+
+	return nil
+}
+
+// revokeUserTerminalsInsecure revokes all the user's terminals except
+// the one specified, if it's valid.
+func (core *Core) revokeUserTerminalsInsecure(
+	inputCtx iam.CallInputContext,
+	userIDNum iam.UserIDNum,
+	exceptTerminalIDNum iam.TerminalIDNum,
+) error {
+	var terminalIDNums []iam.TerminalIDNum
+	err := core.db.Select(&terminalIDNums,
+		`SELECT id_num FROM `+terminalDBTableName+` `+
+			`WHERE user_id = $1 AND id_num <> $2 AND md_d_ts IS NULL`,
+		userIDNum.PrimitiveValue(), exceptTerminalIDNum.PrimitiveValue())
+	if err != nil {
+		return errors.Wrap("select", err)
+	}
+	for _, terminalIDNum := range terminalIDNums {
+		if _, err = core.revokeTerminalInsecure(inputCtx, terminalIDNum); err != nil {
+			return errors.Wrap("revokeTerminalInsecure", err)
+		}
+	}
+	return nil
+}
+
+func hashUserPasswordResetToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
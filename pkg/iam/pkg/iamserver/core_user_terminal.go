@@ -0,0 +1,121 @@
+package iamserver
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	goqu "github.com/doug-martin/goqu/v9"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// UserTerminalInfo holds the information about a terminal which a user
+// is signed in with.
+type UserTerminalInfo struct {
+	TerminalID  iam.TerminalID
+	DisplayName string
+	// AcceptLanguage is the value of the Accept-Language header when
+	// the terminal was registered.
+	AcceptLanguage   string
+	VerificationType string
+
+	CreationTime          time.Time
+	CreationOriginAddress string
+	CreationOriginEnv     string
+	// LastUseTime is the last time an access token was issued for
+	// the terminal. It's nil if no token has been issued for it. It
+	// could lag behind by a few seconds as it's recorded asynchronously.
+	LastUseTime *time.Time
+	// LastUseOriginAddress and LastUseOriginEnv are the IP address and
+	// the user agent of the request which LastUseTime is for.
+	LastUseOriginAddress string
+	LastUseOriginEnv     string
+
+	// Current is true for the terminal which made the call.
+	Current bool
+}
+
+// ListUserTerminals retrieves the active terminals of the user in
+// the context, the most recently used ones first.
+func (core *Core) ListUserTerminals(
+	inputCtx iam.CallInputContext,
+) ([]UserTerminalInfo, error) {
+	if inputCtx == nil {
+		return nil, errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return nil, iam.ErrUserContextRequired
+	}
+
+	sqlString, _, _ := goqu.
+		From(terminalDBTableName).
+		Select(
+			"id_num", "application_id",
+			"display_name", "accept_language", "verification_type",
+			"md_c_ts", "md_c_origin_address", "md_c_origin_env",
+			"last_use_ts", "last_use_origin_address", "last_use_origin_env").
+		Where(
+			goqu.C("user_id").Eq(ctxAuth.UserIDNum().PrimitiveValue()),
+			goqu.C("md_d_ts").IsNull(),
+			goqu.C("verification_ts").IsNotNull(),
+		).
+		Order(
+			goqu.C("last_use_ts").Desc().NullsLast(),
+			goqu.C("md_c_ts").Desc()).
+		ToSQL()
+	rows, err := core.db.Query(sqlString)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var terminals []UserTerminalInfo
+	for rows.Next() {
+		var terminalIDNum iam.TerminalIDNum
+		var appIDNum iam.ApplicationIDNum
+		var displayName, originAddress, originEnv sql.NullString
+		var lastUseOriginAddress, lastUseOriginEnv sql.NullString
+		var termInfo UserTerminalInfo
+		err = rows.Scan(
+			&terminalIDNum, &appIDNum,
+			&displayName, &termInfo.AcceptLanguage, &termInfo.VerificationType,
+			&termInfo.CreationTime, &originAddress, &originEnv,
+			&termInfo.LastUseTime, &lastUseOriginAddress, &lastUseOriginEnv)
+		if err != nil {
+			return nil, err
+		}
+		termInfo.TerminalID = iam.NewTerminalID(
+			iam.NewApplicationID(appIDNum), ctxAuth.UserID(), terminalIDNum)
+		termInfo.DisplayName = displayName.String
+		termInfo.CreationOriginAddress = originAddress.String
+		termInfo.CreationOriginEnv = originEnv.String
+		termInfo.LastUseOriginAddress = lastUseOriginAddress.String
+		termInfo.LastUseOriginEnv = lastUseOriginEnv.String
+		termInfo.Current = ctxAuth.TerminalIDNum().EqualsTerminalIDNum(terminalIDNum)
+		terminals = append(terminals, termInfo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return terminals, nil
+}
+
+// RevokeUserOtherTerminals revokes all the terminals of the user in
+// the context except the one which made the call.
+func (core *Core) RevokeUserOtherTerminals(
+	inputCtx iam.CallInputContext,
+) error {
+	if inputCtx == nil {
+		return errors.ArgMsg("inputCtx", "missing")
+	}
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		return iam.ErrUserContextRequired
+	}
+
+	return core.revokeUserTerminalsInsecure(inputCtx,
+		ctxAuth.UserIDNum(), ctxAuth.TerminalIDNum())
+}
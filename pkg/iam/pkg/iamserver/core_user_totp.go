@@ -0,0 +1,511 @@
+package iamserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/totp"
+)
+
+const (
+	userTOTPDBTableName            = "user_totp_dt"
+	userMFARecoveryCodeDBTableName = "user_mfa_recovery_code_dt"
+
+	// The secret which contains the key used to encrypt the TOTP
+	// secrets.
+	totpEncryptionKeySecretName = "totp_encryption.key"
+
+	userMFARecoveryCodeCount = 10
+)
+
+var (
+	ErrUserTOTPUnavailable = errors.New("TOTP is not configured")
+
+	ErrUserTOTPAlreadyEnabled = errors.EntMsg("totp", "already enabled")
+	ErrUserTOTPNotEnabled     = errors.EntMsg("totp", "not enabled")
+	ErrUserTOTPNotPending     = errors.EntMsg("totp", "no pending enrollment")
+)
+
+// UserTOTPEnrollmentData holds the secret of a pending TOTP enrollment.
+// The user adds the secret to an authenticator application, usually by
+// scanning the KeyURI as a QR code.
+type UserTOTPEnrollmentData struct {
+	// Secret is the base32-encoded secret for users who enter the secret
+	// manually.
+	Secret string
+	// KeyURI is the otpauth URI of the secret.
+	KeyURI string
+}
+
+// StartUserTOTPEnrollment generates a new TOTP secret for the user. The
+// secret is not used until the user has confirmed it with
+// ConfirmUserTOTPEnrollment. A pending enrollment is replaced.
+func (core *Core) StartUserTOTPEnrollment(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) (*UserTOTPEnrollmentData, error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+	if core.totpSecretCipher == nil {
+		return nil, ErrUserTOTPUnavailable
+	}
+
+	enabled, err := core.IsUserTOTPEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrUserTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.Wrap("secret generation", err)
+	}
+	secretEncrypted, err := core.totpSecretCipher.seal(
+		secret, userTOTPSecretAssociatedData(userID.IDNum()))
+	if err != nil {
+		return nil, errors.Wrap("secret encryption", err)
+	}
+
+	accountName, err := core.userAccountName(inputCtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	err = doTx(core.db, func(tx *sqlx.Tx) error {
+		_, txErr := tx.Exec(
+			`UPDATE `+userTOTPDBTableName+` SET `+
+				`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
+				`WHERE user_id = $4 AND enabled_ts IS NULL AND md_d_ts IS NULL`,
+			ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+			userID.IDNum().PrimitiveValue())
+		if txErr != nil {
+			return txErr
+		}
+		_, txErr = tx.Exec(
+			`INSERT INTO `+userTOTPDBTableName+` `+
+				`(user_id, secret_encrypted, md_c_ts, md_c_uid, md_c_tid) `+
+				`VALUES ($1, $2, $3, $4, $5)`,
+			userID.IDNum().PrimitiveValue(), secretEncrypted,
+			ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue())
+		return txErr
+	})
+	if err != nil {
+		return nil, errors.Wrap("insert", err)
+	}
+
+	return &UserTOTPEnrollmentData{
+		Secret: totp.EncodeSecret(secret),
+		KeyURI: totp.KeyURI(core.realmInfo.Name, accountName, secret),
+	}, nil
+}
+
+// ConfirmUserTOTPEnrollment enables the pending TOTP secret if the code
+// matches. It returns the recovery codes which the user should keep
+// somewhere safe; they are not retrievable later.
+func (core *Core) ConfirmUserTOTPEnrollment(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	code string,
+) (recoveryCodes []string, err error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+	if core.totpSecretCipher == nil {
+		return nil, ErrUserTOTPUnavailable
+	}
+
+	rateLimitKeys := core.mfaRateLimitKeys(inputCtx, userID.IDNum())
+	var attempt *rateLimitedAttempt
+	attempt, err = core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return nil, err
+	}
+	defer attempt.end()
+
+	var secretEncrypted []byte
+	err = core.db.
+		QueryRow(
+			`SELECT secret_encrypted FROM `+userTOTPDBTableName+` `+
+				`WHERE user_id = $1 AND enabled_ts IS NULL AND md_d_ts IS NULL`,
+			userID.IDNum().PrimitiveValue()).
+		Scan(&secretEncrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserTOTPNotPending
+		}
+		return nil, errors.Wrap("select", err)
+	}
+	secret, err := core.totpSecretCipher.open(
+		secretEncrypted, userTOTPSecretAssociatedData(userID.IDNum()))
+	if err != nil {
+		return nil, errors.Wrap("secret decryption", err)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	timeStep, valid := totp.Validate(secret, code, ctxTime)
+	if !valid {
+		attempt.fail()
+		return nil, iam.ErrMFACodeMismatch
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateUserMFARecoveryCodes()
+	if err != nil {
+		return nil, errors.Wrap("recovery code generation", err)
+	}
+
+	err = doTx(core.db, func(tx *sqlx.Tx) error {
+		xres, txErr := tx.Exec(
+			`UPDATE `+userTOTPDBTableName+` SET `+
+				`enabled_ts = $1, last_time_step = $2 `+
+				`WHERE user_id = $3 AND enabled_ts IS NULL AND md_d_ts IS NULL`,
+			ctxTime, timeStep, userID.IDNum().PrimitiveValue())
+		if txErr != nil {
+			return txErr
+		}
+		n, txErr := xres.RowsAffected()
+		if txErr != nil {
+			return txErr
+		}
+		if n != 1 {
+			// Confirmed by a concurrent call
+			return ErrUserTOTPNotPending
+		}
+		return core.replaceUserMFARecoveryCodesTx(
+			inputCtx, tx, userID.IDNum(), recoveryCodeHashes)
+	})
+	if err != nil {
+		if err == ErrUserTOTPNotPending {
+			return nil, err
+		}
+		return nil, errors.Wrap("update", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableUserTOTP disables the second factor. The user needs to provide
+// a TOTP code or a recovery code.
+func (core *Core) DisableUserTOTP(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	code string,
+) error {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return iam.ErrOperationNotAllowed
+	}
+
+	enabled, err := core.IsUserTOTPEnabled(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrUserTOTPNotEnabled
+	}
+
+	if err = core.verifyUserSecondFactorInsecure(inputCtx, userID.IDNum(), code); err != nil {
+		return err
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	return doTx(core.db, func(tx *sqlx.Tx) error {
+		for _, tableName := range []string{
+			userTOTPDBTableName, userMFARecoveryCodeDBTableName,
+		} {
+			_, txErr := tx.Exec(
+				`UPDATE `+tableName+` SET `+
+					`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
+					`WHERE user_id = $4 AND md_d_ts IS NULL`,
+				ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+				userID.IDNum().PrimitiveValue())
+			if txErr != nil {
+				return txErr
+			}
+		}
+		return nil
+	})
+}
+
+// RegenerateUserMFARecoveryCodes replaces the user's recovery codes. The
+// user needs to provide a TOTP code or one of the current recovery codes.
+func (core *Core) RegenerateUserMFARecoveryCodes(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	code string,
+) (recoveryCodes []string, err error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+
+	enabled, err := core.IsUserTOTPEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrUserTOTPNotEnabled
+	}
+
+	if err = core.verifyUserSecondFactorInsecure(inputCtx, userID.IDNum(), code); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateUserMFARecoveryCodes()
+	if err != nil {
+		return nil, errors.Wrap("recovery code generation", err)
+	}
+	err = doTx(core.db, func(tx *sqlx.Tx) error {
+		return core.replaceUserMFARecoveryCodesTx(
+			inputCtx, tx, userID.IDNum(), recoveryCodeHashes)
+	})
+	if err != nil {
+		return nil, errors.Wrap("update", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// IsUserTOTPEnabled returns true if the user has confirmed a TOTP secret.
+// Such users are required to provide a second factor when they sign in.
+func (core *Core) IsUserTOTPEnabled(userID iam.UserID) (bool, error) {
+	var enabled bool
+	err := core.db.
+		QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM `+userTOTPDBTableName+` `+
+				`WHERE user_id = $1 AND enabled_ts IS NOT NULL AND md_d_ts IS NULL)`,
+			userID.IDNum().PrimitiveValue()).
+		Scan(&enabled)
+	if err != nil {
+		return false, errors.Wrap("select", err)
+	}
+	return enabled, nil
+}
+
+// verifyUserSecondFactorInsecure checks the code, which is either a TOTP
+// code or a recovery code. A code is accepted only once. It returns
+// iam.ErrMFACodeMismatch if the code is not valid.
+func (core *Core) verifyUserSecondFactorInsecure(
+	inputCtx iam.CallInputContext,
+	userIDNum iam.UserIDNum,
+	code string,
+) error {
+	rateLimitKeys := core.mfaRateLimitKeys(inputCtx, userIDNum)
+	attempt, err := core.startRateLimitedAttempt(inputCtx, rateLimitKeys...)
+	if err != nil {
+		return err
+	}
+	defer attempt.end()
+
+	var accepted bool
+	if isTOTPCodeFormat(code) {
+		accepted, err = core.useUserTOTPCodeInsecure(inputCtx, userIDNum, code)
+	} else {
+		accepted, err = core.useUserMFARecoveryCodeInsecure(inputCtx, userIDNum, code)
+	}
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		attempt.fail()
+		return iam.ErrMFACodeMismatch
+	}
+	return nil
+}
+
+func (core *Core) useUserTOTPCodeInsecure(
+	inputCtx iam.CallInputContext,
+	userIDNum iam.UserIDNum,
+	code string,
+) (accepted bool, err error) {
+	if core.totpSecretCipher == nil {
+		return false, ErrUserTOTPUnavailable
+	}
+
+	var secretEncrypted []byte
+	err = core.db.
+		QueryRow(
+			`SELECT secret_encrypted FROM `+userTOTPDBTableName+` `+
+				`WHERE user_id = $1 AND enabled_ts IS NOT NULL AND md_d_ts IS NULL`,
+			userIDNum.PrimitiveValue()).
+		Scan(&secretEncrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.Wrap("select", err)
+	}
+	secret, err := core.totpSecretCipher.open(
+		secretEncrypted, userTOTPSecretAssociatedData(userIDNum))
+	if err != nil {
+		return false, errors.Wrap("secret decryption", err)
+	}
+
+	timeStep, valid := totp.Validate(secret, code,
+		inputCtx.CallInputMetadata().ReceiveTime)
+	if !valid {
+		return false, nil
+	}
+
+	// Prevents the replay of the code, and of any earlier code.
+	xres, err := core.db.Exec(
+		`UPDATE `+userTOTPDBTableName+` SET last_time_step = $1 `+
+			`WHERE user_id = $2 AND enabled_ts IS NOT NULL AND md_d_ts IS NULL `+
+			`AND last_time_step < $1`,
+		timeStep, userIDNum.PrimitiveValue())
+	if err != nil {
+		return false, errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap("update", err)
+	}
+	return n == 1, nil
+}
+
+func (core *Core) useUserMFARecoveryCodeInsecure(
+	inputCtx iam.CallInputContext,
+	userIDNum iam.UserIDNum,
+	code string,
+) (accepted bool, err error) {
+	code = normalizeUserMFARecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	xres, err := core.db.Exec(
+		`UPDATE `+userMFARecoveryCodeDBTableName+` SET used_ts = $1 `+
+			`WHERE user_id = $2 AND code_hash = $3 `+
+			`AND used_ts IS NULL AND md_d_ts IS NULL`,
+		inputCtx.CallInputMetadata().ReceiveTime,
+		userIDNum.PrimitiveValue(), hashUserMFARecoveryCode(code))
+	if err != nil {
+		return false, errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap("update", err)
+	}
+	return n == 1, nil
+}
+
+func (core *Core) replaceUserMFARecoveryCodesTx(
+	inputCtx iam.CallInputContext,
+	tx *sqlx.Tx,
+	userIDNum iam.UserIDNum,
+	codeHashes []string,
+) error {
+	ctxAuth := inputCtx.Authorization()
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+
+	_, err := tx.Exec(
+		`UPDATE `+userMFARecoveryCodeDBTableName+` SET `+
+			`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
+			`WHERE user_id = $4 AND md_d_ts IS NULL`,
+		ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+		userIDNum.PrimitiveValue())
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(
+			`INSERT INTO `+userMFARecoveryCodeDBTableName+` `+
+				`(user_id, code_hash, md_c_ts, md_c_uid, md_c_tid) `+
+				`VALUES ($1, $2, $3, $4, $5)`,
+			userIDNum.PrimitiveValue(), codeHash,
+			ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userAccountName returns the name which identifies the user in
+// the authenticator applications.
+func (core *Core) userAccountName(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) (string, error) {
+	emailAddress, err := core.getUserKeyEmailAddressInsecure(inputCtx, userID)
+	if err != nil {
+		return "", errors.Wrap("email address", err)
+	}
+	if emailAddress != nil {
+		return emailAddress.String(), nil
+	}
+	phoneNumber, err := core.getUserKeyPhoneNumberInsecure(inputCtx, userID)
+	if err != nil {
+		return "", errors.Wrap("phone number", err)
+	}
+	if phoneNumber != nil {
+		return phoneNumber.String(), nil
+	}
+	return userID.AZIDText(), nil
+}
+
+func userTOTPSecretAssociatedData(userIDNum iam.UserIDNum) []byte {
+	return []byte(userTOTPDBTableName + ":" + iam.NewUserID(userIDNum).AZIDText())
+}
+
+func isTOTPCodeFormat(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// The recovery codes are 10 base32 characters, about 50 bits, formatted
+// as two groups of five, e.g., "abcde-fghij".
+var userMFARecoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateUserMFARecoveryCodes() (codes []string, codeHashes []string, err error) {
+	codes = make([]string, 0, userMFARecoveryCodeCount)
+	codeHashes = make([]string, 0, userMFARecoveryCodeCount)
+	for i := 0; i < userMFARecoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(userMFARecoveryCodeEncoding.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		codeHashes = append(codeHashes, hashUserMFARecoveryCode(code))
+	}
+	return codes, codeHashes, nil
+}
+
+// normalizeUserMFARecoveryCode accepts the codes as typed by the users:
+// with or without the separator, in any case.
+func normalizeUserMFARecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// The recovery codes are random enough that they don't need a slow hash.
+func hashUserMFARecoveryCode(normalizedCode string) string {
+	sum := sha256.Sum256([]byte(normalizedCode))
+	return hex.EncodeToString(sum[:])
+}
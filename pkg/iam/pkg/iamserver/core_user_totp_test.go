@@ -0,0 +1,43 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateUserMFARecoveryCodes(t *testing.T) {
+	codes, codeHashes, err := generateUserMFARecoveryCodes()
+	assert.Nil(t, err)
+	assert.Len(t, codes, userMFARecoveryCodeCount)
+	assert.Len(t, codeHashes, userMFARecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, byte('-'), code[5])
+		assert.False(t, seen[code])
+		seen[code] = true
+
+		// The hashes are of the normalized codes
+		assert.Equal(t, codeHashes[i],
+			hashUserMFARecoveryCode(normalizeUserMFARecoveryCode(code)))
+		assert.NotContains(t, codeHashes[i], code[:5])
+	}
+}
+
+func TestNormalizeUserMFARecoveryCode(t *testing.T) {
+	assert.Equal(t, "abcdefghij", normalizeUserMFARecoveryCode("abcde-fghij"))
+	assert.Equal(t, "abcdefghij", normalizeUserMFARecoveryCode(" ABCDE FGHIJ "))
+	assert.Equal(t, "abcdefghij", normalizeUserMFARecoveryCode("abcdefghij"))
+	assert.Equal(t, "", normalizeUserMFARecoveryCode(" - "))
+}
+
+func TestIsTOTPCodeFormat(t *testing.T) {
+	assert.True(t, isTOTPCodeFormat("123456"))
+	assert.True(t, isTOTPCodeFormat(" 012345 "))
+	assert.False(t, isTOTPCodeFormat("12345"))
+	assert.False(t, isTOTPCodeFormat("1234567"))
+	assert.False(t, isTOTPCodeFormat("12345a"))
+	assert.False(t, isTOTPCodeFormat("abcde-fghij"))
+}
@@ -0,0 +1,604 @@
+package iamserver
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
+)
+
+const (
+	userWebAuthnCredentialDBTableName = "user_webauthn_credential_dt"
+	webAuthnChallengeDBTableName      = "webauthn_challenge_dt"
+
+	webAuthnCeremonyRegistration   = "registration"
+	webAuthnCeremonyAuthentication = "authentication"
+
+	userWebAuthnCredentialCountMax          = 20
+	userWebAuthnCredentialDisplayNameMaxLen = 64
+)
+
+var (
+	ErrUserWebAuthnUnavailable = errors.New("WebAuthn is not configured")
+
+	ErrUserWebAuthnCredentialNotFound     = errors.EntMsg("webauthn credential", "not found")
+	ErrUserWebAuthnCredentialConflict     = errors.EntMsg("webauthn credential", "already registered")
+	ErrUserWebAuthnCredentialLimitReached = errors.EntMsg("webauthn credential", "limit reached")
+)
+
+// UserWebAuthnCredentialInfo describes a passkey of a user.
+type UserWebAuthnCredentialInfo struct {
+	// ID is the credential ID as generated by the authenticator.
+	ID          []byte
+	DisplayName string
+	// Synced is true for the passkeys which are backed up and synced
+	// among the user's devices.
+	Synced       bool
+	CreationTime time.Time
+	LastUseTime  *time.Time
+}
+
+// IsWebAuthnEnabled returns true if the passkeys have been configured.
+func (core *Core) IsWebAuthnEnabled() bool {
+	return core.webAuthnRelyingParty != nil
+}
+
+// StartUserWebAuthnRegistration starts the registration of a passkey
+// for the user. The options are passed to navigator.credentials.create
+// and the result to FinishUserWebAuthnRegistration.
+func (core *Core) StartUserWebAuthnRegistration(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) (*webauthn.CredentialCreationOptions, error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+	rp := core.webAuthnRelyingParty
+	if rp == nil {
+		return nil, ErrUserWebAuthnUnavailable
+	}
+
+	existing, err := core.listUserWebAuthnCredentialIDsInsecure(userID.IDNum())
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= userWebAuthnCredentialCountMax {
+		return nil, ErrUserWebAuthnCredentialLimitReached
+	}
+
+	accountName, err := core.userAccountName(inputCtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := core.createWebAuthnChallenge(
+		inputCtx, webAuthnCeremonyRegistration, userID.IDNum(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prevents registering the same authenticator twice
+	excludeCredentials := make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, credID := range existing {
+		excludeCredentials = append(excludeCredentials, webauthn.CredentialDescriptor{
+			Type: webauthn.CredentialTypePublicKey,
+			ID:   credID,
+		})
+	}
+
+	return rp.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          userWebAuthnUserHandle(userID.IDNum()),
+		Name:        accountName,
+		DisplayName: accountName,
+	}, excludeCredentials), nil
+}
+
+// FinishUserWebAuthnRegistration verifies the result of
+// navigator.credentials.create and stores the credential.
+func (core *Core) FinishUserWebAuthnRegistration(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	displayName string,
+	credential *webauthn.RegistrationResponse,
+) (*UserWebAuthnCredentialInfo, error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+	rp := core.webAuthnRelyingParty
+	if rp == nil {
+		return nil, ErrUserWebAuthnUnavailable
+	}
+	if credential == nil {
+		return nil, errors.ArgMsg("credential", "missing")
+	}
+	displayName, err := normalizeUserWebAuthnCredentialDisplayName(displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeData, err := core.claimWebAuthnChallenge(inputCtx,
+		webAuthnCeremonyRegistration, credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if challengeData.userIDNum != userID.IDNum() {
+		return nil, iam.ErrWebAuthnChallengeInvalid
+	}
+
+	cred, err := rp.VerifyRegistration(challengeData.challenge, credential)
+	if err != nil {
+		logCtx(inputCtx).Warn().Err(err).
+			Msg("WebAuthn registration verification")
+		return nil, iam.ErrWebAuthnCredentialInvalid
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	_, err = core.db.Exec(
+		`INSERT INTO `+userWebAuthnCredentialDBTableName+` `+
+			`(user_id, credential_id, public_key, algorithm, sign_count, `+
+			`aaguid, transports, attestation_format, backup_eligible, backup_state, `+
+			`display_name, md_c_ts, md_c_uid, md_c_tid) `+
+			`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		userID.IDNum().PrimitiveValue(), cred.ID, cred.PublicKey,
+		int64(cred.Algorithm), int64(cred.SignCount),
+		cred.AAGUID, strings.Join(cred.Transports, ","), cred.AttestationFormat,
+		cred.BackupEligible, cred.BackupState, displayName,
+		ctxTime, ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue())
+	if err != nil {
+		if pqErr, _ := err.(*pq.Error); pqErr != nil && pqErr.Code == "23505" {
+			return nil, ErrUserWebAuthnCredentialConflict
+		}
+		return nil, errors.Wrap("insert", err)
+	}
+
+	return &UserWebAuthnCredentialInfo{
+		ID:           cred.ID,
+		DisplayName:  displayName,
+		Synced:       cred.BackupState,
+		CreationTime: ctxTime,
+	}, nil
+}
+
+// ListUserWebAuthnCredentials returns the user's passkeys, the most
+// recently registered first.
+func (core *Core) ListUserWebAuthnCredentials(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+) ([]UserWebAuthnCredentialInfo, error) {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return nil, iam.ErrOperationNotAllowed
+	}
+
+	rows, err := core.db.Query(
+		`SELECT credential_id, display_name, backup_state, md_c_ts, last_use_ts `+
+			`FROM `+userWebAuthnCredentialDBTableName+` `+
+			`WHERE user_id = $1 AND md_d_ts IS NULL `+
+			`ORDER BY md_c_ts DESC`,
+		userID.IDNum().PrimitiveValue())
+	if err != nil {
+		return nil, errors.Wrap("query", err)
+	}
+	defer rows.Close()
+
+	creds := []UserWebAuthnCredentialInfo{}
+	for rows.Next() {
+		var cred UserWebAuthnCredentialInfo
+		err = rows.Scan(&cred.ID, &cred.DisplayName, &cred.Synced,
+			&cred.CreationTime, &cred.LastUseTime)
+		if err != nil {
+			return nil, errors.Wrap("scan", err)
+		}
+		creds = append(creds, cred)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap("query", err)
+	}
+
+	return creds, nil
+}
+
+// RenameUserWebAuthnCredential sets the name the user identifies
+// the passkey with.
+func (core *Core) RenameUserWebAuthnCredential(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	credentialID []byte,
+	displayName string,
+) error {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return iam.ErrOperationNotAllowed
+	}
+	displayName, err := normalizeUserWebAuthnCredentialDisplayName(displayName)
+	if err != nil {
+		return err
+	}
+
+	xres, err := core.db.Exec(
+		`UPDATE `+userWebAuthnCredentialDBTableName+` SET `+
+			`display_name = $1, md_u_ts = $2, md_u_uid = $3, md_u_tid = $4 `+
+			`WHERE user_id = $5 AND credential_id = $6 AND md_d_ts IS NULL`,
+		displayName, inputCtx.CallInputMetadata().ReceiveTime,
+		ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+		userID.IDNum().PrimitiveValue(), credentialID)
+	if err != nil {
+		return errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return errors.Wrap("update", err)
+	}
+	if n != 1 {
+		return ErrUserWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteUserWebAuthnCredential removes the passkey. The terminals which
+// were authorized with the passkey are revoked as well.
+func (core *Core) DeleteUserWebAuthnCredential(
+	inputCtx iam.CallInputContext,
+	userID iam.UserID,
+	credentialID []byte,
+) error {
+	ctxAuth := inputCtx.Authorization()
+	if !ctxAuth.IsUser(userID) {
+		return iam.ErrOperationNotAllowed
+	}
+
+	var credIDNum int64
+	err := core.db.
+		QueryRow(
+			`UPDATE `+userWebAuthnCredentialDBTableName+` SET `+
+				`md_d_ts = $1, md_d_uid = $2, md_d_tid = $3 `+
+				`WHERE user_id = $4 AND credential_id = $5 AND md_d_ts IS NULL `+
+				`RETURNING id_num`,
+			inputCtx.CallInputMetadata().ReceiveTime,
+			ctxAuth.UserIDNum().PrimitiveValue(), ctxAuth.TerminalIDNum().PrimitiveValue(),
+			userID.IDNum().PrimitiveValue(), credentialID).
+		Scan(&credIDNum)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserWebAuthnCredentialNotFound
+		}
+		return errors.Wrap("update", err)
+	}
+
+	var terminalIDNums []iam.TerminalIDNum
+	err = core.db.Select(&terminalIDNums,
+		`SELECT id_num FROM `+terminalDBTableName+` `+
+			`WHERE user_id = $1 AND verification_type = $2 AND verification_id = $3 `+
+			`AND md_d_ts IS NULL`,
+		userID.IDNum().PrimitiveValue(),
+		iam.TerminalVerificationResourceTypeWebAuthn, credIDNum)
+	if err != nil {
+		return errors.Wrap("terminal query", err)
+	}
+	for _, terminalIDNum := range terminalIDNums {
+		_, err = core.revokeTerminalInsecure(inputCtx, terminalIDNum)
+		if err != nil {
+			return errors.Wrap("revokeTerminalInsecure", err)
+		}
+	}
+
+	return nil
+}
+
+// StartWebAuthnAuthentication starts a passkey sign-in for
+// the application. The options are passed to navigator.credentials.get
+// and the result to AuthorizeTerminalByWebAuthnAssertion. The users
+// are not identified beforehand; they choose any of their passkeys.
+func (core *Core) StartWebAuthnAuthentication(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+) (*webauthn.CredentialRequestOptions, error) {
+	rp := core.webAuthnRelyingParty
+	if rp == nil {
+		return nil, ErrUserWebAuthnUnavailable
+	}
+	if reqApp == nil {
+		return nil, errors.ArgMsg("reqApp", "missing")
+	}
+	if !reqApp.ID.IDNum().IsUserAgent() {
+		return nil, iam.ErrOperationNotAllowed
+	}
+
+	challenge, err := core.createWebAuthnChallenge(
+		inputCtx, webAuthnCeremonyAuthentication, 0, reqApp.ID.IDNum())
+	if err != nil {
+		return nil, err
+	}
+
+	return rp.RequestOptions(challenge, nil), nil
+}
+
+// AuthorizeTerminalByWebAuthnAssertion registers a terminal for the user
+// who owns the passkey the assertion was made with. If the authenticator
+// didn't verify the user and the user has enabled a second factor, it
+// returns an *MFARequiredError.
+func (core *Core) AuthorizeTerminalByWebAuthnAssertion(
+	inputCtx iam.CallInputContext,
+	reqApp *iam.Application,
+	terminalDisplayName string,
+	scope string,
+	assertion *webauthn.AssertionResponse,
+) (terminalID iam.TerminalID, terminalSecret string, userID iam.UserID, err error) {
+	rp := core.webAuthnRelyingParty
+	if rp == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), ErrUserWebAuthnUnavailable
+	}
+	if reqApp == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.ArgMsg("reqApp", "missing")
+	}
+	if assertion == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.ArgMsg("assertion", "missing")
+	}
+
+	challengeData, err := core.claimWebAuthnChallenge(inputCtx,
+		webAuthnCeremonyAuthentication, assertion.Response.ClientDataJSON)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+	// The challenge is only usable by the application it was issued to
+	if challengeData.applicationIDNum != reqApp.ID.IDNum() {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrWebAuthnChallengeInvalid
+	}
+
+	credIDNum, userIDNum, cred, err := core.getUserWebAuthnCredentialInsecure(
+		assertion.CredentialID())
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+	if cred == nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrWebAuthnCredentialInvalid
+	}
+	if userHandle := assertion.Response.UserHandle; len(userHandle) != 0 &&
+		string(userHandle) != string(userWebAuthnUserHandle(userIDNum)) {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrWebAuthnCredentialInvalid
+	}
+
+	assertionResult, err := rp.VerifyAssertion(challengeData.challenge, assertion, cred)
+	if err != nil {
+		if err == webauthn.ErrSignCountInvalid {
+			logCtx(inputCtx).Warn().Err(err).
+				Str("user_id", iam.NewUserID(userIDNum).AZIDText()).
+				Msg("WebAuthn signature counter did not increase; " +
+					"the authenticator might have been cloned")
+		} else {
+			logCtx(inputCtx).Warn().Err(err).
+				Msg("WebAuthn assertion verification")
+		}
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrWebAuthnCredentialInvalid
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	// The counter is compared so that only one of the concurrent
+	// assertions with the same counter is accepted.
+	xres, err := core.db.Exec(
+		`UPDATE `+userWebAuthnCredentialDBTableName+` SET `+
+			`sign_count = $1, backup_state = $2, last_use_ts = $3 `+
+			`WHERE id_num = $4 AND sign_count = $5 AND md_d_ts IS NULL`,
+		int64(assertionResult.SignCount), assertionResult.BackupState, ctxTime,
+		credIDNum, int64(cred.SignCount))
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("update", err)
+	}
+	n, err := xres.RowsAffected()
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), errors.Wrap("update", err)
+	}
+	if n != 1 {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), iam.ErrWebAuthnCredentialInvalid
+	}
+
+	userID = iam.NewUserID(userIDNum)
+
+	scope, err = core.scopeRegistry.ResolveApplicationScope(reqApp, scope)
+	if err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+
+	// A passkey which has been used with user verification is
+	// a multi-factor authentication on its own.
+	secondFactorRequired := false
+	if !assertionResult.UserVerified {
+		secondFactorRequired, err = core.IsUserTOTPEnabled(userID)
+		if err != nil {
+			return iam.TerminalIDZero(), "", iam.UserIDZero(),
+				errors.Wrap("IsUserTOTPEnabled", err)
+		}
+	}
+
+	regOutCtx, regOutData := core.RegisterTerminal(inputCtx, TerminalRegistrationInputData{
+		ApplicationID:        reqApp.ID,
+		UserID:               userID,
+		DisplayName:          terminalDisplayName,
+		VerificationType:     iam.TerminalVerificationResourceTypeWebAuthn,
+		VerificationID:       credIDNum,
+		SecondFactorRequired: secondFactorRequired,
+		OAuth2Scope:          scope,
+	})
+	if err = regOutCtx.Err; err != nil {
+		return iam.TerminalIDZero(), "", iam.UserIDZero(),
+			errors.Wrap("RegisterTerminal", err)
+	}
+
+	_, err = core.db.Exec(
+		`UPDATE `+userWebAuthnCredentialDBTableName+` SET last_use_tid = $1 `+
+			`WHERE id_num = $2`,
+		regOutData.TerminalID.IDNum().PrimitiveValue(), credIDNum)
+	if err != nil {
+		logCtx(inputCtx).Error().Err(err).
+			Msg("WebAuthn credential last-use terminal update")
+	}
+
+	if secondFactorRequired {
+		err = core.requireTerminalSecondFactor(
+			inputCtx, regOutData.TerminalID.IDNum(), userID)
+		return iam.TerminalIDZero(), "", iam.UserIDZero(), err
+	}
+
+	return regOutData.TerminalID, regOutData.TerminalSecret, userID, nil
+}
+
+func (core *Core) listUserWebAuthnCredentialIDsInsecure(
+	userIDNum iam.UserIDNum,
+) ([][]byte, error) {
+	var credIDs [][]byte
+	err := core.db.Select(&credIDs,
+		`SELECT credential_id FROM `+userWebAuthnCredentialDBTableName+` `+
+			`WHERE user_id = $1 AND md_d_ts IS NULL`,
+		userIDNum.PrimitiveValue())
+	if err != nil {
+		return nil, errors.Wrap("query", err)
+	}
+	return credIDs, nil
+}
+
+// getUserWebAuthnCredentialInsecure returns the stored credential. It
+// returns a nil credential if it's not registered.
+func (core *Core) getUserWebAuthnCredentialInsecure(
+	credentialID []byte,
+) (idNum int64, userIDNum iam.UserIDNum, cred *webauthn.Credential, err error) {
+	if len(credentialID) == 0 {
+		return 0, iam.UserIDNumZero, nil, nil
+	}
+	var algorithm, signCount int64
+	cred = &webauthn.Credential{ID: credentialID}
+	err = core.db.
+		QueryRow(
+			`SELECT id_num, user_id, public_key, algorithm, sign_count `+
+				`FROM `+userWebAuthnCredentialDBTableName+` `+
+				`WHERE credential_id = $1 AND md_d_ts IS NULL`,
+			credentialID).
+		Scan(&idNum, &userIDNum, &cred.PublicKey, &algorithm, &signCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, iam.UserIDNumZero, nil, nil
+		}
+		return 0, iam.UserIDNumZero, nil, errors.Wrap("select", err)
+	}
+	cred.Algorithm = webauthn.COSEAlgorithm(algorithm)
+	cred.SignCount = uint32(signCount)
+	return idNum, userIDNum, cred, nil
+}
+
+// createWebAuthnChallenge generates and stores the challenge of
+// a ceremony. A registration is for a user while an authentication is
+// for an application.
+func (core *Core) createWebAuthnChallenge(
+	inputCtx iam.CallInputContext,
+	ceremony string,
+	userIDNum iam.UserIDNum,
+	applicationIDNum iam.ApplicationIDNum,
+) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, errors.Wrap("challenge generation", err)
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	expiry := ctxTime.Add(core.webAuthnRelyingParty.Timeout())
+	err = doTx(core.db, func(tx *sqlx.Tx) error {
+		// The abandoned ceremonies are cleaned up here
+		_, txErr := tx.Exec(
+			`DELETE FROM `+webAuthnChallengeDBTableName+` WHERE expiry_ts < $1`,
+			ctxTime.Add(-time.Hour))
+		if txErr != nil {
+			return txErr
+		}
+		_, txErr = tx.Exec(
+			`INSERT INTO `+webAuthnChallengeDBTableName+` `+
+				`(challenge_hash, ceremony, user_id, application_id, expiry_ts) `+
+				`VALUES ($1, $2, $3, $4, $5)`,
+			hashWebAuthnChallenge(challenge), ceremony,
+			userIDNum.PrimitiveValue(), applicationIDNum.PrimitiveValue(), expiry)
+		return txErr
+	})
+	if err != nil {
+		return nil, errors.Wrap("insert", err)
+	}
+
+	return challenge, nil
+}
+
+type webAuthnChallengeData struct {
+	challenge        []byte
+	userIDNum        iam.UserIDNum
+	applicationIDNum iam.ApplicationIDNum
+}
+
+// claimWebAuthnChallenge looks up the ceremony by the challenge in
+// the client data and marks it as used. A challenge is claimed even if
+// the response turns out to be invalid so that each challenge gets only
+// one attempt.
+func (core *Core) claimWebAuthnChallenge(
+	inputCtx iam.CallInputContext,
+	ceremony string,
+	clientDataJSON []byte,
+) (*webAuthnChallengeData, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, iam.ErrWebAuthnChallengeInvalid
+	}
+	challenge, err := clientData.ChallengeBytes()
+	if err != nil || len(challenge) == 0 {
+		return nil, iam.ErrWebAuthnChallengeInvalid
+	}
+
+	ctxTime := inputCtx.CallInputMetadata().ReceiveTime
+	data := webAuthnChallengeData{challenge: challenge}
+	var expiry time.Time
+	err = core.db.
+		QueryRow(
+			`UPDATE `+webAuthnChallengeDBTableName+` SET claimed_ts = $1 `+
+				`WHERE challenge_hash = $2 AND ceremony = $3 AND claimed_ts IS NULL `+
+				`RETURNING user_id, application_id, expiry_ts`,
+			ctxTime, hashWebAuthnChallenge(challenge), ceremony).
+		Scan(&data.userIDNum, &data.applicationIDNum, &expiry)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, iam.ErrWebAuthnChallengeInvalid
+		}
+		return nil, errors.Wrap("update", err)
+	}
+	if ctxTime.After(expiry) {
+		return nil, iam.ErrWebAuthnChallengeExpired
+	}
+
+	return &data, nil
+}
+
+func hashWebAuthnChallenge(challenge []byte) string {
+	sum := sha256.Sum256(challenge)
+	return hex.EncodeToString(sum[:])
+}
+
+// userWebAuthnUserHandle returns the user handle of the user's
+// credentials. The authenticators return it with the assertions of
+// the discoverable credentials.
+func userWebAuthnUserHandle(userIDNum iam.UserIDNum) []byte {
+	return []byte(iam.NewUserID(userIDNum).AZIDText())
+}
+
+func normalizeUserWebAuthnCredentialDisplayName(displayName string) (string, error) {
+	displayName = strings.TrimSpace(displayName)
+	if utf8.RuneCountInString(displayName) > userWebAuthnCredentialDisplayNameMaxLen {
+		return "", errors.ArgMsg("displayName", "too long")
+	}
+	return displayName, nil
+}
@@ -0,0 +1,55 @@
+package iamserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
+)
+
+func TestNewWebAuthnRelyingParty(t *testing.T) {
+	rp, err := newWebAuthnRelyingParty(WebAuthnConfig{}, "Example")
+	assert.Nil(t, err)
+	assert.Nil(t, rp)
+
+	// The origins are required once the passkeys are enabled
+	_, err = newWebAuthnRelyingParty(WebAuthnConfig{
+		RPID: "example.com", Origins: " , "}, "Example")
+	assert.NotNil(t, err)
+
+	rp, err = newWebAuthnRelyingParty(WebAuthnConfig{
+		RPID:    "example.com",
+		Origins: "https://app.example.com, android:apk-key-hash:abc",
+		Timeout: time.Minute,
+	}, "Example")
+	assert.Nil(t, err)
+	if assert.NotNil(t, rp) {
+		assert.Equal(t, "example.com", rp.ID())
+		assert.Equal(t, time.Minute, rp.Timeout())
+		opts := rp.CreationOptions([]byte("challenge"), webauthn.UserEntity{}, nil)
+		assert.Equal(t, "Example", opts.RP.Name)
+	}
+}
+
+func TestNormalizeUserWebAuthnCredentialDisplayName(t *testing.T) {
+	displayName, err := normalizeUserWebAuthnCredentialDisplayName("  Laptop ")
+	assert.Nil(t, err)
+	assert.Equal(t, "Laptop", displayName)
+
+	_, err = normalizeUserWebAuthnCredentialDisplayName(
+		strings.Repeat("é", userWebAuthnCredentialDisplayNameMaxLen))
+	assert.Nil(t, err)
+	_, err = normalizeUserWebAuthnCredentialDisplayName(
+		strings.Repeat("é", userWebAuthnCredentialDisplayNameMaxLen+1))
+	assert.NotNil(t, err)
+}
+
+func TestHashWebAuthnChallenge(t *testing.T) {
+	assert.Len(t, hashWebAuthnChallenge([]byte("challenge")), 64)
+	assert.NotEqual(t,
+		hashWebAuthnChallenge([]byte("challenge")),
+		hashWebAuthnChallenge([]byte("Challenge")))
+}
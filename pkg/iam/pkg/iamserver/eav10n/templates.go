@@ -24,16 +24,51 @@ var (
 		"{{ .RealmName }} - Account Activation": {"en", "en-US", "en-GB"},
 		"{{ .RealmName }} - Aktifasi Akun":      {"id", "id-ID"},
 	}
+
+	localizedPasswordResetBodyHTMLTemplates map[string]*htmltpl.Template
+
+	localizedPasswordResetBodyHTMLTemplateSources = map[string][]string{
+		"password-reset-en.html": {"en", "en-US", "en-GB"},
+		"password-reset-id.html": {"id", "id-ID"},
+	}
+
+	localizedPasswordResetSubjectTemplates map[string]*texttpl.Template
+
+	localizedPasswordResetSubjectTemplateSources = map[string][]string{
+		"{{ .RealmName }} - Password Reset":        {"en", "en-US", "en-GB"},
+		"{{ .RealmName }} - Atur Ulang Kata Sandi": {"id", "id-ID"},
+	}
 )
 
 func loadTemplates(resourcesDir string) {
-	loadSubjectTemplates()
-	loadBodyTemplates(resourcesDir)
+	localizedAccountActivationSubjectTemplates = loadSubjectTemplates(
+		localizedAccountActivationSubjectTemplateSources)
+	localizedAccountActivationBodyHTMLTemplates = loadBodyTemplates(
+		resourcesDir, localizedAccountActivationBodyHTMLTemplateSources)
+	localizedPasswordResetSubjectTemplates = loadSubjectTemplates(
+		localizedPasswordResetSubjectTemplateSources)
+	localizedPasswordResetBodyHTMLTemplates = loadBodyTemplates(
+		resourcesDir, localizedPasswordResetBodyHTMLTemplateSources)
+}
+
+// localizedTemplates returns the templates of the messages sent for
+// the purpose.
+func localizedTemplates(
+	purpose VerificationPurpose,
+) (subjectTemplates map[string]*texttpl.Template, bodyTemplates map[string]*htmltpl.Template) {
+	if purpose == VerificationPurposePasswordReset {
+		return localizedPasswordResetSubjectTemplates,
+			localizedPasswordResetBodyHTMLTemplates
+	}
+	return localizedAccountActivationSubjectTemplates,
+		localizedAccountActivationBodyHTMLTemplates
 }
 
-func loadSubjectTemplates() {
-	localizedAccountActivationSubjectTemplates = make(map[string]*texttpl.Template)
-	for tplstr, locales := range localizedAccountActivationSubjectTemplateSources {
+func loadSubjectTemplates(
+	templateSources map[string][]string,
+) map[string]*texttpl.Template {
+	localizedTemplates := make(map[string]*texttpl.Template)
+	for tplstr, locales := range templateSources {
 		if len(locales) == 0 {
 			continue
 		}
@@ -43,23 +78,27 @@ func loadSubjectTemplates() {
 				continue
 			}
 			langTag := language.MustParse(locale)
-			if _, ok := localizedAccountActivationSubjectTemplates[langTag.String()]; ok {
+			if _, ok := localizedTemplates[langTag.String()]; ok {
 				panic("duplicate for locale " + locale + " (" + langTag.String() + ")")
 			}
-			localizedAccountActivationSubjectTemplates[langTag.String()] = tpl
+			localizedTemplates[langTag.String()] = tpl
 		}
 	}
 	// Ensure that we have a message template for the default locale.
-	if v := localizedAccountActivationSubjectTemplates[messageLocaleDefault.String()]; v == nil {
+	if v := localizedTemplates[messageLocaleDefault.String()]; v == nil {
 		panic("no template for default locale " + messageLocaleDefault.String())
 	}
+	return localizedTemplates
 }
 
-func loadBodyTemplates(resourcesDir string) {
-	localizedAccountActivationBodyHTMLTemplates = make(map[string]*htmltpl.Template)
+func loadBodyTemplates(
+	resourcesDir string,
+	templateSources map[string][]string,
+) map[string]*htmltpl.Template {
+	localizedTemplates := make(map[string]*htmltpl.Template)
 	// Load all message templates. We also ensure that there's no
 	// duplicates for the same language.
-	for tplfname, locales := range localizedAccountActivationBodyHTMLTemplateSources {
+	for tplfname, locales := range templateSources {
 		if len(locales) == 0 {
 			continue
 		}
@@ -71,14 +110,15 @@ func loadBodyTemplates(resourcesDir string) {
 				continue
 			}
 			langTag := language.MustParse(locale)
-			if _, ok := localizedAccountActivationBodyHTMLTemplates[langTag.String()]; ok {
+			if _, ok := localizedTemplates[langTag.String()]; ok {
 				panic("duplicate for locale " + locale + " (" + langTag.String() + ")")
 			}
-			localizedAccountActivationBodyHTMLTemplates[langTag.String()] = tpl
+			localizedTemplates[langTag.String()] = tpl
 		}
 	}
 	// Ensure that we have a message template for the default locale.
-	if v := localizedAccountActivationBodyHTMLTemplates[messageLocaleDefault.String()]; v == nil {
+	if v := localizedTemplates[messageLocaleDefault.String()]; v == nil {
 		panic("no template for default locale " + messageLocaleDefault.String())
 	}
+	return localizedTemplates
 }
@@ -128,13 +128,37 @@ type Verifier struct {
 	emailDeliveryServicesByDomain map[string]EmailDeliveryService
 }
 
-//TODO(exa): make the operations atomic
 func (verifier *Verifier) StartVerification(
 	inputCtx iam.CallInputContext,
 	emailAddress email.Address,
 	codeTTL time.Duration,
 	userPreferredLanguages []language.Tag,
 	preferredVerificationMethods []VerificationMethod,
+) (idNum int64, codeExpiry *time.Time, err error) {
+	return verifier.startVerification(inputCtx, VerificationPurposeDefault,
+		emailAddress, codeTTL, userPreferredLanguages, preferredVerificationMethods)
+}
+
+// StartPasswordResetVerification is like StartVerification but the email
+// contains the instructions to reset the password.
+func (verifier *Verifier) StartPasswordResetVerification(
+	inputCtx iam.CallInputContext,
+	emailAddress email.Address,
+	codeTTL time.Duration,
+	userPreferredLanguages []language.Tag,
+) (idNum int64, codeExpiry *time.Time, err error) {
+	return verifier.startVerification(inputCtx, VerificationPurposePasswordReset,
+		emailAddress, codeTTL, userPreferredLanguages, nil)
+}
+
+//TODO(exa): make the operations atomic
+func (verifier *Verifier) startVerification(
+	inputCtx iam.CallInputContext,
+	purpose VerificationPurpose,
+	emailAddress email.Address,
+	codeTTL time.Duration,
+	userPreferredLanguages []language.Tag,
+	preferredVerificationMethods []VerificationMethod,
 ) (idNum int64, codeExpiry *time.Time, err error) {
 	if inputCtx == nil {
 		return 0, nil, errors.ArgMsg("inputCtx", "missing")
@@ -150,11 +174,13 @@ func (verifier *Verifier) StartVerification(
 		QueryRow(
 			"SELECT id_num, code_expiry, confirmation_attempts_remaining "+
 				`FROM `+verificationDBTableName+` `+
-				"WHERE domain_part = $1 AND local_part = $2 AND confirmation_ts IS NULL "+
+				"WHERE domain_part = $1 AND local_part = $2 AND purpose = $3 "+
+				"AND confirmation_ts IS NULL "+
 				"ORDER BY id_num DESC "+
 				"LIMIT 1",
 			emailAddress.DomainPart(),
-			emailAddress.LocalPart()).
+			emailAddress.LocalPart(),
+			purpose).
 		Scan(&prevVerificationID, &prevCodeExpiry, &prevAttempts)
 	if err == nil {
 		// Return previous verification code
@@ -176,13 +202,14 @@ func (verifier *Verifier) StartVerification(
 	err = verifier.db.
 		QueryRow(
 			`INSERT INTO `+verificationDBTableName+` (`+
-				`domain_part, local_part, `+
+				`domain_part, local_part, purpose, `+
 				"md_c_ts, md_c_uid, md_c_tid, "+
 				"code, code_expiry, confirmation_attempts_remaining"+
-				") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) "+
+				") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) "+
 				"RETURNING id_num",
 			emailAddress.DomainPart(),
 			emailAddress.LocalPart(),
+			purpose,
 			ctxTime,
 			ctxAuth.UserIDNumPtr(),
 			ctxAuth.TerminalIDNumPtr(),
@@ -197,7 +224,7 @@ func (verifier *Verifier) StartVerification(
 	noDelivery := len(preferredVerificationMethods) == 1 &&
 		preferredVerificationMethods[0] == VerificationMethodNone
 	err = verifier.sendVerificationEmail(
-		emailAddress, code, userPreferredLanguages, noDelivery)
+		purpose, emailAddress, code, userPreferredLanguages, noDelivery)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -261,27 +288,30 @@ func (verifier *Verifier) ConfirmVerification(
 }
 
 func (verifier *Verifier) sendVerificationEmail(
+	purpose VerificationPurpose,
 	emailAddress email.Address,
 	code string,
 	userPreferredLanguages []language.Tag,
 	noDelivery bool,
 ) error {
+	subjectTemplates, bodyTemplates := localizedTemplates(purpose)
+
 	var subjectTemplate *texttpl.Template
 	var bodyTemplate *htmltpl.Template
 	if len(userPreferredLanguages) != 0 {
 		for _, locale := range userPreferredLanguages {
-			bodyTemplate = localizedAccountActivationBodyHTMLTemplates[locale.String()]
-			subjectTemplate = localizedAccountActivationSubjectTemplates[locale.String()]
+			bodyTemplate = bodyTemplates[locale.String()]
+			subjectTemplate = subjectTemplates[locale.String()]
 			if bodyTemplate != nil {
 				break
 			}
 		}
 	}
 	if bodyTemplate == nil {
-		bodyTemplate = localizedAccountActivationBodyHTMLTemplates[messageLocaleDefault.String()]
+		bodyTemplate = bodyTemplates[messageLocaleDefault.String()]
 	}
 	if subjectTemplate == nil {
-		subjectTemplate = localizedAccountActivationSubjectTemplates[messageLocaleDefault.String()]
+		subjectTemplate = subjectTemplates[messageLocaleDefault.String()]
 	}
 
 	var err error
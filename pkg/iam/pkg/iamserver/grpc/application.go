@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	grpcerrs "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/grpc/errors"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	iamv1pb "github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/grpc/iamv1pb"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+// ApplicationManagementServiceServer provides the gRPC counterpart of
+// the REST application management API. The service is defined in
+// iamv1pb's application_management.proto.
+type ApplicationManagementServiceServer struct {
+	iamv1pb.UnimplementedApplicationManagementServiceServer
+
+	iamServerCore *iamserver.Core
+}
+
+func NewApplicationManagementServiceServer(
+	iamServerCore *iamserver.Core,
+	grpcServer *grpc.Server,
+) *ApplicationManagementServiceServer {
+	appServer := &ApplicationManagementServiceServer{
+		iamServerCore: iamServerCore,
+	}
+	iamv1pb.RegisterApplicationManagementServiceServer(grpcServer, appServer)
+	return appServer
+}
+
+func (appServer *ApplicationManagementServiceServer) CreateApplication(
+	inputCtx context.Context,
+	reqProto *iamv1pb.CreateApplicationRequest,
+) (*iamv1pb.CreateApplicationResponse, error) {
+	reqCtx, err := appServer.iamServerCore.GRPCCallInputContext(inputCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+
+	outData, err := appServer.iamServerCore.
+		CreateApplication(reqCtx, iamserver.ApplicationCreationInputData{
+			Type:       reqProto.GetType(),
+			FirstParty: reqProto.GetFirstParty(),
+
+			ApplicationAttributesInputData: applicationAttributesInputDataFromProto(
+				reqProto.GetAttributes()),
+		})
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("CreateApplication")
+		return nil, applicationManagementError(err)
+	}
+
+	return &iamv1pb.CreateApplicationResponse{
+		ApplicationId: outData.ApplicationID.AZIDText(),
+		Secret:        outData.Secret,
+	}, nil
+}
+
+func (appServer *ApplicationManagementServiceServer) UpdateApplication(
+	inputCtx context.Context,
+	reqProto *iamv1pb.UpdateApplicationRequest,
+) (*emptypb.Empty, error) {
+	reqCtx, err := appServer.iamServerCore.GRPCCallInputContext(inputCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+
+	appID, err := iam.ApplicationIDFromAZIDText(reqProto.GetApplicationId())
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("application_id", reqProto.GetApplicationId()).
+			Msg("Malformed")
+		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
+	}
+
+	err = appServer.iamServerCore.
+		UpdateApplication(reqCtx, appID,
+			applicationAttributesInputDataFromProto(reqProto.GetAttributes()))
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("UpdateApplication")
+		return nil, applicationManagementError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (appServer *ApplicationManagementServiceServer) RotateApplicationSecret(
+	inputCtx context.Context,
+	reqProto *iamv1pb.RotateApplicationSecretRequest,
+) (*iamv1pb.RotateApplicationSecretResponse, error) {
+	reqCtx, err := appServer.iamServerCore.GRPCCallInputContext(inputCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+
+	appID, err := iam.ApplicationIDFromAZIDText(reqProto.GetApplicationId())
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("application_id", reqProto.GetApplicationId()).
+			Msg("Malformed")
+		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
+	}
+
+	secret, err := appServer.iamServerCore.
+		RotateApplicationSecret(reqCtx, appID,
+			time.Duration(reqProto.GetPreviousSecretsExpiresIn())*time.Second)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("RotateApplicationSecret")
+		return nil, applicationManagementError(err)
+	}
+
+	return &iamv1pb.RotateApplicationSecretResponse{
+		Secret: secret,
+	}, nil
+}
+
+func (appServer *ApplicationManagementServiceServer) DisableApplication(
+	inputCtx context.Context,
+	reqProto *iamv1pb.DisableApplicationRequest,
+) (*emptypb.Empty, error) {
+	reqCtx, err := appServer.iamServerCore.GRPCCallInputContext(inputCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+
+	appID, err := iam.ApplicationIDFromAZIDText(reqProto.GetApplicationId())
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("application_id", reqProto.GetApplicationId()).
+			Msg("Malformed")
+		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
+	}
+
+	stateChanged, err := appServer.iamServerCore.
+		DisableApplication(reqCtx, appID)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("DisableApplication")
+		return nil, applicationManagementError(err)
+	}
+	if !stateChanged {
+		return nil, grpcstatus.Error(grpccodes.NotFound, "")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func applicationManagementError(err error) error {
+	switch err {
+	case iam.ErrAuthorizationInvalid:
+		return grpcstatus.Error(grpccodes.Unauthenticated, "")
+	case iam.ErrScopeInsufficient, iam.ErrOperationNotAllowed:
+		return grpcstatus.Error(grpccodes.PermissionDenied, "")
+	case iam.ErrApplicationNotFound:
+		return grpcstatus.Error(grpccodes.NotFound, "")
+	}
+	return grpcerrs.Error(err)
+}
+
+func applicationAttributesInputDataFromProto(
+	attrs *iamv1pb.ApplicationAttributes,
+) iamserver.ApplicationAttributesInputData {
+	return iamserver.ApplicationAttributesInputData{
+		DisplayName:        attrs.GetDisplayName(),
+		PlatformType:       attrs.GetPlatformType(),
+		RequiredScopes:     attrs.GetRequiredScopes(),
+		OAuth2RedirectURI:  attrs.GetOauth2RedirectUri(),
+		OAuth2PKCERequired: attrs.GetOauth2PkceRequired(),
+	}
+}
@@ -67,6 +67,8 @@ func NewServer(
 	}
 
 	NewTerminalAuthorizationServiceServer(iamServerCore, srv.transportServer)
+	NewApplicationManagementServiceServer(iamServerCore, srv.transportServer)
+	NewUserTerminalServiceServer(iamServerCore, srv.transportServer)
 
 	return srv, nil
 }
@@ -2,17 +2,20 @@ package grpc
 
 import (
 	"context"
+	"strings"
 
 	"github.com/alloyzeus/go-azfl/errors"
 	iampb "github.com/alloyzeus/go-azgrpc/azgrpc/iam/v1"
 	pbtypes "github.com/gogo/protobuf/types"
 	"google.golang.org/grpc"
 	grpccodes "google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
 	grpcstatus "google.golang.org/grpc/status"
 
 	grpcerrs "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/grpc/errors"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
 )
 
@@ -84,7 +87,13 @@ func (authServer *TerminalAuthorizationServiceServer) InitiateUserTerminalAuthor
 				},
 			})
 	if err = authStartOutCtx.Err; err != nil {
-		switch err.(type) {
+		switch errDesc := err.(type) {
+		case *ratelimit.ExceededError:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msgf("StartTerminalAuthorizationByPhoneNumber %v",
+					phoneNumber)
+			return nil, rateLimitExceededError(inputCtx, errDesc)
 		case errors.CallError:
 			logCtx(reqCtx).
 				Warn().Err(err).
@@ -139,6 +148,18 @@ func (authServer *TerminalAuthorizationServiceServer) ConfirmTerminalAuthorizati
 		ConfirmTerminalAuthorization(
 			reqCtx, termID, reqProto.VerificationCode)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorization")
+			return nil, rateLimitExceededError(inputCtx, exceededErr)
+		}
+		if mfaErr, ok := err.(*iamserver.MFARequiredError); ok {
+			logCtx(reqCtx).
+				Info().Str("terminal", termID.AZIDText()).
+				Msg("Second factor required")
+			return nil, mfaRequiredError(inputCtx, mfaErr)
+		}
 		logCtx(reqCtx).
 			Warn().Err(err).
 			Msgf("Terminal authorization confirm failed: %v")
@@ -153,9 +174,14 @@ func (authServer *TerminalAuthorizationServiceServer) ConfirmTerminalAuthorizati
 func (authServer *TerminalAuthorizationServiceServer) GenerateAccessTokenByTerminalCredentials(
 	inputCtx context.Context, reqProto *iampb.GenerateAccessTokenByTerminalCredentialsRequest,
 ) (*iampb.GenerateAccessTokenByTerminalCredentialsResponse, error) {
+	// The client credentials, if any, are provided as a Basic
+	// authorization, which the call input context doesn't support.
 	reqCtx, err := authServer.iamServerCore.GRPCCallInputContext(inputCtx)
-	if err != nil {
-		panic(err) //TODO: translate and return the error
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
 	}
 	ctxAuth := reqCtx.Authorization()
 	if ctxAuth.IsStaticallyValid() {
@@ -172,41 +198,45 @@ func (authServer *TerminalAuthorizationServiceServer) GenerateAccessTokenByTermi
 		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
 	}
 
-	authOK, userID, err := authServer.iamServerCore.
-		AuthenticateTerminal(termID, reqProto.TerminalSecret)
+	// The request message has no field for the client credentials; they
+	// are taken from the metadata instead. The clients which are able to
+	// keep their secrets must authenticate themselves, as they do with
+	// the REST API. The terminals of the public clients are authenticated
+	// with the terminal credentials alone.
+	reqApp, err := authServer.requestApplication(inputCtx)
 	if err != nil {
 		logCtx(reqCtx).
-			Warn().Err(err).Str("terminal", termID.AZIDText()).
-			Msg("Terminal authentication")
-		return nil, grpcerrs.Error(err)
+			Warn().Err(err).
+			Msg("Client authentication")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
 	}
-	if !authOK {
+	if appIDNum := termID.Application().IDNum(); reqApp == nil &&
+		(appIDNum.IsService() || appIDNum.IsUserAgentAuthorizationConfidential()) {
 		logCtx(reqCtx).
-			Warn().Str("terminal", termID.AZIDText()).Msg("Terminal authentication")
-		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
+			Warn().Str("terminal", termID.AZIDText()).
+			Msg("Client authentication required")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
 	}
 
-	if userID.IsStaticallyValid() {
-		userInstInfo, err := authServer.iamServerCore.UserService.
-			GetUserInstanceInfo(reqCtx, userID)
-		if err != nil {
+	userID, err := authServer.iamServerCore.
+		AuthenticateTerminalByCredentials(reqCtx, reqApp, termID, reqProto.TerminalSecret)
+	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
 			logCtx(reqCtx).
 				Warn().Err(err).Str("terminal", termID.AZIDText()).
-				Msg("Terminal user account state")
-			return nil, grpcerrs.Error(err)
+				Msg("AuthenticateTerminalByCredentials")
+			return nil, rateLimitExceededError(inputCtx, exceededErr)
 		}
-		if userInstInfo == nil || !userInstInfo.IsActive() {
-			var status string
-			if userInstInfo == nil {
-				status = "not exist"
-			} else {
-				status = "deleted"
-			}
+		if err == iam.ErrTerminalCredentialsInvalid {
 			logCtx(reqCtx).
-				Warn().Str("terminal", termID.AZIDText()).Str("user", userID.AZIDText()).
-				Msg("Terminal user account " + status)
+				Warn().Err(err).Str("terminal", termID.AZIDText()).
+				Msg("AuthenticateTerminalByCredentials")
 			return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
 		}
+		logCtx(reqCtx).
+			Error().Err(err).Str("terminal", termID.AZIDText()).
+			Msg("AuthenticateTerminalByCredentials")
+		return nil, grpcerrs.Error(err)
 	}
 
 	tokenString, err := authServer.iamServerCore.
@@ -222,3 +252,47 @@ func (authServer *TerminalAuthorizationServiceServer) GenerateAccessTokenByTermi
 		},
 	}, nil
 }
+
+// requestApplication returns the application authenticated by the Basic
+// authorization in the call's metadata. It returns nil if the call has no
+// Basic authorization.
+func (authServer *TerminalAuthorizationServiceServer) requestApplication(
+	inputCtx context.Context,
+) (*iam.Application, error) {
+	md, ok := grpcmetadata.FromIncomingContext(inputCtx)
+	if !ok {
+		return nil, nil
+	}
+	authorizations := md.Get(iam.AuthorizationMetadataKey)
+	if len(authorizations) == 0 ||
+		!strings.HasPrefix(authorizations[0], "Basic ") {
+		return nil, nil
+	}
+	return authServer.iamServerCore.
+		ApplicationByBasicAuthorization(authorizations[0])
+}
+
+// rateLimitExceededError returns the status for the calls which have been
+// rejected by the rate limits. Like the REST endpoints, the wait time is
+// provided in the retry-after header.
+func rateLimitExceededError(
+	inputCtx context.Context,
+	exceededErr *ratelimit.ExceededError,
+) error {
+	_ = grpc.SetHeader(inputCtx, grpcmetadata.Pairs(
+		"retry-after", exceededErr.RetryAfterSeconds()))
+	return grpcstatus.Error(grpccodes.ResourceExhausted, "too many attempts")
+}
+
+// mfaRequiredError returns the status for the authorizations of which
+// the user has enabled a second factor. The MFA token is provided in
+// the mfa-token header; the authorization is completed through the OAuth
+// token endpoint.
+func mfaRequiredError(
+	inputCtx context.Context,
+	mfaErr *iamserver.MFARequiredError,
+) error {
+	_ = grpc.SetHeader(inputCtx, grpcmetadata.Pairs(
+		"mfa-token", mfaErr.MFAToken))
+	return grpcstatus.Error(grpccodes.FailedPrecondition, "mfa_required")
+}
@@ -0,0 +1,173 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	grpcerrs "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/grpc/errors"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	iamv1pb "github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/grpc/iamv1pb"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+// UserTerminalServiceServer provides the gRPC counterpart of the REST
+// API for the terminals of the current user. The service is defined in
+// iamv1pb's user_terminal.proto.
+type UserTerminalServiceServer struct {
+	iamv1pb.UnimplementedUserTerminalServiceServer
+
+	iamServerCore *iamserver.Core
+}
+
+func NewUserTerminalServiceServer(
+	iamServerCore *iamserver.Core,
+	grpcServer *grpc.Server,
+) *UserTerminalServiceServer {
+	termServer := &UserTerminalServiceServer{
+		iamServerCore: iamServerCore,
+	}
+	iamv1pb.RegisterUserTerminalServiceServer(grpcServer, termServer)
+	return termServer
+}
+
+func (termServer *UserTerminalServiceServer) ListUserTerminals(
+	inputCtx context.Context,
+	reqProto *emptypb.Empty,
+) (*iamv1pb.ListUserTerminalsResponse, error) {
+	reqCtx, err := termServer.userRequestContext(inputCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	terminals, err := termServer.iamServerCore.
+		ListUserTerminals(reqCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ListUserTerminals")
+		return nil, userTerminalError(err)
+	}
+
+	items := make([]*iamv1pb.UserTerminal, 0, len(terminals))
+	for _, termInfo := range terminals {
+		appID := termInfo.TerminalID.Application()
+		item := &iamv1pb.UserTerminal{
+			TerminalId:            termInfo.TerminalID.AZIDText(),
+			DisplayName:           termInfo.DisplayName,
+			ApplicationId:         appID.AZIDText(),
+			VerificationType:      termInfo.VerificationType,
+			AcceptLanguage:        termInfo.AcceptLanguage,
+			CreationTime:          timestamppb.New(termInfo.CreationTime),
+			CreationOriginAddress: termInfo.CreationOriginAddress,
+			CreationOriginEnv:     termInfo.CreationOriginEnv,
+			LastUseOriginAddress:  termInfo.LastUseOriginAddress,
+			LastUseOriginEnv:      termInfo.LastUseOriginEnv,
+			Current:               termInfo.Current,
+		}
+		if termInfo.LastUseTime != nil {
+			item.LastUseTime = timestamppb.New(*termInfo.LastUseTime)
+		}
+		app, err := termServer.iamServerCore.
+			ApplicationByID(appID)
+		if err != nil {
+			logCtx(reqCtx).
+				Error().Err(err).Str("client_id", appID.AZIDText()).
+				Msg("ApplicationByID")
+			return nil, grpcerrs.Error(err)
+		}
+		if app != nil {
+			item.ApplicationDisplayName = app.Attributes.DisplayName
+		}
+		items = append(items, item)
+	}
+
+	return &iamv1pb.ListUserTerminalsResponse{
+		Items: items,
+	}, nil
+}
+
+func (termServer *UserTerminalServiceServer) RevokeUserTerminal(
+	inputCtx context.Context,
+	reqProto *iamv1pb.RevokeUserTerminalRequest,
+) (*emptypb.Empty, error) {
+	reqCtx, err := termServer.userRequestContext(inputCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	termID, err := iam.TerminalIDFromAZIDText(reqProto.GetTerminalId())
+	if err != nil || termID.IsNotStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("terminal_id", reqProto.GetTerminalId()).
+			Msg("Malformed")
+		return nil, grpcstatus.Error(grpccodes.InvalidArgument, "")
+	}
+
+	stateChanged, err := termServer.iamServerCore.
+		DeleteTerminal(reqCtx, termID)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).Str("terminal_id", termID.AZIDText()).
+			Msg("DeleteTerminal")
+		return nil, userTerminalError(err)
+	}
+	if !stateChanged {
+		return nil, grpcstatus.Error(grpccodes.NotFound, "")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (termServer *UserTerminalServiceServer) RevokeUserOtherTerminals(
+	inputCtx context.Context,
+	reqProto *emptypb.Empty,
+) (*emptypb.Empty, error) {
+	reqCtx, err := termServer.userRequestContext(inputCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = termServer.iamServerCore.
+		RevokeUserOtherTerminals(reqCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("RevokeUserOtherTerminals")
+		return nil, userTerminalError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (termServer *UserTerminalServiceServer) userRequestContext(
+	inputCtx context.Context,
+) (*iam.GRPCCallInputContext, error) {
+	reqCtx, err := termServer.iamServerCore.GRPCCallInputContext(inputCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+	if !reqCtx.Authorization().IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("Unauthorized")
+		return nil, grpcstatus.Error(grpccodes.Unauthenticated, "")
+	}
+	return reqCtx, nil
+}
+
+func userTerminalError(err error) error {
+	switch err {
+	case iam.ErrUserContextRequired:
+		return grpcstatus.Error(grpccodes.Unauthenticated, "")
+	case iam.ErrOperationNotAllowed:
+		return grpcstatus.Error(grpccodes.PermissionDenied, "")
+	}
+	return grpcerrs.Error(err)
+}
@@ -0,0 +1,32 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- Refresh tokens are single-use. Each time a refresh token is exchanged,
+-- it's marked as rotated and a new one is issued. An attempt to use
+-- a rotated token is considered as a replay and will cause the whole
+-- terminal to be revoked.
+CREATE TABLE terminal_refresh_token_dt (
+    terminal_id  bigint NOT NULL,
+    token_id     text NOT NULL,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint,
+    md_c_uid  bigint,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint,
+
+    expiry       timestamp with time zone NOT NULL,
+    rotation_ts  timestamp with time zone,
+
+    PRIMARY KEY (terminal_id, token_id),
+    CHECK (terminal_id > 0)
+);
+
+----
+END;
@@ -0,0 +1,15 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The code challenge provided by the client when it requested
+-- an authorization code. RFC 7636.
+ALTER TABLE terminal_dt
+    ADD COLUMN oauth2_code_challenge         text NOT NULL DEFAULT '',
+    ADD COLUMN oauth2_code_challenge_method  text NOT NULL DEFAULT '';
+
+----
+END;
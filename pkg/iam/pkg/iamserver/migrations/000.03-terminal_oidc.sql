@@ -0,0 +1,16 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The scope and the OpenID Connect nonce provided by the client when
+-- it requested an authorization code. They are used when issuing
+-- the ID Token. OpenID Connect Core 1.0 § 3.1.2.1.
+ALTER TABLE terminal_dt
+    ADD COLUMN oauth2_scope  text NOT NULL DEFAULT '',
+    ADD COLUMN oidc_nonce    text NOT NULL DEFAULT '';
+
+----
+END;
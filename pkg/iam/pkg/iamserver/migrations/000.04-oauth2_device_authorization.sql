@@ -0,0 +1,47 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- Pending device authorization requests. RFC 8628.
+--
+-- A terminal is registered only after the end-user has approved the
+-- request. The device obtains the terminal's credentials by polling
+-- the token endpoint with the device code.
+CREATE TABLE oauth2_device_authorization_dt (
+    device_code     text PRIMARY KEY,
+    user_code       text NOT NULL,
+    application_id  integer NOT NULL,
+    scope           text NOT NULL DEFAULT '',
+
+    md_c_ts              timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_origin_address  text NOT NULL,
+    md_c_origin_env      text NOT NULL,
+
+    expiry         timestamp with time zone NOT NULL,
+    -- The minimum interval, in seconds, between polling requests. It's
+    -- increased each time the device polls too frequently.
+    poll_interval  integer NOT NULL,
+    poll_ts        timestamp with time zone,
+
+    -- The end-user's decision.
+    decision_ts   timestamp with time zone,
+    decision_uid  bigint,
+    decision_tid  bigint,
+    denied        boolean NOT NULL DEFAULT false,
+    -- The terminal registered for the device when the request was
+    -- approved.
+    terminal_id   bigint,
+    -- The time the device obtained the terminal's credentials.
+    claim_ts      timestamp with time zone,
+
+    CHECK (application_id > 0)
+);
+CREATE UNIQUE INDEX oauth2_device_authorization_dt_user_code_pidx
+    ON oauth2_device_authorization_dt (user_code)
+    WHERE decision_ts IS NULL;
+
+----
+END;
@@ -0,0 +1,31 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The applications a user has authorized through the authorization
+-- endpoint, along with the scopes granted to each. A new row replaces
+-- the active one each time the granted scopes change.
+CREATE TABLE user_oauth2_consent_dt (
+    user_id         bigint NOT NULL,
+    application_id  integer NOT NULL,
+    scope           text NOT NULL DEFAULT '',
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint NOT NULL,
+    md_c_uid  bigint NOT NULL,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint,
+
+    CHECK (application_id > 0)
+);
+CREATE UNIQUE INDEX user_oauth2_consent_dt_pidx
+    ON user_oauth2_consent_dt (user_id, application_id)
+    WHERE md_d_ts IS NULL;
+
+----
+END;
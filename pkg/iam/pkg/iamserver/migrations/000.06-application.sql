@@ -0,0 +1,38 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The registered applications (OAuth 2.0 clients). This table
+-- supersedes the clients.csv file.
+CREATE TABLE application_dt (
+    id_num  integer,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint,
+    md_c_uid  bigint,
+
+    md_u_ts   timestamp with time zone,
+    md_u_tid  bigint,
+    md_u_uid  bigint,
+
+    -- An application is disabled by deleting it.
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint,
+
+    display_name          text NOT NULL DEFAULT '',
+    secret                text NOT NULL DEFAULT '',
+    platform_type         text NOT NULL DEFAULT '',
+    required_scopes       text[] NOT NULL DEFAULT '{}',
+    oauth2_redirect_uri   text[] NOT NULL DEFAULT '{}',
+    oauth2_pkce_required  boolean NOT NULL DEFAULT false,
+
+    CONSTRAINT application_dt_pkey PRIMARY KEY (id_num),
+    CHECK (id_num > 0)
+);
+
+----
+END;
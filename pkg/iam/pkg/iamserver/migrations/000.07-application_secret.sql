@@ -0,0 +1,38 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The secrets of the applications. Only the argon2id hashes of
+-- the secrets are stored. An application could have more than one
+-- active secret so that its secret could be rotated without downtime.
+CREATE TABLE application_secret_dt (
+    application_id  integer NOT NULL,
+    secret_hash     text NOT NULL,
+    -- The secret is no longer accepted after this time. NULL means
+    -- the secret does not expire.
+    expiry_ts       timestamp with time zone,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint,
+    md_c_uid  bigint,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint,
+
+    CHECK (application_id > 0)
+);
+CREATE INDEX application_secret_dt_application_id_idx
+    ON application_secret_dt (application_id)
+    WHERE md_d_ts IS NULL;
+
+-- The plain-text secrets are no longer used. The server hashes them
+-- into application_secret_dt on start up and then clears them; the column
+-- will be dropped once all the deployments have done so.
+ALTER TABLE application_dt RENAME COLUMN secret TO secret_plaintext;
+
+----
+END;
@@ -0,0 +1,26 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The counters of the rate limits. Each row is the count of events
+-- within a fixed window for a key. The keys are hashed so that
+-- the identifiers, e.g., email addresses and IP addresses, are not
+-- stored in the clear.
+CREATE TABLE rate_limit_counter_dt (
+    counter_key      text NOT NULL,
+    window_start_ts  timestamp with time zone NOT NULL,
+    count            bigint NOT NULL DEFAULT 0,
+    -- The counter is no longer used after this time and it could
+    -- be deleted.
+    expiry_ts        timestamp with time zone NOT NULL,
+
+    PRIMARY KEY (counter_key, window_start_ts)
+);
+CREATE INDEX rate_limit_counter_dt_expiry_ts_idx
+    ON rate_limit_counter_dt (expiry_ts);
+
+----
+END;
@@ -0,0 +1,70 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The TOTP (RFC 6238) secrets of the users. The secrets are encrypted
+-- with the key in the totp_encryption.key secret. A secret is pending
+-- until the user has confirmed it with a code; only one secret of
+-- a user, pending or enabled, is active at a time.
+CREATE TABLE user_totp_dt (
+    user_id           bigint NOT NULL,
+    secret_encrypted  bytea NOT NULL,
+    -- When the user confirmed the secret. The second factor is
+    -- required only after it has been confirmed.
+    enabled_ts        timestamp with time zone,
+    -- The time step of the last accepted code. A code is accepted
+    -- only once.
+    last_time_step    bigint NOT NULL DEFAULT 0,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint NOT NULL,
+    md_c_uid  bigint NOT NULL,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint
+);
+CREATE UNIQUE INDEX user_totp_dt_user_id_uidx ON user_totp_dt (user_id)
+    WHERE md_d_ts IS NULL;
+
+-- The one-time recovery codes which could be used in place of a TOTP
+-- code, e.g., when the user has lost the authenticator. Only the SHA-256
+-- hashes of the codes are stored.
+CREATE TABLE user_mfa_recovery_code_dt (
+    user_id    bigint NOT NULL,
+    code_hash  text NOT NULL,
+    used_ts    timestamp with time zone,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint NOT NULL,
+    md_c_uid  bigint NOT NULL,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint
+);
+CREATE INDEX user_mfa_recovery_code_dt_user_id_idx
+    ON user_mfa_recovery_code_dt (user_id)
+    WHERE md_d_ts IS NULL;
+
+-- The pending second-factor challenges. The terminal has been
+-- authorized with the first factor, e.g., a password, but it won't be
+-- verified until the challenge has been completed. Only the SHA-256
+-- hashes of the tokens are stored.
+CREATE TABLE terminal_mfa_challenge_dt (
+    terminal_id  bigint PRIMARY KEY,
+    user_id      bigint NOT NULL,
+    token_hash   text NOT NULL,
+    expiry_ts    timestamp with time zone NOT NULL,
+    claimed_ts   timestamp with time zone,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX terminal_mfa_challenge_dt_token_hash_uidx
+    ON terminal_mfa_challenge_dt (token_hash);
+
+----
+END;
@@ -0,0 +1,68 @@
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The WebAuthn credentials, i.e., passkeys, of the users. The terminals
+-- authorized with a credential refer to it by their verification_id
+-- where verification_type is webauthn.
+CREATE TABLE user_webauthn_credential_dt (
+    id_num              bigserial PRIMARY KEY,
+    user_id             bigint NOT NULL,
+    -- As generated by the authenticator. Up to 1023 bytes.
+    credential_id       bytea NOT NULL,
+    -- The COSE_Key of the credential
+    public_key          bytea NOT NULL,
+    algorithm           integer NOT NULL,
+    -- The signature counter of the last assertion; a counter which
+    -- doesn't increase is a signal of a cloned authenticator.
+    sign_count          bigint NOT NULL DEFAULT 0,
+    aaguid              bytea NOT NULL,
+    transports          text NOT NULL DEFAULT '',
+    attestation_format  text NOT NULL DEFAULT '',
+    backup_eligible     boolean NOT NULL DEFAULT false,
+    backup_state        boolean NOT NULL DEFAULT false,
+    display_name        text NOT NULL DEFAULT '',
+    last_use_ts         timestamp with time zone,
+    -- The terminal which was authorized with the last assertion
+    last_use_tid        bigint,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint NOT NULL,
+    md_c_uid  bigint NOT NULL,
+
+    md_u_ts   timestamp with time zone,
+    md_u_tid  bigint,
+    md_u_uid  bigint,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint
+);
+CREATE UNIQUE INDEX user_webauthn_credential_dt_credential_id_uidx
+    ON user_webauthn_credential_dt (credential_id)
+    WHERE md_d_ts IS NULL;
+CREATE INDEX user_webauthn_credential_dt_user_id_idx
+    ON user_webauthn_credential_dt (user_id)
+    WHERE md_d_ts IS NULL;
+
+-- The challenges of the pending ceremonies. A registration ceremony is
+-- for a user; an authentication ceremony is for an application as
+-- the user is not known until the assertion has been provided. Only
+-- the SHA-256 hashes of the challenges are stored.
+CREATE TABLE webauthn_challenge_dt (
+    challenge_hash  text PRIMARY KEY,
+    ceremony        text NOT NULL,
+    user_id         bigint NOT NULL DEFAULT 0,
+    application_id  bigint NOT NULL DEFAULT 0,
+    expiry_ts       timestamp with time zone NOT NULL,
+    claimed_ts      timestamp with time zone,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX webauthn_challenge_dt_expiry_ts_idx
+    ON webauthn_challenge_dt (expiry_ts);
+
+----
+END;
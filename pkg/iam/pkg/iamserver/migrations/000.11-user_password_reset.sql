@@ -0,0 +1,41 @@
+--
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The codes sent for a purpose are never reused for another purpose.
+-- The empty purpose is for the ownership verifications.
+ALTER TABLE email_address_verification_dt
+    ADD COLUMN purpose text NOT NULL DEFAULT '';
+ALTER TABLE phone_number_verification_dt
+    ADD COLUMN purpose text NOT NULL DEFAULT '';
+
+-- The password resets. The reset token is given to the requester while
+-- the code is sent to the user's email address or phone number. A reset
+-- is also created for the identifiers which don't belong to any user,
+-- with user_id 0, so that the responses don't reveal whether
+-- an identifier is registered. Only the SHA-256 hashes of the tokens
+-- are stored.
+CREATE TABLE user_password_reset_dt (
+    token_hash          text PRIMARY KEY,
+    user_id             bigint NOT NULL DEFAULT 0,
+    -- email-address or phone-number
+    verification_type   text NOT NULL DEFAULT '',
+    verification_id     bigint NOT NULL DEFAULT 0,
+    expiry_ts           timestamp with time zone NOT NULL,
+    -- Counted here rather than by the verifications so that the resets
+    -- of the unregistered identifiers behave the same
+    confirmation_attempts_remaining  smallint NOT NULL DEFAULT 0,
+    claimed_ts          timestamp with time zone,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint,
+    md_c_uid  bigint
+);
+CREATE INDEX user_password_reset_dt_expiry_ts_idx
+    ON user_password_reset_dt (expiry_ts);
+
+----
+END;
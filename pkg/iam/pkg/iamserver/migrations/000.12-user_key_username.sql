@@ -0,0 +1,34 @@
+
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The usernames of the users. Unlike the email addresses and the phone
+-- numbers, the usernames don't need verification.
+CREATE TABLE user_key_username_dt (
+    user_id    bigint NOT NULL,
+    -- The normalized form which is used for look ups, e.g., case-folded
+    username   text NOT NULL,
+    -- As provided by the user; this is the one displayed
+    raw_input  text NOT NULL,
+
+    md_c_ts   timestamp with time zone NOT NULL DEFAULT now(),
+    md_c_tid  bigint NOT NULL,
+    md_c_uid  bigint NOT NULL,
+
+    md_d_ts   timestamp with time zone,
+    md_d_tid  bigint,
+    md_d_uid  bigint
+);
+-- Each user has only one non-deleted username
+CREATE UNIQUE INDEX user_key_username_dt_user_id_uidx
+    ON user_key_username_dt (user_id)
+    WHERE md_d_ts IS NULL;
+-- One instance for a non-deleted username
+CREATE UNIQUE INDEX user_key_username_dt_username_uidx
+    ON user_key_username_dt (username)
+    WHERE md_d_ts IS NULL;
+
+----
+END;
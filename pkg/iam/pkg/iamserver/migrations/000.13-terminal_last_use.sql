@@ -0,0 +1,27 @@
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The last time an access token was issued for the terminal, and
+-- the origin of the request. These are updated asynchronously so
+-- the values could lag behind by a few seconds.
+ALTER TABLE terminal_dt
+    ADD COLUMN last_use_ts              timestamp with time zone,
+    ADD COLUMN last_use_origin_address  text,
+    ADD COLUMN last_use_origin_env      text;
+
+UPDATE terminal_dt AS t
+    SET last_use_ts = (
+        SELECT max(s.md_c_ts) FROM session_dt AS s
+        WHERE s.terminal_id = t.id_num
+    )
+    WHERE t.md_d_ts IS NULL;
+
+-- For looking up the idle terminals
+CREATE INDEX terminal_dt_last_use_ts_idx
+    ON terminal_dt (coalesce(last_use_ts, md_c_ts))
+    WHERE md_d_ts IS NULL AND user_id <> 0;
+
+----
+END;
@@ -0,0 +1,14 @@
+\set ON_ERROR_STOP true
+
+BEGIN;
+------
+
+-- The origin of the request which the session was issued for. The
+-- sessions are issued when the terminal is used, thus these are
+-- the per-session counterparts of terminal_dt's last_use_* columns.
+ALTER TABLE session_dt
+    ADD COLUMN md_c_origin_address  text,
+    ADD COLUMN md_c_origin_env      text;
+
+----
+END;
@@ -0,0 +1,192 @@
+package iamserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// BreachedPasswordCorpus looks up passwords in a collection of passwords
+// which have been exposed in data breaches.
+type BreachedPasswordCorpus interface {
+	ContainsPassword(password string) (bool, error)
+}
+
+// NewBreachedPasswordCorpus opens a local copy of Have I Been Pwned's
+// Pwned Passwords SHA-1 hashes. The path is either:
+//
+//   - a directory of range files, as served by the k-anonymity range API
+//     and as downloaded by the official downloader, where each file is
+//     named by the 5-character hash prefix, e.g., 21BD1.txt, and contains
+//     lines of SUFFIX:COUNT; or
+//   - a single file of HASH:COUNT lines sorted by the hash.
+//
+// Lines with a zero count, which are used to pad the range responses,
+// are ignored.
+func NewBreachedPasswordCorpus(path string) (BreachedPasswordCorpus, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fileInfo.IsDir() {
+		return &pwnedPasswordsRangeDir{dirName: path}, nil
+	}
+	return &pwnedPasswordsSortedFile{fileName: path}, nil
+}
+
+const (
+	pwnedPasswordsPrefixLength = 5
+	// The longest line we expect, with plenty of room for the count.
+	pwnedPasswordsLineMaxLength = 128
+)
+
+func pwnedPasswordsHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// pwnedPasswordsLineMatch compares the hash in the line with the hash.
+// The line might contain only the suffix of the hash, as in the range
+// files.
+func pwnedPasswordsLineMatch(line []byte, hash string) (cmp int, breached bool) {
+	lineHash, countStr, _ := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	cmp = strings.Compare(strings.ToUpper(string(lineHash)), hash)
+	if cmp != 0 {
+		return cmp, false
+	}
+	return 0, len(countStr) > 0 && string(bytes.TrimLeft(countStr, "0")) != ""
+}
+
+type pwnedPasswordsRangeDir struct {
+	dirName string
+}
+
+func (corpus *pwnedPasswordsRangeDir) ContainsPassword(password string) (bool, error) {
+	hash := pwnedPasswordsHash(password)
+	prefix, suffix := hash[:pwnedPasswordsPrefixLength], hash[pwnedPasswordsPrefixLength:]
+
+	rangeFile, err := os.Open(filepath.Join(corpus.dirName, prefix+".txt"))
+	if os.IsNotExist(err) {
+		rangeFile, err = os.Open(filepath.Join(corpus.dirName, prefix))
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer rangeFile.Close()
+
+	// The range files are small, and they might not be sorted.
+	scanner := bufio.NewScanner(rangeFile)
+	for scanner.Scan() {
+		if cmp, breached := pwnedPasswordsLineMatch(scanner.Bytes(), suffix); cmp == 0 {
+			return breached, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+type pwnedPasswordsSortedFile struct {
+	fileName string
+}
+
+func (corpus *pwnedPasswordsSortedFile) ContainsPassword(password string) (bool, error) {
+	hash := pwnedPasswordsHash(password)
+
+	corpusFile, err := os.Open(corpus.fileName)
+	if err != nil {
+		return false, err
+	}
+	defer corpusFile.Close()
+	fileInfo, err := corpusFile.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Binary search for the region of the file which would contain
+	// the line of the hash. The line, if any, starts within [lo, hi].
+	lo, hi := int64(0), fileInfo.Size()
+	for hi-lo > 4*pwnedPasswordsLineMaxLength {
+		mid := lo + (hi-lo)/2
+		lineStart, line, err := readLineAtOrAfter(corpusFile, mid)
+		if err != nil {
+			return false, err
+		}
+		if lineStart >= hi || line == nil {
+			return false, errors.Msg("breached-password corpus format invalid")
+		}
+		if cmp, _ := pwnedPasswordsLineMatch(line, hash); cmp < 0 {
+			lo = lineStart + int64(len(line))
+		} else {
+			hi = lineStart
+		}
+	}
+
+	lineStart, _, err := readLineAtOrAfter(corpusFile, lo)
+	if err != nil {
+		return false, err
+	}
+	reader := bufio.NewReader(io.NewSectionReader(corpusFile, lineStart,
+		fileInfo.Size()-lineStart))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			cmp, breached := pwnedPasswordsLineMatch(line, hash)
+			if cmp == 0 {
+				return breached, nil
+			}
+			if cmp > 0 {
+				return false, nil
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+}
+
+// readLineAtOrAfter reads the first line which starts at or after
+// the offset. The returned line includes its line break. The line is
+// nil if there's no such line.
+func readLineAtOrAfter(
+	file io.ReaderAt, offset int64,
+) (lineStart int64, line []byte, err error) {
+	buf := make([]byte, 2*pwnedPasswordsLineMaxLength)
+	lineStart = offset
+	if offset > 0 {
+		// Find the end of the line which contains the byte before
+		// the offset.
+		n, err := file.ReadAt(buf, offset-1)
+		if err != nil && err != io.EOF {
+			return 0, nil, err
+		}
+		idx := bytes.IndexByte(buf[:n], '\n')
+		if idx < 0 {
+			return offset - 1 + int64(n), nil, nil
+		}
+		lineStart = offset + int64(idx)
+	}
+
+	n, err := file.ReadAt(buf, lineStart)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if n == 0 {
+		return lineStart, nil, nil
+	}
+	if idx := bytes.IndexByte(buf[:n], '\n'); idx >= 0 {
+		n = idx + 1
+	}
+	return lineStart, buf[:n], nil
+}
@@ -0,0 +1,103 @@
+package iamserver
+
+import (
+	"runtime"
+)
+
+// PasswordHashingConfig holds the argon2id parameters used to hash
+// the passwords and the application secrets. The hashes stored with
+// weaker parameters are re-hashed when the users sign in.
+type PasswordHashingConfig struct {
+	// Memory is in KiB
+	Memory      uint32 `env:"MEMORY"`
+	Iterations  uint32 `env:"ITERATIONS"`
+	Parallelism uint8  `env:"PARALLELISM"`
+
+	// MaxConcurrency limits the number of hashes computed at the same time
+	// so that the memory used for hashing is bounded to
+	// Memory * MaxConcurrency.
+	MaxConcurrency int `env:"MAX_CONCURRENCY"`
+}
+
+func (PasswordHashingConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"Memory":      "The memory used by argon2id, in KiB. Defaults to 65536 (64 MiB)",
+		"Iterations":  "The number of argon2id iterations. Defaults to 3",
+		"Parallelism": "The number of argon2id threads. Defaults to 2",
+		"MaxConcurrency": "The maximum number of hashes computed at the same " +
+			"time. Defaults to the number of CPUs",
+	}
+}
+
+// passwordHasher computes and matches the argon2id hashes in a bounded
+// pool so that a burst of requests can't exhaust the memory.
+type passwordHasher struct {
+	params argon2PasswordHashingParams
+	slots  chan struct{}
+}
+
+func newPasswordHasher(cfg PasswordHashingConfig) *passwordHasher {
+	params := argon2PasswordHashingParamsDefault
+	if cfg.Memory > 0 {
+		params.Memory = cfg.Memory
+	}
+	if cfg.Iterations > 0 {
+		params.Iterations = cfg.Iterations
+	}
+	if cfg.Parallelism > 0 {
+		params.Parallelism = cfg.Parallelism
+	}
+	maxConcurrency := cfg.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = runtime.NumCPU()
+	}
+	return &passwordHasher{
+		params: params,
+		slots:  make(chan struct{}, maxConcurrency),
+	}
+}
+
+func (hasher *passwordHasher) acquire() { hasher.slots <- struct{}{} }
+func (hasher *passwordHasher) release() { <-hasher.slots }
+
+// hash returns the encoded hash of the password, hashed with
+// the configured parameters.
+func (hasher *passwordHasher) hash(password string) (string, error) {
+	hasher.acquire()
+	defer hasher.release()
+	return hashPasswordArgon2id(password, hasher.params)
+}
+
+// match checks the password against the encoded hash. If they match,
+// needsRehash tells whether the hash was computed with parameters
+// weaker than the configured ones.
+func (hasher *passwordHasher) match(
+	password, encodedPasswordHash string,
+) (match bool, needsRehash bool, err error) {
+	if encodedPasswordHash == "" {
+		return false, false, nil
+	}
+	params, _, _, err := decodePasswordHash(encodedPasswordHash)
+	if err != nil {
+		return false, false, err
+	}
+
+	hasher.acquire()
+	match, err = matchPasswordArgon2id(password, encodedPasswordHash)
+	hasher.release()
+	if err != nil || !match {
+		return false, false, err
+	}
+
+	return true, params.isWeakerThan(hasher.params), nil
+}
+
+func (params argon2PasswordHashingParams) isWeakerThan(
+	other argon2PasswordHashingParams,
+) bool {
+	return params.Memory < other.Memory ||
+		params.Iterations < other.Iterations ||
+		params.Parallelism < other.Parallelism ||
+		params.SaltLength < other.SaltLength ||
+		params.KeyLength < other.KeyLength
+}
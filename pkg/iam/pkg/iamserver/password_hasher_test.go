@@ -0,0 +1,63 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHasherRehash(t *testing.T) {
+	weakHasher := &passwordHasher{
+		params: argon2PasswordHashingParamsTest,
+		slots:  make(chan struct{}, 1),
+	}
+	strongParams := argon2PasswordHashingParamsTest
+	strongParams.Iterations++
+	strongHasher := &passwordHasher{
+		params: strongParams,
+		slots:  make(chan struct{}, 1),
+	}
+
+	weakHash, err := weakHasher.hash("password")
+	assert.Nil(t, err)
+
+	match, needsRehash, err := weakHasher.match("password", weakHash)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	assert.False(t, needsRehash)
+
+	match, needsRehash, err = strongHasher.match("password", weakHash)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	assert.True(t, needsRehash)
+
+	// Re-hashing is only for the right passwords
+	match, needsRehash, err = strongHasher.match("other", weakHash)
+	assert.Nil(t, err)
+	assert.False(t, match)
+	assert.False(t, needsRehash)
+
+	strongHash, err := strongHasher.hash("password")
+	assert.Nil(t, err)
+	match, needsRehash, err = strongHasher.match("password", strongHash)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	assert.False(t, needsRehash)
+
+	// Stronger hashes are kept
+	match, needsRehash, err = weakHasher.match("password", strongHash)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	assert.False(t, needsRehash)
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	hasher := newPasswordHasher(PasswordHashingConfig{
+		Memory:         32 * 1024,
+		MaxConcurrency: 3,
+	})
+	assert.Equal(t, uint32(32*1024), hasher.params.Memory)
+	assert.Equal(t, argon2PasswordHashingParamsDefault.Iterations, hasher.params.Iterations)
+	assert.Equal(t, argon2PasswordHashingParamsDefault.Parallelism, hasher.params.Parallelism)
+	assert.Equal(t, 3, cap(hasher.slots))
+}
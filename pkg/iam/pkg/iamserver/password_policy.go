@@ -0,0 +1,202 @@
+package iamserver
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// PasswordPolicyConfig holds the rules a new password must satisfy.
+type PasswordPolicyConfig struct {
+	MinLength int `env:"MIN_LENGTH"`
+	MaxLength int `env:"MAX_LENGTH"`
+
+	// MinCharacterClasses is the number of character classes, out of
+	// lowercase letters, uppercase letters, digits and symbols,
+	// a password must contain.
+	MinCharacterClasses int `env:"MIN_CHARACTER_CLASSES"`
+
+	// BreachedPasswordsPath is the breached-password corpus in the format
+	// of Have I Been Pwned's Pwned Passwords SHA-1 hashes. See
+	// NewBreachedPasswordCorpus.
+	BreachedPasswordsPath string `env:"BREACHED_PASSWORDS_PATH"`
+}
+
+func (PasswordPolicyConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"MinLength": "The minimum number of characters of a password. Defaults to 8",
+		"MaxLength": "The maximum number of characters of a password. Defaults to 256",
+		"MinCharacterClasses": "The number of character classes, out of lowercase " +
+			"letters, uppercase letters, digits and symbols, a password must contain",
+		"BreachedPasswordsPath": "The breached-password corpus, in the Pwned Passwords " +
+			"SHA-1 format, to reject the passwords found in it. It's either " +
+			"a file sorted by hash, or a directory of range files named by " +
+			"the 5-character hash prefixes",
+	}
+}
+
+const (
+	passwordMinLengthDefault = 8
+	passwordMaxLengthDefault = 256
+
+	// User identifiers shorter than this are not checked against
+	// the passwords as they would reject too many passwords.
+	passwordUserIdentifierMinLength = 4
+)
+
+// The codes of the password policy violations.
+const (
+	PasswordPolicyViolationTooShort               = "too_short"
+	PasswordPolicyViolationTooLong                = "too_long"
+	PasswordPolicyViolationCharacterClasses       = "insufficient_character_classes"
+	PasswordPolicyViolationContainsUserIdentifier = "contains_user_identifier"
+	PasswordPolicyViolationBreached               = "breached"
+)
+
+type PasswordPolicyViolation struct {
+	Code        string
+	Description string
+}
+
+// PasswordPolicyError is returned when a password doesn't satisfy
+// the password policy.
+type PasswordPolicyError struct {
+	Violations []PasswordPolicyViolation
+}
+
+var _ error = &PasswordPolicyError{}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		codes = append(codes, v.Code)
+	}
+	return "password policy violation: " + strings.Join(codes, ", ")
+}
+
+type passwordPolicy struct {
+	minLength           int
+	maxLength           int
+	minCharacterClasses int
+	breachedPasswords   BreachedPasswordCorpus
+}
+
+func newPasswordPolicy(cfg PasswordPolicyConfig) (*passwordPolicy, error) {
+	policy := &passwordPolicy{
+		minLength:           cfg.MinLength,
+		maxLength:           cfg.MaxLength,
+		minCharacterClasses: cfg.MinCharacterClasses,
+	}
+	// An empty password is never allowed
+	if policy.minLength <= 0 {
+		policy.minLength = passwordMinLengthDefault
+	}
+	if policy.maxLength <= 0 {
+		policy.maxLength = passwordMaxLengthDefault
+	}
+	if policy.maxLength < policy.minLength {
+		return nil, errors.ArgMsg("cfg.MaxLength", "less than MinLength")
+	}
+	if policy.minCharacterClasses > 4 {
+		return nil, errors.ArgMsg("cfg.MinCharacterClasses", "more than 4")
+	}
+	if cfg.BreachedPasswordsPath != "" {
+		corpus, err := NewBreachedPasswordCorpus(cfg.BreachedPasswordsPath)
+		if err != nil {
+			return nil, errors.Arg("cfg.BreachedPasswordsPath", err)
+		}
+		policy.breachedPasswords = corpus
+	}
+	return policy, nil
+}
+
+// check returns a *PasswordPolicyError if the password violates
+// the policy. The userIdentifiers are the values which identify the user,
+// e.g., the email address, which must not be part of the password.
+func (policy *passwordPolicy) check(
+	password string,
+	userIdentifiers []string,
+) error {
+	var violations []PasswordPolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.minLength {
+		violations = append(violations, PasswordPolicyViolation{
+			Code: PasswordPolicyViolationTooShort,
+			Description: "The password must contain at least " +
+				strconv.Itoa(policy.minLength) + " characters",
+		})
+	}
+	if length > policy.maxLength {
+		// The other rules are not checked for overly long passwords
+		return &PasswordPolicyError{Violations: append(violations, PasswordPolicyViolation{
+			Code: PasswordPolicyViolationTooLong,
+			Description: "The password must not contain more than " +
+				strconv.Itoa(policy.maxLength) + " characters",
+		})}
+	}
+
+	if policy.minCharacterClasses > 0 &&
+		passwordCharacterClassCount(password) < policy.minCharacterClasses {
+		violations = append(violations, PasswordPolicyViolation{
+			Code: PasswordPolicyViolationCharacterClasses,
+			Description: "The password must contain characters from at least " +
+				strconv.Itoa(policy.minCharacterClasses) + " of these: " +
+				"lowercase letters, uppercase letters, digits and symbols",
+		})
+	}
+
+	lowerPassword := strings.ToLower(password)
+	for _, identifier := range userIdentifiers {
+		identifier = strings.ToLower(strings.TrimSpace(identifier))
+		if utf8.RuneCountInString(identifier) < passwordUserIdentifierMinLength {
+			continue
+		}
+		if strings.Contains(lowerPassword, identifier) {
+			violations = append(violations, PasswordPolicyViolation{
+				Code:        PasswordPolicyViolationContainsUserIdentifier,
+				Description: "The password must not contain the user's identifiers",
+			})
+			break
+		}
+	}
+
+	if policy.breachedPasswords != nil && password != "" {
+		breached, err := policy.breachedPasswords.ContainsPassword(password)
+		if err != nil {
+			return errors.Wrap("breached password look up", err)
+		}
+		if breached {
+			violations = append(violations, PasswordPolicyViolation{
+				Code: PasswordPolicyViolationBreached,
+				Description: "The password has appeared in a data breach " +
+					"and must not be used",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func passwordCharacterClassCount(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
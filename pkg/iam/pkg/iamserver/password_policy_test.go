@@ -0,0 +1,113 @@
+package iamserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func passwordPolicyViolationCodes(err error) []string {
+	policyErr, ok := err.(*PasswordPolicyError)
+	if !ok {
+		return nil
+	}
+	var codes []string
+	for _, v := range policyErr.Violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := newPasswordPolicy(PasswordPolicyConfig{MinCharacterClasses: 3})
+	assert.Nil(t, err)
+
+	assert.Nil(t, policy.check("correct Horse 9", nil))
+	assert.Equal(t,
+		[]string{PasswordPolicyViolationTooShort, PasswordPolicyViolationCharacterClasses},
+		passwordPolicyViolationCodes(policy.check("", nil)))
+	assert.Equal(t,
+		[]string{PasswordPolicyViolationCharacterClasses},
+		passwordPolicyViolationCodes(policy.check("correcthorse", nil)))
+	assert.Equal(t,
+		[]string{PasswordPolicyViolationTooLong},
+		passwordPolicyViolationCodes(policy.check(strings.Repeat("aB1", 100), nil)))
+	assert.Equal(t,
+		[]string{PasswordPolicyViolationContainsUserIdentifier},
+		passwordPolicyViolationCodes(policy.check("My name is Alice!",
+			[]string{"alice@example.com", "alice", "Bo"})))
+	assert.Nil(t, policy.check("Bo bo bo 12345", []string{"Bo"}))
+
+	_, err = newPasswordPolicy(PasswordPolicyConfig{MinLength: 10, MaxLength: 9})
+	assert.NotNil(t, err)
+}
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	breachedPasswords := []string{"password", "123456", "qwerty"}
+	var lines []string
+	for _, password := range breachedPasswords {
+		lines = append(lines, pwnedPasswordsHash(password)+":42")
+	}
+	// Padding entries don't count
+	lines = append(lines, pwnedPasswordsHash("padding")+":0")
+	// Enough entries to exercise the binary search
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, pwnedPasswordsHash(fmt.Sprintf("breached-%d", i))+":1")
+	}
+	sort.Strings(lines)
+
+	dirName := t.TempDir()
+	sortedFileName := filepath.Join(dirName, "pwned-passwords-sha1.txt")
+	err := os.WriteFile(sortedFileName, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rangeDirName := filepath.Join(dirName, "ranges")
+	if err = os.Mkdir(rangeDirName, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		f, err := os.OpenFile(filepath.Join(rangeDirName, line[:5]+".txt"),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(f, "%s\r\n", line[5:])
+		f.Close()
+	}
+
+	for _, path := range []string{sortedFileName, rangeDirName} {
+		corpus, err := NewBreachedPasswordCorpus(path)
+		assert.Nil(t, err)
+		for _, password := range breachedPasswords {
+			breached, err := corpus.ContainsPassword(password)
+			assert.Nil(t, err)
+			assert.True(t, breached, password)
+		}
+		for i := 0; i < 1000; i += 97 {
+			breached, err := corpus.ContainsPassword(fmt.Sprintf("breached-%d", i))
+			assert.Nil(t, err)
+			assert.True(t, breached)
+		}
+		for _, password := range []string{"padding", "correct Horse 9", ""} {
+			breached, err := corpus.ContainsPassword(password)
+			assert.Nil(t, err)
+			assert.False(t, breached, password)
+		}
+	}
+
+	policy, err := newPasswordPolicy(PasswordPolicyConfig{
+		BreachedPasswordsPath: sortedFileName,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t,
+		[]string{PasswordPolicyViolationBreached},
+		passwordPolicyViolationCodes(policy.check("password", nil)))
+	assert.Nil(t, policy.check("correct Horse 9", nil))
+}
@@ -33,11 +33,24 @@ func VerificationMethodFromString(str string) VerificationMethod {
 	return VerificationMethodUnknown
 }
 
+// VerificationPurpose determines the message sent with the code. The
+// verifications of a purpose are never reused for another purpose.
+type VerificationPurpose string
+
+const (
+	// VerificationPurposeDefault is for the verification of the ownership
+	// of the identifiers, e.g., for account activation.
+	VerificationPurposeDefault VerificationPurpose = ""
+
+	VerificationPurposePasswordReset VerificationPurpose = "password_reset"
+)
+
 //TODO: make this private
 type verificationDBModel struct {
 	IDNum                         int64              `db:"id_num"`
 	CountryCode                   int32              `db:"country_code"`
 	NationalNumber                int64              `db:"national_number"`
+	Purpose                       string             `db:"purpose"`
 	Code                          string             `db:"code"`
 	CodeExpiry                    *time.Time         `db:"code_expiry"`
 	CreationTime                  time.Time          `db:"md_c_ts"`
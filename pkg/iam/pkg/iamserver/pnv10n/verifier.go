@@ -118,13 +118,37 @@ type Verifier struct {
 	smsDeliveryServicesByCountry map[int32]SMSDeliveryService
 }
 
-//TODO(exa): make the operations atomic
 func (verifier *Verifier) StartVerification(
 	inputCtx iam.CallInputContext,
 	phoneNumber telephony.PhoneNumber,
 	codeTTL time.Duration,
 	userPreferredLanguages []language.Tag,
 	preferredVerificationMethods []VerificationMethod,
+) (idNum int64, codeExpiry *time.Time, err error) {
+	return verifier.startVerification(inputCtx, VerificationPurposeDefault,
+		phoneNumber, codeTTL, userPreferredLanguages, preferredVerificationMethods)
+}
+
+// StartPasswordResetVerification is like StartVerification but the text
+// message tells that the code is for resetting the password.
+func (verifier *Verifier) StartPasswordResetVerification(
+	inputCtx iam.CallInputContext,
+	phoneNumber telephony.PhoneNumber,
+	codeTTL time.Duration,
+	userPreferredLanguages []language.Tag,
+) (idNum int64, codeExpiry *time.Time, err error) {
+	return verifier.startVerification(inputCtx, VerificationPurposePasswordReset,
+		phoneNumber, codeTTL, userPreferredLanguages, nil)
+}
+
+//TODO(exa): make the operations atomic
+func (verifier *Verifier) startVerification(
+	inputCtx iam.CallInputContext,
+	purpose VerificationPurpose,
+	phoneNumber telephony.PhoneNumber,
+	codeTTL time.Duration,
+	userPreferredLanguages []language.Tag,
+	preferredVerificationMethods []VerificationMethod,
 ) (idNum int64, codeExpiry *time.Time, err error) {
 	if inputCtx == nil {
 		return 0, nil, errors.ArgMsg("inputCtx", "missing")
@@ -140,11 +164,13 @@ func (verifier *Verifier) StartVerification(
 		QueryRow(
 			"SELECT id_num, code_expiry, confirmation_attempts_remaining "+
 				`FROM `+verificationDBTableName+` `+
-				"WHERE country_code = $1 AND national_number = $2 AND confirmation_ts IS NULL "+
+				"WHERE country_code = $1 AND national_number = $2 AND purpose = $3 "+
+				"AND confirmation_ts IS NULL "+
 				"ORDER BY id_num DESC "+
 				"LIMIT 1",
 			phoneNumber.CountryCode(),
-			phoneNumber.NationalNumber()).
+			phoneNumber.NationalNumber(),
+			purpose).
 		Scan(&prevVerificationID, &prevCodeExpiry, &prevAttempts)
 	if err == nil {
 		// Return previous verification code
@@ -166,13 +192,14 @@ func (verifier *Verifier) StartVerification(
 	err = verifier.db.
 		QueryRow(
 			`INSERT INTO `+verificationDBTableName+` (`+
-				"country_code, national_number, "+
+				"country_code, national_number, purpose, "+
 				"md_c_ts, md_c_uid, md_c_tid, "+
 				"code, code_expiry, confirmation_attempts_remaining"+
-				") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) "+
+				") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) "+
 				"RETURNING id_num",
 			phoneNumber.CountryCode(),
 			phoneNumber.NationalNumber(),
+			purpose,
 			ctxTime,
 			ctxAuth.UserIDNumPtr(),
 			ctxAuth.TerminalIDNumPtr(),
@@ -187,7 +214,7 @@ func (verifier *Verifier) StartVerification(
 	noDelivery := len(preferredVerificationMethods) == 1 &&
 		preferredVerificationMethods[0] == VerificationMethodNone
 	err = verifier.sendTextMessage(
-		phoneNumber, code, userPreferredLanguages, noDelivery)
+		purpose, phoneNumber, code, userPreferredLanguages, noDelivery)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -290,22 +317,28 @@ func (verifier *Verifier) generateVerificationCode() string {
 }
 
 func (verifier *Verifier) sendTextMessage(
+	purpose VerificationPurpose,
 	phoneNumber telephony.PhoneNumber,
 	code string,
 	userPreferredLanguages []language.Tag,
 	noDelivery bool,
 ) error {
+	messageTemplates := localizedMessageTemplates
+	if purpose == VerificationPurposePasswordReset {
+		messageTemplates = localizedPasswordResetMessageTemplates
+	}
+
 	var messageTemplate *template.Template
 	if len(userPreferredLanguages) != 0 {
 		for _, locale := range userPreferredLanguages {
-			messageTemplate = localizedMessageTemplates[locale.String()]
+			messageTemplate = messageTemplates[locale.String()]
 			if messageTemplate != nil {
 				break
 			}
 		}
 	}
 	if messageTemplate == nil {
-		messageTemplate = localizedMessageTemplates[messageLocaleDefault.String()]
+		messageTemplate = messageTemplates[messageLocaleDefault.String()]
 	}
 
 	var bodyBuilder strings.Builder
@@ -367,11 +400,29 @@ var localizedMessageTemplateSources = map[string][]string{
 	"{{ .RealmName }} - kode verifikasi Anda: {{ .Code }}": {"id", "id-ID"},
 }
 
+var localizedPasswordResetMessageTemplates map[string]*template.Template
+
+var localizedPasswordResetMessageTemplateSources = map[string][]string{
+	"{{ .RealmName }} - password reset code: {{ .Code }}. " +
+		"Ignore this message if you didn't request it.": {"en", "en-US", "en-GB"},
+	"{{ .RealmName }} - kode atur ulang kata sandi Anda: {{ .Code }}. " +
+		"Abaikan pesan ini jika Anda tidak memintanya.": {"id", "id-ID"},
+}
+
 func loadTemplates() {
-	localizedMessageTemplates = make(map[string]*template.Template)
+	localizedMessageTemplates = loadMessageTemplates(
+		localizedMessageTemplateSources)
+	localizedPasswordResetMessageTemplates = loadMessageTemplates(
+		localizedPasswordResetMessageTemplateSources)
+}
+
+func loadMessageTemplates(
+	templateSources map[string][]string,
+) map[string]*template.Template {
+	localizedTemplates := make(map[string]*template.Template)
 	// Load all message templates. We also ensure that there's no
 	// duplicates for the same language.
-	for tplstr, locales := range localizedMessageTemplateSources {
+	for tplstr, locales := range templateSources {
 		if len(locales) == 0 {
 			continue
 		}
@@ -381,14 +432,15 @@ func loadTemplates() {
 				continue
 			}
 			langTag := language.MustParse(locale)
-			if _, ok := localizedMessageTemplates[langTag.String()]; ok {
+			if _, ok := localizedTemplates[langTag.String()]; ok {
 				panic("duplicate for locale " + locale + " (" + langTag.String() + ")")
 			}
-			localizedMessageTemplates[langTag.String()] = tpl
+			localizedTemplates[langTag.String()] = tpl
 		}
 	}
 	// Ensure that we have a message template for the default locale.
-	if v := localizedMessageTemplates[messageLocaleDefault.String()]; v == nil {
+	if v := localizedTemplates[messageLocaleDefault.String()]; v == nil {
 		panic("no template for default locale " + messageLocaleDefault.String())
 	}
+	return localizedTemplates
 }
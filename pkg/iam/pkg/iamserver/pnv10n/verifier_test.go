@@ -0,0 +1,26 @@
+package pnv10n
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordResetMessageTemplates(t *testing.T) {
+	loadTemplates()
+
+	for _, locale := range []string{"en-US", "id"} {
+		buf := new(bytes.Buffer)
+		err := localizedPasswordResetMessageTemplates[locale].
+			Execute(buf, map[string]interface{}{
+				"RealmName": "Kadisoka",
+				"Code":      "123456",
+			})
+		assert.Nil(t, err, locale)
+		assert.Contains(t, buf.String(), "123456", locale)
+		assert.NotEqual(t,
+			localizedMessageTemplates[locale],
+			localizedPasswordResetMessageTemplates[locale], locale)
+	}
+}
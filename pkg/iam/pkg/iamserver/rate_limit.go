@@ -0,0 +1,337 @@
+package iamserver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+)
+
+// RateLimitConfig configures the limits of the calls which are prone to
+// brute-force attacks or which trigger deliveries of verification codes.
+// The limits which are not configured use the defaults.
+type RateLimitConfig struct {
+	Disabled bool   `env:"DISABLED"`
+	Store    string `env:"STORE"`
+
+	// Failed password grants
+	PasswordIdentifier RateLimitRuleConfig `env:"PASSWORD_IDENTIFIER"`
+	PasswordIP         RateLimitRuleConfig `env:"PASSWORD_IP"`
+	// All password grants
+	PasswordApplication RateLimitRuleConfig `env:"PASSWORD_APPLICATION"`
+
+	// Terminal registrations and other calls which send verification codes
+	VerificationStartIdentifier  RateLimitRuleConfig `env:"VERIFICATION_START_IDENTIFIER"`
+	VerificationStartIP          RateLimitRuleConfig `env:"VERIFICATION_START_IP"`
+	VerificationStartApplication RateLimitRuleConfig `env:"VERIFICATION_START_APPLICATION"`
+
+	// Failed verification code confirmations
+	VerificationConfirmTerminal RateLimitRuleConfig `env:"VERIFICATION_CONFIRM_TERMINAL"`
+	VerificationConfirmIP       RateLimitRuleConfig `env:"VERIFICATION_CONFIRM_IP"`
+
+	// Failed second-factor codes
+	MFAUser RateLimitRuleConfig `env:"MFA_USER"`
+
+	// Password reset requests, whether the identifier is registered or not
+	PasswordResetIdentifier RateLimitRuleConfig `env:"PASSWORD_RESET_IDENTIFIER"`
+	PasswordResetIP         RateLimitRuleConfig `env:"PASSWORD_RESET_IP"`
+}
+
+func (RateLimitConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"Disabled": "Disable the rate limits",
+		"Store": "Where the counters are stored: memory or postgres. Use " +
+			"postgres to share the limits among the instances. Defaults to memory",
+	}
+}
+
+type RateLimitRuleConfig struct {
+	Limit  int64         `env:"LIMIT"`
+	Window time.Duration `env:"WINDOW"`
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+type rateLimitRules struct {
+	passwordIdentifier  ratelimit.Rule
+	passwordIP          ratelimit.Rule
+	passwordApplication ratelimit.Rule
+
+	verificationStartIdentifier  ratelimit.Rule
+	verificationStartIP          ratelimit.Rule
+	verificationStartApplication ratelimit.Rule
+
+	verificationConfirmTerminal ratelimit.Rule
+	verificationConfirmIP       ratelimit.Rule
+
+	mfaUser ratelimit.Rule
+
+	passwordResetIdentifier ratelimit.Rule
+	passwordResetIP         ratelimit.Rule
+}
+
+type rateLimiter struct {
+	limiter *ratelimit.Limiter
+	rules   rateLimitRules
+}
+
+func newRateLimiter(cfg RateLimitConfig, db *sqlx.DB) (*rateLimiter, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+
+	var store ratelimit.Store
+	switch cfg.Store {
+	case "", RateLimitStoreMemory:
+		store = ratelimit.NewMemoryStore()
+	case RateLimitStorePostgres:
+		store = ratelimit.NewPostgresStore(db)
+	default:
+		return nil, errors.ArgMsg("cfg.Store", "unsupported: "+cfg.Store)
+	}
+
+	rule := func(name string, ruleCfg RateLimitRuleConfig, limit int64, window time.Duration) ratelimit.Rule {
+		if ruleCfg.Limit > 0 {
+			limit = ruleCfg.Limit
+		}
+		if ruleCfg.Window > 0 {
+			window = ruleCfg.Window
+		}
+		return ratelimit.Rule{Name: name, Limit: limit, Window: window}
+	}
+
+	return &rateLimiter{
+		limiter: ratelimit.NewLimiter(store),
+		rules: rateLimitRules{
+			passwordIdentifier: rule("password_identifier",
+				cfg.PasswordIdentifier, 10, 15*time.Minute),
+			passwordIP: rule("password_ip",
+				cfg.PasswordIP, 100, 15*time.Minute),
+			passwordApplication: rule("password_application",
+				cfg.PasswordApplication, 600, time.Minute),
+			verificationStartIdentifier: rule("verification_start_identifier",
+				cfg.VerificationStartIdentifier, 5, time.Hour),
+			verificationStartIP: rule("verification_start_ip",
+				cfg.VerificationStartIP, 30, time.Hour),
+			verificationStartApplication: rule("verification_start_application",
+				cfg.VerificationStartApplication, 300, time.Minute),
+			verificationConfirmTerminal: rule("verification_confirm_terminal",
+				cfg.VerificationConfirmTerminal, 5, 15*time.Minute),
+			verificationConfirmIP: rule("verification_confirm_ip",
+				cfg.VerificationConfirmIP, 50, 15*time.Minute),
+			mfaUser: rule("mfa_user",
+				cfg.MFAUser, 10, 15*time.Minute),
+			passwordResetIdentifier: rule("password_reset_identifier",
+				cfg.PasswordResetIdentifier, 3, time.Hour),
+			passwordResetIP: rule("password_reset_ip",
+				cfg.PasswordResetIP, 20, time.Hour),
+		},
+	}, nil
+}
+
+type rateLimitKey struct {
+	rule ratelimit.Rule
+	key  string
+}
+
+// takeRateLimits counts the call against the limits. It returns
+// a *ratelimit.ExceededError, and counts nothing, if any of the limits
+// has been reached.
+func (core *Core) takeRateLimits(
+	inputCtx iam.CallInputContext,
+	keys ...rateLimitKey,
+) error {
+	for i := range keys {
+		err := core.applyRateLimits(inputCtx, (*ratelimit.Limiter).Take, keys[i:i+1])
+		if err != nil {
+			core.refundRateLimits(inputCtx, keys[:i]...)
+			return err
+		}
+	}
+	return nil
+}
+
+// refundRateLimits uncounts a call which has been counted by
+// takeRateLimits.
+func (core *Core) refundRateLimits(
+	inputCtx iam.CallInputContext,
+	keys ...rateLimitKey,
+) {
+	_ = core.applyRateLimits(inputCtx, (*ratelimit.Limiter).Refund, keys)
+}
+
+// rateLimitedAttempt is used for the limits of the failed attempts, e.g.,
+// wrong passwords. The attempt is counted before it's made so that
+// concurrent attempts could not all pass the limits, and the count is
+// refunded when the attempt ends unless it has been marked as failed.
+type rateLimitedAttempt struct {
+	core     *Core
+	inputCtx iam.CallInputContext
+	keys     []rateLimitKey
+	failed   bool
+}
+
+// startRateLimitedAttempt returns a *ratelimit.ExceededError if any of
+// the limits has been reached. Otherwise, the caller must call end on
+// the returned attempt.
+func (core *Core) startRateLimitedAttempt(
+	inputCtx iam.CallInputContext,
+	keys ...rateLimitKey,
+) (*rateLimitedAttempt, error) {
+	if err := core.takeRateLimits(inputCtx, keys...); err != nil {
+		return nil, err
+	}
+	return &rateLimitedAttempt{
+		core:     core,
+		inputCtx: inputCtx,
+		keys:     keys,
+	}, nil
+}
+
+// fail marks the attempt as failed so that it stays counted.
+func (attempt *rateLimitedAttempt) fail() { attempt.failed = true }
+
+func (attempt *rateLimitedAttempt) end() {
+	if !attempt.failed {
+		attempt.core.refundRateLimits(attempt.inputCtx, attempt.keys...)
+	}
+}
+
+func (core *Core) applyRateLimits(
+	inputCtx iam.CallInputContext,
+	op func(*ratelimit.Limiter, ratelimit.Rule, string) error,
+	keys []rateLimitKey,
+) error {
+	if core.rateLimiter == nil {
+		return nil
+	}
+	for _, k := range keys {
+		err := op(core.rateLimiter.limiter, k.rule, k.key)
+		if err == nil {
+			continue
+		}
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(inputCtx).Warn().
+				Str("event", "rate_limit_exceeded").
+				Str("rate_limit_rule", exceededErr.RuleName).
+				Dur("retry_after", exceededErr.RetryAfter).
+				Msg("Rate limit exceeded")
+			return err
+		}
+		// The calls are allowed when the store is unavailable so that
+		// the service keeps working.
+		logCtx(inputCtx).Error().Err(err).
+			Str("rate_limit_rule", k.rule.Name).
+			Msg("Rate limiting")
+	}
+	return nil
+}
+
+func (core *Core) rateLimitRules() rateLimitRules {
+	if core.rateLimiter == nil {
+		return rateLimitRules{}
+	}
+	return core.rateLimiter.rules
+}
+
+// rateLimitOriginKey returns the IP address the call came from. Behind
+// reverse proxies, the proxies must be listed in the TrustedProxies
+// config; otherwise, all the calls share the address of the proxy.
+func rateLimitOriginKey(inputCtx iam.CallInputContext) string {
+	addr := inputCtx.OriginInfo().Address
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func rateLimitApplicationKey(appID iam.ApplicationID) string {
+	if appID.IsNotStaticallyValid() {
+		return ""
+	}
+	return appID.AZIDText()
+}
+
+func rateLimitIdentifierKey(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// rateLimitUserKey is used in place of the identifier key once
+// the identifier has been resolved to a user.
+func rateLimitUserKey(userIDNum iam.UserIDNum) string {
+	return "user:" + iam.NewUserID(userIDNum).AZIDText()
+}
+
+// verificationStartRateLimitKeys returns the limits of the calls which
+// send verification codes to the identifier, e.g., a phone number.
+func (core *Core) verificationStartRateLimitKeys(
+	inputCtx iam.CallInputContext,
+	identifier string,
+	appID iam.ApplicationID,
+) []rateLimitKey {
+	rules := core.rateLimitRules()
+	return []rateLimitKey{
+		{rules.verificationStartIdentifier, rateLimitIdentifierKey(identifier)},
+		{rules.verificationStartIP, rateLimitOriginKey(inputCtx)},
+		{rules.verificationStartApplication, rateLimitApplicationKey(appID)},
+	}
+}
+
+// verificationConfirmRateLimitKeys returns the limits of the failed
+// verification code confirmations for the terminal.
+func (core *Core) verificationConfirmRateLimitKeys(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+) []rateLimitKey {
+	rules := core.rateLimitRules()
+	var terminalKey string
+	if terminalID.IsStaticallyValid() {
+		terminalKey = terminalID.AZIDText()
+	}
+	return []rateLimitKey{
+		{rules.verificationConfirmTerminal, terminalKey},
+		{rules.verificationConfirmIP, rateLimitOriginKey(inputCtx)},
+	}
+}
+
+// mfaRateLimitKeys returns the limits of the failed second-factor codes,
+// i.e., TOTP codes and recovery codes. The TOTP codes are short thus
+// the attempts are limited per user regardless of the terminal.
+func (core *Core) mfaRateLimitKeys(
+	inputCtx iam.CallInputContext,
+	userIDNum iam.UserIDNum,
+) []rateLimitKey {
+	rules := core.rateLimitRules()
+	var userKey string
+	if userIDNum.IsStaticallyValid() {
+		userKey = iam.NewUserID(userIDNum).AZIDText()
+	}
+	return []rateLimitKey{
+		{rules.mfaUser, userKey},
+		{rules.verificationConfirmIP, rateLimitOriginKey(inputCtx)},
+	}
+}
+
+// passwordResetRateLimitKeys returns the limits of the password reset
+// requests. They apply to the unregistered identifiers as well so that
+// the limits don't tell which identifiers have been registered.
+func (core *Core) passwordResetRateLimitKeys(
+	inputCtx iam.CallInputContext,
+	identifier string,
+	appID iam.ApplicationID,
+) []rateLimitKey {
+	rules := core.rateLimitRules()
+	return []rateLimitKey{
+		{rules.passwordResetIdentifier, rateLimitIdentifierKey(identifier)},
+		{rules.passwordResetIP, rateLimitOriginKey(inputCtx)},
+		{rules.verificationStartApplication, rateLimitApplicationKey(appID)},
+	}
+}
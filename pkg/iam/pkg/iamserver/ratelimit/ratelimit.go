@@ -0,0 +1,201 @@
+// Package ratelimit provides rate limiting with sliding-window counters.
+//
+// The sliding window is approximated with the counters of two consecutive
+// fixed windows: the count of the previous window is weighted by how much
+// of it still overlaps the sliding window.
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+)
+
+// Rule defines how many events are allowed for a key within the window.
+type Rule struct {
+	// Name identifies the rule. The counters of a key are separated
+	// per rule.
+	Name string
+
+	Limit  int64
+	Window time.Duration
+}
+
+// IsEnabled returns false if the rule doesn't limit anything.
+func (rule Rule) IsEnabled() bool { return rule.Limit > 0 && rule.Window > 0 }
+
+// Store holds the counters.
+type Store interface {
+	// Add adds n, which could be zero, to the counter of the key in
+	// the window which starts at windowStart. It returns the counts of
+	// that window and of the window before it.
+	Add(
+		key string,
+		windowStart time.Time,
+		window time.Duration,
+		n int64,
+	) (current, previous int64, err error)
+}
+
+// ExceededError is returned when the limit of a rule has been reached.
+type ExceededError struct {
+	RuleName string
+	// RetryAfter is how long until the next event would be allowed
+	RetryAfter time.Duration
+}
+
+var _ error = &ExceededError{}
+
+func (e *ExceededError) Error() string {
+	return "rate limit exceeded: " + e.RuleName
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds, rounded up, in
+// the format of the Retry-After HTTP header.
+func (e *ExceededError) RetryAfterSeconds() string {
+	seconds := int64(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+type Limiter struct {
+	store Store
+
+	now func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Check returns an *ExceededError if the limit of the rule for the key
+// has been reached. It doesn't count the call itself; see Hit and Take.
+// Empty keys are never limited.
+func (limiter *Limiter) Check(rule Rule, key string) error {
+	return limiter.add(rule, key, 0, true)
+}
+
+// Hit counts an event, e.g., a failed attempt, for the key.
+func (limiter *Limiter) Hit(rule Rule, key string) error {
+	return limiter.add(rule, key, 1, false)
+}
+
+// Take counts an event for the key if the limit has not been reached.
+// Otherwise, it returns an *ExceededError. The event is counted before
+// the limit is checked, and uncounted if the limit has been reached, so
+// that concurrent calls could not all pass the limit.
+func (limiter *Limiter) Take(rule Rule, key string) error {
+	if !rule.IsEnabled() || key == "" {
+		return nil
+	}
+
+	now := limiter.now()
+	windowStart := now.Truncate(rule.Window)
+	current, previous, err := limiter.store.Add(
+		counterKey(rule, key), windowStart, rule.Window, 1)
+	if err != nil {
+		return errors.Wrap("rate limit store", err)
+	}
+
+	// It's the count before this event which decides.
+	exceededErr := exceededError(rule, now.Sub(windowStart), current-1, previous)
+	if exceededErr == nil {
+		return nil
+	}
+	_, _, err = limiter.store.Add(
+		counterKey(rule, key), windowStart, rule.Window, -1)
+	if err != nil {
+		return errors.Wrap("rate limit store", err)
+	}
+	return exceededErr
+}
+
+// Refund uncounts an event which has been counted by Take, e.g., when
+// only the failed attempts are limited and the attempt did not fail.
+func (limiter *Limiter) Refund(rule Rule, key string) error {
+	return limiter.add(rule, key, -1, false)
+}
+
+func (limiter *Limiter) add(rule Rule, key string, n int64, check bool) error {
+	if !rule.IsEnabled() || key == "" {
+		return nil
+	}
+
+	now := limiter.now()
+	windowStart := now.Truncate(rule.Window)
+	current, previous, err := limiter.store.Add(
+		counterKey(rule, key), windowStart, rule.Window, n)
+	if err != nil {
+		return errors.Wrap("rate limit store", err)
+	}
+	if !check {
+		return nil
+	}
+
+	if exceededErr := exceededError(rule, now.Sub(windowStart), current, previous); exceededErr != nil {
+		return exceededErr
+	}
+	return nil
+}
+
+// exceededError returns an *ExceededError if the counts have reached
+// the limit of the rule.
+func exceededError(
+	rule Rule,
+	elapsed time.Duration,
+	current, previous int64,
+) *ExceededError {
+	if slidingWindowCount(current, previous, elapsed, rule.Window) < float64(rule.Limit) {
+		return nil
+	}
+	return &ExceededError{
+		RuleName: rule.Name,
+		RetryAfter: slidingWindowRetryAfter(rule.Limit,
+			current, previous, elapsed, rule.Window),
+	}
+}
+
+// counterKey derives the key of the counter. The keys are hashed so that
+// the stores don't hold the identifiers, e.g., email addresses, in
+// the clear.
+func counterKey(rule Rule, key string) string {
+	sum := sha256.Sum256([]byte(rule.Name + "\x00" + key))
+	return rule.Name + ":" + hex.EncodeToString(sum[:16])
+}
+
+func slidingWindowCount(
+	current, previous int64,
+	elapsed, window time.Duration,
+) float64 {
+	return float64(previous)*float64(window-elapsed)/float64(window) +
+		float64(current)
+}
+
+// slidingWindowRetryAfter returns how long until the sliding-window count
+// drops below the limit, assuming no more events.
+func slidingWindowRetryAfter(
+	limit int64,
+	current, previous int64,
+	elapsed, window time.Duration,
+) time.Duration {
+	// Within the current window, the count drops as the previous window
+	// slides out.
+	if current < limit && previous > 0 {
+		target := float64(window) * (1 - float64(limit-current)/float64(previous))
+		if target < float64(window) {
+			return time.Duration(target) - elapsed + time.Second
+		}
+	}
+	// In the next window, the current window becomes the previous one.
+	retryAfter := window - elapsed
+	if current >= limit {
+		retryAfter += time.Duration(float64(window) * (1 - float64(limit)/float64(current)))
+	}
+	return retryAfter + time.Second
+}
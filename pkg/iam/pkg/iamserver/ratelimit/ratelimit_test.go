@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLimiterForTest(now *time.Time) *Limiter {
+	limiter := NewLimiter(NewMemoryStore())
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func TestLimiterTake(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+	rule := Rule{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, limiter.Take(rule, "alice"))
+	}
+	err := limiter.Take(rule, "alice")
+	if assert.IsType(t, &ExceededError{}, err) {
+		exceededErr := err.(*ExceededError)
+		assert.Equal(t, "test", exceededErr.RuleName)
+		assert.True(t, exceededErr.RetryAfter > 0)
+		assert.True(t, exceededErr.RetryAfter <= 2*time.Minute)
+	}
+
+	// Other keys have their own counters
+	assert.Nil(t, limiter.Take(rule, "bob"))
+	// and so do other rules
+	assert.Nil(t, limiter.Take(Rule{Name: "other", Limit: 1, Window: time.Minute}, "alice"))
+}
+
+func TestLimiterSlidingWindow(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+	rule := Rule{Name: "test", Limit: 3, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, limiter.Hit(rule, "alice"))
+	}
+	assert.NotNil(t, limiter.Check(rule, "alice"))
+
+	// A quarter into the next window, three quarters of the previous
+	// window's events still count, which is at the limit.
+	now = now.Add(time.Minute + 15*time.Second)
+	err := limiter.Check(rule, "alice")
+	if assert.IsType(t, &ExceededError{}, err) {
+		// The count drops below the limit once more than a quarter of
+		// the previous window has slid out.
+		assert.Equal(t, time.Second, err.(*ExceededError).RetryAfter)
+	}
+
+	now = now.Add(time.Second)
+	assert.Nil(t, limiter.Check(rule, "alice"))
+
+	// Two windows later, the count is gone.
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, limiter.Take(rule, "alice"))
+	}
+}
+
+func TestLimiterCheckDoesNotCount(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+	rule := Rule{Name: "test", Limit: 1, Window: time.Minute}
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, limiter.Check(rule, "alice"))
+	}
+	assert.Nil(t, limiter.Hit(rule, "alice"))
+	assert.NotNil(t, limiter.Check(rule, "alice"))
+}
+
+func TestLimiterSkips(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+
+	rule := Rule{Name: "test", Limit: 1, Window: time.Minute}
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, limiter.Take(rule, ""))
+	}
+
+	disabled := Rule{Name: "disabled"}
+	assert.False(t, disabled.IsEnabled())
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, limiter.Take(disabled, "alice"))
+	}
+}
+
+func TestCounterKey(t *testing.T) {
+	rule := Rule{Name: "test", Limit: 1, Window: time.Minute}
+	key := counterKey(rule, "alice@example.com")
+	assert.NotContains(t, key, "alice")
+	assert.Equal(t, key, counterKey(rule, "alice@example.com"))
+	assert.NotEqual(t, key, counterKey(Rule{Name: "other"}, "alice@example.com"))
+}
+
+func TestExceededErrorRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "1", (&ExceededError{RetryAfter: 0}).RetryAfterSeconds())
+	assert.Equal(t, "1", (&ExceededError{RetryAfter: 300 * time.Millisecond}).RetryAfterSeconds())
+	assert.Equal(t, "2", (&ExceededError{RetryAfter: 1100 * time.Millisecond}).RetryAfterSeconds())
+	assert.Equal(t, "60", (&ExceededError{RetryAfter: time.Minute}).RetryAfterSeconds())
+}
+
+func TestLimiterTakeConcurrent(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+	rule := Rule{Name: "test", Limit: 10, Window: time.Minute}
+
+	var wg sync.WaitGroup
+	var taken int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Take(rule, "alice") == nil {
+				atomic.AddInt64(&taken, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), taken)
+	// The rejected calls are not counted
+	assert.Nil(t, limiter.Refund(rule, "alice"))
+	assert.Nil(t, limiter.Take(rule, "alice"))
+}
+
+func TestLimiterRefund(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newLimiterForTest(&now)
+	rule := Rule{Name: "test", Limit: 1, Window: time.Minute}
+
+	assert.Nil(t, limiter.Take(rule, "alice"))
+	assert.NotNil(t, limiter.Check(rule, "alice"))
+	assert.Nil(t, limiter.Refund(rule, "alice"))
+	assert.Nil(t, limiter.Check(rule, "alice"))
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store which keeps the counters in the memory. The
+// counters are not shared among the instances of a service; use
+// PostgresStore for that.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	counters  map[memoryCounterKey]*memoryCounter
+	lastSweep time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+type memoryCounterKey struct {
+	key         string
+	windowStart int64
+}
+
+type memoryCounter struct {
+	count      int64
+	expiryTime time.Time
+}
+
+const memoryStoreSweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[memoryCounterKey]*memoryCounter{}}
+}
+
+func (store *MemoryStore) Add(
+	key string,
+	windowStart time.Time,
+	window time.Duration,
+	n int64,
+) (current, previous int64, err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(store.lastSweep) >= memoryStoreSweepInterval {
+		store.sweep(now)
+	}
+
+	currentKey := memoryCounterKey{key: key, windowStart: windowStart.UnixNano()}
+	counter := store.counters[currentKey]
+	if n != 0 {
+		if counter == nil {
+			// The counter is needed until it's no longer the previous
+			// window.
+			counter = &memoryCounter{expiryTime: windowStart.Add(2 * window)}
+			store.counters[currentKey] = counter
+		}
+		counter.count += n
+	}
+	if counter != nil {
+		current = counter.count
+	}
+
+	previousKey := memoryCounterKey{key: key,
+		windowStart: windowStart.Add(-window).UnixNano()}
+	if counter := store.counters[previousKey]; counter != nil {
+		previous = counter.count
+	}
+
+	return current, previous, nil
+}
+
+func (store *MemoryStore) sweep(now time.Time) {
+	for k, counter := range store.counters {
+		if !counter.expiryTime.After(now) {
+			delete(store.counters, k)
+		}
+	}
+	store.lastSweep = now
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore is a Store which keeps the counters in a PostgreSQL
+// database so that the limits are shared among the instances of
+// a service. The table is created by the IAM migrations.
+type PostgresStore struct {
+	db *sqlx.DB
+
+	cleanupMutex    sync.Mutex
+	lastCleanupTime time.Time
+}
+
+var _ Store = &PostgresStore{}
+
+const (
+	counterDBTableName = "rate_limit_counter_dt"
+
+	postgresStoreCleanupInterval = time.Minute
+)
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (store *PostgresStore) Add(
+	key string,
+	windowStart time.Time,
+	window time.Duration,
+	n int64,
+) (current, previous int64, err error) {
+	store.cleanupExpired()
+
+	// The count of the current window is the one returned by
+	// the increment so that each of concurrent increments gets
+	// a distinct count.
+	added := n != 0
+	if added {
+		err = store.db.QueryRow(
+			`INSERT INTO `+counterDBTableName+` `+
+				`(counter_key, window_start_ts, count, expiry_ts) `+
+				`VALUES ($1, $2, $3, $4) `+
+				`ON CONFLICT (counter_key, window_start_ts) DO UPDATE `+
+				`SET count = `+counterDBTableName+`.count + EXCLUDED.count `+
+				`RETURNING count`,
+			key, windowStart.UTC(), n, windowStart.Add(2*window).UTC()).
+			Scan(&current)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	rows, err := store.db.Query(
+		`SELECT window_start_ts, count FROM `+counterDBTableName+` `+
+			`WHERE counter_key = $1 AND window_start_ts IN ($2, $3)`,
+		key, windowStart.UTC(), windowStart.Add(-window).UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rowWindowStart time.Time
+		var count int64
+		if err = rows.Scan(&rowWindowStart, &count); err != nil {
+			return 0, 0, err
+		}
+		if rowWindowStart.Equal(windowStart) {
+			if !added {
+				current = count
+			}
+		} else {
+			previous = count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return current, previous, nil
+}
+
+// cleanupExpired deletes the expired counters, at most once in
+// the cleanup interval.
+func (store *PostgresStore) cleanupExpired() {
+	store.cleanupMutex.Lock()
+	if time.Since(store.lastCleanupTime) < postgresStoreCleanupInterval {
+		store.cleanupMutex.Unlock()
+		return
+	}
+	store.lastCleanupTime = time.Now()
+	store.cleanupMutex.Unlock()
+
+	// The counters are only read within their expiry, thus a failed
+	// cleanup is not an issue; it will be retried later.
+	_, _ = store.db.Exec(
+		`DELETE FROM ` + counterDBTableName + ` WHERE expiry_ts < now()`)
+}
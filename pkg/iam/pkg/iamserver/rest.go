@@ -1,12 +1,7 @@
 package iamserver
 
 import (
-	"encoding/base64"
 	"net/http"
-	"strings"
-
-	"github.com/alloyzeus/go-azfl/errors"
-	dataerrs "github.com/alloyzeus/go-azfl/errors/data"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 )
@@ -44,40 +39,5 @@ func (svcBase *RESTServiceServerBase) RequestApplication(
 		return nil, nil
 	}
 
-	authorizationParts := strings.SplitN(authorizationHeader, " ", 2)
-	if len(authorizationParts) != 2 {
-		return nil, iam.ErrReqFieldAuthorizationMalformed
-	}
-	if authorizationParts[0] != "Basic" {
-		return nil, iam.ErrReqFieldAuthorizationTypeUnsupported
-	}
-
-	credsBytes, err := base64.StdEncoding.
-		DecodeString(strings.TrimSpace(authorizationParts[1]))
-	if err != nil {
-		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, dataerrs.Malformed(err))
-	}
-
-	creds := strings.SplitN(string(credsBytes), ":", 2)
-	if creds[0] == "" {
-		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.EntMsg("username", "empty"))
-	}
-
-	appID, err := iam.ApplicationIDFromAZIDText(creds[0])
-	if err != nil {
-		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.Ent("username", dataerrs.Malformed(err)))
-	}
-	if appID.IsNotStaticallyValid() {
-		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.Ent("username", nil))
-	}
-
-	app, err = svcBase.AuthenticatedApplication(appID, creds[1])
-	if err != nil {
-		return nil, errors.Wrap("client look up", err)
-	}
-	if app == nil {
-		return nil, iam.ReqFieldErr(iam.AuthorizationMetadataKey, errors.EntMsg("username", "reference invalid"))
-	}
-
-	return app, nil
+	return svcBase.ApplicationByBasicAuthorization(authorizationHeader)
 }
@@ -0,0 +1,358 @@
+// Package application provides the REST API to manage the registered
+// applications.
+package application
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	restfulopenapi "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/logging"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/sec"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+var (
+	log    = logging.NewPkgLogger()
+	logCtx = log.WithContext
+)
+
+type ServerConfig struct {
+	ServePath string
+}
+
+func NewServer(
+	iamServerCore *iamserver.Core,
+	config ServerConfig,
+) *Server {
+	return &Server{
+		serverCore: iamserver.RESTServiceServerWith(iamServerCore),
+		basePath:   config.ServePath,
+	}
+}
+
+type Server struct {
+	serverCore *iamserver.RESTServiceServerBase
+	basePath   string
+}
+
+func (restSrv *Server) RESTCallInputContext(req *http.Request) (*iam.RESTCallInputContext, error) {
+	return restSrv.serverCore.RESTCallInputContext(req)
+}
+
+func (restSrv *Server) RestfulWebService() *restful.WebService {
+	restWS := new(restful.WebService)
+	restWS.
+		Path(restSrv.basePath).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON)
+
+	tags := []string{"iam.v1.applications"}
+
+	restWS.Route(restWS.
+		POST("").
+		To(restSrv.postApplication).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Register a new application").
+		Notes("The access token must be of a service application, "+
+			"obtained with its client credentials, and it must have "+
+			"been granted the scope "+
+			iam.ScopeApplicationsManage+". The secret of the new "+
+			"application is provided only in the response of this request. "+
+			"The public user-agent applications are created without a secret.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(iam.ApplicationCreateRequestJSONV1{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusForbidden, "Missing required scope or not a service application", rest.ErrorResponse{}).
+		Returns(http.StatusCreated, "Application registered", iam.ApplicationCreateResponseJSONV1{}))
+
+	restWS.Route(restWS.
+		PUT("/{application-id}").
+		To(restSrv.putApplication).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Replace the attributes of an application").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("application-id",
+			"The ID of the application.").
+			Required(true)).
+		Reads(iam.ApplicationAttributesJSONV1{}).
+		Returns(http.StatusNotFound, "Application not found or disabled", nil).
+		Returns(http.StatusNoContent, "Application updated", nil))
+
+	restWS.Route(restWS.
+		POST("/{application-id}/secret").
+		To(restSrv.postApplicationSecret).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Generate a new secret for an application").
+		Notes("The existing secrets are still accepted for the number "+
+			"of seconds specified in previous_secrets_expires_in, so that "+
+			"the application could be updated with the new secret without "+
+			"an outage. An existing secret which expires earlier keeps its "+
+			"expiry. If the field is zero or the request has no body, "+
+			"the existing secrets are invalidated immediately. The public "+
+			"user-agent applications have no secrets.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("application-id",
+			"The ID of the application.").
+			Required(true)).
+		Reads(iam.ApplicationSecretRotateRequestJSONV1{}).
+		Returns(http.StatusForbidden, "Public user-agent application", nil).
+		Returns(http.StatusNotFound, "Application not found or disabled", nil).
+		Returns(http.StatusOK, "Secret generated", iam.ApplicationSecretResponseJSONV1{}))
+
+	restWS.Route(restWS.
+		DELETE("/{application-id}").
+		To(restSrv.deleteApplication).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Disable an application").
+		Notes("All the terminals registered for the application will be "+
+			"revoked. A disabled application can't be re-enabled.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("application-id",
+			"The ID of the application.").
+			Required(true)).
+		Returns(http.StatusNotFound, "Application not found or already disabled", nil).
+		Returns(http.StatusNoContent, "Application disabled", nil))
+
+	return restWS
+}
+
+func (restSrv *Server) postApplication(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	var reqEntity iam.ApplicationCreateRequestJSONV1
+	err = req.ReadEntity(&reqEntity)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	outData, err := restSrv.serverCore.
+		CreateApplication(reqCtx, iamserver.ApplicationCreationInputData{
+			Type:       reqEntity.Type,
+			FirstParty: reqEntity.FirstParty,
+
+			ApplicationAttributesInputData: attributesInputDataFromJSONV1(
+				reqEntity.ApplicationAttributesJSONV1),
+		})
+	if err != nil {
+		respondToError(reqCtx, resp, err, "CreateApplication")
+		return
+	}
+
+	resp.WriteHeaderAndJson(http.StatusCreated,
+		&iam.ApplicationCreateResponseJSONV1{
+			ApplicationID: outData.ApplicationID.AZIDText(),
+			Secret:        outData.Secret,
+		}, restful.MIME_JSON)
+}
+
+func (restSrv *Server) putApplication(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	appID, ok := applicationIDFromPath(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	var reqEntity iam.ApplicationAttributesJSONV1
+	err = req.ReadEntity(&reqEntity)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	err = restSrv.serverCore.
+		UpdateApplication(reqCtx, appID, attributesInputDataFromJSONV1(reqEntity))
+	if err != nil {
+		respondToError(reqCtx, resp, err, "UpdateApplication")
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (restSrv *Server) postApplicationSecret(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	appID, ok := applicationIDFromPath(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	var reqEntity iam.ApplicationSecretRotateRequestJSONV1
+	if req.Request.ContentLength != 0 {
+		err = req.ReadEntity(&reqEntity)
+		if err != nil {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("Request entity")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret, err := restSrv.serverCore.
+		RotateApplicationSecret(reqCtx, appID,
+			time.Duration(reqEntity.PreviousSecretsExpiresIn)*time.Second)
+	if err != nil {
+		respondToError(reqCtx, resp, err, "RotateApplicationSecret")
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	rest.RespondTo(resp).Success(
+		&iam.ApplicationSecretResponseJSONV1{
+			Secret: secret,
+		})
+}
+
+func (restSrv *Server) deleteApplication(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	appID, ok := applicationIDFromPath(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	stateChanged, err := restSrv.serverCore.
+		DisableApplication(reqCtx, appID)
+	if err != nil {
+		respondToError(reqCtx, resp, err, "DisableApplication")
+		return
+	}
+	if !stateChanged {
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func applicationIDFromPath(
+	reqCtx *iam.RESTCallInputContext,
+	req *restful.Request,
+	resp *restful.Response,
+) (appID iam.ApplicationID, ok bool) {
+	appIDArgVal := req.PathParameter("application-id")
+	appID, err := iam.ApplicationIDFromAZIDText(appIDArgVal)
+	if err != nil || appID.IsNotStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("path.application-id", appIDArgVal).
+			Msg("Malformed")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return iam.ApplicationIDZero(), false
+	}
+	return appID, true
+}
+
+func attributesInputDataFromJSONV1(
+	attrs iam.ApplicationAttributesJSONV1,
+) iamserver.ApplicationAttributesInputData {
+	return iamserver.ApplicationAttributesInputData{
+		DisplayName:        attrs.DisplayName,
+		PlatformType:       attrs.PlatformType,
+		RequiredScopes:     attrs.RequiredScopes,
+		OAuth2RedirectURI:  attrs.OAuth2RedirectURI,
+		OAuth2PKCERequired: attrs.OAuth2PKCERequired,
+	}
+}
+
+func respondToError(
+	reqCtx *iam.RESTCallInputContext,
+	resp *restful.Response,
+	err error,
+	opName string,
+) {
+	switch err {
+	case iam.ErrAuthorizationInvalid:
+		logCtx(reqCtx).Warn().Err(err).Msg(opName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	case iam.ErrScopeInsufficient, iam.ErrOperationNotAllowed:
+		logCtx(reqCtx).Warn().Err(err).Msg(opName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusForbidden)
+		return
+	case iam.ErrApplicationNotFound:
+		logCtx(reqCtx).Warn().Err(err).Msg(opName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	}
+	if errors.IsCallError(err) {
+		logCtx(reqCtx).Warn().Err(err).Msg(opName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+	logCtx(reqCtx).Error().Err(err).Msg(opName)
+	rest.RespondTo(resp).EmptyError(
+		http.StatusInternalServerError)
+}
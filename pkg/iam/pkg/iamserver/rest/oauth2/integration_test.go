@@ -14,6 +14,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 )
 
 var baseURL = "http://localhost:8080/iam/oauth"
@@ -91,6 +94,248 @@ func TestPostTokenInvalidGrantType(t *testing.T) {
 	assert.Equal(t, "unsupported_grant_type", errData.Error)
 }
 
+func TestPostNoClientAuthorization(t *testing.T) {
+	testCases := []struct {
+		name string
+		path string
+		data url.Values
+	}{
+		{"refresh token", "/token", url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {"invalid"},
+		}},
+		{"introspect", "/introspect", url.Values{
+			"token": {"invalid"},
+		}},
+		{"revoke", "/revoke", url.Values{
+			"token": {"invalid"},
+		}},
+		{"device authorization", "/device_authorization", url.Values{
+			"scope": {"openid"},
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp, err := postForm(testCase.path, testCase.data, false)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			var errData errorResponse
+			errDec := json.NewDecoder(resp.Body).Decode(&errData)
+
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			assert.Nil(t, errDec)
+			assert.Equal(t, "invalid_client", errData.Error)
+		})
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	tokenSet := passwordGrantTokenSet(t)
+	if tokenSet == nil {
+		return
+	}
+
+	resp, err := postForm("/token", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokenSet.RefreshToken},
+	}, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	var rotatedTokenSet iam.OAuth2TokenResponse
+	errDec := json.NewDecoder(resp.Body).Decode(&rotatedTokenSet)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, errDec)
+	assert.NotEmpty(t, rotatedTokenSet.RefreshToken)
+	assert.NotEqual(t, tokenSet.RefreshToken, rotatedTokenSet.RefreshToken)
+
+	// Reusing the rotated refresh token revokes the terminal, which
+	// invalidates the new refresh token as well.
+	for _, refreshToken := range []string{
+		tokenSet.RefreshToken, rotatedTokenSet.RefreshToken,
+	} {
+		resp, err = postForm("/token", url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		}, true)
+		if !assert.Nil(t, err) {
+			return
+		}
+		var errData errorResponse
+		errDec = json.NewDecoder(resp.Body).Decode(&errData)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Nil(t, errDec)
+		assert.Equal(t, "invalid_grant", errData.Error)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	tokenSet := passwordGrantTokenSet(t)
+	if tokenSet == nil {
+		return
+	}
+
+	for _, token := range []string{
+		tokenSet.AccessToken, tokenSet.RefreshToken,
+	} {
+		introspection := introspect(t, token)
+		if assert.NotNil(t, introspection) {
+			assert.True(t, introspection.Active)
+			assert.Equal(t, os.Getenv("IAM_TEST_CLIENT_ID"), introspection.ClientID)
+			assert.Equal(t, tokenSet.TerminalID, introspection.TerminalID)
+		}
+	}
+
+	introspection := introspect(t, "invalid")
+	if assert.NotNil(t, introspection) {
+		assert.False(t, introspection.Active)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tokenSet := passwordGrantTokenSet(t)
+	if tokenSet == nil {
+		return
+	}
+
+	// Invalid tokens are ignored. RFC 7009 § 2.2.
+	for _, token := range []string{
+		"invalid", tokenSet.RefreshToken,
+	} {
+		resp, err := postForm("/revoke", url.Values{
+			"token": {token},
+		}, true)
+		if !assert.Nil(t, err) {
+			return
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Revoking the refresh token revokes the terminal along with
+	// its sessions.
+	for _, token := range []string{
+		tokenSet.AccessToken, tokenSet.RefreshToken,
+	} {
+		introspection := introspect(t, token)
+		if assert.NotNil(t, introspection) {
+			assert.False(t, introspection.Active)
+		}
+	}
+}
+
+func TestDeviceCodePolling(t *testing.T) {
+	if os.Getenv("IAM_TEST_CLIENT_ID") == "" {
+		t.Skip("IAM_TEST_CLIENT_ID is required")
+	}
+
+	resp, err := postForm("/device_authorization", url.Values{}, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	var deviceAuth oauth2.DeviceAuthorizationResponse
+	errDec := json.NewDecoder(resp.Body).Decode(&deviceAuth)
+	resp.Body.Close()
+
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) || !assert.Nil(t, errDec) {
+		return
+	}
+	assert.NotEmpty(t, deviceAuth.DeviceCode)
+	assert.NotEmpty(t, deviceAuth.UserCode)
+
+	// The request has not been approved. The second poll comes before
+	// the interval has elapsed. RFC 8628 § 3.5.
+	for _, expectedError := range []string{
+		"authorization_pending", "slow_down",
+	} {
+		resp, err = postForm("/token", url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {deviceAuth.DeviceCode},
+		}, true)
+		if !assert.Nil(t, err) {
+			return
+		}
+		var errData errorResponse
+		errDec = json.NewDecoder(resp.Body).Decode(&errData)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Nil(t, errDec)
+		assert.Equal(t, expectedError, errData.Error)
+	}
+}
+
+// postForm posts the data to the endpoint at path. The client
+// credentials from IAM_TEST_CLIENT_ID and IAM_TEST_CLIENT_SECRET are
+// provided if withClient is true.
+func postForm(path string, data url.Values, withClient bool) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, baseURL+path,
+		strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if withClient {
+		req.SetBasicAuth(os.Getenv("IAM_TEST_CLIENT_ID"),
+			os.Getenv("IAM_TEST_CLIENT_SECRET"))
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// passwordGrantTokenSet obtains a token set for the user identified by
+// IAM_TEST_USERNAME and IAM_TEST_PASSWORD. The test is skipped if
+// the user or the client is not configured.
+func passwordGrantTokenSet(t *testing.T) *iam.OAuth2TokenResponse {
+	if os.Getenv("IAM_TEST_CLIENT_ID") == "" || os.Getenv("IAM_TEST_USERNAME") == "" {
+		t.Skip("IAM_TEST_CLIENT_ID and IAM_TEST_USERNAME are required")
+		return nil
+	}
+
+	resp, err := postForm("/token", url.Values{
+		"grant_type": {"password"},
+		"username":   {os.Getenv("IAM_TEST_USERNAME")},
+		"password":   {os.Getenv("IAM_TEST_PASSWORD")},
+	}, true)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var tokenSet iam.OAuth2TokenResponse
+	errDec := json.NewDecoder(resp.Body).Decode(&tokenSet)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) || !assert.Nil(t, errDec) {
+		return nil
+	}
+	return &tokenSet
+}
+
+// introspect returns the introspection of the token, or nil if
+// the request failed.
+func introspect(t *testing.T, token string) *iam.OAuth2TokenIntrospectionResponse {
+	resp, err := postForm("/introspect", url.Values{
+		"token": {token},
+	}, true)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var introspection iam.OAuth2TokenIntrospectionResponse
+	errDec := json.NewDecoder(resp.Body).Decode(&introspection)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) || !assert.Nil(t, errDec) {
+		return nil
+	}
+	return &introspection
+}
+
 type errorResponse struct {
 	Error string `json:"error"`
 }
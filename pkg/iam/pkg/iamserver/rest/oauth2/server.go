@@ -2,6 +2,8 @@ package oauth2
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
 	restfulopenapi "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
@@ -12,6 +14,7 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/logging"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/sec"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
 )
 
 var (
@@ -23,6 +26,18 @@ var (
 type ServerConfig struct {
 	ServePath string
 	SignInURL string
+
+	// IssuerURL is the absolute URL of the REST API base as seen by
+	// the clients. It's used as the OpenID Connect issuer identifier
+	// and as the base of the URLs in the discovery document. If it's
+	// empty or not an absolute URL, OpenID Connect will be disabled.
+	IssuerURL string
+
+	// DeviceVerificationURL is the URL of the page where end-users enter
+	// the user code of a device authorization request. A relative URL
+	// will be resolved against IssuerURL. If it's empty, the device
+	// authorization grant will be disabled. RFC 8628.
+	DeviceVerificationURL string
 }
 
 // New instantiates an Server.
@@ -33,10 +48,38 @@ func NewServer(
 	if !iamServerCore.JWTKeyChain().CanSign() {
 		return nil, apperrs.NewConfigurationMsg("JWT key chain is required")
 	}
+
+	issuerURL := strings.TrimRight(config.IssuerURL, "/")
+	if issuerURL != "" {
+		// OpenID Connect Discovery 1.0 § 3
+		u, err := url.Parse(issuerURL)
+		if err != nil || !u.IsAbs() || u.Host == "" ||
+			u.RawQuery != "" || u.Fragment != "" {
+			log.Warn().Err(err).Str("issuer_url", issuerURL).
+				Msg("Issuer URL must be an absolute URL without query " +
+					"and fragment. OpenID Connect is disabled.")
+			issuerURL = ""
+		}
+	}
+
+	deviceVerificationURL := config.DeviceVerificationURL
+	if deviceVerificationURL != "" {
+		u, err := url.Parse(deviceVerificationURL)
+		if err != nil {
+			return nil, apperrs.NewConfigurationMsg("device verification URL is invalid")
+		}
+		if !u.IsAbs() && issuerURL != "" {
+			baseURL, _ := url.Parse(issuerURL)
+			deviceVerificationURL = baseURL.ResolveReference(u).String()
+		}
+	}
+
 	return &Server{
 		iamserver.RESTServiceServerWith(iamServerCore),
 		config.ServePath,
 		config.SignInURL,
+		issuerURL,
+		deviceVerificationURL,
 	}, nil
 }
 
@@ -45,6 +88,15 @@ type Server struct {
 	serverCore *iamserver.RESTServiceServerBase
 	basePath   string
 	signInURL  string
+	issuerURL  string
+
+	deviceVerificationURL string
+}
+
+// IsOpenIDConnectEnabled returns true if the server is able to issue
+// ID Tokens and to serve the discovery document.
+func (restSrv *Server) IsOpenIDConnectEnabled() bool {
+	return restSrv.issuerURL != ""
 }
 
 func (restSrv *Server) jwtKeyChain() *iam.JWTKeyChain {
@@ -89,6 +141,21 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 			QueryParameter(
 				"state", "An opaque value used by the client to "+
 					"maintain state between the request and callback.")).
+		Param(restWS.
+			QueryParameter(
+				"code_challenge", "PKCE code challenge. Required for "+
+					"public clients. RFC 7636 § 4.3")).
+		Param(restWS.
+			QueryParameter(
+				"code_challenge_method", "Either `plain` (default) or `S256`")).
+		Param(restWS.
+			QueryParameter(
+				"scope", "Space-delimited scope values. Include `openid` "+
+					"to obtain an ID Token")).
+		Param(restWS.
+			QueryParameter(
+				"nonce", "OpenID Connect nonce. The value will be "+
+					"included in the ID Token")).
 		Returns(http.StatusFound, "Success", nil))
 
 	restWS.Route(restWS.
@@ -122,6 +189,19 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 			FormParameter(
 				"state", "An opaque value used by the client to "+
 					"maintain state between the request and callback.")).
+		Param(restWS.
+			FormParameter(
+				"code_challenge", "PKCE code challenge. Required for "+
+					"public clients. RFC 7636 § 4.3")).
+		Param(restWS.
+			FormParameter(
+				"code_challenge_method", "Either `plain` (default) or `S256`")).
+		Param(restWS.
+			FormParameter(
+				"scope", "Space-delimited scope values")).
+		Param(restWS.
+			FormParameter(
+				"nonce", "OpenID Connect nonce")).
 		Returns(
 			http.StatusOK,
 			"Success",
@@ -159,7 +239,9 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 			FormParameter(
 				"grant_type",
 				"Supported grant types: `password`, "+
-					"`authorization_code`, `client_credentials`").
+					"`authorization_code`, `client_credentials`, "+
+					"`refresh_token`, "+
+					"`urn:ietf:params:oauth:grant-type:device_code`").
 			Required(true)).
 		Param(restWS.
 			FormParameter(
@@ -170,13 +252,187 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 		Param(restWS.
 			FormParameter(
 				"code", "Required for `authorization_code` grant type")).
+		Param(restWS.
+			FormParameter(
+				"code_verifier", "PKCE code verifier for `authorization_code` "+
+					"grant type. RFC 7636 § 4.5")).
+		Param(restWS.
+			FormParameter(
+				"refresh_token", "Required for `refresh_token` grant type")).
+		Param(restWS.
+			FormParameter(
+				"scope", "For use with `password` grant type. Include "+
+					"`openid` to obtain an ID Token")).
+		Param(restWS.
+			FormParameter(
+				"device_code", "Required for "+
+					"`urn:ietf:params:oauth:grant-type:device_code` grant type")).
 		Returns(http.StatusOK, "Authorization successful", iam.OAuth2TokenResponse{}).
 		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", oauth2.ErrorResponse{}).
 		Returns(http.StatusUnauthorized, "Client authorization check failure", oauth2.ErrorResponse{}))
 
+	restWS.Route(restWS.
+		POST("/introspect").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.postIntrospect).
+		Doc("OAuth 2.0 token introspection endpoint").
+		Notes(
+			"The introspection endpoint is used by resource servers to "+
+				"query the state of an access token or a refresh token. "+
+				"Tokens which are invalid, expired or revoked are reported "+
+				"as inactive. RFC 7662 § 2.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"token", "The string value of the token").
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"token_type_hint", "Either `access_token` or `refresh_token`")).
+		Returns(http.StatusOK, "Introspection successful", iam.OAuth2TokenIntrospectionResponse{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", oauth2.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", oauth2.ErrorResponse{}))
+
+	restWS.Route(restWS.
+		POST("/revoke").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.postRevoke).
+		Doc("OAuth 2.0 token revocation endpoint").
+		Notes(
+			"The revocation endpoint is used by clients to notify the "+
+				"server that a token is no longer needed. Revoking an "+
+				"access token ends its session while revoking a refresh "+
+				"token signs out the terminal it was issued for. "+
+				"RFC 7009 § 2.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"token", "The token that the client wants to get revoked").
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"token_type_hint", "Either `access_token` or `refresh_token`")).
+		Returns(http.StatusOK, "The token has been revoked or is invalid", nil).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", oauth2.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", oauth2.ErrorResponse{}))
+
+	if restSrv.deviceVerificationURL != "" {
+		restSrv.addDeviceAuthorizationRoutes(restWS, tags)
+	}
+	if restSrv.serverCore.IsWebAuthnEnabled() {
+		restSrv.addWebAuthnRoutes(restWS, tags)
+	}
+
 	return restWS
 }
 
+func (restSrv *Server) addWebAuthnRoutes(
+	restWS *restful.WebService, tags []string,
+) {
+	restWS.Route(restWS.
+		POST("/webauthn_assertion_options").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.postWebAuthnAssertionOptions).
+		Doc("Passkey sign-in options").
+		Notes(
+			"This endpoint is not defined in the standard.\n\nThe response "+
+				"is the publicKey options to be passed to "+
+				"navigator.credentials.get. The resulting credential is "+
+				"exchanged for tokens at the token endpoint with the "+
+				"`"+oauth2.GrantTypeWebAuthn.String()+"` grant type and "+
+				"the credential in the `credential` parameter.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Returns(http.StatusOK, "Success", webauthn.CredentialRequestOptions{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", oauth2.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", oauth2.ErrorResponse{}))
+}
+
+func (restSrv *Server) addDeviceAuthorizationRoutes(
+	restWS *restful.WebService, tags []string,
+) {
+	restWS.Route(restWS.
+		POST("/device_authorization").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.postDeviceAuthorization).
+		Doc("OAuth 2.0 device authorization endpoint").
+		Notes(
+			"The device authorization endpoint is used by devices which "+
+				"lack a browser or are input-constrained to obtain a user "+
+				"code to be entered by the end-user on another device, and "+
+				"a device code to poll the token endpoint with. "+
+				"RFC 8628 § 3.1.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"scope", "Space-delimited scope values")).
+		Returns(http.StatusOK, "Success", oauth2.DeviceAuthorizationResponse{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", oauth2.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", oauth2.ErrorResponse{}))
+
+	restWS.Route(restWS.
+		GET("/device").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.getDevice).
+		Doc("Device authorization request details").
+		Notes(
+			"This endpoint is not defined in the standard.\n\nThis endpoint "+
+				"is used by the web front-end to show the details of a "+
+				"device authorization request to the end-user who entered "+
+				"the user code.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.
+			QueryParameter(
+				"user_code", "The user code displayed by the device").
+			Required(true)).
+		Returns(http.StatusOK, "Success", iam.OAuth2DeviceGetResponse{}).
+		Returns(http.StatusNotFound, "The user code is invalid or has expired", nil))
+
+	restWS.Route(restWS.
+		POST("/device").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.postDevice).
+		Doc("Device authorization decision endpoint").
+		Notes(
+			"This endpoint is not defined in the standard.\n\nThis endpoint "+
+				"is used by the web front-end when the end-user approved or "+
+				"denied a device authorization request. RFC 8628 § 3.3.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"user_code", "The user code displayed by the device").
+			Required(true)).
+		Param(restWS.
+			FormParameter(
+				"decision", "Either `approve` or `deny`").
+			Required(true)).
+		Returns(http.StatusNoContent, "The decision has been recorded", nil).
+		Returns(http.StatusNotFound, "The user code is invalid or has expired", nil))
+}
+
 // Note that these structs are not represententing the actual structure
 // of JWK Key and JWK Key Set as the structure is dynamic. For the actual
 // structure, refer to the RFC standards.
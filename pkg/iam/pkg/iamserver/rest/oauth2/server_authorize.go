@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/alloyzeus/go-azfl/errors"
 	"github.com/emicklei/go-restful/v3"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
@@ -16,9 +17,6 @@ import (
 )
 
 func (restSrv *Server) getAuthorize(req *restful.Request, resp *restful.Response) {
-	//TODO: if authorization context is valid, and the application has been
-	// previously authorized for the user, simply redirect back.
-
 	r := req.Request
 	w := resp
 
@@ -115,6 +113,16 @@ func (restSrv *Server) getAuthorize(req *restful.Request, resp *restful.Response
 		return
 	}
 
+	// There's nowhere to redirect to. RFC 6749 § 4.1.2.1
+	if val.RedirectURI == "" && len(app.Attributes.OAuth2RedirectURI) == 0 {
+		logReq(r).
+			Warn().Str("client_id", appID.AZIDText()).
+			Msg("redirect_uri missing and client has none registered")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
 	responseTypeArgVal, _ := req.BodyParameter("response_type")
 	responseType := oauth2.ResponseTypeFromString(responseTypeArgVal)
 	if responseType != oauth2.ResponseTypeCode {
@@ -126,9 +134,115 @@ func (restSrv *Server) getAuthorize(req *restful.Request, resp *restful.Response
 		return
 	}
 
-	//TODO:
-	// - check the scopes
-	// - ensure that the client is allowed to use this flow
+	// RFC 7636 § 4.4.1
+	if val.CodeChallenge == "" {
+		if app.IsOAuth2PKCERequired() {
+			logReq(r).
+				Warn().Str("client_id", appID.AZIDText()).
+				Msg("code_challenge required")
+			cbURL := val.RedirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+				Error:            oauth2.ErrorInvalidRequest,
+				ErrorDescription: "code challenge required",
+				State:            val.State,
+			})
+			http.Redirect(w, r, cbURL, http.StatusFound)
+			return
+		}
+	} else {
+		codeChallengeMethod := oauth2.CodeChallengeMethodFromString(val.CodeChallengeMethod)
+		if codeChallengeMethod == oauth2.CodeChallengeMethodUnknown ||
+			!oauth2.IsCodeVerifierValid(val.CodeChallenge) {
+			logReq(r).
+				Warn().Str("query.code_challenge_method", val.CodeChallengeMethod).
+				Msg("code_challenge invalid")
+			cbURL := val.RedirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+				Error: oauth2.ErrorInvalidRequest,
+				State: val.State,
+			})
+			http.Redirect(w, r, cbURL, http.StatusFound)
+			return
+		}
+	}
+
+	// RFC 6749 § 4.1.2.1
+	scope, err := restSrv.serverCore.
+		ResolveApplicationScope(appID, val.Scope)
+	if err != nil {
+		if err != iam.ErrScopeInvalid {
+			logReq(r).
+				Error().Err(err).Str("client_id", appID.AZIDText()).
+				Msg("ResolveApplicationScope")
+			cbURL := val.RedirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+				Error: oauth2.ErrorServerError,
+				State: val.State,
+			})
+			http.Redirect(w, r, cbURL, http.StatusFound)
+			return
+		}
+		logReq(r).
+			Warn().Str("client_id", appID.AZIDText()).Str("query.scope", val.Scope).
+			Msg("scope invalid")
+		cbURL := val.RedirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+			Error: oauth2.ErrorInvalidScope,
+			State: val.State,
+		})
+		http.Redirect(w, r, cbURL, http.StatusFound)
+		return
+	}
+
+	// The same check is applied when the user approves the request;
+	// it's also needed here as the approval might be skipped below.
+	if appIDNum := appID.IDNum(); !appIDNum.IsUserAgentAuthorizationConfidential() &&
+		!appIDNum.IsUserAgentAuthorizationPublic() {
+		logReq(r).
+			Warn().Str("client_id", appID.AZIDText()).
+			Msg("Requires user-agent client type")
+		cbURL := val.RedirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+			Error: oauth2.ErrorUnauthorizedClient,
+			State: val.State,
+		})
+		http.Redirect(w, r, cbURL, http.StatusFound)
+		return
+	}
+
+	// If the user has previously authorized the application for all
+	// the requested scopes, there's no need to prompt the user again.
+	if reqCtx, err := restSrv.RESTCallInputContext(r); err == nil &&
+		reqCtx.Authorization().IsUserSubject() {
+		consentInfo, err := restSrv.serverCore.
+			GetUserOAuth2Consent(reqCtx, appID)
+		if err != nil {
+			logCtx(reqCtx).
+				Error().Err(err).Str("client_id", appID.AZIDText()).
+				Msg("GetUserOAuth2Consent")
+		} else if consentInfo != nil && consentInfo.CoversScope(scope) {
+			redirectURI := val.RedirectURI
+			if redirectURI == "" {
+				redirectURI = app.Attributes.OAuth2RedirectURI[0]
+			}
+			code, err := restSrv.issueAuthorizationCode(reqCtx, appID,
+				val.CodeChallenge,
+				oauth2.CodeChallengeMethodFromString(val.CodeChallengeMethod),
+				scope, val.Nonce)
+			if err != nil {
+				logCtx(reqCtx).
+					Error().Err(err).Str("client_id", appID.AZIDText()).
+					Msg("issueAuthorizationCode")
+				cbURL := redirectURI + "?" + oauth2.MustQueryString(oauth2.ErrorResponse{
+					Error: oauth2.ErrorServerError,
+					State: val.State,
+				})
+				http.Redirect(w, r, cbURL, http.StatusFound)
+				return
+			}
+			cbURL := redirectURI + "?" + oauth2.MustQueryString(oauth2.AuthorizationResponse{
+				Code:  code,
+				State: val.State,
+			})
+			http.Redirect(w, r, cbURL, http.StatusFound)
+			return
+		}
+	}
 
 	targetURL := restSrv.signInURL + "?" + inQuery.Encode()
 	http.Redirect(w, r, targetURL, http.StatusFound)
@@ -194,10 +308,25 @@ func (restSrv *Server) postAuthorize(req *restful.Request, resp *restful.Respons
 			http.StatusBadRequest)
 		return
 	}
-	if !appID.IDNum().IsUserAgentAuthorizationConfidential() {
+	if appIDNum := appID.IDNum(); !appIDNum.IsUserAgentAuthorizationConfidential() &&
+		!appIDNum.IsUserAgentAuthorizationPublic() {
 		logCtx(reqCtx).
 			Warn().Str("client_id", appID.AZIDText()).
-			Msg("Requires ua-confidential client type")
+			Msg("Requires user-agent client type")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	// Public clients are required to use PKCE. It will be enforced by
+	// the core when registering the terminal.
+	codeChallenge, _ := req.BodyParameter("code_challenge")
+	codeChallengeMethodArgVal, _ := req.BodyParameter("code_challenge_method")
+	codeChallengeMethod := oauth2.CodeChallengeMethodFromString(codeChallengeMethodArgVal)
+	if codeChallenge != "" && codeChallengeMethod == oauth2.CodeChallengeMethodUnknown {
+		logCtx(reqCtx).
+			Warn().Str("form.code_challenge_method", codeChallengeMethodArgVal).
+			Msg("Unsupported")
 		rest.RespondTo(resp).EmptyError(
 			http.StatusBadRequest)
 		return
@@ -214,6 +343,14 @@ func (restSrv *Server) postAuthorize(req *restful.Request, resp *restful.Respons
 	}
 
 	if redirectURIStr == "" {
+		if len(app.Attributes.OAuth2RedirectURI) == 0 {
+			logCtx(reqCtx).
+				Warn().Str("client_id", appID.AZIDText()).
+				Msg("redirect_uri missing and client has none registered")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusBadRequest)
+			return
+		}
 		redirectURIStr = app.Attributes.OAuth2RedirectURI[0]
 	}
 	redirectURI, err := url.Parse(redirectURIStr)
@@ -222,26 +359,55 @@ func (restSrv *Server) postAuthorize(req *restful.Request, resp *restful.Respons
 	}
 
 	state, _ := req.BodyParameter("state")
-	termDisplayName := ""
-	var termID iam.TerminalID
+	scopeArgVal, _ := req.BodyParameter("scope")
+	scope, err := restSrv.serverCore.
+		ResolveApplicationScope(appID, scopeArgVal)
+	if err != nil {
+		if err == iam.ErrScopeInvalid {
+			logCtx(reqCtx).
+				Warn().Str("client_id", appID.AZIDText()).Str("form.scope", scopeArgVal).
+				Msg("ResolveApplicationScope")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusBadRequest)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).Str("client_id", appID.AZIDText()).
+			Msg("ResolveApplicationScope")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	// Will be used to issue the ID Token when the code is exchanged.
+	nonce, _ := req.BodyParameter("nonce")
 
-	regOutCtx, regOutData := restSrv.serverCore.
-		RegisterTerminal(reqCtx,
-			iamserver.TerminalRegistrationInputData{
-				ApplicationID:    appID,
-				UserID:           ctxAuth.UserID(),
-				DisplayName:      termDisplayName,
-				VerificationType: iam.TerminalVerificationResourceTypeOAuthAuthorizationCode,
-				VerificationID:   0,
-			})
-	if err := regOutCtx.Err; err != nil {
+	code, err := restSrv.issueAuthorizationCode(reqCtx, appID,
+		codeChallenge, codeChallengeMethod, scope, nonce)
+	if err != nil {
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).Str("client_id", appID.AZIDText()).
+				Msg("issueAuthorizationCode")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusBadRequest)
+			return
+		}
 		panic(err)
 	}
 
-	termID = regOutData.TerminalID
+	err = restSrv.serverCore.
+		GrantUserOAuth2Consent(reqCtx, appID, scope)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).Str("client_id", appID.AZIDText()).
+			Msg("GrantUserOAuth2Consent")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
 
 	redirectURI.RawQuery = oauth2.MustQueryString(oauth2.AuthorizationResponse{
-		Code:  termID.AZIDText(),
+		Code:  code,
 		State: state,
 	})
 
@@ -250,3 +416,38 @@ func (restSrv *Server) postAuthorize(req *restful.Request, resp *restful.Respons
 			RedirectURI: redirectURI.String(),
 		})
 }
+
+// issueAuthorizationCode registers a terminal for the user in the context
+// and returns the authorization code which the application will exchange
+// for the terminal's credentials.
+func (restSrv *Server) issueAuthorizationCode(
+	reqCtx *iam.RESTCallInputContext,
+	appID iam.ApplicationID,
+	codeChallenge string,
+	codeChallengeMethod oauth2.CodeChallengeMethod,
+	scope string,
+	nonce string,
+) (code string, err error) {
+	termDisplayName := ""
+
+	regOutCtx, regOutData := restSrv.serverCore.
+		RegisterTerminal(reqCtx,
+			iamserver.TerminalRegistrationInputData{
+				ApplicationID:    appID,
+				UserID:           reqCtx.Authorization().UserID(),
+				DisplayName:      termDisplayName,
+				VerificationType: iam.TerminalVerificationResourceTypeOAuthAuthorizationCode,
+				VerificationID:   0,
+
+				OAuth2CodeChallenge:       codeChallenge,
+				OAuth2CodeChallengeMethod: codeChallengeMethod,
+
+				OAuth2Scope: scope,
+				OIDCNonce:   nonce,
+			})
+	if err := regOutCtx.Err; err != nil {
+		return "", err
+	}
+
+	return regOutData.TerminalID.AZIDText(), nil
+}
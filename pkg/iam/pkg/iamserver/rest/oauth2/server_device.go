@@ -0,0 +1,151 @@
+//
+
+package oauth2
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// getDevice is used by the web front-end to show the details of the device
+// authorization request to the end-user before they approve it.
+func (restSrv *Server) getDevice(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	ctxAuth := reqCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("User context required")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	userCode := req.QueryParameter("user_code")
+	authzInfo, err := restSrv.serverCore.
+		GetOAuth2DeviceAuthorizationByUserCode(reqCtx, userCode)
+	if err != nil {
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("GetOAuth2DeviceAuthorizationByUserCode")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusNotFound)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("GetOAuth2DeviceAuthorizationByUserCode")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
+	app, err := restSrv.serverCore.ApplicationByID(authzInfo.ApplicationID)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).Str("client_id", authzInfo.ApplicationID.AZIDText()).
+			Msg("ApplicationByID")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	var appDisplayName string
+	if app != nil {
+		appDisplayName = app.Attributes.DisplayName
+	}
+
+	ctxTime := reqCtx.CallInputMetadata().ReceiveTime
+
+	rest.RespondTo(resp).Success(
+		&iam.OAuth2DeviceGetResponse{
+			ClientID:          authzInfo.ApplicationID.AZIDText(),
+			ClientDisplayName: appDisplayName,
+			Scope:             authzInfo.Scope,
+			ExpiresIn:         int64(authzInfo.ExpiryTime.Sub(ctxTime) / time.Second),
+		})
+}
+
+// postDevice is used by the web front-end when the end-user has made
+// their decision on a device authorization request. RFC 8628 § 3.3.
+func (restSrv *Server) postDevice(req *restful.Request, resp *restful.Response) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	ctxAuth := reqCtx.Authorization()
+	if !ctxAuth.IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("User context required")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	userCode, _ := req.BodyParameter("user_code")
+
+	var approved bool
+	decisionArgVal, _ := req.BodyParameter("decision")
+	switch decisionArgVal {
+	case "approve":
+		approved = true
+	case "deny":
+		approved = false
+	default:
+		logCtx(reqCtx).
+			Warn().Str("form.decision", decisionArgVal).
+			Msg("Unsupported")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	_, err = restSrv.serverCore.
+		DecideOAuth2DeviceAuthorization(reqCtx, userCode, approved)
+	if err != nil {
+		if err == iam.ErrDeviceUserCodeInvalid {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("DecideOAuth2DeviceAuthorization")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusNotFound)
+			return
+		}
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("DecideOAuth2DeviceAuthorization")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusBadRequest)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("DecideOAuth2DeviceAuthorization")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+//
+
+package oauth2
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RFC 8628 § 3.1
+func (restSrv *Server) postDeviceAuthorization(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		// RFC 8628 § 3.2
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	// The device acts on behalf of an end-user
+	if !reqApp.ID.IDNum().IsUserAgent() {
+		logReq(req.Request).
+			Warn().Str("client_id", reqApp.ID.AZIDText()).
+			Msg("Client is not allowed to use device authorization")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorUnauthorizedClient)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	scope := req.Request.FormValue("scope")
+
+	startOutData, err := restSrv.serverCore.
+		StartOAuth2DeviceAuthorization(reqCtx, reqApp.ID, scope)
+	if err != nil {
+		if err == iam.ErrScopeInvalid {
+			logCtx(reqCtx).
+				Warn().Str("client_id", reqApp.ID.AZIDText()).Str("form.scope", scope).
+				Msg("StartOAuth2DeviceAuthorization")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidScope)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).Str("client_id", reqApp.ID.AZIDText()).
+			Msg("StartOAuth2DeviceAuthorization")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	ctxTime := reqCtx.CallInputMetadata().ReceiveTime
+
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Pragma", "no-cache")
+	resp.WriteJson(
+		&oauth2.DeviceAuthorizationResponse{
+			DeviceCode:      startOutData.DeviceCode,
+			UserCode:        startOutData.UserCode,
+			VerificationURI: restSrv.deviceVerificationURL,
+			VerificationURIComplete: restSrv.deviceVerificationURL + "?" +
+				url.Values{"user_code": {startOutData.UserCode}}.Encode(),
+			ExpiresIn: int64(startOutData.ExpiryTime.Sub(ctxTime) / time.Second),
+			Interval:  int64(startOutData.PollingInterval / time.Second),
+		},
+		restful.MIME_JSON)
+}
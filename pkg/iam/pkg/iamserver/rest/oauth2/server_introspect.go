@@ -0,0 +1,78 @@
+//
+
+package oauth2
+
+import (
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RFC 7662 § 2
+func (restSrv *Server) postIntrospect(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		// RFC 7662 § 2.1
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	// Introspection is meant for resource servers, which are expected
+	// to be able to secure their credentials.
+	if appIDNum := reqApp.ID.IDNum(); !appIDNum.IsService() && !appIDNum.IsUserAgentAuthorizationConfidential() {
+		logReq(req.Request).
+			Warn().Str("client_id", reqApp.ID.AZIDText()).
+			Msg("Client is not allowed to introspect tokens")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorUnauthorizedClient)
+		return
+	}
+
+	token := req.Request.FormValue("token")
+	if token == "" {
+		logReq(req.Request).
+			Warn().Msg("Empty token")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	// The token_type_hint is not used as we are able to determine
+	// the type of the token by ourselves.
+	introspection, err := restSrv.serverCore.
+		IntrospectTokenJWT(reqCtx, reqApp.ID, token)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("IntrospectTokenJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Pragma", "no-cache")
+	resp.WriteJson(introspection, restful.MIME_JSON)
+}
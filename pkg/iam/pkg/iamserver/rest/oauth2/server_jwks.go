@@ -6,8 +6,13 @@ import (
 	"github.com/emicklei/go-restful/v3"
 )
 
+// The consumers refresh their copies of the key set at this interval.
+// The upcoming keys are published ahead of their activation so that
+// the consumers have them by the time they are used.
+const jwksCacheControl = "public, max-age=300"
+
 func (restSrv *Server) getJWKS(req *restful.Request, resp *restful.Response) {
 	jwks := restSrv.jwtKeyChain().JWKSet()
-	//TODO: caching directive
+	resp.Header().Set("Cache-Control", jwksCacheControl)
 	resp.WriteJson(jwks, restful.MIME_JSON)
 }
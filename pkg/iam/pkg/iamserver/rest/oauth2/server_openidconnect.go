@@ -0,0 +1,177 @@
+//
+
+package oauth2
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	restfulopenapi "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	oidc "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/openid/connect"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+// OpenIDConnectRestfulWebService is used to obtain restful WebService
+// which serves the discovery document. The document is served at
+// /.well-known/openid-configuration and at
+// /.well-known/oauth-authorization-server relative to the issuer URL,
+// which corresponds to the parent path of the server's ServePath.
+//
+// It returns nil if OpenID Connect is disabled.
+func (restSrv *Server) OpenIDConnectRestfulWebService() *restful.WebService {
+	if !restSrv.IsOpenIDConnectEnabled() {
+		return nil
+	}
+
+	restWS := new(restful.WebService)
+	restWS.
+		Path(path.Dir(restSrv.basePath) + "/.well-known").
+		Produces(restful.MIME_JSON)
+
+	tags := []string{"iam.v1.oauth2"}
+
+	restWS.Route(restWS.
+		GET("/openid-configuration").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.getProviderMetadata).
+		Doc("OpenID Provider configuration").
+		Notes("The discovery document which describes the configuration "+
+			"of this OpenID provider. OpenID Connect Discovery 1.0 § 4.").
+		Returns(http.StatusOK, "OK", oidc.ProviderMetadata{}))
+
+	restWS.Route(restWS.
+		GET("/oauth-authorization-server").
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		To(restSrv.getProviderMetadata).
+		Doc("OAuth 2.0 authorization server metadata").
+		Notes("The metadata which describes the configuration of this "+
+			"authorization server. RFC 8414 § 3.").
+		Returns(http.StatusOK, "OK", oidc.ProviderMetadata{}))
+
+	return restWS
+}
+
+func (restSrv *Server) getProviderMetadata(req *restful.Request, resp *restful.Response) {
+	//TODO: caching directive
+	resp.WriteJson(restSrv.providerMetadata(), restful.MIME_JSON)
+}
+
+func (restSrv *Server) providerMetadata() *oidc.ProviderMetadata {
+	issuerURL := restSrv.issuerURL
+	endpointBaseURL := issuerURL + "/" + path.Base(restSrv.basePath)
+
+	// All the published keys are included, not only the current signing
+	// key, so that the clients are prepared for the tokens signed with
+	// the upcoming keys and still accept those signed with the retired
+	// ones during a rotation to another algorithm.
+	var signingAlgs []string
+	signingAlgSet := map[string]bool{}
+	if alg := restSrv.jwtKeyChain().SignatureAlgorithm(); alg != "" {
+		signingAlgs = append(signingAlgs, string(alg))
+		signingAlgSet[string(alg)] = true
+	}
+	var otherSigningAlgs []string
+	for _, key := range restSrv.jwtKeyChain().JWKSetAt(time.Now()).Keys {
+		if key.Algorithm == "" || signingAlgSet[key.Algorithm] {
+			continue
+		}
+		signingAlgSet[key.Algorithm] = true
+		otherSigningAlgs = append(otherSigningAlgs, key.Algorithm)
+	}
+	sort.Strings(otherSigningAlgs)
+	signingAlgs = append(signingAlgs, otherSigningAlgs...)
+
+	grantTypes := []string{
+		oauth2.GrantTypeAuthorizationCode.String(),
+		oauth2.GrantTypeClientCredentials.String(),
+		oauth2.GrantTypePassword.String(),
+		oauth2.GrantTypeRefreshToken.String(),
+		oauth2.GrantTypeMFAOTP.String(),
+	}
+	var deviceAuthorizationEndpoint string
+	if restSrv.deviceVerificationURL != "" {
+		deviceAuthorizationEndpoint = endpointBaseURL + "/device_authorization"
+		grantTypes = append(grantTypes, oauth2.GrantTypeDeviceCode.String())
+	}
+	if restSrv.serverCore.IsWebAuthnEnabled() {
+		grantTypes = append(grantTypes, oauth2.GrantTypeWebAuthn.String())
+	}
+
+	return &oidc.ProviderMetadata{
+		Issuer:                issuerURL,
+		AuthorizationEndpoint: endpointBaseURL + "/authorize",
+		TokenEndpoint:         endpointBaseURL + "/token",
+		// Served by the user service
+		UserInfoEndpoint:      issuerURL + "/users/me/openidconnect-userinfo",
+		JWKSURI:               endpointBaseURL + "/jwks",
+		RevocationEndpoint:    endpointBaseURL + "/revoke",
+		IntrospectionEndpoint: endpointBaseURL + "/introspect",
+
+		DeviceAuthorizationEndpoint: deviceAuthorizationEndpoint,
+
+		ScopesSupported: []string{oidc.ScopeOpenID},
+		ResponseTypesSupported: []string{
+			oauth2.ResponseTypeCode.String(),
+		},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  signingAlgs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time",
+			"nonce", "azp", "at_hash",
+			"name", "email", "email_verified",
+			"phone_number", "phone_number_verified",
+		},
+		CodeChallengeMethodsSupported: []string{
+			oauth2.CodeChallengeMethodPlain.String(),
+			oauth2.CodeChallengeMethodS256.String(),
+		},
+	}
+}
+
+// generateTerminalIDToken generates an ID Token for a terminal which was
+// registered through an authorization request, e.g., the authorization
+// code flow. The ID Token will only be generated if OpenID Connect is
+// enabled and the request included the openid scope. Otherwise, it
+// returns an empty string.
+func (restSrv *Server) generateTerminalIDToken(
+	reqCtx *iam.RESTCallInputContext,
+	termID iam.TerminalID,
+	userID iam.UserID,
+	accessToken string,
+) (idToken string, err error) {
+	if !restSrv.IsOpenIDConnectEnabled() {
+		return "", nil
+	}
+
+	authzData, err := restSrv.serverCore.
+		GetTerminalOAuth2AuthorizationData(termID)
+	if err != nil {
+		return "", errors.Wrap("GetTerminalOAuth2AuthorizationData", err)
+	}
+	if authzData == nil || !oauth2.ScopeContains(authzData.Scope, oidc.ScopeOpenID) {
+		return "", nil
+	}
+
+	idToken, err = restSrv.serverCore.
+		GenerateIDTokenJWT(reqCtx, iamserver.IDTokenInputData{
+			Issuer:      restSrv.issuerURL,
+			TerminalID:  termID,
+			UserID:      userID,
+			Nonce:       authzData.OIDCNonce,
+			AuthTime:    authzData.AuthorizationTime,
+			AccessToken: accessToken,
+		})
+	if err != nil {
+		return "", errors.Wrap("GenerateIDTokenJWT", err)
+	}
+	return idToken, nil
+}
@@ -0,0 +1,76 @@
+//
+
+package oauth2
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RFC 7009 § 2
+func (restSrv *Server) postRevoke(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		// RFC 7009 § 2.1
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	token := req.Request.FormValue("token")
+	if token == "" {
+		logReq(req.Request).
+			Warn().Msg("Empty token")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	// The token_type_hint is not used as we are able to determine
+	// the type of the token by ourselves.
+	_, err = restSrv.serverCore.
+		RevokeTokenJWT(reqCtx, reqApp.ID, token)
+	if err != nil {
+		if err == iam.ErrOperationNotAllowed {
+			logCtx(reqCtx).
+				Warn().Str("client_id", reqApp.ID.AZIDText()).
+				Msg("Token was issued to other client")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorUnauthorizedClient)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("RevokeTokenJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	// RFC 7009 § 2.2: invalid tokens do not cause an error response.
+	resp.WriteHeader(http.StatusOK)
+}
@@ -3,10 +3,15 @@
 package oauth2
 
 import (
+	"encoding/json"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/emicklei/go-restful/v3"
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 )
 
 func (restSrv *Server) postToken(req *restful.Request, resp *restful.Response) {
@@ -47,16 +52,23 @@ func (restSrv *Server) postToken(req *restful.Request, resp *restful.Response) {
 		restSrv.handleTokenRequestByPasswordGrant(req, resp)
 		return
 	case oauth2.GrantTypeRefreshToken:
-		//TODO: our refresh tokens are JWT which claims structure can be found
-		// in iam.RefreshTokenClaims. It contains terminal ID (and optionally
-		// terminal secret). We load it and its related data and then
-		// issue another access token if the previous token is about to
-		// expire (e.g., < 10 min from expiration), otherwise, we could reuse
-		// the previously issued access token (check the authorization ID).
-		logReq(req.Request).
-			Warn().Msgf("Unsupported grant_type: %v", grantType)
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorUnsupportedGrantType)
+		restSrv.handleTokenRequestByRefreshTokenGrant(req, resp)
+		return
+	case oauth2.GrantTypeMFAOTP:
+		restSrv.handleTokenRequestByMFAOTPGrant(req, resp)
+		return
+	case oauth2.GrantTypeWebAuthn:
+		restSrv.handleTokenRequestByWebAuthnGrant(req, resp)
+		return
+	case oauth2.GrantTypeDeviceCode:
+		if restSrv.deviceVerificationURL == "" {
+			logReq(req.Request).
+				Warn().Msg("Device authorization is disabled")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorUnsupportedGrantType)
+			return
+		}
+		restSrv.handleTokenRequestByDeviceCodeGrant(req, resp)
 		return
 	default:
 		logReq(req.Request).
@@ -66,3 +78,42 @@ func (restSrv *Server) postToken(req *restful.Request, resp *restful.Response) {
 		return
 	}
 }
+
+// respondRateLimitExceeded responds to requests which have been rejected
+// by the rate limits.
+func respondRateLimitExceeded(
+	resp *restful.Response,
+	exceededErr *ratelimit.ExceededError,
+) {
+	resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+	oauth2.RespondTo(resp).ErrorWithHTTPStatusCode(oauth2.ErrorResponse{
+		Error:            oauth2.ErrorInvalidRequest,
+		ErrorDescription: "too many attempts",
+	}, http.StatusTooManyRequests)
+}
+
+// respondMFARequired responds to requests of which the user has enabled
+// a second factor.
+func respondMFARequired(
+	resp *restful.Response,
+	mfaErr *iamserver.MFARequiredError,
+) {
+	expiresIn := int64(math.Ceil(time.Until(mfaErr.Expiry).Seconds()))
+	if expiresIn < 0 {
+		expiresIn = 0
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.WriteHeader(oauth2.ErrorMFARequired.HTTPStatusCode())
+	err := json.NewEncoder(resp).Encode(oauth2.MFARequiredErrorResponse{
+		ErrorResponse: oauth2.ErrorResponse{
+			Error:            oauth2.ErrorMFARequired,
+			ErrorDescription: "second factor required",
+		},
+		MFAToken:  mfaErr.MFAToken,
+		ExpiresIn: expiresIn,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
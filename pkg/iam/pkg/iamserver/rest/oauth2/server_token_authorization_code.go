@@ -10,6 +10,8 @@ import (
 
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 )
 
 func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
@@ -39,7 +41,8 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 	}
 
 	var termID iam.TerminalID
-	if strings.HasPrefix(authCode, "otp:") {
+	isOTP := strings.HasPrefix(authCode, "otp:")
+	if isOTP {
 		// Only for non-confidential user-agents
 		if appID := reqApp.ID; !appID.IDNum().IsUserAgentAuthorizationPublic() {
 			logReq(req.Request).
@@ -71,8 +74,10 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 		}
 		authCode = parts[2]
 	} else {
-		// Only for confidential user-agents
-		if appID := reqApp.ID; !appID.IDNum().IsUserAgentAuthorizationConfidential() {
+		// Only for user-agents. Public clients are required to use PKCE,
+		// which is enforced by the core.
+		if appIDNum := reqApp.ID.IDNum(); !appIDNum.IsUserAgentAuthorizationConfidential() &&
+			!appIDNum.IsUserAgentAuthorizationPublic() {
 			logReq(req.Request).
 				Warn().Str("client_id", reqApp.ID.AZIDText()).
 				Msg("Client is not allowed to use grant type 'authorization_code'")
@@ -90,7 +95,18 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 				oauth2.ErrorInvalidGrant)
 			return
 		}
-		authCode = ""
+		// RFC 6749 § 4.1.3
+		if !termID.Application().EqualsApplicationID(reqApp.ID) {
+			logReq(req.Request).
+				Warn().Str("client_id", reqApp.ID.AZIDText()).
+				Msg("Code was issued to other client")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		// For this flow, the code verifier takes the place of
+		// the verification code. RFC 7636 § 4.5.
+		authCode = req.Request.FormValue("code_verifier")
 	}
 
 	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
@@ -131,9 +147,32 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 		return
 	}
 
-	terminalSecret, userID, err := restSrv.serverCore.
-		ConfirmTerminalAuthorization(reqCtx, termID, authCode)
+	var terminalSecret string
+	var userID iam.UserID
+	if isOTP {
+		terminalSecret, userID, err = restSrv.serverCore.
+			ConfirmTerminalAuthorization(reqCtx, termID, authCode)
+	} else {
+		// Only the terminals registered through the authorization
+		// endpoint could be redeemed with this grant.
+		terminalSecret, userID, err = restSrv.serverCore.
+			ConfirmTerminalOAuth2AuthorizationCode(reqCtx, termID, authCode)
+	}
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorization")
+			respondRateLimitExceeded(resp, exceededErr)
+			return
+		}
+		if mfaErr, ok := err.(*iamserver.MFARequiredError); ok {
+			logCtx(reqCtx).
+				Info().Str("terminal", termID.AZIDText()).
+				Msg("Second factor required")
+			respondMFARequired(resp, mfaErr)
+			return
+		}
 		switch err {
 		case iam.ErrTerminalVerificationCodeExpired:
 			logCtx(reqCtx).
@@ -146,6 +185,7 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 				ErrorDescription: "expired"})
 			return
 		case iam.ErrAuthorizationCodeAlreadyClaimed,
+			iam.ErrAuthorizationCodeVerifierMismatch,
 			iam.ErrTerminalVerificationCodeMismatch:
 			logCtx(reqCtx).
 				Warn().Err(err).
@@ -181,6 +221,17 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 		return
 	}
 
+	idToken, err := restSrv.generateTerminalIDToken(
+		reqCtx, termID, userID, accessToken)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("generateTerminalIDToken")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
 	oauth2.RespondTo(resp).TokenCustom(
 		&iam.OAuth2TokenResponse{
 			TokenResponse: oauth2.TokenResponse{
@@ -191,5 +242,6 @@ func (restSrv *Server) handleTokenRequestByAuthorizationCodeGrant(
 			},
 			UserID:         userID.AZIDText(),
 			TerminalSecret: terminalSecret,
+			IDToken:        idToken,
 		})
 }
@@ -58,6 +58,26 @@ func (restSrv *Server) handleTokenRequestByClientCredentials(
 		return
 	}
 
+	scopeArgVal := req.Request.FormValue("scope")
+	scope, err := restSrv.serverCore.
+		ResolveApplicationScope(reqApp.ID, scopeArgVal)
+	if err != nil {
+		if err == iam.ErrScopeInvalid {
+			logCtx(reqCtx).
+				Warn().Str("form.scope", scopeArgVal).
+				Msg("ResolveApplicationScope")
+			oauth2.RespondTo(resp).
+				ErrorCode(oauth2.ErrorInvalidScope)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ResolveApplicationScope")
+		oauth2.RespondTo(resp).
+			ErrorCode(oauth2.ErrorServerError)
+		return
+	}
+
 	termDisplayName := ""
 
 	regOutCtx, regOutData := restSrv.serverCore.
@@ -68,6 +88,7 @@ func (restSrv *Server) handleTokenRequestByClientCredentials(
 				DisplayName:      termDisplayName,
 				VerificationType: iam.TerminalVerificationResourceTypeOAuthClientCredentials,
 				VerificationID:   0,
+				OAuth2Scope:      scope,
 			})
 	if err := regOutCtx.Err; err != nil {
 		logCtx(reqCtx).
@@ -0,0 +1,133 @@
+//
+
+package oauth2
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+)
+
+// RFC 8628 § 3.4
+func (restSrv *Server) handleTokenRequestByDeviceCodeGrant(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		// RFC 6749 § 5.2
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	deviceCode := req.Request.FormValue("device_code")
+	if deviceCode == "" {
+		logReq(req.Request).
+			Warn().Msg("Empty device_code")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	termID, userID, termSecret, err := restSrv.serverCore.
+		ExchangeOAuth2DeviceCode(reqCtx, reqApp.ID, deviceCode)
+	if err != nil {
+		// RFC 8628 § 3.5
+		switch err {
+		case iam.ErrDeviceAuthorizationPending:
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorAuthorizationPending)
+			return
+		case iam.ErrDeviceAuthorizationPollingTooFrequent:
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorSlowDown)
+			return
+		case iam.ErrDeviceAuthorizationDenied:
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorAccessDenied)
+			return
+		case iam.ErrDeviceCodeExpired:
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorExpiredToken)
+			return
+		}
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ExchangeOAuth2DeviceCode")
+			respondRateLimitExceeded(resp, exceededErr)
+			return
+		}
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ExchangeOAuth2DeviceCode")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ExchangeOAuth2DeviceCode")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	accessToken, refreshToken, err := restSrv.serverCore.
+		GenerateTokenSetJWT(reqCtx, termID, userID, termSecret)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("GenerateTokenSetJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	idToken, err := restSrv.generateTerminalIDToken(
+		reqCtx, termID, userID, accessToken)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("generateTerminalIDToken")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	oauth2.RespondTo(resp).TokenCustom(
+		&iam.OAuth2TokenResponse{
+			TokenResponse: oauth2.TokenResponse{
+				AccessToken:  accessToken,
+				TokenType:    oauth2.TokenTypeBearer,
+				ExpiresIn:    iam.AccessTokenTTLDefaultInSeconds,
+				RefreshToken: refreshToken,
+			},
+			UserID:         userID.AZIDText(),
+			TerminalID:     termID.AZIDText(),
+			TerminalSecret: termSecret,
+			IDToken:        idToken,
+		})
+}
@@ -0,0 +1,149 @@
+//
+
+package oauth2
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+)
+
+// handleTokenRequestByMFAOTPGrant completes the authorizations which have
+// been rejected with mfa_required. The request provides the mfa_token from
+// that response and either an otp, i.e., a TOTP code, or a recovery_code.
+func (restSrv *Server) handleTokenRequestByMFAOTPGrant(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if err != nil {
+		logReq(req.Request).
+			Warn().Err(err).
+			Msg("Client authentication")
+		// RFC 6749 § 5.2
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+	if reqApp == nil {
+		logReq(req.Request).
+			Warn().Msg("Application authentication is required")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorUnauthorizedClient)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Msg("Authorization context must not be valid")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	mfaToken := req.Request.FormValue("mfa_token")
+	code := req.Request.FormValue("otp")
+	if code == "" {
+		code = req.Request.FormValue("recovery_code")
+	}
+	if mfaToken == "" || code == "" {
+		logCtx(reqCtx).
+			Warn().Msg("Missing mfa_token, otp or recovery_code")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	termID, termSecret, userID, err := restSrv.serverCore.
+		ConfirmTerminalAuthorizationSecondFactor(reqCtx, reqApp, mfaToken, code)
+	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorizationSecondFactor")
+			respondRateLimitExceeded(resp, exceededErr)
+			return
+		}
+		switch err {
+		case iam.ErrMFATokenExpired:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorizationSecondFactor")
+			oauth2.RespondTo(resp).Error(oauth2.ErrorResponse{
+				Error:            oauth2.ErrorInvalidGrant,
+				ErrorDescription: "expired"})
+			return
+		case iam.ErrMFATokenInvalid,
+			iam.ErrMFACodeMismatch:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorizationSecondFactor")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmTerminalAuthorizationSecondFactor")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidRequest)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ConfirmTerminalAuthorizationSecondFactor")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	accessToken, refreshToken, err := restSrv.serverCore.
+		GenerateTokenSetJWT(reqCtx, termID, userID, termSecret)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("GenerateTokenSetJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	idToken, err := restSrv.generateTerminalIDToken(
+		reqCtx, termID, userID, accessToken)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("generateTerminalIDToken")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	oauth2.RespondTo(resp).TokenCustom(
+		&iam.OAuth2TokenResponse{
+			TokenResponse: oauth2.TokenResponse{
+				AccessToken:  accessToken,
+				TokenType:    oauth2.TokenTypeBearer,
+				ExpiresIn:    iam.AccessTokenTTLDefaultInSeconds,
+				RefreshToken: refreshToken,
+			},
+			UserID:         userID.AZIDText(),
+			TerminalID:     termID.AZIDText(),
+			TerminalSecret: termSecret,
+			IDToken:        idToken,
+		})
+}
@@ -3,13 +3,14 @@
 package oauth2
 
 import (
-	"strings"
-
 	"github.com/alloyzeus/go-azfl/errors"
 	"github.com/emicklei/go-restful/v3"
 
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	oidc "github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/openid/connect"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 )
 
 func (restSrv *Server) handleTokenRequestByPasswordGrant(
@@ -62,20 +63,48 @@ func (restSrv *Server) handleTokenRequestByPasswordGrant(
 	}
 	password := req.Request.FormValue("password")
 
-	//TODO: move this to core
-	// Username with scheme. The format is '<scheme>:<scheme-specific-identifier>'
-	if names := strings.SplitN(username, ":", 2); len(names) == 2 {
-		switch names[0] {
-		case "terminal":
-			restSrv.handleTokenRequestByPasswordGrantWithTerminalCreds(
-				reqCtx, resp, reqApp, names[1], password)
-			return
-		}
-	}
-
 	termID, termSecret, userID, err := restSrv.serverCore.
-		AuthorizeTerminalByUserIdentifierAndPassword(reqCtx, reqApp, "", username, password)
+		AuthorizeTerminalByUserIdentifierAndPassword(reqCtx, reqApp, "",
+			req.Request.FormValue("scope"), username, password)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logReq(req.Request).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByUserIdentifierAndPassword")
+			respondRateLimitExceeded(resp, exceededErr)
+			return
+		}
+		if mfaErr, ok := err.(*iamserver.MFARequiredError); ok {
+			logReq(req.Request).
+				Info().Str("username", username).
+				Msg("Second factor required")
+			respondMFARequired(resp, mfaErr)
+			return
+		}
+		if err == iam.ErrOperationNotAllowed {
+			logReq(req.Request).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByUserIdentifierAndPassword")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorUnauthorizedClient)
+			return
+		}
+		if err == iam.ErrTerminalCredentialsInvalid {
+			logReq(req.Request).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByUserIdentifierAndPassword")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		if err == iam.ErrScopeInvalid {
+			logReq(req.Request).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByUserIdentifierAndPassword")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidScope)
+			return
+		}
 		if _, ok := err.(errors.CallError); ok {
 			logReq(req.Request).
 				Warn().Err(err).
@@ -93,15 +122,19 @@ func (restSrv *Server) handleTokenRequestByPasswordGrant(
 		return
 	}
 
-	if userID.IsNotStaticallyValid() {
+	// The terminals of service applications are not associated to
+	// any user.
+	if termID.IsNotStaticallyValid() {
 		logReq(req.Request).
 			Warn().Str("username", username).
 			Msg("Authentication failed")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidGrant)
 		return
 	}
 
 	accessToken, refreshToken, err := restSrv.serverCore.
-		GenerateTokenSetJWT(reqCtx, termID, ctxAuth.UserID(), termSecret)
+		GenerateTokenSetJWT(reqCtx, termID, userID, termSecret)
 	if err != nil {
 		logCtx(reqCtx).
 			Error().Err(err).
@@ -111,6 +144,28 @@ func (restSrv *Server) handleTokenRequestByPasswordGrant(
 		return
 	}
 
+	var idToken string
+	if restSrv.IsOpenIDConnectEnabled() && userID.IsStaticallyValid() &&
+		oauth2.ScopeContains(req.Request.FormValue("scope"), oidc.ScopeOpenID) {
+		idToken, err = restSrv.serverCore.
+			GenerateIDTokenJWT(reqCtx, iamserver.IDTokenInputData{
+				Issuer:     restSrv.issuerURL,
+				TerminalID: termID,
+				UserID:     userID,
+				// The user has just been authenticated
+				AuthTime:    reqCtx.CallInputMetadata().ReceiveTime,
+				AccessToken: accessToken,
+			})
+		if err != nil {
+			logCtx(reqCtx).
+				Error().Err(err).
+				Msg("GenerateIDTokenJWT")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorServerError)
+			return
+		}
+	}
+
 	oauth2.RespondTo(resp).TokenCustom(
 		&iam.OAuth2TokenResponse{
 			TokenResponse: oauth2.TokenResponse{
@@ -122,96 +177,6 @@ func (restSrv *Server) handleTokenRequestByPasswordGrant(
 			UserID:         userID.AZIDText(),
 			TerminalID:     termID.AZIDText(),
 			TerminalSecret: termSecret,
-		})
-}
-
-func (restSrv *Server) handleTokenRequestByPasswordGrantWithTerminalCreds(
-	reqCtx *iam.RESTCallInputContext,
-	resp *restful.Response,
-	reqApp *iam.Application,
-	terminalIDStr string,
-	terminalSecret string,
-) {
-	termID, err := iam.TerminalIDFromAZIDText(terminalIDStr)
-	if err != nil {
-		logCtx(reqCtx).
-			Warn().Err(err).Str("terminalIDStr", terminalIDStr).
-			Msg("Unable to parse username as TerminalID")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorInvalidGrant)
-		return
-	}
-
-	if termID.IsNotStaticallyValid() {
-		logCtx(reqCtx).
-			Warn().Str("terminalIDStr", terminalIDStr).Str("terminalID", termID.AZIDText()).
-			Msg("Terminal ref is invalid")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorInvalidGrant)
-		return
-	}
-
-	appID := termID.Application()
-	if !appID.IDNum().IsService() {
-		logCtx(reqCtx).
-			Warn().Str("terminalID", termID.AZIDText()).
-			Msg("Application is not allowed to use grant type")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorUnauthorizedClient)
-		return
-	}
-
-	if !appID.EqualsApplicationID(reqApp.ID) {
-		logCtx(reqCtx).
-			Warn().Str("terminalID", termID.AZIDText()).Str("applicationRef", appID.AZIDText()).
-			Msg("Terminal credentials are that of other application")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorInvalidGrant)
-		return
-	}
-
-	authOK, userID, err := restSrv.serverCore.
-		AuthenticateTerminal(termID, terminalSecret)
-	if err != nil {
-		logCtx(reqCtx).
-			Error().Err(err).Str("terminalID", termID.AZIDText()).
-			Msg("AuthenticateTerminal")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorServerError)
-		return
-	}
-	if !authOK {
-		logCtx(reqCtx).
-			Warn().Str("terminalID", termID.AZIDText()).
-			Msg("Terminal authentication failed")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorInvalidGrant)
-		return
-	}
-
-	if userID.IsStaticallyValid() {
-		logCtx(reqCtx).
-			Warn().Str("terminalID", termID.AZIDText()).Str("userID", userID.AZIDText()).
-			Msg("Terminal must not be associated to any user")
-		oauth2.RespondTo(resp).ErrorCode(
-			oauth2.ErrorServerError)
-		return
-	}
-
-	accessToken, refreshToken, err := restSrv.serverCore.
-		GenerateTokenSetJWT(reqCtx, termID, userID, terminalSecret)
-	if err != nil {
-		panic(err)
-	}
-
-	oauth2.RespondTo(resp).TokenCustom(
-		&iam.OAuth2TokenResponse{
-			TokenResponse: oauth2.TokenResponse{
-				AccessToken:  accessToken,
-				TokenType:    oauth2.TokenTypeBearer,
-				ExpiresIn:    iam.AccessTokenTTLDefaultInSeconds,
-				RefreshToken: refreshToken,
-			},
-			UserID: userID.AZIDText(),
+			IDToken:        idToken,
 		})
 }
@@ -0,0 +1,99 @@
+//
+
+package oauth2
+
+import (
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// RFC 6749 § 6
+func (restSrv *Server) handleTokenRequestByRefreshTokenGrant(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		// RFC 6749 § 5.2
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	refreshToken := req.Request.FormValue("refresh_token")
+	if refreshToken == "" {
+		logReq(req.Request).
+			Warn().Msg("Empty refresh_token")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Msg("Authorization context must not be valid")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	termID, userID, accessToken, newRefreshToken, err := restSrv.serverCore.
+		ExchangeRefreshTokenJWT(reqCtx, reqApp.ID, refreshToken)
+	if err != nil {
+		if err == iam.ErrRefreshTokenAlreadyRotated {
+			logCtx(reqCtx).
+				Warn().Err(err).Str("client_id", reqApp.ID.AZIDText()).
+				Msg("Refresh token reuse detected; terminal revoked")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ExchangeRefreshTokenJWT")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ExchangeRefreshTokenJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	oauth2.RespondTo(resp).TokenCustom(
+		&iam.OAuth2TokenResponse{
+			TokenResponse: oauth2.TokenResponse{
+				AccessToken:  accessToken,
+				TokenType:    oauth2.TokenTypeBearer,
+				ExpiresIn:    iam.AccessTokenTTLDefaultInSeconds,
+				RefreshToken: newRefreshToken,
+			},
+			UserID:     userID.AZIDText(),
+			TerminalID: termID.AZIDText(),
+		})
+}
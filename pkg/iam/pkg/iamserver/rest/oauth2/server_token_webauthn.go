@@ -0,0 +1,181 @@
+//
+
+package oauth2
+
+import (
+	"encoding/json"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
+)
+
+// handleTokenRequestByWebAuthnGrant signs in the user with a passkey. The
+// request provides the credential, i.e., the JSON form of the
+// PublicKeyCredential returned by navigator.credentials.get for the
+// options obtained from the webauthn_assertion_options endpoint.
+func (restSrv *Server) handleTokenRequestByWebAuthnGrant(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if err != nil {
+		logReq(req.Request).
+			Warn().Err(err).
+			Msg("Client authentication")
+		// RFC 6749 § 5.2
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+	if reqApp == nil {
+		logReq(req.Request).
+			Warn().Msg("Application authentication is required")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorUnauthorizedClient)
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Msg("Authorization context must not be valid")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	credentialArgVal := req.Request.FormValue("credential")
+	if credentialArgVal == "" {
+		logCtx(reqCtx).
+			Warn().Msg("Missing credential")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+	var assertion webauthn.AssertionResponse
+	err = json.Unmarshal([]byte(credentialArgVal), &assertion)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Malformed credential")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorInvalidRequest)
+		return
+	}
+
+	termID, termSecret, userID, err := restSrv.serverCore.
+		AuthorizeTerminalByWebAuthnAssertion(reqCtx, reqApp, "",
+			req.Request.FormValue("scope"), &assertion)
+	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			respondRateLimitExceeded(resp, exceededErr)
+			return
+		}
+		if mfaErr, ok := err.(*iamserver.MFARequiredError); ok {
+			logCtx(reqCtx).
+				Info().Msg("Second factor required")
+			respondMFARequired(resp, mfaErr)
+			return
+		}
+		switch err {
+		case iam.ErrWebAuthnChallengeExpired:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			oauth2.RespondTo(resp).Error(oauth2.ErrorResponse{
+				Error:            oauth2.ErrorInvalidGrant,
+				ErrorDescription: "expired"})
+			return
+		case iam.ErrWebAuthnChallengeInvalid,
+			iam.ErrWebAuthnCredentialInvalid:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidGrant)
+			return
+		case iam.ErrScopeInvalid:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidScope)
+			return
+		case iamserver.ErrUserWebAuthnUnavailable:
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorUnsupportedGrantType)
+			return
+		}
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("AuthorizeTerminalByWebAuthnAssertion")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorInvalidRequest)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("AuthorizeTerminalByWebAuthnAssertion")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	accessToken, refreshToken, err := restSrv.serverCore.
+		GenerateTokenSetJWT(reqCtx, termID, userID, termSecret)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("GenerateTokenSetJWT")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	idToken, err := restSrv.generateTerminalIDToken(
+		reqCtx, termID, userID, accessToken)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("generateTerminalIDToken")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	oauth2.RespondTo(resp).TokenCustom(
+		&iam.OAuth2TokenResponse{
+			TokenResponse: oauth2.TokenResponse{
+				AccessToken:  accessToken,
+				TokenType:    oauth2.TokenTypeBearer,
+				ExpiresIn:    iam.AccessTokenTTLDefaultInSeconds,
+				RefreshToken: refreshToken,
+			},
+			UserID:         userID.AZIDText(),
+			TerminalID:     termID.AZIDText(),
+			TerminalSecret: termSecret,
+			IDToken:        idToken,
+		})
+}
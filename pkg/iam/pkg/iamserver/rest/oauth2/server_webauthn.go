@@ -0,0 +1,65 @@
+//
+
+package oauth2
+
+import (
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// postWebAuthnAssertionOptions starts a passkey sign-in. The options are
+// passed to navigator.credentials.get and the resulting credential is
+// exchanged for tokens with the webauthn grant.
+func (restSrv *Server) postWebAuthnAssertionOptions(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if reqApp == nil {
+		if err != nil {
+			logReq(req.Request).
+				Warn().Err(err).Msg("Client authentication")
+		} else {
+			logReq(req.Request).
+				Warn().Msg("No authorized client")
+		}
+		oauth2.RespondTo(resp).ErrInvalidClientBasicAuthorization(
+			restSrv.serverCore.RealmName(), "")
+		return
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	options, err := restSrv.serverCore.
+		StartWebAuthnAuthentication(reqCtx, reqApp)
+	if err != nil {
+		if err == iam.ErrOperationNotAllowed {
+			logCtx(reqCtx).
+				Warn().Str("client_id", reqApp.ID.AZIDText()).
+				Msg("Client is not allowed to use passkeys")
+			oauth2.RespondTo(resp).ErrorCode(
+				oauth2.ErrorUnauthorizedClient)
+			return
+		}
+		logCtx(reqCtx).
+			Error().Err(err).Str("client_id", reqApp.ID.AZIDText()).
+			Msg("StartWebAuthnAuthentication")
+		oauth2.RespondTo(resp).ErrorCode(
+			oauth2.ErrorServerError)
+		return
+	}
+
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("Pragma", "no-cache")
+	resp.WriteJson(options, restful.MIME_JSON)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/sec"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/rest/application"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/rest/oauth2"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/rest/terminal"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/rest/user"
@@ -48,6 +49,11 @@ func (serverCfg ServerConfig) APISpecServePath() string {
 
 type ServerV1Config struct {
 	ServePath string `env:"SERVE_PATH"`
+
+	// CanonicalBaseURL is the absolute URL of the version 1 of the API
+	// service as seen by the clients. It's used as the OpenID Connect
+	// issuer identifier.
+	CanonicalBaseURL string `env:"CANONICAL_BASE_URL"`
 }
 
 type Server struct {
@@ -192,9 +198,10 @@ func GenerateOpenAPISpec(
 
 func initRESTV1Services(
 	servePath string,
+	canonicalBaseURL string,
 	container *restful.Container,
 	iamServerCore *iamserver.Core,
-	signInURL string,
+	webUIURLs *iam.WebUIURLs,
 ) {
 	log.Info().Msg("Initializing terminal service...")
 	terminalSrv := terminal.NewServer(iamServerCore,
@@ -210,17 +217,30 @@ func initRESTV1Services(
 		})
 	container.Add(userSrv.RestfulWebService())
 
+	log.Info().Msg("Initializing application service...")
+	applicationSrv := application.NewServer(iamServerCore,
+		application.ServerConfig{
+			ServePath: servePath + "/applications",
+		})
+	container.Add(applicationSrv.RestfulWebService())
+
 	log.Info().Msg("Initializing OAuth 2.0 service...")
 	oauth2Srv, err := oauth2.NewServer(iamServerCore,
 		oauth2.ServerConfig{
 			ServePath: servePath + "/oauth2",
-			SignInURL: signInURL,
+			SignInURL: webUIURLs.SignIn,
+			IssuerURL: canonicalBaseURL,
+
+			DeviceVerificationURL: webUIURLs.DeviceVerification,
 		})
 	if err != nil {
 		log.Fatal().Err(err).
 			Msg("OAuth 2.0 service initialization")
 	}
 	container.Add(oauth2Srv.RestfulWebService())
+	if oidcWS := oauth2Srv.OpenIDConnectRestfulWebService(); oidcWS != nil {
+		container.Add(oidcWS)
+	}
 }
 
 func processSwaggerSpec(
@@ -297,15 +317,16 @@ func setUpRestfulContainer(
 	// We need CORS for our webclients
 	rest.SetUpCORSFilterByEnv(container, "CORS_", nil) //TODO: from config
 
-	var v1ServePath string
+	var v1ServePath, v1CanonicalBaseURL string
 	if config.V1 != nil {
 		v1ServePath = config.V1.ServePath
+		v1CanonicalBaseURL = config.V1.CanonicalBaseURL
 	}
 	if v1ServePath == "" {
 		v1ServePath = servePath + "/v1"
 	}
 
-	initRESTV1Services(v1ServePath, container, iamServerCore, webUIURLs.SignIn)
+	initRESTV1Services(v1ServePath, v1CanonicalBaseURL, container, iamServerCore, webUIURLs)
 
 	return container, nil
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/email"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
 )
@@ -363,6 +364,15 @@ func (restSrv *Server) handleTerminalRegisterByPhoneNumber(
 				},
 			})
 	if err = authStartOutCtx.Err; err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("StartTerminalAuthorizationByPhoneNumber")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
@@ -441,6 +451,15 @@ func (restSrv *Server) handleTerminalRegisterByEmailAddress(
 				},
 			})
 	if err = authStartOutCtx.Err; err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("StartTerminalAuthorizationByEmailAddress")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
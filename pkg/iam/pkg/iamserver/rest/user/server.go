@@ -12,11 +12,13 @@ import (
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/logging"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam/rest/sec"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
 )
 
 var (
 	log    = logging.NewPkgLogger()
 	logCtx = log.WithContext
+	logReq = log.WithRequest
 )
 
 type ServerConfig struct {
@@ -44,6 +46,32 @@ func (restSrv *Server) RESTCallInputContext(req *http.Request) (*iam.RESTCallInp
 	return restSrv.serverCore.RESTCallInputContext(req)
 }
 
+// userRequestContext returns the context of a request which must be
+// made by a user. It responds to the request and returns false if it
+// isn't.
+func (restSrv *Server) userRequestContext(
+	req *restful.Request, resp *restful.Response,
+) (*iam.RESTCallInputContext, bool) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return nil, false
+	}
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsNotStaticallyValid() || !ctxAuth.IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("Unauthorized")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return nil, false
+	}
+	return reqCtx, true
+}
+
 func (restSrv *Server) RestfulWebService() *restful.WebService {
 	restWS := new(restful.WebService)
 	restWS.
@@ -86,6 +114,283 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 		Returns(http.StatusConflict, "Request has duplicate value or contains invalid data", rest.ErrorResponse{}).
 		Returns(http.StatusNoContent, "Password set", nil))
 
+	restWS.Route(restWS.
+		GET("/me/username/availability").
+		To(restSrv.getUserUsernameAvailability).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Check whether a username could be used by the current user").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.QueryParameter("username", "The username to check").
+			Required(true)).
+		Returns(http.StatusBadRequest, "The username doesn't satisfy the username policy", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusOK, "OK", userUsernameAvailabilityResponse{}))
+
+	restWS.Route(restWS.
+		PUT("/me/username").
+		To(restSrv.putUserUsername).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Set or change the username of the current user").
+		Notes("The username could be used to sign in with the password. "+
+			"The previous username becomes available for the other users.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(userUsernamePutRequest{}).
+		Returns(http.StatusBadRequest, "The username doesn't satisfy the username policy", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusConflict, "The username has been taken", rest.ErrorResponse{}).
+		Returns(http.StatusNoContent, "Username set", nil))
+
+	restWS.Route(restWS.
+		POST("/password_reset").
+		To(restSrv.postUserPasswordReset).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Start a password reset").
+		Notes("Sends a password reset code to the email address or the "+
+			"phone number if it's a verified identifier of a user. The "+
+			"response is the same whether the identifier has been "+
+			"registered or not; the code and the returned token are "+
+			"required to set the new password.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Reads(userPasswordResetPostRequest{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", nil).
+		Returns(http.StatusTooManyRequests, "Too many password resets requested", nil).
+		Returns(http.StatusOK, "Password reset started", userPasswordResetPostResponse{}))
+
+	restWS.Route(restWS.
+		POST("/password_reset/confirmation").
+		To(restSrv.postUserPasswordResetConfirmation).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Set a new password with a password reset code").
+		Notes("All the user's terminals are revoked once the password "+
+			"has been set.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBasicOAuth2ClientCredentials.String()).
+			Required(true)).
+		Reads(userPasswordResetConfirmationPostRequest{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", nil).
+		Returns(http.StatusTooManyRequests, "Too many failed attempts", nil).
+		Returns(http.StatusNoContent, "Password set", nil))
+
+	restWS.Route(restWS.
+		POST("/me/totp").
+		To(restSrv.postUserTOTP).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Start the enrollment of a TOTP second factor").
+		Notes("Generates a new TOTP secret. The secret is not used until it "+
+			"has been confirmed with a code from the authenticator. Starting "+
+			"another enrollment replaces the pending one.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusConflict, "TOTP has been enabled", rest.ErrorResponse{}).
+		Returns(http.StatusNotImplemented, "TOTP is not configured on the server", nil).
+		Returns(http.StatusOK, "Enrollment started", userTOTPPostResponse{}))
+
+	restWS.Route(restWS.
+		POST("/me/totp/confirmation").
+		To(restSrv.postUserTOTPConfirmation).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Confirm the TOTP enrollment").
+		Notes("Enables the pending TOTP secret. The response contains the "+
+			"one-time recovery codes; they are not retrievable later.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(userTOTPCodeRequest{}).
+		Returns(http.StatusBadRequest, "The code is not valid", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "There's no pending enrollment", nil).
+		Returns(http.StatusTooManyRequests, "Too many failed attempts", nil).
+		Returns(http.StatusOK, "TOTP enabled", userMFARecoveryCodesResponse{}))
+
+	restWS.Route(restWS.
+		DELETE("/me/totp").
+		To(restSrv.deleteUserTOTP).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Disable the TOTP second factor").
+		Notes("Requires a TOTP code or a recovery code. The recovery codes "+
+			"are disabled as well.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(userTOTPCodeRequest{}).
+		Returns(http.StatusBadRequest, "The code is not valid", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "TOTP is not enabled", nil).
+		Returns(http.StatusTooManyRequests, "Too many failed attempts", nil).
+		Returns(http.StatusNoContent, "TOTP disabled", nil))
+
+	restWS.Route(restWS.
+		POST("/me/totp/recovery_codes").
+		To(restSrv.postUserMFARecoveryCodes).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Regenerate the recovery codes").
+		Notes("Requires a TOTP code or one of the current recovery codes. "+
+			"The current recovery codes are replaced.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(userTOTPCodeRequest{}).
+		Returns(http.StatusBadRequest, "The code is not valid", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "TOTP is not enabled", nil).
+		Returns(http.StatusTooManyRequests, "Too many failed attempts", nil).
+		Returns(http.StatusOK, "Recovery codes regenerated", userMFARecoveryCodesResponse{}))
+
+	restWS.Route(restWS.
+		POST("/me/passkeys/registration_options").
+		To(restSrv.postUserPasskeyRegistrationOptions).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Start the registration of a passkey").
+		Notes("The response is the publicKey options to be passed to "+
+			"navigator.credentials.create. The challenge in the options "+
+			"expires after the configured timeout.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusConflict, "The user has too many passkeys", rest.ErrorResponse{}).
+		Returns(http.StatusNotImplemented, "Passkeys are not configured on the server", nil).
+		Returns(http.StatusOK, "Registration started", webauthn.CredentialCreationOptions{}))
+
+	restWS.Route(restWS.
+		POST("/me/passkeys").
+		To(restSrv.postUserPasskey).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Finish the registration of a passkey").
+		Notes("The credential is the PublicKeyCredential returned by "+
+			"navigator.credentials.create, in its JSON form.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Reads(userPasskeyPostRequest{}).
+		Returns(http.StatusBadRequest, "The credential could not be verified", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusConflict, "The passkey has been registered", rest.ErrorResponse{}).
+		Returns(http.StatusNotImplemented, "Passkeys are not configured on the server", nil).
+		Returns(http.StatusOK, "Passkey registered", iam.UserPasskeyJSONV1{}))
+
+	restWS.Route(restWS.
+		GET("/me/passkeys").
+		To(restSrv.getUserPasskeys).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("List the passkeys of the current user").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusOK, "Success", iam.UserPasskeyListJSONV1{}))
+
+	restWS.Route(restWS.
+		PUT("/me/passkeys/{passkey-id}").
+		To(restSrv.putUserPasskey).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Rename a passkey").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("passkey-id", "The base64url-encoded credential ID of the passkey")).
+		Reads(userPasskeyPutRequest{}).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "The passkey is not found", nil).
+		Returns(http.StatusNoContent, "Passkey renamed", nil))
+
+	restWS.Route(restWS.
+		DELETE("/me/passkeys/{passkey-id}").
+		To(restSrv.deleteUserPasskey).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Remove a passkey").
+		Notes("The terminals which were signed in with the passkey are "+
+			"revoked as well.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("passkey-id", "The base64url-encoded credential ID of the passkey")).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "The passkey is not found", nil).
+		Returns(http.StatusNoContent, "Passkey removed", nil))
+
+	restWS.Route(restWS.
+		GET("/me/terminals").
+		To(restSrv.getUserTerminals).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("List the terminals the current user is signed in with").
+		Notes("The terminals are sorted by their last use, the most "+
+			"recently used ones first.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusOK, "Success", iam.UserTerminalListJSONV1{}))
+
+	restWS.Route(restWS.
+		DELETE("/me/terminals").
+		To(restSrv.deleteUserTerminals).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Revoke all the terminals of the current user except the current one").
+		Notes("This signs the user out from all the other devices.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusNoContent, "Terminals revoked", nil))
+
+	restWS.Route(restWS.
+		DELETE("/me/terminals/{terminal-id}").
+		To(restSrv.deleteUserTerminal).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Revoke a terminal of the current user").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("terminal-id",
+			"The ID of the terminal.").
+			Required(true)).
+		Returns(http.StatusBadRequest, "Request has missing data or contains invalid data", rest.ErrorResponse{}).
+		Returns(http.StatusUnauthorized, "Client authorization check failure", rest.ErrorResponse{}).
+		Returns(http.StatusNotFound, "The terminal is not found", nil).
+		Returns(http.StatusNoContent, "Terminal revoked", nil))
+
 	restWS.Route(restWS.
 		PUT("/{user-id}/email_address").
 		To(restSrv.putUserEmailAddress).
@@ -180,6 +485,37 @@ func (restSrv *Server) RestfulWebService() *restful.WebService {
 		Returns(http.StatusNotAcceptable, "The target resource does not have a current representation that would be acceptable.", nil).
 		Returns(http.StatusOK, "Profile image updated", userProfileImagePutResponse{}))
 
+	restWS.Route(restWS.
+		GET("/me/granted_applications").
+		To(restSrv.getUserGrantedApplications).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("List the applications the current user has authorized").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Returns(http.StatusOK, "OK", iam.UserGrantedApplicationListJSONV1{}))
+
+	restWS.Route(restWS.
+		DELETE("/me/granted_applications/{application-id}").
+		To(restSrv.deleteUserGrantedApplication).
+		Metadata(restfulopenapi.KeyOpenAPITags, tags).
+		Doc("Revoke an application the current user has authorized").
+		Notes("All the user's terminals for the application will be revoked "+
+			"as well. The application will need to request the user's "+
+			"authorization again.").
+		Param(restWS.
+			HeaderParameter(
+				iam.AuthorizationMetadataKey,
+				sec.AuthorizationBearerAccessToken.String()).
+			Required(true)).
+		Param(restWS.PathParameter("application-id",
+			"The ID of the application.").
+			Required(true)).
+		Returns(http.StatusNotFound, "The user has not authorized the application", nil).
+		Returns(http.StatusNoContent, "Application revoked", nil))
+
 	restWS.Route(restWS.
 		GET("/me/openidconnect-userinfo").
 		To(restSrv.getUserOpenIDConnectUserInfo).
@@ -304,5 +640,17 @@ func (restSrv *Server) getUser(req *restful.Request, resp *restful.Response) {
 		restUserProfile.Data.EmailAddress = userEmailAddress.RawInput()
 	}
 
+	username, err := restSrv.serverCore.
+		GetUserKeyUsername(reqCtx, requestedUserID)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("User username fetch")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	restUserProfile.Data.Username = username
+
 	restSrv.eTagResponder.RespondGetJSON(req, resp, restUserProfile)
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 )
 
 func (restSrv *Server) putUserEmailAddress(
@@ -100,6 +101,15 @@ func (restSrv *Server) handleSetEmailAddress(
 		SetUserKeyEmailAddress(
 			reqCtx, ctxAuth.UserID(), emailAddress, verificationMethods)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("SetUserKeyEmailAddress")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
@@ -158,6 +168,15 @@ func (restSrv *Server) postUserEmailAddressVerificationConfirmation(
 		ConfirmUserEmailAddressVerification(
 			reqCtx, reqEntity.VerificationID, reqEntity.Code)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmUserEmailAddressVerification")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
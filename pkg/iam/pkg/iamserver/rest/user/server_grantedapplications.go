@@ -0,0 +1,130 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+func (restSrv *Server) getUserGrantedApplications(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsNotStaticallyValid() || !ctxAuth.IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("Unauthorized")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	consents, err := restSrv.serverCore.
+		ListUserOAuth2Consents(reqCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ListUserOAuth2Consents")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]iam.UserGrantedApplicationJSONV1, 0, len(consents))
+	for _, consentInfo := range consents {
+		item := iam.UserGrantedApplicationJSONV1{
+			ApplicationID: consentInfo.ApplicationID.AZIDText(),
+			Scope:         consentInfo.Scope,
+			GrantTime:     consentInfo.GrantTime.UTC().Format(time.RFC3339),
+		}
+		app, err := restSrv.serverCore.
+			ApplicationByID(consentInfo.ApplicationID)
+		if err != nil {
+			logCtx(reqCtx).
+				Error().Err(err).Str("client_id", consentInfo.ApplicationID.AZIDText()).
+				Msg("ApplicationByID")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusInternalServerError)
+			return
+		}
+		if app != nil {
+			item.DisplayName = app.Attributes.DisplayName
+		}
+		for _, s := range oauth2.ParseScope(consentInfo.Scope) {
+			if scopeDef := restSrv.serverCore.ScopeDefinition(s); scopeDef != nil &&
+				scopeDef.Description != "" {
+				item.ScopeDescriptions = append(item.ScopeDescriptions, scopeDef.Description)
+			}
+		}
+		items = append(items, item)
+	}
+
+	rest.RespondTo(resp).Success(
+		&iam.UserGrantedApplicationListJSONV1{
+			Items: items,
+		})
+}
+
+func (restSrv *Server) deleteUserGrantedApplication(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Request context")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	ctxAuth := reqCtx.Authorization()
+	if ctxAuth.IsNotStaticallyValid() || !ctxAuth.IsUserSubject() {
+		logCtx(reqCtx).
+			Warn().Msg("Unauthorized")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	}
+
+	appIDArgVal := req.PathParameter("application-id")
+	appID, err := iam.ApplicationIDFromAZIDText(appIDArgVal)
+	if err != nil || appID.IsNotStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("path.application-id", appIDArgVal).
+			Msg("Malformed")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	stateChanged, err := restSrv.serverCore.
+		RevokeUserOAuth2Consent(reqCtx, appID)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).Str("application_id", appID.AZIDText()).
+			Msg("RevokeUserOAuth2Consent")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	if !stateChanged {
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
@@ -78,6 +78,16 @@ func (restSrv *Server) getUserOpenIDConnectUserInfo(
 		emailAddressVerified = true
 	}
 
+	username, err := restSrv.serverCore.
+		GetUserKeyUsername(reqCtx, requestedUserID)
+	if err != nil {
+		logCtx(reqCtx).
+			Err(err).Msg("User username fetch")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
 	userInfo := oidc.StandardClaims{
 		Sub:                 requestedUserID.AZIDText(),
 		Name:                userBaseProfile.DisplayName,
@@ -85,6 +95,7 @@ func (restSrv *Server) getUserOpenIDConnectUserInfo(
 		EmailVerified:       emailAddressVerified,
 		PhoneNumber:         phoneNumberStr,
 		PhoneNumberVerified: phoneNumberVerified,
+		PreferredUsername:   username,
 	}
 
 	restSrv.eTagResponder.RespondGetJSON(req, resp, &userInfo)
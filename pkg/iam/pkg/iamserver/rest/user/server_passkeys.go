@@ -0,0 +1,278 @@
+package user
+
+import (
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
+)
+
+type userPasskeyPostRequest struct {
+	DisplayName string `json:"display_name"`
+	// The PublicKeyCredential returned by navigator.credentials.create,
+	// in its JSON form.
+	Credential *webauthn.RegistrationResponse `json:"credential"`
+}
+
+type userPasskeyPutRequest struct {
+	DisplayName string `json:"display_name"`
+}
+
+func (restSrv *Server) postUserPasskeyRegistrationOptions(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	options, err := restSrv.serverCore.
+		StartUserWebAuthnRegistration(reqCtx, reqCtx.Authorization().UserID())
+	if err != nil {
+		respondUserPasskeyError(reqCtx, resp, "StartUserWebAuthnRegistration", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(options)
+}
+
+func (restSrv *Server) postUserPasskey(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	var reqBody userPasskeyPostRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+	if reqBody.Credential == nil {
+		logCtx(reqCtx).
+			Warn().Msg("Credential missing")
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "credential",
+				Code:  "empty",
+			}},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	credInfo, err := restSrv.serverCore.
+		FinishUserWebAuthnRegistration(reqCtx, reqCtx.Authorization().UserID(),
+			reqBody.DisplayName, reqBody.Credential)
+	if err != nil {
+		respondUserPasskeyError(reqCtx, resp, "FinishUserWebAuthnRegistration", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(userPasskeyJSONV1(*credInfo))
+}
+
+func (restSrv *Server) getUserPasskeys(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	creds, err := restSrv.serverCore.
+		ListUserWebAuthnCredentials(reqCtx, reqCtx.Authorization().UserID())
+	if err != nil {
+		respondUserPasskeyError(reqCtx, resp, "ListUserWebAuthnCredentials", err)
+		return
+	}
+
+	items := make([]iam.UserPasskeyJSONV1, 0, len(creds))
+	for _, credInfo := range creds {
+		items = append(items, *userPasskeyJSONV1(credInfo))
+	}
+
+	rest.RespondTo(resp).Success(
+		&iam.UserPasskeyListJSONV1{
+			Items: items,
+		})
+}
+
+func (restSrv *Server) putUserPasskey(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+	credID, ok := readUserPasskeyIDPathParameter(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	var reqBody userPasskeyPutRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	err = restSrv.serverCore.
+		RenameUserWebAuthnCredential(reqCtx, reqCtx.Authorization().UserID(),
+			credID, reqBody.DisplayName)
+	if err != nil {
+		respondUserPasskeyError(reqCtx, resp, "RenameUserWebAuthnCredential", err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (restSrv *Server) deleteUserPasskey(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+	credID, ok := readUserPasskeyIDPathParameter(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	err := restSrv.serverCore.
+		DeleteUserWebAuthnCredential(reqCtx, reqCtx.Authorization().UserID(), credID)
+	if err != nil {
+		respondUserPasskeyError(reqCtx, resp, "DeleteUserWebAuthnCredential", err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func readUserPasskeyIDPathParameter(
+	reqCtx *iam.RESTCallInputContext,
+	req *restful.Request, resp *restful.Response,
+) ([]byte, bool) {
+	credIDArgVal := req.PathParameter("passkey-id")
+	credID, err := base64.RawURLEncoding.DecodeString(credIDArgVal)
+	if err != nil || len(credID) == 0 {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("path.passkey-id", credIDArgVal).
+			Msg("Malformed")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return nil, false
+	}
+	return credID, true
+}
+
+func userPasskeyJSONV1(credInfo iamserver.UserWebAuthnCredentialInfo) *iam.UserPasskeyJSONV1 {
+	item := &iam.UserPasskeyJSONV1{
+		ID:           base64.RawURLEncoding.EncodeToString(credInfo.ID),
+		DisplayName:  credInfo.DisplayName,
+		Synced:       credInfo.Synced,
+		CreationTime: credInfo.CreationTime.UTC().Format(time.RFC3339),
+	}
+	if credInfo.LastUseTime != nil {
+		item.LastUseTime = credInfo.LastUseTime.UTC().Format(time.RFC3339)
+	}
+	return item
+}
+
+func respondUserPasskeyError(
+	reqCtx *iam.RESTCallInputContext,
+	resp *restful.Response,
+	methodName string,
+	err error,
+) {
+	switch err {
+	case iam.ErrWebAuthnChallengeInvalid,
+		iam.ErrWebAuthnChallengeExpired,
+		iam.ErrWebAuthnCredentialInvalid:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "credential",
+				Code:  "invalid",
+				Description: "The credential could not be verified; " +
+					"start another registration",
+			}},
+		}, http.StatusBadRequest)
+		return
+	case iamserver.ErrUserWebAuthnCredentialConflict:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Code:        "passkey_already_registered",
+			Description: "The passkey has been registered",
+		}, http.StatusConflict)
+		return
+	case iamserver.ErrUserWebAuthnCredentialLimitReached:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Code:        "passkey_limit_reached",
+			Description: "Remove a passkey to register another one",
+		}, http.StatusConflict)
+		return
+	case iamserver.ErrUserWebAuthnCredentialNotFound:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	case iamserver.ErrUserWebAuthnUnavailable:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotImplemented)
+		return
+	case iam.ErrOperationNotAllowed:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusForbidden)
+		return
+	}
+
+	if errors.IsCallError(err) {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "display_name",
+				Code:  "invalid",
+			}},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	logCtx(reqCtx).
+		Error().Err(err).
+		Msg(methodName)
+	rest.RespondTo(resp).EmptyError(
+		http.StatusInternalServerError)
+}
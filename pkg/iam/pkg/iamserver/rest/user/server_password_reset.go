@@ -0,0 +1,222 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+)
+
+type userPasswordResetPostRequest struct {
+	// The email address or the phone number of the user.
+	Identifier string `json:"identifier"`
+}
+
+type userPasswordResetPostResponse struct {
+	// The token to be provided along with the code sent to the user.
+	ResetToken string `json:"reset_token"`
+	// The number of seconds the token is valid for.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type userPasswordResetConfirmationPostRequest struct {
+	ResetToken string `json:"reset_token"`
+	Code       string `json:"code"`
+	Password   string `json:"password"`
+}
+
+func (restSrv *Server) postUserPasswordReset(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqApp, reqCtx, ok := restSrv.userPasswordResetRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	var reqBody userPasswordResetPostRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	resetToken, expiry, err := restSrv.serverCore.
+		StartUserPasswordReset(reqCtx, reqApp, reqBody.Identifier)
+	if err != nil {
+		if errors.IsCallError(err) {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("StartUserPasswordReset")
+			rest.RespondTo(resp).Error(rest.ErrorResponse{
+				Fields: []rest.ErrorResponseField{{
+					Field:       "identifier",
+					Code:        "invalid",
+					Description: "Provide an email address or a phone number",
+				}},
+			}, http.StatusBadRequest)
+			return
+		}
+		respondUserPasswordResetError(reqCtx, resp, "StartUserPasswordReset", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(&userPasswordResetPostResponse{
+		ResetToken: resetToken,
+		ExpiresIn:  int64(expiry.Sub(reqCtx.CallInputMetadata().ReceiveTime) / time.Second),
+	})
+}
+
+func (restSrv *Server) postUserPasswordResetConfirmation(
+	req *restful.Request, resp *restful.Response,
+) {
+	_, reqCtx, ok := restSrv.userPasswordResetRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	var reqBody userPasswordResetConfirmationPostRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+	if reqBody.Code == "" {
+		logCtx(reqCtx).
+			Warn().Msg("Empty code")
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "code",
+				Code:  "empty",
+			}},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	err = restSrv.serverCore.
+		ConfirmUserPasswordReset(reqCtx, reqBody.ResetToken, reqBody.Code, reqBody.Password)
+	if err != nil {
+		var policyErr *iamserver.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			logCtx(reqCtx).
+				Warn().Err(err).Msg("ConfirmUserPasswordReset")
+			rest.RespondTo(resp).Error(
+				passwordPolicyErrorResponse(policyErr),
+				http.StatusBadRequest)
+			return
+		}
+		respondUserPasswordResetError(reqCtx, resp, "ConfirmUserPasswordReset", err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// userPasswordResetRequestContext authenticates the client. The requests
+// must not be made on behalf of a user.
+func (restSrv *Server) userPasswordResetRequestContext(
+	req *restful.Request, resp *restful.Response,
+) (*iam.Application, *iam.RESTCallInputContext, bool) {
+	reqApp, err := restSrv.serverCore.
+		RequestApplication(req.Request)
+	if err != nil {
+		logReq(req.Request).
+			Warn().Err(err).Msg("Client authentication")
+		realmName := restSrv.serverCore.RealmName()
+		if realmName == "" {
+			realmName = "Restricted"
+		}
+		resp.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realmName))
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	if reqApp == nil {
+		logReq(req.Request).
+			Warn().Msg("No authorized client")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
+	if err != nil && err != iam.ErrReqFieldAuthorizationTypeUnsupported {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg("Unable to read authorization")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if reqCtx.Authorization().IsStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Msg("Authorization context must not be valid")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	return reqApp, reqCtx, true
+}
+
+func respondUserPasswordResetError(
+	reqCtx *iam.RESTCallInputContext,
+	resp *restful.Response,
+	methodName string,
+	err error,
+) {
+	if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+		rest.RespondTo(resp).EmptyError(
+			http.StatusTooManyRequests)
+		return
+	}
+
+	switch err {
+	case iam.ErrUserPasswordResetCodeMismatch:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "code",
+				Code:  "mismatch",
+			}},
+		}, http.StatusBadRequest)
+		return
+	case iam.ErrUserPasswordResetTokenInvalid,
+		iam.ErrUserPasswordResetTokenExpired:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field:       "reset_token",
+				Code:        "invalid",
+				Description: "The reset has expired or it has been used; start another reset",
+			}},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	logCtx(reqCtx).
+		Error().Err(err).
+		Msg(methodName)
+	rest.RespondTo(resp).EmptyError(
+		http.StatusInternalServerError)
+}
@@ -1,10 +1,13 @@
 package user
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/emicklei/go-restful/v3"
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
 )
 
 type userPasswordPutRequest struct {
@@ -12,7 +15,6 @@ type userPasswordPutRequest struct {
 	OldPassword string `json:"old_password,omitempty"`
 }
 
-//TODO:SEC: harded
 func (restSrv *Server) putUserPassword(req *restful.Request, resp *restful.Response) {
 	reqCtx, err := restSrv.RESTCallInputContext(req.Request)
 	if err != nil {
@@ -42,36 +44,52 @@ func (restSrv *Server) putUserPassword(req *restful.Request, resp *restful.Respo
 		return
 	}
 
-	matched, err := restSrv.serverCore.
-		MatchUserPassword(ctxAuth.UserID(), reqBody.OldPassword)
+	// The old password is required only if the user has set a password
+	hasPassword, err := restSrv.serverCore.UserHasPassword(ctxAuth.UserID())
 	if err != nil {
 		logCtx(reqCtx).
-			Err(err).Msg("Passwords matching")
+			Err(err).Msg("UserHasPassword")
 		rest.RespondTo(resp).EmptyError(
 			http.StatusInternalServerError)
 		return
 	}
+	if hasPassword {
+		matched, err := restSrv.serverCore.
+			MatchUserPassword(ctxAuth.UserID(), reqBody.OldPassword)
+		if err != nil {
+			logCtx(reqCtx).
+				Err(err).Msg("Passwords matching")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusInternalServerError)
+			return
+		}
 
-	if !matched {
-		logCtx(reqCtx).
-			Warn().Msg("Passwords mismatch")
-		rest.RespondTo(resp).EmptyError(
-			http.StatusBadRequest)
-		return
-	}
-
-	password := reqBody.Password
-	if password == "" {
-		logCtx(reqCtx).
-			Warn().Msg("Password empty")
-		rest.RespondTo(resp).EmptyError(
-			http.StatusBadRequest)
-		return
+		if !matched {
+			logCtx(reqCtx).
+				Warn().Msg("Passwords mismatch")
+			rest.RespondTo(resp).Error(rest.ErrorResponse{
+				Fields: []rest.ErrorResponseField{{
+					Field:       "old_password",
+					Code:        "mismatch",
+					Description: "The old password doesn't match the current password",
+				}},
+			}, http.StatusBadRequest)
+			return
+		}
 	}
 
 	err = restSrv.serverCore.
-		SetUserPassword(reqCtx, ctxAuth.UserID(), password)
+		SetUserPassword(reqCtx, ctxAuth.UserID(), reqBody.Password)
 	if err != nil {
+		var policyErr *iamserver.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			logCtx(reqCtx).
+				Warn().Err(err).Msg("SetUserPassword")
+			rest.RespondTo(resp).Error(
+				passwordPolicyErrorResponse(policyErr),
+				http.StatusBadRequest)
+			return
+		}
 		logCtx(reqCtx).
 			Error().Err(err).
 			Msg("SetUserPassword")
@@ -82,3 +100,21 @@ func (restSrv *Server) putUserPassword(req *restful.Request, resp *restful.Respo
 
 	rest.RespondTo(resp).Success(nil)
 }
+
+func passwordPolicyErrorResponse(
+	policyErr *iamserver.PasswordPolicyError,
+) rest.ErrorResponse {
+	fields := make([]rest.ErrorResponseField, 0, len(policyErr.Violations))
+	for _, violation := range policyErr.Violations {
+		fields = append(fields, rest.ErrorResponseField{
+			Field:       "password",
+			Code:        violation.Code,
+			Description: violation.Description,
+		})
+	}
+	return rest.ErrorResponse{
+		Code:        "password_policy_violation",
+		Description: "The password doesn't satisfy the password policy",
+		Fields:      fields,
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
 	"github.com/kadisoka/kadisoka-framework/pkg/volib/pkg/telephony"
 )
 
@@ -74,6 +75,15 @@ func (restSrv *Server) putUserPhoneNumber(
 		SetUserKeyPhoneNumber(
 			reqCtx, ctxAuth.UserID(), phoneNumber, verificationMethods)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("SetUserKeyPhoneNumber")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
@@ -135,6 +145,15 @@ func (restSrv *Server) postUserPhoneNumberVerificationConfirmation(
 		ConfirmUserPhoneNumberVerification(
 			reqCtx, reqEntity.VerificationID, reqEntity.Code)
 	if err != nil {
+		if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+			logCtx(reqCtx).
+				Warn().Err(err).
+				Msg("ConfirmUserPhoneNumberVerification")
+			resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+			rest.RespondTo(resp).EmptyError(
+				http.StatusTooManyRequests)
+			return
+		}
 		if errors.IsCallError(err) {
 			logCtx(reqCtx).
 				Warn().Err(err).
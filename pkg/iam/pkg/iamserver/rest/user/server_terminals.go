@@ -0,0 +1,131 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+func (restSrv *Server) getUserTerminals(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	terminals, err := restSrv.serverCore.
+		ListUserTerminals(reqCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("ListUserTerminals")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]iam.UserTerminalJSONV1, 0, len(terminals))
+	for _, termInfo := range terminals {
+		appID := termInfo.TerminalID.Application()
+		item := iam.UserTerminalJSONV1{
+			TerminalID:            termInfo.TerminalID.AZIDText(),
+			DisplayName:           termInfo.DisplayName,
+			ApplicationID:         appID.AZIDText(),
+			VerificationType:      termInfo.VerificationType,
+			AcceptLanguage:        termInfo.AcceptLanguage,
+			CreationTime:          termInfo.CreationTime.UTC().Format(time.RFC3339),
+			CreationOriginAddress: termInfo.CreationOriginAddress,
+			CreationOriginEnv:     termInfo.CreationOriginEnv,
+			LastUseOriginAddress:  termInfo.LastUseOriginAddress,
+			LastUseOriginEnv:      termInfo.LastUseOriginEnv,
+			Current:               termInfo.Current,
+		}
+		if termInfo.LastUseTime != nil {
+			item.LastUseTime = termInfo.LastUseTime.UTC().Format(time.RFC3339)
+		}
+		app, err := restSrv.serverCore.
+			ApplicationByID(appID)
+		if err != nil {
+			logCtx(reqCtx).
+				Error().Err(err).Str("client_id", appID.AZIDText()).
+				Msg("ApplicationByID")
+			rest.RespondTo(resp).EmptyError(
+				http.StatusInternalServerError)
+			return
+		}
+		if app != nil {
+			item.ApplicationDisplayName = app.Attributes.DisplayName
+		}
+		items = append(items, item)
+	}
+
+	rest.RespondTo(resp).Success(
+		&iam.UserTerminalListJSONV1{
+			Items: items,
+		})
+}
+
+func (restSrv *Server) deleteUserTerminal(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	termIDArgVal := req.PathParameter("terminal-id")
+	termID, err := iam.TerminalIDFromAZIDText(termIDArgVal)
+	if err != nil || termID.IsNotStaticallyValid() {
+		logCtx(reqCtx).
+			Warn().Err(err).Str("path.terminal-id", termIDArgVal).
+			Msg("Malformed")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	stateChanged, err := restSrv.serverCore.
+		DeleteTerminal(reqCtx, termID)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).Str("terminal_id", termID.AZIDText()).
+			Msg("DeleteTerminal")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+	if !stateChanged {
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (restSrv *Server) deleteUserTerminals(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	err := restSrv.serverCore.
+		RevokeUserOtherTerminals(reqCtx)
+	if err != nil {
+		logCtx(reqCtx).
+			Error().Err(err).
+			Msg("RevokeUserOtherTerminals")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusInternalServerError)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
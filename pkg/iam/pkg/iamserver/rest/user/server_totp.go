@@ -0,0 +1,208 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/ratelimit"
+)
+
+type userTOTPPostResponse struct {
+	// The base32-encoded secret for the users who enter it manually.
+	Secret string `json:"secret"`
+	// The otpauth URI of the secret. Present it as a QR code.
+	KeyURI string `json:"key_uri"`
+}
+
+type userTOTPCodeRequest struct {
+	// A TOTP code, or, where allowed, a recovery code.
+	Code string `json:"code"`
+}
+
+type userMFARecoveryCodesResponse struct {
+	// The one-time recovery codes. They are only shown once.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (restSrv *Server) postUserTOTP(req *restful.Request, resp *restful.Response) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	enrollmentData, err := restSrv.serverCore.
+		StartUserTOTPEnrollment(reqCtx, reqCtx.Authorization().UserID())
+	if err != nil {
+		respondUserTOTPError(reqCtx, resp, "StartUserTOTPEnrollment", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(&userTOTPPostResponse{
+		Secret: enrollmentData.Secret,
+		KeyURI: enrollmentData.KeyURI,
+	})
+}
+
+func (restSrv *Server) postUserTOTPConfirmation(req *restful.Request, resp *restful.Response) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+	reqBody, ok := readUserTOTPCodeRequest(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := restSrv.serverCore.
+		ConfirmUserTOTPEnrollment(reqCtx, reqCtx.Authorization().UserID(), reqBody.Code)
+	if err != nil {
+		respondUserTOTPError(reqCtx, resp, "ConfirmUserTOTPEnrollment", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(&userMFARecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (restSrv *Server) deleteUserTOTP(req *restful.Request, resp *restful.Response) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+	reqBody, ok := readUserTOTPCodeRequest(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	err := restSrv.serverCore.
+		DisableUserTOTP(reqCtx, reqCtx.Authorization().UserID(), reqBody.Code)
+	if err != nil {
+		respondUserTOTPError(reqCtx, resp, "DisableUserTOTP", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(nil)
+}
+
+func (restSrv *Server) postUserMFARecoveryCodes(req *restful.Request, resp *restful.Response) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+	reqBody, ok := readUserTOTPCodeRequest(reqCtx, req, resp)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := restSrv.serverCore.
+		RegenerateUserMFARecoveryCodes(reqCtx, reqCtx.Authorization().UserID(), reqBody.Code)
+	if err != nil {
+		respondUserTOTPError(reqCtx, resp, "RegenerateUserMFARecoveryCodes", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(&userMFARecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func readUserTOTPCodeRequest(
+	reqCtx *iam.RESTCallInputContext,
+	req *restful.Request, resp *restful.Response,
+) (*userTOTPCodeRequest, bool) {
+	var reqBody userTOTPCodeRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if reqBody.Code == "" {
+		logCtx(reqCtx).
+			Warn().Msg("Empty code")
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field: "code",
+				Code:  "empty",
+			}},
+		}, http.StatusBadRequest)
+		return nil, false
+	}
+	return &reqBody, true
+}
+
+func respondUserTOTPError(
+	reqCtx *iam.RESTCallInputContext,
+	resp *restful.Response,
+	methodName string,
+	err error,
+) {
+	if exceededErr, ok := err.(*ratelimit.ExceededError); ok {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		resp.Header().Set("Retry-After", exceededErr.RetryAfterSeconds())
+		rest.RespondTo(resp).EmptyError(
+			http.StatusTooManyRequests)
+		return
+	}
+
+	switch err {
+	case iam.ErrMFACodeMismatch:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field:       "code",
+				Code:        "mismatch",
+				Description: "The code is not valid or it has been used",
+			}},
+		}, http.StatusBadRequest)
+		return
+	case iamserver.ErrUserTOTPAlreadyEnabled:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Code:        "totp_already_enabled",
+			Description: "Disable the current TOTP to enroll a new one",
+		}, http.StatusConflict)
+		return
+	case iamserver.ErrUserTOTPNotEnabled,
+		iamserver.ErrUserTOTPNotPending:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotFound)
+		return
+	case iamserver.ErrUserTOTPUnavailable:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusNotImplemented)
+		return
+	case iam.ErrOperationNotAllowed:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusForbidden)
+		return
+	}
+
+	logCtx(reqCtx).
+		Error().Err(err).
+		Msg(methodName)
+	rest.RespondTo(resp).EmptyError(
+		http.StatusInternalServerError)
+}
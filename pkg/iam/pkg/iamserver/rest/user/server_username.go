@@ -0,0 +1,134 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/emicklei/go-restful/v3"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/rest"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+type userUsernamePutRequest struct {
+	Username string `json:"username"`
+}
+
+type userUsernameAvailabilityResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+}
+
+func (restSrv *Server) getUserUsernameAvailability(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	username := req.QueryParameter("username")
+	available, err := restSrv.serverCore.
+		IsUsernameAvailable(reqCtx, username)
+	if err != nil {
+		respondUserUsernameError(reqCtx, resp, "IsUsernameAvailable", err)
+		return
+	}
+
+	rest.RespondTo(resp).Success(&userUsernameAvailabilityResponse{
+		Username:  username,
+		Available: available,
+	})
+}
+
+func (restSrv *Server) putUserUsername(
+	req *restful.Request, resp *restful.Response,
+) {
+	reqCtx, ok := restSrv.userRequestContext(req, resp)
+	if !ok {
+		return
+	}
+
+	var reqBody userUsernamePutRequest
+	err := req.ReadEntity(&reqBody)
+	if err != nil {
+		logCtx(reqCtx).
+			Warn().Err(err).Msg("Request entity")
+		rest.RespondTo(resp).EmptyError(
+			http.StatusBadRequest)
+		return
+	}
+
+	_, err = restSrv.serverCore.
+		SetUserKeyUsername(reqCtx, reqCtx.Authorization().UserID(), reqBody.Username)
+	if err != nil {
+		respondUserUsernameError(reqCtx, resp, "SetUserKeyUsername", err)
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func respondUserUsernameError(
+	reqCtx *iam.RESTCallInputContext,
+	resp *restful.Response,
+	methodName string,
+	err error,
+) {
+	var policyErr *iamserver.UsernamePolicyError
+	if errors.As(err, &policyErr) {
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		fields := make([]rest.ErrorResponseField, 0, len(policyErr.Violations))
+		for _, violation := range policyErr.Violations {
+			fields = append(fields, rest.ErrorResponseField{
+				Field:       "username",
+				Code:        violation.Code,
+				Description: violation.Description,
+			})
+		}
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Code:        "username_policy_violation",
+			Description: "The username doesn't satisfy the username policy",
+			Fields:      fields,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	switch err {
+	case iam.ErrUserKeyUsernameConflict:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).Error(rest.ErrorResponse{
+			Fields: []rest.ErrorResponseField{{
+				Field:       "username",
+				Code:        "conflict",
+				Description: "The username has been taken",
+			}},
+		}, http.StatusConflict)
+		return
+	case iam.ErrUserContextRequired:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusUnauthorized)
+		return
+	case iam.ErrOperationNotAllowed:
+		logCtx(reqCtx).
+			Warn().Err(err).
+			Msg(methodName)
+		rest.RespondTo(resp).EmptyError(
+			http.StatusForbidden)
+		return
+	}
+
+	logCtx(reqCtx).
+		Error().Err(err).
+		Msg(methodName)
+	rest.RespondTo(resp).EmptyError(
+		http.StatusInternalServerError)
+}
@@ -0,0 +1,98 @@
+package iamserver
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/alloyzeus/go-azfl/errors"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/app"
+)
+
+// secretCipherKeySize is the size of the keys in bytes. The secrets are
+// encrypted with AES-256-GCM.
+const secretCipherKeySize = 32
+
+// secretCipher encrypts the secrets which need to be stored in
+// a recoverable form, e.g., the TOTP secrets. Unlike the passwords, these
+// can't be stored as hashes because the server needs them to compute
+// the codes.
+type secretCipher struct {
+	aead cipher.AEAD
+}
+
+func newSecretCipher(key []byte) (*secretCipher, error) {
+	if len(key) != secretCipherKeySize {
+		return nil, errors.ArgMsg("key", "must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Arg("key", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretCipher{aead: aead}, nil
+}
+
+// loadSecretCipherFromSecretSource loads the key from the secret. The
+// key is encoded either in base64 or in hex, e.g., the output of
+// `openssl rand -base64 32`. It returns nil if the secret doesn't exist.
+func loadSecretCipherFromSecretSource(
+	secretSource app.SecretSource,
+	secretName string,
+) (*secretCipher, error) {
+	keyText, err := secretSource.GetSecret(secretName)
+	if err != nil {
+		if err == app.ErrSecretNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(secretName, err)
+	}
+	key, err := parseSecretCipherKey(keyText)
+	if err != nil {
+		return nil, errors.Wrap(secretName, err)
+	}
+	return newSecretCipher(key)
+}
+
+func parseSecretCipherKey(keyText []byte) ([]byte, error) {
+	keyText = bytes.TrimSpace(keyText)
+	if len(keyText) == hex.EncodedLen(secretCipherKeySize) {
+		if key, err := hex.DecodeString(string(keyText)); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(string(keyText))
+	if err != nil {
+		return nil, errors.Msg("key is neither hex- nor base64-encoded")
+	}
+	if len(key) != secretCipherKeySize {
+		return nil, errors.Msg("key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// seal encrypts the plaintext. The associatedData binds the ciphertext to
+// its owner, e.g., the user ID, so that it can't be moved to another
+// record.
+func (c *secretCipher) seal(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func (c *secretCipher) open(sealed, associatedData []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.ArgMsg("sealed", "too short")
+	}
+	return c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], associatedData)
+}
@@ -0,0 +1,56 @@
+package iamserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, secretCipherKeySize)
+	c, err := newSecretCipher(key)
+	assert.Nil(t, err)
+
+	sealed, err := c.seal([]byte("secret"), []byte("user-1"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	opened, err := c.open(sealed, []byte("user-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	// Bound to the owner
+	_, err = c.open(sealed, []byte("user-2"))
+	assert.NotNil(t, err)
+
+	// Tampered
+	sealed[len(sealed)-1] ^= 0x01
+	_, err = c.open(sealed, []byte("user-1"))
+	assert.NotNil(t, err)
+
+	_, err = c.open([]byte("short"), []byte("user-1"))
+	assert.NotNil(t, err)
+
+	_, err = newSecretCipher(key[:16])
+	assert.NotNil(t, err)
+}
+
+func TestParseSecretCipherKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, secretCipherKeySize)
+
+	parsed, err := parseSecretCipherKey([]byte(base64.StdEncoding.EncodeToString(key) + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, key, parsed)
+
+	parsed, err = parseSecretCipherKey([]byte(hex.EncodeToString(key)))
+	assert.Nil(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = parseSecretCipherKey([]byte(base64.StdEncoding.EncodeToString(key[:16])))
+	assert.NotNil(t, err)
+	_, err = parseSecretCipherKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
@@ -3,6 +3,7 @@ package iamserver
 import (
 	"time"
 
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/api/oauth2"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/eav10n"
 	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/pnv10n"
@@ -21,6 +22,25 @@ type TerminalRegistrationInputData struct {
 	VerificationType string
 	VerificationID   int64
 	VerificationTime *time.Time
+	// SecondFactorRequired defers the verification of the terminals
+	// which would otherwise be verified on registration, e.g., those
+	// authorized with a password, until the user has provided
+	// the second factor.
+	SecondFactorRequired bool
+
+	// OAuth2CodeChallenge and OAuth2CodeChallengeMethod are for
+	// terminals which are registered through the authorization code
+	// flow with PKCE. RFC 7636.
+	OAuth2CodeChallenge       string
+	OAuth2CodeChallengeMethod oauth2.CodeChallengeMethod
+
+	// OAuth2Scope is the scope granted to the terminal. It will be
+	// included in the access tokens issued for the terminal.
+	OAuth2Scope string
+	// OIDCNonce is for terminals which are registered through
+	// the authorization code flow. It's used to issue the ID Token
+	// when the code is exchanged.
+	OIDCNonce string
 }
 
 type TerminalRegistrationOutputData struct {
@@ -79,4 +99,24 @@ type terminalDBRawModel struct {
 	VerificationType string     `db:"verification_type"`
 	VerificationID   int64      `db:"verification_id"`
 	VerificationTime *time.Time `db:"verification_ts"`
+
+	OAuth2CodeChallenge       string `db:"oauth2_code_challenge"`
+	OAuth2CodeChallengeMethod string `db:"oauth2_code_challenge_method"`
+
+	OAuth2Scope string `db:"oauth2_scope"`
+	OIDCNonce   string `db:"oidc_nonce"`
+
+	LastUseTime          *time.Time `db:"last_use_ts"`
+	LastUseOriginAddress *string    `db:"last_use_origin_address"`
+	LastUseOriginEnv     *string    `db:"last_use_origin_env"`
+}
+
+// TerminalOAuth2AuthorizationData holds the parameters of the
+// authorization request which a terminal was registered for.
+type TerminalOAuth2AuthorizationData struct {
+	Scope     string
+	OIDCNonce string
+	// AuthorizationTime is the time the end-user granted
+	// the authorization.
+	AuthorizationTime time.Time
 }
@@ -0,0 +1,301 @@
+package iamserver
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+// TerminalConfig holds the configuration for the terminals' lifecycle.
+type TerminalConfig struct {
+	// IdleTimeoutDays is the number of days after which the terminals
+	// of the users which have not been used are revoked. The idle
+	// terminals are kept if it's zero.
+	IdleTimeoutDays int `env:"IDLE_TIMEOUT_DAYS"`
+	// ActivityFlushInterval is how often the terminals' last use is
+	// written to the database.
+	ActivityFlushInterval time.Duration `env:"ACTIVITY_FLUSH_INTERVAL"`
+}
+
+func (TerminalConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"IdleTimeoutDays": "Revoke the users' terminals which have not been " +
+			"used for this number of days. Disabled if it's 0, the default",
+		"ActivityFlushInterval": "How often the terminals' last use is " +
+			"written to the database. Defaults to 10s",
+	}
+}
+
+const (
+	terminalActivityFlushIntervalDefault = 10 * time.Second
+	// The recorder flushes before the interval once it has this many
+	// terminals pending.
+	terminalActivityBatchSizeMax = 500
+	// The activities are dropped, rather than blocking the token
+	// issuance, when this many are waiting to be batched.
+	terminalActivityQueueSize = 4096
+
+	terminalIdleSweepInterval = time.Hour
+	// The number of terminals revoked in one go by the idle sweeper.
+	terminalIdleSweepBatchSize = 1000
+)
+
+// terminalActivity is a use of a terminal, i.e., a token was issued
+// for the terminal.
+type terminalActivity struct {
+	TerminalIDNum iam.TerminalIDNum
+	Time          time.Time
+	OriginAddress string
+	OriginEnv     string
+}
+
+// terminalActivityRecorder collects the terminals' activities and passes
+// them in batches to the flush function. Only the latest activity of
+// each terminal is kept.
+type terminalActivityRecorder struct {
+	queue chan terminalActivity
+	flush func([]terminalActivity) error
+
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newTerminalActivityRecorder(
+	flushInterval time.Duration,
+	flush func([]terminalActivity) error,
+) *terminalActivityRecorder {
+	if flushInterval <= 0 {
+		flushInterval = terminalActivityFlushIntervalDefault
+	}
+	recorder := &terminalActivityRecorder{
+		queue:   make(chan terminalActivity, terminalActivityQueueSize),
+		flush:   flush,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go recorder.run(flushInterval)
+	return recorder
+}
+
+// record queues the activity. It doesn't block.
+func (recorder *terminalActivityRecorder) record(activity terminalActivity) {
+	select {
+	case recorder.queue <- activity:
+	default:
+		log.Warn().Int64("terminal_id", activity.TerminalIDNum.PrimitiveValue()).
+			Msg("Terminal activity queue is full; activity dropped")
+	}
+}
+
+// stop flushes the pending activities and stops the recorder. The activities
+// recorded after the recorder has been stopped are discarded.
+func (recorder *terminalActivityRecorder) stop() {
+	recorder.stopOnce.Do(func() {
+		close(recorder.done)
+	})
+	<-recorder.stopped
+}
+
+func (recorder *terminalActivityRecorder) run(flushInterval time.Duration) {
+	defer close(recorder.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	pending := map[iam.TerminalIDNum]terminalActivity{}
+	add := func(activity terminalActivity) {
+		if existing, ok := pending[activity.TerminalIDNum]; ok &&
+			existing.Time.After(activity.Time) {
+			return
+		}
+		pending[activity.TerminalIDNum] = activity
+	}
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		batch := make([]terminalActivity, 0, len(pending))
+		for _, activity := range pending {
+			batch = append(batch, activity)
+		}
+		pending = map[iam.TerminalIDNum]terminalActivity{}
+		if err := recorder.flush(batch); err != nil {
+			log.Error().Err(err).Int("count", len(batch)).
+				Msg("Terminal activity flush")
+		}
+	}
+
+	for {
+		select {
+		case <-recorder.done:
+			for {
+				select {
+				case activity := <-recorder.queue:
+					add(activity)
+				default:
+					flush()
+					return
+				}
+			}
+		case activity := <-recorder.queue:
+			add(activity)
+			if len(pending) >= terminalActivityBatchSizeMax {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// recordTerminalUse records that a token has been issued for
+// the terminal. The record is written asynchronously.
+func (core *Core) recordTerminalUse(
+	inputCtx iam.CallInputContext,
+	terminalID iam.TerminalID,
+	useTime time.Time,
+) {
+	if core.terminalActivityRecorder == nil {
+		return
+	}
+	originInfo := inputCtx.OriginInfo()
+	core.terminalActivityRecorder.record(terminalActivity{
+		TerminalIDNum: terminalID.IDNum(),
+		Time:          useTime,
+		OriginAddress: originInfo.Address,
+		OriginEnv:     originInfo.EnvironmentString,
+	})
+}
+
+// updateTerminalsLastUse writes the activities in a single statement.
+// The records which are older than the stored ones are ignored.
+func (core *Core) updateTerminalsLastUse(activities []terminalActivity) error {
+	terminalIDNums := make(pq.Int64Array, 0, len(activities))
+	useTimes := make(pq.StringArray, 0, len(activities))
+	originAddresses := make(pq.StringArray, 0, len(activities))
+	originEnvs := make(pq.StringArray, 0, len(activities))
+	for _, activity := range activities {
+		terminalIDNums = append(terminalIDNums, activity.TerminalIDNum.PrimitiveValue())
+		useTimes = append(useTimes, activity.Time.UTC().Format(time.RFC3339Nano))
+		originAddresses = append(originAddresses, activity.OriginAddress)
+		originEnvs = append(originEnvs, activity.OriginEnv)
+	}
+
+	_, err := core.db.Exec(
+		`UPDATE `+terminalDBTableName+` AS t SET `+
+			`last_use_ts = a.use_ts, `+
+			`last_use_origin_address = a.origin_address, `+
+			`last_use_origin_env = a.origin_env `+
+			`FROM unnest($1::bigint[], $2::timestamptz[], $3::text[], $4::text[]) `+
+			`AS a (id_num, use_ts, origin_address, origin_env) `+
+			`WHERE t.id_num = a.id_num AND `+
+			`(t.last_use_ts IS NULL OR t.last_use_ts < a.use_ts)`,
+		terminalIDNums, useTimes, originAddresses, originEnvs)
+	if err != nil {
+		return errors.Wrap("update", err)
+	}
+	return nil
+}
+
+// isTerminalIdleInsecure returns true if the idle timeout has been
+// configured and the user's terminal has not been used within it.
+func (core *Core) isTerminalIdleInsecure(
+	terminalIDNum iam.TerminalIDNum,
+	refTime time.Time,
+) (bool, error) {
+	if core.terminalIdleTimeout <= 0 {
+		return false, nil
+	}
+
+	var idle bool
+	err := core.db.
+		QueryRow(
+			`SELECT coalesce(last_use_ts, md_c_ts) < $1 `+
+				`FROM `+terminalDBTableName+` `+
+				`WHERE id_num = $2 AND user_id <> 0`,
+			refTime.Add(-core.terminalIdleTimeout),
+			terminalIDNum.PrimitiveValue()).
+		Scan(&idle)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return idle, nil
+}
+
+// startTerminalIdleSweeper starts a background process which revokes
+// the users' terminals which have been idle for longer than the idle
+// timeout. Call the returned function to stop the process.
+func (core *Core) startTerminalIdleSweeper(
+	interval time.Duration,
+) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				n, err := core.revokeIdleTerminals(
+					iam.NewEmptyCallInputContext(context.Background()))
+				if err != nil {
+					log.Error().Err(err).Msg("Idle terminals revocation")
+				} else if n > 0 {
+					log.Info().Int("count", n).Msg("Idle terminals revoked")
+				}
+			}
+		}
+	}()
+	return func() {
+		stopOnce.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// revokeIdleTerminals revokes the users' terminals which have been idle
+// for longer than the idle timeout.
+func (core *Core) revokeIdleTerminals(
+	inputCtx iam.CallInputContext,
+) (revokedCount int, err error) {
+	if core.terminalIdleTimeout <= 0 {
+		return 0, nil
+	}
+
+	idleSince := inputCtx.CallInputMetadata().ReceiveTime.
+		Add(-core.terminalIdleTimeout)
+
+	for {
+		var terminalIDNums []iam.TerminalIDNum
+		err = core.db.Select(&terminalIDNums,
+			`SELECT id_num FROM `+terminalDBTableName+` `+
+				`WHERE md_d_ts IS NULL AND user_id <> 0 AND `+
+				`coalesce(last_use_ts, md_c_ts) < $1 `+
+				`LIMIT $2`,
+			idleSince, terminalIdleSweepBatchSize)
+		if err != nil {
+			return revokedCount, errors.Wrap("select", err)
+		}
+		for _, terminalIDNum := range terminalIDNums {
+			if _, err = core.revokeTerminalInsecure(inputCtx, terminalIDNum); err != nil {
+				return revokedCount, errors.Wrap("revokeTerminalInsecure", err)
+			}
+			revokedCount++
+		}
+		if len(terminalIDNums) < terminalIdleSweepBatchSize {
+			return revokedCount, nil
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package iamserver
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iam"
+)
+
+func TestTerminalActivityRecorder(t *testing.T) {
+	var mu sync.Mutex
+	var flushed []terminalActivity
+	recorder := newTerminalActivityRecorder(time.Hour,
+		func(activities []terminalActivity) error {
+			mu.Lock()
+			flushed = append(flushed, activities...)
+			mu.Unlock()
+			return nil
+		})
+
+	refTime := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	recorder.record(terminalActivity{
+		TerminalIDNum: iam.TerminalIDNum(1),
+		Time:          refTime.Add(time.Minute),
+		OriginAddress: "192.0.2.1",
+	})
+	// Older than the one recorded before; it must not replace it.
+	recorder.record(terminalActivity{
+		TerminalIDNum: iam.TerminalIDNum(1),
+		Time:          refTime,
+		OriginAddress: "192.0.2.2",
+	})
+	recorder.record(terminalActivity{
+		TerminalIDNum: iam.TerminalIDNum(2),
+		Time:          refTime,
+		OriginAddress: "192.0.2.3",
+	})
+
+	// The interval is long; the activities are flushed on stop.
+	recorder.stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, flushed, 2) {
+		byTerminal := map[iam.TerminalIDNum]terminalActivity{}
+		for _, activity := range flushed {
+			byTerminal[activity.TerminalIDNum] = activity
+		}
+		assert.Equal(t, "192.0.2.1", byTerminal[1].OriginAddress)
+		assert.Equal(t, refTime.Add(time.Minute), byTerminal[1].Time)
+		assert.Equal(t, "192.0.2.3", byTerminal[2].OriginAddress)
+	}
+
+	// Stopping again must not block.
+	recorder.stop()
+}
@@ -0,0 +1,113 @@
+// Package totp implements time-based one-time passwords as specified in
+// RFC 6238, with the parameters supported by the common authenticator
+// applications: HMAC-SHA1, six digits and 30-second time steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretSize is the size of the generated secrets in bytes. RFC 4226
+	// recommends 160 bits.
+	SecretSize = 20
+
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Skew is the number of time steps before and after the current
+	// step of which codes are accepted to allow for clock drift.
+	Skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret generates a random secret.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret encodes the secret in base32, the format the users
+// type into authenticator applications.
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// TimeStep returns the time step t is in.
+func TimeStep(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the time step.
+func Code(secret []byte, timeStep int64) string {
+	return hotp(secret, uint64(timeStep), Digits)
+}
+
+// Validate checks the code against the codes of the time steps around
+// t. If the code is valid, it returns the time step the code is for so
+// that the caller could reject the codes which have been used.
+func Validate(secret []byte, code string, t time.Time) (timeStep int64, valid bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	currentStep := TimeStep(t)
+	for step := currentStep - Skew; step <= currentStep+Skew; step++ {
+		expected := Code(secret, step)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// KeyURI returns the otpauth URI of the secret. The URI is usually
+// presented as a QR code to be scanned by authenticator applications.
+//
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func KeyURI(issuer, accountName string, secret []byte) string {
+	label := url.PathEscape(accountName)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int64(Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// hotp implements RFC 4226 § 5.3.
+func hotp(secret []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA-1 test vectors of RFC 6238 Appendix B.
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	testCases := []struct {
+		unixTime int64
+		code     string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, testCase := range testCases {
+		step := TimeStep(time.Unix(testCase.unixTime, 0))
+		assert.Equal(t, testCase.code, hotp(secret, uint64(step), 8))
+		assert.Equal(t, testCase.code[2:], Code(secret, step))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret, SecretSize)
+
+	now := time.Unix(1600000000, 0)
+	code := Code(secret, TimeStep(now))
+
+	step, valid := Validate(secret, code, now)
+	assert.True(t, valid)
+	assert.Equal(t, TimeStep(now), step)
+
+	// Clock drift of a step either way is allowed
+	_, valid = Validate(secret, code, now.Add(Period))
+	assert.True(t, valid)
+	_, valid = Validate(secret, code, now.Add(-Period))
+	assert.True(t, valid)
+	_, valid = Validate(secret, code, now.Add(2*Period))
+	assert.False(t, valid)
+
+	_, valid = Validate(secret, " "+code+" ", now)
+	assert.True(t, valid)
+	_, valid = Validate(secret, code[:Digits-1], now)
+	assert.False(t, valid)
+	_, valid = Validate(secret, "", now)
+	assert.False(t, valid)
+}
+
+func TestKeyURI(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	uri := KeyURI("Example Co", "alice@example.com", secret)
+
+	parsed, err := url.Parse(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/Example Co:alice@example.com", parsed.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", parsed.Query().Get("secret"))
+	assert.Equal(t, "Example Co", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+	assert.Equal(t, "30", parsed.Query().Get("period"))
+}
@@ -0,0 +1,231 @@
+package iamserver
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alloyzeus/go-azfl/errors"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// UsernamePolicyConfig holds the specification of the usernames.
+type UsernamePolicyConfig struct {
+	MinLength int `env:"MIN_LENGTH"`
+	MaxLength int `env:"MAX_LENGTH"`
+
+	// AllowedSymbols are the characters allowed in a username besides
+	// letters and digits.
+	AllowedSymbols string `env:"ALLOWED_SYMBOLS"`
+	// AllowNonASCIILetters allows letters and digits other than those of
+	// ASCII, e.g., accented letters.
+	AllowNonASCIILetters bool `env:"ALLOW_NON_ASCII_LETTERS"`
+
+	// ReservedWords is a comma-separated list of the usernames which
+	// can't be used, in addition to the built-in ones.
+	ReservedWords string `env:"RESERVED_WORDS"`
+
+	// CaseSensitive makes the usernames which differ only in case
+	// distinct usernames.
+	CaseSensitive bool `env:"CASE_SENSITIVE"`
+}
+
+func (UsernamePolicyConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"MinLength": "The minimum number of characters of a username. Defaults to 3",
+		"MaxLength": "The maximum number of characters of a username. Defaults to 32",
+		"AllowedSymbols": "The characters allowed besides letters and digits. " +
+			"Defaults to ._-",
+		"AllowNonASCIILetters": "Allow the letters and digits other than those of ASCII",
+		"ReservedWords": "Comma-separated usernames which can't be used, " +
+			"in addition to the built-in ones, e.g., admin",
+		"CaseSensitive": "Distinguish the usernames which differ only in case",
+	}
+}
+
+const (
+	usernameMinLengthDefault      = 3
+	usernameMaxLengthDefault      = 32
+	usernameAllowedSymbolsDefault = "._-"
+
+	// These distinguish the other kinds of identifiers, e.g., email
+	// addresses, phone numbers and the identifiers with a scheme.
+	usernameDisallowedSymbols = "@:+"
+)
+
+// The usernames which are reserved regardless of the configuration.
+var usernameReservedWordsBuiltin = []string{
+	"admin", "administrator", "root", "system", "support", "help",
+	"security", "me", "self", "terminal", "user", "users", "iam",
+}
+
+// The codes of the username policy violations.
+const (
+	UsernamePolicyViolationTooShort              = "too_short"
+	UsernamePolicyViolationTooLong               = "too_long"
+	UsernamePolicyViolationInvalidCharacters     = "invalid_characters"
+	UsernamePolicyViolationInvalidFirstCharacter = "invalid_first_character"
+	UsernamePolicyViolationReserved              = "reserved"
+)
+
+type UsernamePolicyViolation struct {
+	Code        string
+	Description string
+}
+
+// UsernamePolicyError is returned when a username doesn't satisfy
+// the username policy.
+type UsernamePolicyError struct {
+	Violations []UsernamePolicyViolation
+}
+
+var _ error = &UsernamePolicyError{}
+
+func (e *UsernamePolicyError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		codes = append(codes, v.Code)
+	}
+	return "username policy violation: " + strings.Join(codes, ", ")
+}
+
+type usernamePolicy struct {
+	minLength            int
+	maxLength            int
+	allowedSymbols       string
+	allowNonASCIILetters bool
+	reservedWords        map[string]struct{}
+	caseSensitive        bool
+}
+
+func newUsernamePolicy(cfg UsernamePolicyConfig) (*usernamePolicy, error) {
+	policy := &usernamePolicy{
+		minLength:            cfg.MinLength,
+		maxLength:            cfg.MaxLength,
+		allowedSymbols:       cfg.AllowedSymbols,
+		allowNonASCIILetters: cfg.AllowNonASCIILetters,
+		caseSensitive:        cfg.CaseSensitive,
+	}
+	if policy.minLength <= 0 {
+		policy.minLength = usernameMinLengthDefault
+	}
+	if policy.maxLength <= 0 {
+		policy.maxLength = usernameMaxLengthDefault
+	}
+	if policy.maxLength < policy.minLength {
+		return nil, errors.ArgMsg("cfg.MaxLength", "less than MinLength")
+	}
+	if policy.allowedSymbols == "" {
+		policy.allowedSymbols = usernameAllowedSymbolsDefault
+	}
+	for _, r := range policy.allowedSymbols {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) ||
+			strings.ContainsRune(usernameDisallowedSymbols, r) {
+			return nil, errors.ArgMsg("cfg.AllowedSymbols",
+				"contains disallowed character "+strconv.QuoteRune(r))
+		}
+	}
+
+	policy.reservedWords = make(map[string]struct{})
+	reservedWords := append([]string{}, usernameReservedWordsBuiltin...)
+	reservedWords = append(reservedWords, strings.Split(cfg.ReservedWords, ",")...)
+	for _, word := range reservedWords {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		// Reserved regardless of case
+		policy.reservedWords[cases.Fold().String(norm.NFKC.String(word))] = struct{}{}
+	}
+
+	return policy, nil
+}
+
+// normalize returns the form of the username which is used to look up
+// and to compare usernames. It returns a *UsernamePolicyError if
+// the username violates the policy.
+func (policy *usernamePolicy) normalize(username string) (string, error) {
+	username = cleanUsername(username)
+
+	var violations []UsernamePolicyViolation
+
+	length := utf8.RuneCountInString(username)
+	if length < policy.minLength {
+		violations = append(violations, UsernamePolicyViolation{
+			Code: UsernamePolicyViolationTooShort,
+			Description: "The username must contain at least " +
+				strconv.Itoa(policy.minLength) + " characters",
+		})
+	}
+	if length > policy.maxLength {
+		// The other rules are not checked for overly long usernames
+		return "", &UsernamePolicyError{Violations: append(violations, UsernamePolicyViolation{
+			Code: UsernamePolicyViolationTooLong,
+			Description: "The username must not contain more than " +
+				strconv.Itoa(policy.maxLength) + " characters",
+		})}
+	}
+
+	for _, r := range username {
+		if !policy.isAllowedRune(r) {
+			violations = append(violations, UsernamePolicyViolation{
+				Code: UsernamePolicyViolationInvalidCharacters,
+				Description: "The username must contain only letters, digits " +
+					"and these characters: " + policy.allowedSymbols,
+			})
+			break
+		}
+	}
+
+	// A username which starts with a letter could not be mistaken for
+	// a phone number.
+	if r, _ := utf8.DecodeRuneInString(username); length > 0 &&
+		(!unicode.IsLetter(r) || !policy.isAllowedRune(r)) {
+		violations = append(violations, UsernamePolicyViolation{
+			Code:        UsernamePolicyViolationInvalidFirstCharacter,
+			Description: "The username must start with a letter",
+		})
+	}
+
+	folded := cases.Fold().String(username)
+	if _, reserved := policy.reservedWords[folded]; reserved {
+		violations = append(violations, UsernamePolicyViolation{
+			Code:        UsernamePolicyViolationReserved,
+			Description: "The username is reserved",
+		})
+	}
+
+	if len(violations) > 0 {
+		return "", &UsernamePolicyError{Violations: violations}
+	}
+	if policy.caseSensitive {
+		return username, nil
+	}
+	return folded, nil
+}
+
+// lookupKey returns the form of the username which is used to look up
+// the username of an existing user. Unlike normalize, the policy is not
+// checked so that the usernames set before the policy was changed could
+// still be used, e.g., to sign in.
+func (policy *usernamePolicy) lookupKey(username string) string {
+	username = cleanUsername(username)
+	if policy.caseSensitive {
+		return username
+	}
+	return cases.Fold().String(username)
+}
+
+// cleanUsername returns the username as it's stored and displayed.
+func cleanUsername(username string) string {
+	return norm.NFKC.String(strings.TrimSpace(username))
+}
+
+func (policy *usernamePolicy) isAllowedRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return r < utf8.RuneSelf || policy.allowNonASCIILetters
+	}
+	return strings.ContainsRune(policy.allowedSymbols, r)
+}
@@ -0,0 +1,94 @@
+package iamserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func usernamePolicyViolationCodes(err error) []string {
+	policyErr, ok := err.(*UsernamePolicyError)
+	if !ok {
+		return nil
+	}
+	var codes []string
+	for _, v := range policyErr.Violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestUsernamePolicy(t *testing.T) {
+	policy, err := newUsernamePolicy(UsernamePolicyConfig{ReservedWords: "kadisoka, staff"})
+	assert.Nil(t, err)
+
+	username, err := policy.normalize(" Alice.Smith_1 ")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice.smith_1", username)
+
+	_, err = policy.normalize("al")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationTooShort},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("alice@example.com")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationInvalidCharacters},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("+6281234567")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationInvalidCharacters, UsernamePolicyViolationInvalidFirstCharacter},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("1alice")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationInvalidFirstCharacter},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("Admin")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationReserved},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("STAFF")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationReserved},
+		usernamePolicyViolationCodes(err))
+	_, err = policy.normalize("élise")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationInvalidCharacters, UsernamePolicyViolationInvalidFirstCharacter},
+		usernamePolicyViolationCodes(err))
+
+	_, err = newUsernamePolicy(UsernamePolicyConfig{AllowedSymbols: "._@"})
+	assert.NotNil(t, err)
+	_, err = newUsernamePolicy(UsernamePolicyConfig{MinLength: 10, MaxLength: 9})
+	assert.NotNil(t, err)
+}
+
+func TestUsernamePolicyCaseSensitiveNonASCII(t *testing.T) {
+	policy, err := newUsernamePolicy(UsernamePolicyConfig{
+		AllowNonASCIILetters: true,
+		CaseSensitive:        true,
+	})
+	assert.Nil(t, err)
+
+	username, err := policy.normalize("Élise")
+	assert.Nil(t, err)
+	assert.Equal(t, "Élise", username)
+	// Reserved regardless of case
+	_, err = policy.normalize("ROOT")
+	assert.Equal(t,
+		[]string{UsernamePolicyViolationReserved},
+		usernamePolicyViolationCodes(err))
+}
+
+func TestUsernamePolicyLookupKey(t *testing.T) {
+	policy, err := newUsernamePolicy(UsernamePolicyConfig{MinLength: 8})
+	assert.Nil(t, err)
+
+	// Usernames which were set before the policy was tightened are
+	// still looked up.
+	_, err = policy.normalize("Alice")
+	assert.NotNil(t, err)
+	assert.Equal(t, "alice", policy.lookupKey(" Alice "))
+
+	policy, err = newUsernamePolicy(UsernamePolicyConfig{CaseSensitive: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice", policy.lookupKey(" Alice "))
+}
@@ -0,0 +1,112 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+// The attestation statement formats which are verified. WebAuthn § 8.
+const (
+	AttestationFormatNone   = "none"
+	AttestationFormatPacked = "packed"
+)
+
+// id-fido-gen-ce-aaguid
+var oidFIDOGenCEAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyAttestationStatement verifies the statement of the known formats.
+// As the attestations are not used to decide whether an authenticator
+// is trusted, the statements of the other formats are accepted without
+// verification; they're treated as if they were none.
+func verifyAttestationStatement(
+	format string,
+	attStmt cborMap,
+	authData *authenticatorData,
+	rawAuthData []byte,
+	clientDataHash []byte,
+	credKey *publicKey,
+) error {
+	switch format {
+	case AttestationFormatNone:
+		if len(attStmt) != 0 {
+			return fmt.Errorf("%w: none with a statement", ErrAttestationInvalid)
+		}
+		return nil
+	case AttestationFormatPacked:
+		return verifyPackedAttestation(
+			attStmt, authData, rawAuthData, clientDataHash, credKey)
+	}
+	return nil
+}
+
+// WebAuthn § 8.2.1
+func verifyPackedAttestation(
+	attStmt cborMap,
+	authData *authenticatorData,
+	rawAuthData []byte,
+	clientDataHash []byte,
+	credKey *publicKey,
+) error {
+	algNum, ok := attStmt.int("alg")
+	if !ok {
+		return fmt.Errorf("%w: packed without alg", ErrAttestationInvalid)
+	}
+	alg := COSEAlgorithm(algNum)
+	sig, ok := attStmt.bytes("sig")
+	if !ok {
+		return fmt.Errorf("%w: packed without sig", ErrAttestationInvalid)
+	}
+
+	signedData := make([]byte, 0, len(rawAuthData)+len(clientDataHash))
+	signedData = append(signedData, rawAuthData...)
+	signedData = append(signedData, clientDataHash...)
+
+	x5c, hasX5C := attStmt["x5c"].([]interface{})
+	if !hasX5C {
+		// Self attestation
+		if alg != credKey.alg {
+			return fmt.Errorf("%w: self attestation algorithm mismatch", ErrAttestationInvalid)
+		}
+		if !credKey.verify(signedData, sig) {
+			return fmt.Errorf("%w: self attestation signature", ErrAttestationInvalid)
+		}
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return fmt.Errorf("%w: empty x5c", ErrAttestationInvalid)
+	}
+	certDER, ok := x5c[0].([]byte)
+	if !ok {
+		return fmt.Errorf("%w: x5c entry is not a byte string", ErrAttestationInvalid)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("%w: attestation certificate: %v", ErrAttestationInvalid, err)
+	}
+	// WebAuthn § 8.2.1: the requirements of the certificate
+	if cert.Version != 3 || (cert.BasicConstraintsValid && cert.IsCA) {
+		return fmt.Errorf("%w: attestation certificate requirements", ErrAttestationInvalid)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOGenCEAAGUID) {
+			continue
+		}
+		var aaguid []byte
+		if _, err := asn1.Unmarshal(ext.Value, &aaguid); err != nil ||
+			!bytes.Equal(aaguid, authData.aaguid) {
+			return fmt.Errorf("%w: attestation certificate AAGUID", ErrAttestationInvalid)
+		}
+	}
+
+	certKey, err := publicKeyFromCertificate(cert, alg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+	if !certKey.verify(signedData, sig) {
+		return fmt.Errorf("%w: attestation signature", ErrAttestationInvalid)
+	}
+	return nil
+}
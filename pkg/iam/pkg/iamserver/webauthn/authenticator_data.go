@@ -0,0 +1,102 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The flags of the authenticator data.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagBackupState            = 0x10
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+const (
+	authenticatorDataMinSize = 37
+	credentialIDMaxSize      = 1023
+)
+
+// authenticatorData is the parsed form of the authenticator data
+// structure. WebAuthn § 6.1.
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// Only if flagAttestedCredentialData is set
+	aaguid       []byte
+	credentialID []byte
+	// The COSE_Key as it was encoded by the authenticator
+	credentialPublicKey []byte
+}
+
+func (authData *authenticatorData) userPresent() bool {
+	return authData.flags&flagUserPresent != 0
+}
+
+func (authData *authenticatorData) userVerified() bool {
+	return authData.flags&flagUserVerified != 0
+}
+
+func (authData *authenticatorData) backupEligible() bool {
+	return authData.flags&flagBackupEligible != 0
+}
+
+func (authData *authenticatorData) backupState() bool {
+	return authData.flags&flagBackupState != 0
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authenticatorDataMinSize {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrMalformed)
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data is too short", ErrMalformed)
+		}
+		authData.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > credentialIDMaxSize || idLen > len(rest) {
+			return nil, fmt.Errorf("%w: credential ID length", ErrMalformed)
+		}
+		authData.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, afterKey, err := cborDecode(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrMalformed, err)
+		}
+		authData.credentialPublicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		v, afterExt, err := cborDecode(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrMalformed, err)
+		}
+		if _, ok := v.(cborMap); !ok {
+			return nil, fmt.Errorf("%w: extensions is not a map", ErrMalformed)
+		}
+		rest = afterExt
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrMalformed)
+	}
+
+	return authData, nil
+}
@@ -0,0 +1,181 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The decoder supports the subset of CBOR (RFC 8949) used by the
+// authenticators: integers, byte and text strings, arrays, maps,
+// tags, and the simple values. Indefinite lengths and floating-point
+// numbers are rejected as CTAP2 requires the canonical encoding.
+
+const cborMaxDepth = 16
+
+var errCBORMalformed = errors.New("cbor: malformed data")
+
+// cborMap is a decoded map. The keys are either int64 or string.
+type cborMap map[interface{}]interface{}
+
+// cborDecode decodes the first data item in data. It returns the bytes
+// which follow the item.
+func cborDecode(data []byte) (value interface{}, rest []byte, err error) {
+	return cborDecodeItem(data, 0)
+}
+
+func cborDecodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w: too deeply nested", errCBORMalformed)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+	}
+
+	majorType := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if majorType == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBORMalformed, info)
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		if len(data) < 1 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		arg, data = uint64(data[0]), data[1:]
+	case info == 25:
+		if len(data) < 2 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		arg, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26:
+		if len(data) < 4 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		arg, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27:
+		if len(data) < 8 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		arg, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported additional information %d", errCBORMalformed, info)
+	}
+
+	switch majorType {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBORMalformed)
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBORMalformed)
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		b := make([]byte, arg)
+		copy(b, data[:arg])
+		if majorType == 3 {
+			return string(b), data[arg:], nil
+		}
+		return b, data[arg:], nil
+	case 4:
+		// Every item takes at least a byte
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			var err error
+			item, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBORMalformed)
+		}
+		m := make(cborMap, arg)
+		for i := uint64(0); i < arg; i++ {
+			var k, v interface{}
+			var err error
+			k, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key type %T", errCBORMalformed, k)
+			}
+			if _, dup := m[k]; dup {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errCBORMalformed, k)
+			}
+			v, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, data, nil
+	case 6:
+		// The tags carry no meaning for us
+		return cborDecodeItem(data, depth+1)
+	}
+
+	return nil, nil, fmt.Errorf("%w: unsupported major type %d", errCBORMalformed, majorType)
+}
+
+// cborDecodeMap decodes data which must contain exactly one map.
+func cborDecodeMap(data []byte) (cborMap, error) {
+	v, rest, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", errCBORMalformed)
+	}
+	m, ok := v.(cborMap)
+	if !ok {
+		return nil, fmt.Errorf("%w: expecting a map, got %T", errCBORMalformed, v)
+	}
+	return m, nil
+}
+
+func (m cborMap) bytes(key interface{}) ([]byte, bool) {
+	b, ok := m[key].([]byte)
+	return b, ok
+}
+
+func (m cborMap) int(key interface{}) (int64, bool) {
+	i, ok := m[key].(int64)
+	return i, ok
+}
+
+func (m cborMap) text(key interface{}) (string, bool) {
+	s, ok := m[key].(string)
+	return s, ok
+}
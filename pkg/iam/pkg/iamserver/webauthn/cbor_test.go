@@ -0,0 +1,66 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Some of the examples of RFC 8949 Appendix A.
+func TestCBORDecode(t *testing.T) {
+	testCases := []struct {
+		hex   string
+		value interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"a201020304", cborMap{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", cborMap{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"c249010000000000000000", []byte{1, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, testCase := range testCases {
+		data, err := hex.DecodeString(testCase.hex)
+		assert.Nil(t, err)
+		value, rest, err := cborDecode(data)
+		assert.Nil(t, err, testCase.hex)
+		assert.Empty(t, rest, testCase.hex)
+		assert.Equal(t, testCase.value, value, testCase.hex)
+	}
+}
+
+func TestCBORDecodeRejected(t *testing.T) {
+	testCases := []string{
+		"",
+		"18",                 // truncated argument
+		"4401",               // truncated byte string
+		"5f42010243030405ff", // indefinite length
+		"f93c00",             // float
+		"1bffffffffffffffff", // overflows int64
+		"a201020103",         // duplicate key
+		"a1f401",             // boolean key
+		"9bffffffffffffffff", // huge array
+	}
+	for _, testCase := range testCases {
+		data, err := hex.DecodeString(testCase)
+		assert.Nil(t, err)
+		_, _, err = cborDecode(data)
+		assert.ErrorIs(t, err, errCBORMalformed, testCase)
+	}
+
+	_, err := cborDecodeMap([]byte{0xa0, 0x00})
+	assert.ErrorIs(t, err, errCBORMalformed)
+	_, err = cborDecodeMap([]byte{0x80})
+	assert.ErrorIs(t, err, errCBORMalformed)
+}
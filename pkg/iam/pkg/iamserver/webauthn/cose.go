@@ -0,0 +1,157 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+)
+
+// COSEAlgorithm identifies a signature algorithm as registered in
+// the IANA COSE Algorithms registry.
+type COSEAlgorithm int64
+
+// The supported algorithms, in the order of preference.
+const (
+	AlgES256 COSEAlgorithm = -7
+	AlgEdDSA COSEAlgorithm = -8
+	AlgRS256 COSEAlgorithm = -257
+)
+
+var supportedAlgorithms = []COSEAlgorithm{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE_Key labels and values. RFC 9053.
+const (
+	coseKeyLabelKty int64 = 1
+	coseKeyLabelAlg int64 = 3
+
+	coseKeyLabelCrv int64 = -1
+	coseKeyLabelX   int64 = -2
+	coseKeyLabelY   int64 = -3
+	coseKeyLabelN   int64 = -1
+	coseKeyLabelE   int64 = -2
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+)
+
+const rsaKeyMinBits = 2048
+
+// publicKey is a credential public key decoded from its COSE_Key form.
+type publicKey struct {
+	alg COSEAlgorithm
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key which must contain exactly one key.
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	m, err := cborDecodeMap(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyFromCOSEKeyMap(m)
+}
+
+func publicKeyFromCOSEKeyMap(m cborMap) (*publicKey, error) {
+	kty, ok := m.int(coseKeyLabelKty)
+	if !ok {
+		return nil, fmt.Errorf("%w: key type missing", ErrPublicKeyInvalid)
+	}
+	algNum, ok := m.int(coseKeyLabelAlg)
+	if !ok {
+		return nil, fmt.Errorf("%w: algorithm missing", ErrPublicKeyInvalid)
+	}
+	alg := COSEAlgorithm(algNum)
+
+	switch alg {
+	case AlgES256:
+		crv, _ := m.int(coseKeyLabelCrv)
+		x, _ := m.bytes(coseKeyLabelX)
+		y, _ := m.bytes(coseKeyLabelY)
+		if kty != coseKeyTypeEC2 || crv != coseCurveP256 ||
+			len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: not a P-256 key", ErrPublicKeyInvalid)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point is not on the curve", ErrPublicKeyInvalid)
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+
+	case AlgEdDSA:
+		crv, _ := m.int(coseKeyLabelCrv)
+		x, _ := m.bytes(coseKeyLabelX)
+		if kty != coseKeyTypeOKP || crv != coseCurveEd25519 ||
+			len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: not an Ed25519 key", ErrPublicKeyInvalid)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case AlgRS256:
+		n, _ := m.bytes(coseKeyLabelN)
+		e, _ := m.bytes(coseKeyLabelE)
+		if kty != coseKeyTypeRSA || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: not an RSA key", ErrPublicKeyInvalid)
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < rsaKeyMinBits || pub.E < 3 || pub.E%2 == 0 {
+			return nil, fmt.Errorf("%w: weak RSA key", ErrPublicKeyInvalid)
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+	}
+
+	return nil, fmt.Errorf("%w: algorithm %d", ErrAlgorithmUnsupported, alg)
+}
+
+// publicKeyFromCertificate returns the key of an attestation
+// certificate to verify the signatures made with alg.
+func publicKeyFromCertificate(cert *x509.Certificate, alg COSEAlgorithm) (*publicKey, error) {
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if alg == AlgES256 && key.Curve == elliptic.P256() {
+			return &publicKey{alg: alg, key: key}, nil
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA {
+			return &publicKey{alg: alg, key: key}, nil
+		}
+	case *rsa.PublicKey:
+		if alg == AlgRS256 {
+			return &publicKey{alg: alg, key: key}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: certificate key does not match algorithm %d",
+		ErrPublicKeyInvalid, alg)
+}
+
+// verify checks the signature of the message. For ES256, the signature
+// is in ASN.1 DER as the authenticators produce.
+func (pub *publicKey) verify(message, sig []byte) bool {
+	switch key := pub.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,571 @@
+// Package webauthn implements the relying party side of the Web
+// Authentication (WebAuthn) registration and authentication ceremonies,
+// i.e., passkeys, as specified in the W3C Web Authentication Level 2
+// recommendation.
+//
+// The attestation statements are verified only to the extent of
+// the signatures; the authenticators' certificate chains are not
+// evaluated. The credentials are requested without attestation.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The values of user verification requirement.
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+const (
+	// CredentialTypePublicKey is the only credential type defined.
+	CredentialTypePublicKey = "public-key"
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+
+	// ChallengeSize is the size of the generated challenges in bytes.
+	// WebAuthn § 13.4.3 requires at least 16.
+	ChallengeSize = 32
+
+	timeoutDefault = 5 * time.Minute
+)
+
+var (
+	ErrMalformed              = errors.New("webauthn: malformed data")
+	ErrPublicKeyInvalid       = errors.New("webauthn: public key invalid")
+	ErrAlgorithmUnsupported   = errors.New("webauthn: algorithm unsupported")
+	ErrCredentialTypeInvalid  = errors.New("webauthn: credential type invalid")
+	ErrCredentialIDMismatch   = errors.New("webauthn: credential ID mismatch")
+	ErrClientDataTypeMismatch = errors.New("webauthn: client data type mismatch")
+	ErrChallengeMismatch      = errors.New("webauthn: challenge mismatch")
+	ErrOriginNotAllowed       = errors.New("webauthn: origin not allowed")
+	ErrRPIDMismatch           = errors.New("webauthn: relying party ID mismatch")
+	ErrUserNotPresent         = errors.New("webauthn: user not present")
+	ErrUserNotVerified        = errors.New("webauthn: user not verified")
+	ErrAttestationInvalid     = errors.New("webauthn: attestation invalid")
+	ErrSignatureInvalid       = errors.New("webauthn: signature invalid")
+	// ErrSignCountInvalid is returned when the signature counter has not
+	// increased since the last assertion. It's a signal that
+	// the authenticator might have been cloned.
+	ErrSignCountInvalid = errors.New("webauthn: signature counter invalid")
+)
+
+// Base64URL is a byte string which is encoded in JSON as an unpadded
+// base64url string, the encoding of the binary fields in the JSON
+// forms of the WebAuthn structures.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts the padded form too as some clients produce it.
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	*b = decoded
+	return nil
+}
+
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Config holds the identity of the relying party.
+type Config struct {
+	// RPID is the relying party ID, i.e., the domain the credentials
+	// are scoped to, e.g., example.com. It must be equal to, or
+	// a registrable suffix of, the domains of the origins.
+	RPID string
+	// RPName is the name shown to the users by the authenticators.
+	RPName string
+	// Origins are the origins the ceremonies are allowed to be
+	// performed from, e.g., https://app.example.com. The origins
+	// of Android apps are in the form android:apk-key-hash:<hash>.
+	Origins []string
+	// UserVerification is one of required, preferred or discouraged.
+	// Defaults to preferred.
+	UserVerification string
+	// Timeout is the time the users are given to complete
+	// a ceremony. Defaults to five minutes.
+	Timeout time.Duration
+}
+
+// RelyingParty creates the options of the ceremonies and verifies
+// the responses of the authenticators.
+type RelyingParty struct {
+	id               string
+	name             string
+	idHash           [32]byte
+	origins          map[string]bool
+	userVerification string
+	timeout          time.Duration
+}
+
+func NewRelyingParty(cfg Config) (*RelyingParty, error) {
+	if cfg.RPID == "" {
+		return nil, errors.New("webauthn: RPID is required")
+	}
+	if len(cfg.Origins) == 0 {
+		return nil, errors.New("webauthn: at least one origin is required")
+	}
+	origins := map[string]bool{}
+	for _, origin := range cfg.Origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		origins[origin] = true
+	}
+
+	userVerification := cfg.UserVerification
+	switch userVerification {
+	case "":
+		userVerification = UserVerificationPreferred
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	default:
+		return nil, fmt.Errorf("webauthn: unsupported user verification %q", userVerification)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = timeoutDefault
+	}
+
+	name := cfg.RPName
+	if name == "" {
+		name = cfg.RPID
+	}
+
+	return &RelyingParty{
+		id:               cfg.RPID,
+		name:             name,
+		idHash:           sha256.Sum256([]byte(cfg.RPID)),
+		origins:          origins,
+		userVerification: userVerification,
+		timeout:          timeout,
+	}, nil
+}
+
+func (rp *RelyingParty) ID() string { return rp.id }
+
+// Timeout returns the time the users are given to complete a ceremony.
+// The challenges should expire after this.
+func (rp *RelyingParty) Timeout() time.Duration { return rp.timeout }
+
+// NewChallenge generates a random challenge for a ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+//region Options
+
+// CredentialCreationOptions is the JSON form of
+// PublicKeyCredentialCreationOptions which is passed to
+// navigator.credentials.create as the publicKey member.
+type CredentialCreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation,omitempty"`
+}
+
+// CredentialRequestOptions is the JSON form of
+// PublicKeyCredentialRequestOptions which is passed to
+// navigator.credentials.get as the publicKey member.
+type CredentialRequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity describes the user account a credential is created for.
+// The ID, i.e., the user handle, must not contain personally
+// identifying information.
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameters struct {
+	Type string        `json:"type"`
+	Alg  COSEAlgorithm `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey,omitempty"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions returns the options of a registration ceremony. The
+// credentials are created as discoverable credentials so that the users
+// could sign in without providing an identifier.
+func (rp *RelyingParty) CreationOptions(
+	challenge []byte,
+	user UserEntity,
+	excludeCredentials []CredentialDescriptor,
+) *CredentialCreationOptions {
+	params := make([]CredentialParameters, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, CredentialParameters{
+			Type: CredentialTypePublicKey, Alg: alg})
+	}
+	return &CredentialCreationOptions{
+		RP:                 RPEntity{ID: rp.id, Name: rp.name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.timeout.Milliseconds(),
+		ExcludeCredentials: excludeCredentials,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   rp.userVerification,
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options of an authentication ceremony.
+// Leave allowCredentials empty to let the user choose any of their
+// discoverable credentials.
+func (rp *RelyingParty) RequestOptions(
+	challenge []byte,
+	allowCredentials []CredentialDescriptor,
+) *CredentialRequestOptions {
+	return &CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: allowCredentials,
+		UserVerification: rp.userVerification,
+	}
+}
+
+//endregion
+
+//region Responses
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential
+// returned by navigator.credentials.create.
+type RegistrationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    Base64URL                        `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential
+// returned by navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string                         `json:"id"`
+	RawID    Base64URL                      `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// CredentialID returns the ID of the credential. The rawId is preferred;
+// the id is used for the clients which don't provide it.
+func (resp *RegistrationResponse) CredentialID() []byte {
+	return credentialIDOf(resp.ID, resp.RawID)
+}
+
+func (resp *AssertionResponse) CredentialID() []byte {
+	return credentialIDOf(resp.ID, resp.RawID)
+}
+
+func credentialIDOf(id string, rawID []byte) []byte {
+	if len(rawID) != 0 {
+		return rawID
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// ClientData is the parsed form of the clientDataJSON.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData parses the clientDataJSON of a response. It's used to
+// look up the ceremony the response is for by its challenge.
+func ParseClientData(clientDataJSON []byte) (*ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrMalformed, err)
+	}
+	return &clientData, nil
+}
+
+// ChallengeBytes returns the decoded challenge.
+func (clientData *ClientData) ChallengeBytes() ([]byte, error) {
+	challenge, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: challenge: %v", ErrMalformed, err)
+	}
+	return challenge, nil
+}
+
+//endregion
+
+// Credential is a registered credential. The fields must be stored as
+// they are required to verify the assertions.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the credential.
+	PublicKey []byte
+	Algorithm COSEAlgorithm
+	SignCount uint32
+
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	// BackupEligible is set for the credentials which could be synced
+	// among the user's devices, i.e., multi-device passkeys.
+	BackupEligible bool
+	BackupState    bool
+}
+
+// Assertion is the result of a successful verification of an
+// assertion.
+type Assertion struct {
+	// SignCount is the new value of the signature counter. It must be
+	// stored to detect cloned authenticators.
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+}
+
+// VerifyRegistration verifies the response of a registration ceremony
+// which has been started with challenge. WebAuthn § 7.1.
+func (rp *RelyingParty) VerifyRegistration(
+	challenge []byte,
+	resp *RegistrationResponse,
+) (*Credential, error) {
+	if resp == nil {
+		return nil, fmt.Errorf("%w: response missing", ErrMalformed)
+	}
+	if resp.Type != CredentialTypePublicKey {
+		return nil, ErrCredentialTypeInvalid
+	}
+
+	clientDataHash, err := rp.verifyClientData(
+		resp.Response.ClientDataJSON, clientDataTypeCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	attObj, err := cborDecodeMap(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrMalformed, err)
+	}
+	format, _ := attObj.text("fmt")
+	attStmt, _ := attObj["attStmt"].(cborMap)
+	rawAuthData, _ := attObj.bytes("authData")
+	if format == "" || attStmt == nil || rawAuthData == nil {
+		return nil, fmt.Errorf("%w: attestation object is incomplete", ErrMalformed)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: attested credential data missing", ErrMalformed)
+	}
+	if !bytes.Equal(authData.credentialID, resp.CredentialID()) {
+		return nil, ErrCredentialIDMismatch
+	}
+
+	credKey, err := parsePublicKey(authData.credentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyAttestationStatement(
+		format, attStmt, authData, rawAuthData, clientDataHash, credKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                append([]byte(nil), authData.credentialID...),
+		PublicKey:         append([]byte(nil), authData.credentialPublicKey...),
+		Algorithm:         credKey.alg,
+		SignCount:         authData.signCount,
+		AAGUID:            append([]byte(nil), authData.aaguid...),
+		Transports:        resp.Response.Transports,
+		AttestationFormat: format,
+		UserVerified:      authData.userVerified(),
+		BackupEligible:    authData.backupEligible(),
+		BackupState:       authData.backupState(),
+	}, nil
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony
+// which has been started with challenge. The credential is the stored
+// credential of which ID is the ID of the response. The caller is
+// responsible to check the user handle, if provided, against the owner
+// of the credential. WebAuthn § 7.2.
+func (rp *RelyingParty) VerifyAssertion(
+	challenge []byte,
+	resp *AssertionResponse,
+	cred *Credential,
+) (*Assertion, error) {
+	if resp == nil || cred == nil {
+		return nil, fmt.Errorf("%w: response or credential missing", ErrMalformed)
+	}
+	if resp.Type != CredentialTypePublicKey {
+		return nil, ErrCredentialTypeInvalid
+	}
+	if !bytes.Equal(resp.CredentialID(), cred.ID) {
+		return nil, ErrCredentialIDMismatch
+	}
+
+	clientDataHash, err := rp.verifyClientData(
+		resp.Response.ClientDataJSON, clientDataTypeGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAuthData := resp.Response.AuthenticatorData
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	credKey, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signedData := make([]byte, 0, len(rawAuthData)+len(clientDataHash))
+	signedData = append(signedData, rawAuthData...)
+	signedData = append(signedData, clientDataHash...)
+	if !credKey.verify(signedData, resp.Response.Signature) {
+		return nil, ErrSignatureInvalid
+	}
+
+	// Authenticators which don't implement the counter always report
+	// zero.
+	if (authData.signCount != 0 || cred.SignCount != 0) &&
+		authData.signCount <= cred.SignCount {
+		return nil, ErrSignCountInvalid
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.userVerified(),
+		BackupState:  authData.backupState(),
+	}, nil
+}
+
+// verifyClientData checks the client data and returns its hash.
+func (rp *RelyingParty) verifyClientData(
+	clientDataJSON []byte,
+	expectedType string,
+	expectedChallenge []byte,
+) (clientDataHash []byte, err error) {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if clientData.Type != expectedType {
+		return nil, ErrClientDataTypeMismatch
+	}
+	challenge, err := clientData.ChallengeBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(expectedChallenge) == 0 ||
+		subtle.ConstantTimeCompare(challenge, expectedChallenge) != 1 {
+		return nil, ErrChallengeMismatch
+	}
+	if !rp.origins[clientData.Origin] || clientData.CrossOrigin {
+		return nil, fmt.Errorf("%w: %q", ErrOriginNotAllowed, clientData.Origin)
+	}
+
+	sum := sha256.Sum256(clientDataJSON)
+	return sum[:], nil
+}
+
+// verifyAuthenticatorData parses the data and checks it against
+// the relying party's requirements.
+func (rp *RelyingParty) verifyAuthenticatorData(
+	rawAuthData []byte,
+) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rp.idHash[:]) != 1 {
+		return nil, ErrRPIDMismatch
+	}
+	if !authData.userPresent() {
+		return nil, ErrUserNotPresent
+	}
+	if rp.userVerification == UserVerificationRequired && !authData.userVerified() {
+		return nil, ErrUserNotVerified
+	}
+	return authData, nil
+}
@@ -0,0 +1,234 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn/webauthntest"
+)
+
+const testOrigin = "https://app.example.com"
+
+func testRelyingParty(t *testing.T, userVerification string) *RelyingParty {
+	rp, err := NewRelyingParty(Config{
+		RPID:             "example.com",
+		RPName:           "Example",
+		Origins:          []string{testOrigin},
+		UserVerification: userVerification,
+	})
+	assert.Nil(t, err)
+	return rp
+}
+
+func testRegister(
+	t *testing.T, rp *RelyingParty, authn *webauthntest.Authenticator,
+) (challenge []byte, resp *RegistrationResponse) {
+	challenge, err := NewChallenge()
+	assert.Nil(t, err)
+	opts := rp.CreationOptions(challenge, UserEntity{
+		ID: []byte("user-handle"), Name: "jane", DisplayName: "Jane"}, nil)
+	optsJSON, err := json.Marshal(opts)
+	assert.Nil(t, err)
+
+	respJSON, err := authn.Create(optsJSON, testOrigin)
+	assert.Nil(t, err)
+	resp = &RegistrationResponse{}
+	assert.Nil(t, json.Unmarshal(respJSON, resp))
+	return challenge, resp
+}
+
+func testAssert(
+	t *testing.T, rp *RelyingParty, authn *webauthntest.Authenticator, origin string,
+) (challenge []byte, resp *AssertionResponse) {
+	challenge, err := NewChallenge()
+	assert.Nil(t, err)
+	optsJSON, err := json.Marshal(rp.RequestOptions(challenge, nil))
+	assert.Nil(t, err)
+
+	respJSON, err := authn.Get(optsJSON, origin)
+	assert.Nil(t, err)
+	resp = &AssertionResponse{}
+	assert.Nil(t, json.Unmarshal(respJSON, resp))
+	return challenge, resp
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := testRelyingParty(t, UserVerificationRequired)
+	authn := webauthntest.NewAuthenticator()
+	authn.Synced = true
+
+	challenge, regResp := testRegister(t, rp, authn)
+	cred, err := rp.VerifyRegistration(challenge, regResp)
+	assert.Nil(t, err)
+	if !assert.NotNil(t, cred) {
+		return
+	}
+	assert.Equal(t, regResp.CredentialID(), cred.ID)
+	assert.Equal(t, AlgES256, cred.Algorithm)
+	assert.Equal(t, uint32(0), cred.SignCount)
+	assert.Equal(t, AttestationFormatNone, cred.AttestationFormat)
+	assert.Equal(t, []string{"internal"}, cred.Transports)
+	assert.True(t, cred.UserVerified)
+	assert.True(t, cred.BackupEligible)
+
+	// The same challenge must not be usable with other ceremonies
+	_, err = rp.VerifyRegistration([]byte("another challenge"), regResp)
+	assert.ErrorIs(t, err, ErrChallengeMismatch)
+
+	challenge, assertResp := testAssert(t, rp, authn, testOrigin)
+	assert.Equal(t, []byte("user-handle"), []byte(assertResp.Response.UserHandle))
+	assertion, err := rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.Nil(t, err)
+	if !assert.NotNil(t, assertion) {
+		return
+	}
+	assert.Equal(t, uint32(1), assertion.SignCount)
+	assert.True(t, assertion.UserVerified)
+	cred.SignCount = assertion.SignCount
+
+	// Replaying the assertion is rejected by the counter even if
+	// the challenge was somehow reused
+	_, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.ErrorIs(t, err, ErrSignCountInvalid)
+
+	challenge, assertResp = testAssert(t, rp, authn, testOrigin)
+	assertion, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), assertion.SignCount)
+}
+
+func TestRegistrationPackedSelfAttestation(t *testing.T) {
+	rp := testRelyingParty(t, "")
+	authn := webauthntest.NewAuthenticator()
+	authn.AttestationFormat = AttestationFormatPacked
+
+	challenge, regResp := testRegister(t, rp, authn)
+	cred, err := rp.VerifyRegistration(challenge, regResp)
+	assert.Nil(t, err)
+	if assert.NotNil(t, cred) {
+		assert.Equal(t, AttestationFormatPacked, cred.AttestationFormat)
+	}
+
+	// Tamper with the signed data
+	challenge, regResp = testRegister(t, rp, authn)
+	regResp.Response.ClientDataJSON = append(regResp.Response.ClientDataJSON[:len(regResp.Response.ClientDataJSON)-1], ' ', '}')
+	_, err = rp.VerifyRegistration(challenge, regResp)
+	assert.ErrorIs(t, err, ErrAttestationInvalid)
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	rp := testRelyingParty(t, UserVerificationRequired)
+
+	otherRP, err := NewRelyingParty(Config{
+		RPID: "example.org", Origins: []string{testOrigin}})
+	assert.Nil(t, err)
+	challenge, regResp := testRegister(t, otherRP, webauthntest.NewAuthenticator())
+	_, err = rp.VerifyRegistration(challenge, regResp)
+	assert.ErrorIs(t, err, ErrRPIDMismatch)
+
+	unverifiedAuthn := webauthntest.NewAuthenticator()
+	unverifiedAuthn.UserVerification = false
+	challenge, regResp = testRegister(t, rp, unverifiedAuthn)
+	_, err = rp.VerifyRegistration(challenge, regResp)
+	assert.ErrorIs(t, err, ErrUserNotVerified)
+	// It's accepted if the verification is only preferred
+	cred, err := testRelyingParty(t, UserVerificationPreferred).
+		VerifyRegistration(challenge, regResp)
+	assert.Nil(t, err)
+	if assert.NotNil(t, cred) {
+		assert.False(t, cred.UserVerified)
+	}
+
+	challenge, regResp = testRegister(t, rp, webauthntest.NewAuthenticator())
+	regResp.RawID = []byte("another credential")
+	_, err = rp.VerifyRegistration(challenge, regResp)
+	assert.ErrorIs(t, err, ErrCredentialIDMismatch)
+
+	challenge, regResp = testRegister(t, rp, webauthntest.NewAuthenticator())
+	regResp.Response.AttestationObject = regResp.Response.AttestationObject[:10]
+	_, err = rp.VerifyRegistration(challenge, regResp)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestAssertionRejected(t *testing.T) {
+	rp := testRelyingParty(t, "")
+	authn := webauthntest.NewAuthenticator()
+
+	challenge, regResp := testRegister(t, rp, authn)
+	cred, err := rp.VerifyRegistration(challenge, regResp)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// A registration response is not an assertion
+	_, err = rp.VerifyAssertion(challenge, &AssertionResponse{
+		RawID: regResp.RawID,
+		Type:  CredentialTypePublicKey,
+		Response: AuthenticatorAssertionResponse{
+			ClientDataJSON: regResp.Response.ClientDataJSON,
+		},
+	}, cred)
+	assert.ErrorIs(t, err, ErrClientDataTypeMismatch)
+
+	challenge, assertResp := testAssert(t, rp, authn, "https://evil.example.net")
+	_, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.ErrorIs(t, err, ErrOriginNotAllowed)
+
+	challenge, assertResp = testAssert(t, rp, authn, testOrigin)
+	assertResp.Response.Signature[len(assertResp.Response.Signature)-1] ^= 0xff
+	_, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+	// The flags are covered by the signature
+	challenge, assertResp = testAssert(t, rp, authn, testOrigin)
+	assertResp.Response.AuthenticatorData[32] &^= flagUserVerified
+	_, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+	otherCred := *cred
+	otherCred.ID = []byte("another credential")
+	challenge, assertResp = testAssert(t, rp, authn, testOrigin)
+	_, err = rp.VerifyAssertion(challenge, assertResp, &otherCred)
+	assert.ErrorIs(t, err, ErrCredentialIDMismatch)
+
+	// A cloned authenticator
+	cred.SignCount = 10
+	authn.SetSignCount(cred.ID, 5)
+	challenge, assertResp = testAssert(t, rp, authn, testOrigin)
+	_, err = rp.VerifyAssertion(challenge, assertResp, cred)
+	assert.ErrorIs(t, err, ErrSignCountInvalid)
+}
+
+func TestNewRelyingPartyConfig(t *testing.T) {
+	_, err := NewRelyingParty(Config{Origins: []string{testOrigin}})
+	assert.NotNil(t, err)
+	_, err = NewRelyingParty(Config{RPID: "example.com"})
+	assert.NotNil(t, err)
+	_, err = NewRelyingParty(Config{
+		RPID: "example.com", Origins: []string{testOrigin}, UserVerification: "always"})
+	assert.NotNil(t, err)
+
+	rp, err := NewRelyingParty(Config{
+		RPID: "example.com", Origins: []string{testOrigin + "/"}})
+	assert.Nil(t, err)
+	assert.Equal(t, timeoutDefault, rp.Timeout())
+	assert.True(t, rp.origins[testOrigin])
+	opts := rp.CreationOptions([]byte("challenge"), UserEntity{}, nil)
+	assert.Equal(t, "example.com", opts.RP.Name)
+	assert.Equal(t, UserVerificationPreferred, opts.AuthenticatorSelection.UserVerification)
+}
+
+func TestBase64URLJSON(t *testing.T) {
+	b, err := json.Marshal(Base64URL{0xfb, 0xff})
+	assert.Nil(t, err)
+	assert.Equal(t, `"-_8"`, string(b))
+
+	var decoded Base64URL
+	assert.Nil(t, json.Unmarshal([]byte(`"-_8"`), &decoded))
+	assert.Equal(t, Base64URL{0xfb, 0xff}, decoded)
+	assert.Nil(t, json.Unmarshal([]byte(`"-_8="`), &decoded))
+	assert.Equal(t, Base64URL{0xfb, 0xff}, decoded)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`"+/8="`), &decoded), ErrMalformed)
+}
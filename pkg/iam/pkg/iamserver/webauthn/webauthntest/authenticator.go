@@ -0,0 +1,325 @@
+// Package webauthntest provides a software authenticator to exercise
+// the WebAuthn ceremonies in tests. It takes the options as a relying
+// party sends them to the browser and produces the JSON the browser
+// would post back.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagBackupState            = 0x10
+	flagAttestedCredentialData = 0x40
+
+	algES256 = -7
+)
+
+var (
+	ErrAlgorithmUnsupported = errors.New("webauthntest: none of the algorithms is supported")
+	ErrCredentialExcluded   = errors.New("webauthntest: credential excluded")
+	ErrCredentialNotFound   = errors.New("webauthntest: no credential found")
+)
+
+// Authenticator is a software authenticator which creates ES256
+// credentials. It's safe for concurrent use.
+type Authenticator struct {
+	// AAGUID identifies the model of the authenticator.
+	AAGUID [16]byte
+	// UserVerification controls whether the authenticator reports that
+	// the user has been verified.
+	UserVerification bool
+	// AttestationFormat is either none, the default, or packed for
+	// self attestation.
+	AttestationFormat string
+	// Synced makes the credentials backup eligible and backed up, like
+	// the passkeys which are synced among the user's devices.
+	Synced bool
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator creates an authenticator which verifies the user.
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{UserVerification: true}
+}
+
+type creationOptions struct {
+	RP struct {
+		ID string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Challenge        string `json:"challenge"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	ExcludeCredentials []credentialDescriptor `json:"excludeCredentials"`
+}
+
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Create performs navigator.credentials.create with the
+// PublicKeyCredentialCreationOptions in JSON, as if it was called from
+// origin. It returns the JSON of the PublicKeyCredential.
+func (authn *Authenticator) Create(optionsJSON []byte, origin string) ([]byte, error) {
+	var opts creationOptions
+	if err := json.Unmarshal(optionsJSON, &opts); err != nil {
+		return nil, err
+	}
+
+	supported := false
+	for _, param := range opts.PubKeyCredParams {
+		if param.Type == "public-key" && param.Alg == algES256 {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, ErrAlgorithmUnsupported
+	}
+
+	authn.mu.Lock()
+	defer authn.mu.Unlock()
+
+	for _, desc := range opts.ExcludeCredentials {
+		if authn.findCredential(opts.RP.ID, desc.ID) != nil {
+			return nil, ErrCredentialExcluded
+		}
+	}
+
+	userHandle, err := decodeBase64URL(opts.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credID := make([]byte, 16)
+	if _, err = rand.Read(credID); err != nil {
+		return nil, err
+	}
+	cred := &credential{
+		id:         credID,
+		rpID:       opts.RP.ID,
+		userHandle: userHandle,
+		key:        key,
+	}
+
+	clientDataJSON, err := json.Marshal(map[string]interface{}{
+		"type":        "webauthn.create",
+		"challenge":   opts.Challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var attestedCredData bytes.Buffer
+	attestedCredData.Write(authn.AAGUID[:])
+	binary.Write(&attestedCredData, binary.BigEndian, uint16(len(credID)))
+	attestedCredData.Write(credID)
+	attestedCredData.Write(coseKeyES256(&key.PublicKey))
+
+	authData := authn.authenticatorData(cred, flagAttestedCredentialData)
+	authData = append(authData, attestedCredData.Bytes()...)
+
+	attStmt := cborMap{}
+	format := "none"
+	if authn.AttestationFormat == "packed" {
+		format = "packed"
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		sig, err := signES256(key, append(append([]byte(nil), authData...), clientDataHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+		attStmt = cborMap{{"alg", int64(algES256)}, {"sig", sig}}
+	}
+	attestationObject := cborEncode(cborMap{
+		{"fmt", format},
+		{"attStmt", attStmt},
+		{"authData", authData},
+	})
+
+	authn.credentials = append(authn.credentials, cred)
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encodeBase64URL(credID),
+		"rawId": encodeBase64URL(credID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encodeBase64URL(clientDataJSON),
+			"attestationObject": encodeBase64URL(attestationObject),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]interface{}{},
+	})
+}
+
+// Get performs navigator.credentials.get with the
+// PublicKeyCredentialRequestOptions in JSON, as if it was called from
+// origin. If the options don't list the allowed credentials, the most
+// recently created credential for the relying party is used. It
+// returns the JSON of the PublicKeyCredential.
+func (authn *Authenticator) Get(optionsJSON []byte, origin string) ([]byte, error) {
+	var opts requestOptions
+	if err := json.Unmarshal(optionsJSON, &opts); err != nil {
+		return nil, err
+	}
+
+	authn.mu.Lock()
+	defer authn.mu.Unlock()
+
+	var cred *credential
+	if len(opts.AllowCredentials) == 0 {
+		for i := len(authn.credentials) - 1; i >= 0; i-- {
+			if authn.credentials[i].rpID == opts.RPID {
+				cred = authn.credentials[i]
+				break
+			}
+		}
+	} else {
+		for _, desc := range opts.AllowCredentials {
+			if cred = authn.findCredential(opts.RPID, desc.ID); cred != nil {
+				break
+			}
+		}
+	}
+	if cred == nil {
+		return nil, ErrCredentialNotFound
+	}
+
+	clientDataJSON, err := json.Marshal(map[string]interface{}{
+		"type":        "webauthn.get",
+		"challenge":   opts.Challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cred.signCount++
+	authData := authn.authenticatorData(cred, 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	sig, err := signES256(cred.key, append(append([]byte(nil), authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encodeBase64URL(cred.id),
+		"rawId": encodeBase64URL(cred.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encodeBase64URL(clientDataJSON),
+			"authenticatorData": encodeBase64URL(authData),
+			"signature":         encodeBase64URL(sig),
+			"userHandle":        encodeBase64URL(cred.userHandle),
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]interface{}{},
+	})
+}
+
+// SetSignCount sets the signature counter of the credential, e.g., to
+// simulate a cloned authenticator.
+func (authn *Authenticator) SetSignCount(credentialID []byte, signCount uint32) {
+	authn.mu.Lock()
+	defer authn.mu.Unlock()
+	for _, cred := range authn.credentials {
+		if bytes.Equal(cred.id, credentialID) {
+			cred.signCount = signCount
+		}
+	}
+}
+
+func (authn *Authenticator) findCredential(rpID, encodedID string) *credential {
+	id, err := decodeBase64URL(encodedID)
+	if err != nil {
+		return nil
+	}
+	for _, cred := range authn.credentials {
+		if cred.rpID == rpID && bytes.Equal(cred.id, id) {
+			return cred
+		}
+	}
+	return nil
+}
+
+func (authn *Authenticator) authenticatorData(cred *credential, flags byte) []byte {
+	flags |= flagUserPresent
+	if authn.UserVerification {
+		flags |= flagUserVerified
+	}
+	if authn.Synced {
+		flags |= flagBackupEligible | flagBackupState
+	}
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	authData := make([]byte, 37)
+	copy(authData, rpIDHash[:])
+	authData[32] = flags
+	binary.BigEndian.PutUint32(authData[33:], cred.signCount)
+	return authData
+}
+
+func coseKeyES256(pub *ecdsa.PublicKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return cborEncode(cborMap{
+		{int64(1), int64(2)},        // kty: EC2
+		{int64(3), int64(algES256)}, // alg
+		{int64(-1), int64(1)},       // crv: P-256
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
+
+func signES256(key *ecdsa.PrivateKey, message []byte) ([]byte, error) {
+	digest := sha256.Sum256(message)
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
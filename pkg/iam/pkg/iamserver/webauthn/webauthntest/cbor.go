@@ -0,0 +1,65 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMap is a map which keeps the order of its entries so that
+// the encoding is deterministic.
+type cborMap []cborMapEntry
+
+type cborMapEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// cborEncode encodes the subset of CBOR the authenticators produce.
+func cborEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v >= 0 {
+			return cborHead(0, uint64(v))
+		}
+		return cborHead(1, uint64(-1-v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case cborMap:
+		out := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			out = append(out, cborEncode(entry.key)...)
+			out = append(out, cborEncode(entry.value)...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("webauthntest: unsupported CBOR type %T", v))
+}
+
+func cborHead(majorType byte, arg uint64) []byte {
+	majorType <<= 5
+	switch {
+	case arg < 24:
+		return []byte{majorType | byte(arg)}
+	case arg <= 0xff:
+		return []byte{majorType | 24, byte(arg)}
+	case arg <= 0xffff:
+		b := []byte{majorType | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+		return b
+	case arg <= 0xffffffff:
+		b := []byte{majorType | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+	b := []byte{majorType | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], arg)
+	return b
+}
@@ -0,0 +1,63 @@
+package iamserver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver/webauthn"
+)
+
+// WebAuthnConfig holds the relying party identity for the passkeys.
+// The passkeys are disabled if RPID is not set.
+type WebAuthnConfig struct {
+	RPID   string `env:"RP_ID"`
+	RPName string `env:"RP_NAME"`
+	// Origins is a comma-separated list of origins
+	Origins          string        `env:"ORIGINS"`
+	UserVerification string        `env:"USER_VERIFICATION"`
+	Timeout          time.Duration `env:"TIMEOUT"`
+}
+
+func (WebAuthnConfig) FieldDescriptions() map[string]string {
+	return map[string]string{
+		"RPID": "The domain the passkeys are scoped to, e.g., example.com. " +
+			"It must be the domain, or a parent domain, of the origins. The " +
+			"passkeys are disabled if it's not set",
+		"RPName": "The name shown by the authenticators. Defaults to the realm name",
+		"Origins": "Comma-separated origins of the apps allowed to use the " +
+			"passkeys, e.g., https://app.example.com. The Android apps are " +
+			"in the form android:apk-key-hash:<hash>",
+		"UserVerification": "Whether the authenticators must verify the users, " +
+			"e.g., with a biometric: required, preferred or discouraged. " +
+			"Defaults to preferred",
+		"Timeout": "The time the users are given to complete a ceremony. Defaults to 5m",
+	}
+}
+
+func newWebAuthnRelyingParty(
+	cfg WebAuthnConfig,
+	realmName string,
+) (*webauthn.RelyingParty, error) {
+	if cfg.RPID == "" {
+		return nil, nil
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(cfg.Origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	rpName := cfg.RPName
+	if rpName == "" {
+		rpName = realmName
+	}
+
+	return webauthn.NewRelyingParty(webauthn.Config{
+		RPID:             cfg.RPID,
+		RPName:           rpName,
+		Origins:          origins,
+		UserVerification: cfg.UserVerification,
+		Timeout:          cfg.Timeout,
+	})
+}
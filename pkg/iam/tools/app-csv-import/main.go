@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/iam/pkg/iamserver"
+)
+
+// This tool imports the applications defined in a clients.csv file into
+// the database. It's intended to be run once when migrating from
+// the CSV-based application registry.
+//
+//	app-csv-import -db-url postgresql://... /run/secrets/clients.csv
+func main() {
+	dbURL := flag.String("db-url", os.Getenv("IAM_DB_URL"),
+		"Connection string of the IAM database. Defaults to IAM_DB_URL.")
+	flag.Parse()
+
+	if *dbURL == "" || flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-db-url URL] <clients.csv>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	db, err := sqlx.Connect("postgres", *dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to the database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	importedIDs, err := iamserver.ImportApplicationsFromCSVFileByName(db, flag.Arg(0))
+	for _, appID := range importedIDs {
+		fmt.Fprintf(os.Stdout, "%s\n", appID.AZIDText())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -20,7 +20,14 @@ func main() {
 	}
 	clientID := GenerateApplicationID(params.FirstParty, params.AppType)
 	clientSecret := genSecret(16)
-	fmt.Fprintf(os.Stdout, "%s\n%s\n", clientID.AZIDText(), clientSecret)
+	clientSecretHash, err := iamserver.HashApplicationSecret(clientSecret)
+	if err != nil {
+		panic(err)
+	}
+	// The plain-text secret is to be handed to the application's
+	// developer. It won't be shown again. Only the hash is to be stored.
+	fmt.Fprintf(os.Stderr, "Secret (shown only once): %s\n", clientSecret)
+	fmt.Fprintf(os.Stdout, "%s\n%s\n", clientID.AZIDText(), clientSecretHash)
 }
 
 // GenerateApplicationID generates a new ApplicationID. Note that this function is
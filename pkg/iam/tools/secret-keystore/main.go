@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kadisoka/kadisoka-framework/pkg/foundation/pkg/app"
+)
+
+// This tool creates a keystore file for the keystore secret source from
+// the secret files. Each file is stored as a secret named by the base
+// name of the file. The passphrase is read from an environment variable
+// so that it doesn't end up in the shell history.
+//
+//	IAM_SECRETS_KEYSTORE_PASSPHRASE=... secret-keystore keystore.json jwt.key clients.csv
+func main() {
+	passphraseEnvVar := flag.String("passphrase-env", "IAM_SECRETS_KEYSTORE_PASSPHRASE",
+		"The environment variable which holds the passphrase.")
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-passphrase-env VAR] <keystore-file> <secret-file>...\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	passphrase := os.Getenv(*passphraseEnvVar)
+	if passphrase == "" {
+		fmt.Fprintf(os.Stderr, "The passphrase is empty. Set it in %s.\n", *passphraseEnvVar)
+		os.Exit(2)
+	}
+
+	secrets := map[string][]byte{}
+	for _, fileName := range flag.Args()[1:] {
+		secretBytes, err := os.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read %s: %v\n", fileName, err)
+			os.Exit(1)
+		}
+		secrets[filepath.Base(fileName)] = secretBytes
+	}
+
+	err := app.WriteKeystoreFile(flag.Arg(0), passphrase, secrets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write the keystore: %v\n", err)
+		os.Exit(1)
+	}
+}